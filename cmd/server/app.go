@@ -0,0 +1,112 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"cms-server/internal/auth"
+	"cms-server/internal/config"
+	"cms-server/internal/events"
+	"cms-server/internal/feed"
+	"cms-server/internal/handlers"
+	"cms-server/internal/health"
+	"cms-server/internal/metrics"
+	"cms-server/internal/middleware"
+	"cms-server/internal/notifications"
+	"cms-server/internal/ratelimit"
+	"cms-server/internal/realtime"
+	"cms-server/internal/store"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// sessionCacheTTL is how long a replica trusts the sessions it looked up,
+// and so how late it notices a revocation made by another replica
+const sessionCacheTTL = 10 * time.Second
+
+// app is the HTTP API with the services working behind it
+type app struct {
+	handler http.Handler
+	hub     *realtime.Hub
+	bus     *events.Bus
+}
+
+// newApp builds the API of cfg on top of s and adds the checks of its
+// services to checker. db is the database of the mongo store, nil with the
+// in-memory one. The caller closes the hub and the bus.
+func newApp(cfg *config.Config, logger *slog.Logger, s *store.Store, db *mongo.Database, checker *health.Checker) (*app, error) {
+	// Every authenticated request checks its session
+	s.Sessions = store.CachedSessions(s.Sessions, sessionCacheTTL)
+	feeds, err := feed.New(cfg.Feed, s)
+	if err != nil {
+		return nil, err
+	}
+
+	bootstrapAdmin(s, cfg.Auth.BootstrapAdmin)
+
+	// Keep feeds, notifications and live streams up to date from the events
+	// the handlers publish
+	hub := realtime.NewHub(s)
+	bus := events.NewBus(1024)
+	bus.Subscribe("feed", feed.Subscriber(feeds))
+	bus.Subscribe("notifications", notifications.NewService(s, hub.PushNotification).HandleEvent)
+	bus.Subscribe("realtime", hub.HandleEvent)
+	checker.Add("event_bus", bus.Check)
+	keys, err := auth.LoadKeys(cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count requests and failed logins where the limits are shared
+	limits := newLimitStore(cfg.RateLimit, db)
+	limiter := middleware.NewRateLimiter(limits, cfg.RateLimit)
+	logins := ratelimit.NewLockout(limits, cfg.RateLimit)
+
+	h := handlers.NewHandler(cfg, handlers.Deps{Store: s, Feed: feeds, Bus: bus, Hub: hub, Keys: keys, Logins: logins})
+
+	// Read access tokens from the configured sources
+	tokenSources, err := middleware.ParseTokenSources(cfg.Auth.TokenSources)
+	if err != nil {
+		return nil, err
+	}
+	authn := middleware.NewAuthenticator(keys, s.Sessions, tokenSources...)
+
+	// Resolve client addresses through the configured proxies
+	proxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a new Gorilla Mux router
+	r := mux.NewRouter()
+	r.NotFoundHandler = http.HandlerFunc(handlers.NotFoundHandler)
+	r.MethodNotAllowedHandler = http.HandlerFunc(handlers.MethodNotAllowedHandler)
+
+	// Probes of the orchestrator
+	r.HandleFunc("/healthz", checker.LiveHandler).Methods("GET")
+	r.HandleFunc("/readyz", checker.ReadyHandler).Methods("GET")
+
+	// Prometheus scrapes
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// Register public routes
+	registerPublicRoutes(r, h, authn, limiter)
+
+	// Register private routes
+	registerPrivateRoutes(r, h, authn, limiter)
+
+	// Every request is tagged with an ID reported in error documents and
+	// logs, resolved to its client address and route template, traced,
+	// logged, then counted and timed
+	var handler http.Handler = r
+	handler = middleware.Metrics(handler)
+	handler = middleware.NewRequestLogger(logger, cfg.Log).Middleware(handler)
+	handler = middleware.Tracing(handler)
+	handler = middleware.RouteTemplate(r, handler)
+	handler = middleware.ClientIP(proxies, handler)
+	handler = middleware.RequestID(handler)
+
+	return &app{handler: handler, hub: hub, bus: bus}, nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"cms-server/internal/config"
+	"cms-server/internal/health"
+	"cms-server/internal/logging"
+	"cms-server/internal/models"
+	"cms-server/internal/store"
+)
+
+// testServer serves the API over a fresh in-memory store
+type testServer struct {
+	t     *testing.T
+	url   string
+	store *store.Store
+}
+
+// testConfig is the configuration of test servers: the in-memory store and
+// no rate limits, so that tests can register as many users as they need
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Store.Backend = config.MemoryBackend
+	cfg.Auth.JWTSecret = "test-secret-of-at-least-32-bytes!"
+	cfg.RateLimit.Auth = config.Rate{}
+	cfg.RateLimit.Read = config.Rate{}
+	cfg.RateLimit.Write = config.Rate{}
+	cfg.Log.Level = "error"
+	return &cfg
+}
+
+// newTestServer starts the API with testConfig, changed by configure, and
+// stops it when the test ends
+func newTestServer(t *testing.T, configure ...func(*config.Config)) *testServer {
+	t.Helper()
+	cfg := testConfig()
+	for _, change := range configure {
+		change(cfg)
+	}
+
+	return startTestServer(t, cfg, io.Discard, store.NewMemoryStore(), health.NewChecker())
+}
+
+// startTestServer starts the API of cfg over s, logging to logs and adding
+// its checks to checker, and stops it when the test ends
+func startTestServer(t *testing.T, cfg *config.Config, logs io.Writer, s *store.Store, checker *health.Checker) *testServer {
+	t.Helper()
+	api, err := newApp(cfg, logging.New(logs, cfg.Log), s, nil, checker)
+	if err != nil {
+		t.Fatalf("newApp: %v", err)
+	}
+	server := httptest.NewServer(api.handler)
+	t.Cleanup(func() {
+		server.Close()
+		api.hub.Close()
+		api.bus.Close()
+	})
+	return &testServer{t: t, url: server.URL, store: s}
+}
+
+// testClient calls the API as one user, or anonymously without a token
+type testClient struct {
+	ts    *testServer
+	id    string
+	token string
+}
+
+// anonymous returns a client sending no token
+func (ts *testServer) anonymous() *testClient {
+	return &testClient{ts: ts}
+}
+
+// register signs username up with the user role and logs it in
+func (ts *testServer) register(username string) *testClient {
+	return ts.registerAs(username, models.RoleUser)
+}
+
+// registerAs signs username up, gives it role and logs it in
+func (ts *testServer) registerAs(username, role string) *testClient {
+	ts.t.Helper()
+	anonymous := ts.anonymous()
+	anonymous.do("POST", "/register", map[string]string{
+		"username": username,
+		"email":    username + "@example.com",
+		"password": testPassword,
+	}).expect(http.StatusOK)
+
+	ctx := context.Background()
+	user, err := ts.store.Users.GetUserByUsername(ctx, username)
+	if err != nil {
+		ts.t.Fatalf("registered user %q not found: %v", username, err)
+	}
+	if role != models.RoleUser {
+		if _, err := ts.store.Users.SetUserRole(ctx, user.ID, role); err != nil {
+			ts.t.Fatalf("SetUserRole: %v", err)
+		}
+	}
+
+	client := &testClient{ts: ts, id: user.ID.Hex()}
+	client.token = ts.login(username).AccessToken
+	return client
+}
+
+// testPassword is the password of every test user
+const testPassword = "Passw0rd!x"
+
+// tokenPair is the body of /login when it returns the tokens
+type tokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// login opens a new session of username
+func (ts *testServer) login(username string) tokenPair {
+	ts.t.Helper()
+	var tokens tokenPair
+	ts.anonymous().do("POST", "/login", map[string]interface{}{
+		"username":     username,
+		"password":     testPassword,
+		"return_token": true,
+	}).expect(http.StatusOK).decode(&tokens)
+	return tokens
+}
+
+// testResponse is a response read in full
+type testResponse struct {
+	t       *testing.T
+	request string
+	status  int
+	header  http.Header
+	body    []byte
+}
+
+// do sends a request with body encoded as JSON, unless it is a string sent
+// as is, and the access token of the client as a Bearer token
+func (c *testClient) do(method, path string, body interface{}, headers ...string) *testResponse {
+	c.ts.t.Helper()
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(body)
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			c.ts.t.Fatalf("encoding the body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.ts.url+path, reader)
+	if err != nil {
+		c.ts.t.Fatalf("NewRequest: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.ts.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		c.ts.t.Fatalf("reading the response of %s %s: %v", method, path, err)
+	}
+	return &testResponse{t: c.ts.t, request: method + " " + path, status: res.StatusCode, header: res.Header, body: data}
+}
+
+// expect fails the test unless the response has status
+func (r *testResponse) expect(status int) *testResponse {
+	r.t.Helper()
+	if r.status != status {
+		r.t.Fatalf("%s: status %d, want %d: %s", r.request, r.status, status, r.body)
+	}
+	return r
+}
+
+// decode reads the JSON body into v
+func (r *testResponse) decode(v interface{}) {
+	r.t.Helper()
+	if err := json.Unmarshal(r.body, v); err != nil {
+		r.t.Fatalf("decoding %s: %v", r.body, err)
+	}
+}
+
+// problemCode returns the code of a problem document
+func (r *testResponse) problemCode() string {
+	r.t.Helper()
+	var doc struct {
+		Code string `json:"code"`
+	}
+	r.decode(&doc)
+	return doc.Code
+}
+
+// contentPage is the envelope of content listings
+type contentPage struct {
+	Items      []models.Content `json:"items"`
+	NextCursor string           `json:"next_cursor"`
+	HasMore    bool             `json:"has_more"`
+}
+
+// names lists the names of the contents of the page, in order
+func (p contentPage) names() []string {
+	names := make([]string, 0, len(p.Items))
+	for _, content := range p.Items {
+		names = append(names, content.Name)
+	}
+	return names
+}
+
+// createContent creates a content named name with stacks and returns its ID
+func (c *testClient) createContent(name string, stacks ...string) string {
+	c.ts.t.Helper()
+	if stacks == nil {
+		stacks = []string{}
+	}
+	c.do("POST", "/content", map[string]interface{}{
+		"name":  name,
+		"url":   "https://example.com/" + name,
+		"stack": stacks,
+	}).expect(http.StatusCreated)
+
+	page, err := c.ts.store.Contents.FindContents(context.Background(),
+		store.ContentFilter{UserID: c.id}, store.ListOptions{Limit: 1, Sort: store.SortNewest})
+	if err != nil || len(page.Items) == 0 || page.Items[0].Name != name {
+		c.ts.t.Fatalf("created content %q not found: %v", name, err)
+	}
+	return page.Items[0].ID.Hex()
+}
+
+// eventually retries check until it passes, for the effects of events
+// delivered in the background
+func eventually(t *testing.T, check func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 2s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestContentRepositoryThroughTheAPI(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+
+	id := alice.createContent("first")
+
+	var page contentPage
+	ts.anonymous().do("GET", "/contents", nil).expect(http.StatusOK).decode(&page)
+	if !slices.Equal(page.names(), []string{"first"}) {
+		t.Fatalf("GET /contents listed %v, want [first]", page.names())
+	}
+
+	tests := []struct {
+		name   string
+		client *testClient
+		method string
+		body   interface{}
+		status int
+	}{
+		{"another user cannot edit", bob, "PUT", map[string]interface{}{"name": "stolen", "url": "https://example.com", "stack": []string{}}, http.StatusNotFound},
+		{"the owner edits", alice, "PUT", map[string]interface{}{"name": "renamed", "url": "https://example.com", "stack": []string{}}, http.StatusOK},
+		{"another user cannot delete", bob, "DELETE", nil, http.StatusNotFound},
+		{"the owner deletes", alice, "DELETE", nil, http.StatusOK},
+		{"a deleted content is gone", alice, "DELETE", nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if res := tt.client.do(tt.method, "/content/"+id, tt.body); res.status != tt.status {
+			t.Fatalf("%s: status %d, want %d: %s", tt.name, res.status, tt.status, res.body)
+		}
+	}
+
+	ts.anonymous().do("GET", "/contents", nil).expect(http.StatusOK).decode(&page)
+	if len(page.Items) != 0 {
+		t.Fatalf("GET /contents listed %v after the delete", page.names())
+	}
+}
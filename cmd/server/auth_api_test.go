@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"cms-server/internal/config"
+)
+
+// tokenCookie returns the token cookie set by res
+func tokenCookie(t *testing.T, res *testResponse) string {
+	t.Helper()
+	for _, cookie := range (&http.Response{Header: res.header}).Cookies() {
+		if cookie.Name == "token" {
+			return cookie.Value
+		}
+	}
+	t.Fatalf("%s set no token cookie", res.request)
+	return ""
+}
+
+func TestTokenSources(t *testing.T) {
+	for _, sources := range [][]string{{"header", "cookie"}, {"cookie", "header"}} {
+		ts := newTestServer(t, func(cfg *config.Config) { cfg.Auth.TokenSources = sources })
+		alice := ts.register("alice")
+
+		// Without return_token, the tokens only come as cookies
+		res := ts.anonymous().do("POST", "/login", map[string]string{"username": "alice", "password": testPassword}).
+			expect(http.StatusOK)
+		if strings.Contains(string(res.body), "access_token") {
+			t.Errorf("POST /login returned the tokens without return_token: %s", res.body)
+		}
+		valid := tokenCookie(t, res)
+		cookie := "token=" + valid
+
+		tests := []tokenSourceTest{
+			{"no token", nil, http.StatusUnauthorized, `Bearer realm="cms-server"`},
+			{"the header", []string{"Authorization", "Bearer " + alice.token}, http.StatusOK, ""},
+			{"the cookie", []string{"Cookie", cookie}, http.StatusOK, ""},
+			{"a lowercase scheme", []string{"Authorization", "bearer " + alice.token}, http.StatusOK, ""},
+			{"another scheme", []string{"Authorization", "Basic YWxpY2U6c2VjcmV0"}, http.StatusBadRequest, `error="invalid_request"`},
+			{"an empty Bearer token", []string{"Authorization", "Bearer "}, http.StatusBadRequest, `error="invalid_request"`},
+			{"an invalid header token", []string{"Authorization", "Bearer nope"}, http.StatusUnauthorized, `error="invalid_token"`},
+			{"an invalid cookie token", []string{"Cookie", "token=nope"}, http.StatusUnauthorized, `error="invalid_token"`},
+		}
+		// The first source carrying a token decides, the other is not tried
+		both := func(header, cookie string) []string {
+			return []string{"Authorization", "Bearer " + header, "Cookie", "token=" + cookie}
+		}
+		if sources[0] == "header" {
+			tests = append(tests,
+				tokenSourceTest{"a valid header over an invalid cookie", both(alice.token, "nope"), http.StatusOK, ""},
+				tokenSourceTest{"an invalid header over a valid cookie", both("nope", valid), http.StatusUnauthorized, `error="invalid_token"`},
+			)
+		} else {
+			tests = append(tests,
+				tokenSourceTest{"a valid cookie over an invalid header", both("nope", valid), http.StatusOK, ""},
+				tokenSourceTest{"an invalid cookie over a valid header", both(alice.token, "nope"), http.StatusUnauthorized, `error="invalid_token"`},
+			)
+		}
+
+		for _, tt := range tests {
+			res := ts.anonymous().do("GET", "/sessions", nil, tt.headers...)
+			if res.status != tt.status {
+				t.Errorf("%v, %s: status %d, want %d: %s", sources, tt.name, res.status, tt.status, res.body)
+				continue
+			}
+			if got := res.header.Get("WWW-Authenticate"); !strings.Contains(got, tt.challenge) || (tt.challenge == "") != (got == "") {
+				t.Errorf("%v, %s: WWW-Authenticate %q, want %q", sources, tt.name, got, tt.challenge)
+			}
+			if tt.status != http.StatusOK && res.header.Get("Content-Type") != "application/problem+json" {
+				t.Errorf("%v, %s: Content-Type %q, want a problem document", sources, tt.name, res.header.Get("Content-Type"))
+			}
+		}
+	}
+}
+
+// tokenSourceTest is a request to a private route with headers
+type tokenSourceTest struct {
+	name      string
+	headers   []string
+	status    int
+	challenge string
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"cms-server/internal/models"
+	"cms-server/internal/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestComments(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.registerAs("admin", models.RoleAdmin)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+	carol := ts.register("carol")
+
+	id := alice.createContent("first")
+	comment := func(client *testClient, body, parentID string) models.Comment {
+		t.Helper()
+		var created models.Comment
+		client.do("POST", "/content/"+id+"/comments", map[string]string{"body": body, "parent_id": parentID}).
+			expect(http.StatusCreated).decode(&created)
+		return created
+	}
+	list := func(client *testClient, query string) []string {
+		t.Helper()
+		var page store.Page[models.Comment]
+		client.do("GET", "/content/"+id+"/comments?sort=oldest"+query, nil).expect(http.StatusOK).decode(&page)
+		bodies := []string{}
+		for _, comment := range page.Items {
+			bodies = append(bodies, comment.Body)
+		}
+		return bodies
+	}
+
+	top := comment(bob, "  nice  ", "")
+	agreed := comment(carol, "agreed", "")
+	reply := comment(alice, "thanks", top.ID.Hex())
+	if top.Body != "nice" || top.Depth != 0 || reply.Depth != 1 || reply.ParentID == nil || *reply.ParentID != top.ID {
+		t.Fatalf("created %+v and the reply %+v", top, reply)
+	}
+
+	if got := list(ts.anonymous(), ""); !slices.Equal(got, []string{"nice", "agreed"}) {
+		t.Errorf("top level comments %v, want [nice agreed]", got)
+	}
+	if got := list(ts.anonymous(), "&parent_id="+top.ID.Hex()); !slices.Equal(got, []string{"thanks"}) {
+		t.Errorf("replies %v, want [thanks]", got)
+	}
+
+	// Replies stop at the maximum depth
+	parent := reply
+	for parent.Depth < 5 {
+		parent = comment(bob, "deeper", parent.ID.Hex())
+	}
+	bob.do("POST", "/content/"+id+"/comments", map[string]string{"body": "too deep", "parent_id": parent.ID.Hex()}).
+		expect(http.StatusBadRequest)
+	bob.do("POST", "/content/"+id+"/comments", map[string]string{"body": "lost", "parent_id": primitive.NewObjectID().Hex()}).
+		expect(http.StatusNotFound)
+	if code := bob.do("POST", "/content/"+id+"/comments", map[string]string{"body": " "}).
+		expect(http.StatusUnprocessableEntity).problemCode(); code != "validation_failed" {
+		t.Errorf("a blank comment: code %q, want validation_failed", code)
+	}
+
+	tests := []struct {
+		name   string
+		client *testClient
+		method string
+		path   string
+		status int
+	}{
+		{"another user cannot edit", carol, "PUT", "/comments/" + top.ID.Hex(), http.StatusForbidden},
+		{"the author edits", bob, "PUT", "/comments/" + top.ID.Hex(), http.StatusOK},
+		{"another user cannot delete", carol, "DELETE", "/comments/" + top.ID.Hex(), http.StatusForbidden},
+		{"the content owner deletes", alice, "DELETE", "/comments/" + top.ID.Hex(), http.StatusOK},
+		{"a deleted comment cannot be edited", bob, "PUT", "/comments/" + top.ID.Hex(), http.StatusNotFound},
+		{"a comment of another content is not found", bob, "PUT", "/comments/" + primitive.NewObjectID().Hex(), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		res := tt.client.do(tt.method, "/content/"+id+tt.path, map[string]string{"body": "edited"})
+		if res.status != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, res.status, tt.status, res.body)
+		}
+	}
+
+	// The deleted comment stays as a tombstone over its replies
+	if got := list(ts.anonymous(), ""); !slices.Equal(got, []string{"", "agreed"}) {
+		t.Errorf("top level comments after the delete %v, want [ agreed]", got)
+	}
+	var page contentPage
+	ts.anonymous().do("GET", "/contents", nil).expect(http.StatusOK).decode(&page)
+	if len(page.Items) != 1 || page.Items[0].CommentCount != 6 {
+		t.Errorf("GET /contents listed %+v, want 6 comments, the deleted one not counted", page.Items)
+	}
+
+	// Deleting a reply takes it off the reply count of its parent
+	answer := comment(bob, "why?", agreed.ID.Hex())
+	bob.do("DELETE", "/content/"+id+"/comments/"+answer.ID.Hex(), nil).expect(http.StatusOK)
+	var threads store.Page[models.Comment]
+	ts.anonymous().do("GET", "/content/"+id+"/comments?sort=oldest", nil).expect(http.StatusOK).decode(&threads)
+	if len(threads.Items) != 2 || threads.Items[0].ReplyCount != 1 || threads.Items[1].ReplyCount != 0 {
+		t.Errorf("top level comments %+v, want 1 reply to the deleted one and none left to the other", threads.Items)
+	}
+
+	// Only the owner and moderators read the comments of a hidden content
+	admin.do("POST", "/content/"+id+"/hide", map[string]string{"reason": "spam"}).expect(http.StatusOK)
+	ts.anonymous().do("GET", "/content/"+id+"/comments", nil).expect(http.StatusNotFound)
+	bob.do("GET", "/content/"+id+"/comments", nil).expect(http.StatusNotFound)
+	if got := list(alice, ""); len(got) != 2 {
+		t.Errorf("the owner of the hidden content listed %v", got)
+	}
+
+	alice.do("DELETE", "/content/"+id, nil).expect(http.StatusOK)
+	left, err := ts.store.Comments.ListComments(context.Background(), top.ContentID, primitive.NilObjectID, store.ListOptions{Limit: 10})
+	if err != nil || len(left.Items) != 0 {
+		t.Errorf("comments left after the content was deleted: %v, %v", left.Items, err)
+	}
+}
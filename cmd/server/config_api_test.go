@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"cms-server/internal/config"
+	"cms-server/internal/models"
+)
+
+func TestConfiguredReactionTypes(t *testing.T) {
+	ts := newTestServer(t, func(cfg *config.Config) { cfg.Reactions.Types = []string{"clap", "boo"} })
+	alice := ts.register("alice")
+	id := alice.createContent("first")
+
+	tests := []struct {
+		reaction string
+		status   int
+	}{
+		{"clap", http.StatusOK},
+		{"boo", http.StatusOK},
+		{"like", http.StatusUnprocessableEntity},
+		{"", http.StatusUnprocessableEntity},
+	}
+	var accepted *testResponse
+	for _, tt := range tests {
+		res := alice.do("POST", "/content/"+id+"/reactions", map[string]string{"type": tt.reaction})
+		if res.status != tt.status {
+			t.Errorf("reacting %q: status %d, want %d: %s", tt.reaction, res.status, tt.status, res.body)
+		} else if res.status == http.StatusOK {
+			accepted = res
+		}
+	}
+
+	var rejection struct {
+		Fields []struct {
+			Message string `json:"message"`
+		} `json:"fields"`
+	}
+	alice.do("POST", "/content/"+id+"/reactions", map[string]string{"type": "love"}).
+		expect(http.StatusUnprocessableEntity).decode(&rejection)
+	if len(rejection.Fields) != 1 || rejection.Fields[0].Message != "must be one of clap, boo" {
+		t.Errorf("an unknown reaction was rejected with %+v", rejection)
+	}
+
+	var summary struct {
+		Reactions      models.ReactionCounts `json:"reactions"`
+		ViewerReaction string                `json:"viewer_reaction"`
+	}
+	if accepted == nil {
+		t.Fatal("no reaction was accepted")
+	}
+	accepted.decode(&summary)
+	if len(summary.Reactions) != 1 || summary.Reactions["boo"] != 1 || summary.ViewerReaction != "boo" {
+		t.Errorf("the reactions are %+v, want the boo of alice replacing her clap", summary)
+	}
+}
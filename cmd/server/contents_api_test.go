@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestContentsPagination(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+	for _, name := range []string{"delta", "alpha", "echo", "charlie"} {
+		alice.createContent(name)
+	}
+	bob.createContent("bravo")
+
+	// walk lists every page of query, following the cursors
+	walk := func(query url.Values) []string {
+		t.Helper()
+		var names []string
+		for pages := 0; ; pages++ {
+			if pages > 5 {
+				t.Fatalf("%v: pagination does not end", query)
+			}
+			var page contentPage
+			ts.anonymous().do("GET", "/contents?"+query.Encode(), nil).expect(http.StatusOK).decode(&page)
+			names = append(names, page.names()...)
+			if !page.HasMore {
+				return names
+			}
+			query.Set("cursor", page.NextCursor)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  []string
+	}{
+		{"newest first by default", url.Values{"limit": {"2"}}, []string{"bravo", "charlie", "echo", "alpha", "delta"}},
+		{"oldest first", url.Values{"limit": {"2"}, "sort": {"oldest"}}, []string{"delta", "alpha", "echo", "charlie", "bravo"}},
+		{"by name", url.Values{"limit": {"3"}, "sort": {"name"}}, []string{"alpha", "bravo", "charlie", "delta", "echo"}},
+		{"of one user", url.Values{"limit": {"1"}, "user_id": {bob.id}}, []string{"bravo"}},
+	}
+	for _, tt := range tests {
+		if got := walk(tt.query); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: listed %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	var first contentPage
+	ts.anonymous().do("GET", "/contents?limit=1", nil).expect(http.StatusOK).decode(&first)
+
+	invalid := []string{
+		"/contents?limit=0",
+		"/contents?sort=random",
+		"/contents?cursor=garbage",
+		"/contents?sort=name&cursor=" + first.NextCursor,
+		"/contents?from=yesterday",
+	}
+	for _, path := range invalid {
+		res := ts.anonymous().do("GET", path, nil).expect(http.StatusBadRequest)
+		if code := res.problemCode(); code != "invalid_query" {
+			t.Errorf("GET %s: code %q, want invalid_query", path, code)
+		}
+	}
+}
+
+func TestSortOrdersOfListings(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.register("alice")
+	id := alice.createContent("first")
+
+	tests := []struct {
+		path   string
+		orders []string
+	}{
+		{"/contents", []string{"newest", "oldest", "name"}},
+		{"/stacks", []string{"newest", "oldest", "name"}},
+		{"/content/" + id + "/comments", []string{"newest", "oldest"}},
+		{"/users/" + alice.id + "/followers", []string{"newest", "oldest"}},
+		{"/users/" + alice.id + "/following", []string{"newest", "oldest"}},
+		{"/notifications", []string{"newest"}},
+		{"/feed", []string{"newest"}},
+	}
+	for _, tt := range tests {
+		for _, order := range []string{"newest", "oldest", "name"} {
+			res := alice.do("GET", tt.path+"?sort="+order, nil)
+			if slices.Contains(tt.orders, order) {
+				res.expect(http.StatusOK)
+			} else if code := res.expect(http.StatusBadRequest).problemCode(); code != "invalid_query" {
+				t.Errorf("GET %s?sort=%s: code %q, want invalid_query", tt.path, order, code)
+			}
+		}
+	}
+}
+
+func TestOwnContentsIncludeOnlyTheCaller(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+	alice.createContent("mine")
+	bob.createContent("theirs")
+
+	var page contentPage
+	alice.do("GET", "/content", nil).expect(http.StatusOK).decode(&page)
+	if !slices.Equal(page.names(), []string{"mine"}) {
+		t.Fatalf("GET /content listed %v, want [mine]", page.names())
+	}
+	ts.anonymous().do("GET", "/content", nil).expect(http.StatusUnauthorized)
+}
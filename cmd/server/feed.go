@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"cms-server/internal/config"
+	"cms-server/internal/database"
+	"cms-server/internal/feed"
+	"cms-server/internal/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// rebuildPageSize is how many users "feed rebuild" loads at once
+const rebuildPageSize = 100
+
+// feedCommand runs "feed rebuild [user-id]", which rebuilds the timeline of
+// one user, or of every user, for fan-out on write, and returns the exit code.
+// With the hybrid strategy, only the users with a timeline or following
+// enough users to get one are rebuilt.
+func feedCommand(cfg *config.Config, args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: server feed rebuild [user-id]")
+		return 2
+	}
+	if len(args) == 0 || args[0] != "rebuild" || len(args) > 2 {
+		return usage()
+	}
+
+	if cfg.Store.Backend == config.MemoryBackend {
+		fmt.Fprintln(os.Stderr, "feed: the in-memory store starts empty, there is nothing to rebuild, unset STORE_BACKEND")
+		return 1
+	}
+
+	db := connectMongo(cfg.Mongo)
+	defer database.Disconnect(context.Background(), db)
+	s := store.NewMongoStore(db)
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	// rebuild reports whether userID has a timeline to rebuild
+	rebuild := func(userID string) (bool, error) {
+		if cfg.Feed.Strategy == feed.FanOutHybrid {
+			return feed.Promote(ctx, s, userID, int64(cfg.Feed.TimelineThreshold))
+		}
+		return true, feed.Rebuild(ctx, s, userID)
+	}
+
+	if len(args) == 2 {
+		if _, err := primitive.ObjectIDFromHex(args[1]); err != nil {
+			return usage()
+		}
+		if _, err := rebuild(args[1]); err != nil {
+			log.Print(err)
+			return 1
+		}
+		return 0
+	}
+
+	opts := store.ListOptions{Limit: rebuildPageSize, Sort: store.SortOldest}
+	rebuilt := 0
+	for {
+		page, err := s.Users.ListUsers(ctx, opts)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		for _, user := range page.Items {
+			ok, err := rebuild(user.ID.Hex())
+			if err != nil {
+				log.Printf("Could not rebuild the timeline of %s: %v", user.ID.Hex(), err)
+				return 1
+			}
+			if ok {
+				rebuilt++
+			}
+		}
+		if !page.HasMore {
+			break
+		}
+		opts.After = &store.Cursor{ID: page.Items[len(page.Items)-1].ID}
+	}
+	log.Printf("Rebuilt the timelines of %d users", rebuilt)
+	return 0
+}
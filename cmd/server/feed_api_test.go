@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"cms-server/internal/config"
+	"cms-server/internal/feed"
+	"cms-server/internal/models"
+)
+
+func TestHomeFeed(t *testing.T) {
+	// With a threshold of one, hybrid gives timelines on the first follow
+	for _, strategy := range []string{feed.FanOutOnRead, feed.FanOutOnWrite, feed.FanOutHybrid} {
+		t.Run(strategy, func(t *testing.T) {
+			ts := newTestServer(t, func(cfg *config.Config) { cfg.Feed = config.Feed{Strategy: strategy, TimelineThreshold: 1} })
+			admin := ts.registerAs("admin", models.RoleAdmin)
+			alice := ts.register("alice")
+			bob := ts.register("bob")
+
+			feedOf := func(c *testClient) []string {
+				t.Helper()
+				var page contentPage
+				c.do("GET", "/feed", nil).expect(http.StatusOK).decode(&page)
+				return page.names()
+			}
+			// expectFeed waits for the events to reach the timelines
+			expectFeed := func(c *testClient, want ...string) {
+				t.Helper()
+				var got []string
+				eventually(t, func() bool {
+					got = feedOf(c)
+					return slices.Equal(got, want)
+				})
+			}
+
+			bob.createContent("bob-1")
+			bob.createContent("bob-2")
+			alice.createContent("alice-1")
+			expectFeed(alice, "alice-1")
+
+			// Following brings the earlier contents in, in their place
+			alice.do("POST", "/users/"+bob.id+"/follow", nil).expect(http.StatusCreated)
+			expectFeed(alice, "alice-1", "bob-2", "bob-1")
+
+			bob3 := bob.createContent("bob-3")
+			expectFeed(alice, "bob-3", "alice-1", "bob-2", "bob-1")
+
+			// Hidden and deleted contents leave the feed
+			admin.do("POST", "/content/"+bob3+"/hide", map[string]string{"reason": "spam"}).expect(http.StatusOK)
+			expectFeed(alice, "alice-1", "bob-2", "bob-1")
+			bob.do("DELETE", "/content/"+bob3, nil).expect(http.StatusOK)
+			admin.do("DELETE", "/content/"+bob3+"/hide", nil).expect(http.StatusNotFound)
+			expectFeed(alice, "alice-1", "bob-2", "bob-1")
+
+			// Pages follow one another newest first, the only order of a feed
+			var paged []string
+			path := "/feed?sort=newest&limit=2"
+			for pages := 0; path != ""; pages++ {
+				if pages > 2 {
+					t.Fatal("the feed pages do not end")
+				}
+				var page contentPage
+				alice.do("GET", path, nil).expect(http.StatusOK).decode(&page)
+				paged = append(paged, page.names()...)
+				path = ""
+				if page.HasMore {
+					path = "/feed?limit=2&cursor=" + page.NextCursor
+				}
+			}
+			if want := []string{"alice-1", "bob-2", "bob-1"}; !slices.Equal(paged, want) {
+				t.Errorf("paged through %v, want %v", paged, want)
+			}
+			for _, order := range []string{"oldest", "name", "best"} {
+				if code := alice.do("GET", "/feed?sort="+order, nil).expect(http.StatusBadRequest).problemCode(); code != "invalid_query" {
+					t.Errorf("GET /feed?sort=%s: code %s, want invalid_query", order, code)
+				}
+			}
+
+			// Unfollowing removes every content of the author
+			alice.do("DELETE", "/users/"+bob.id+"/follow", nil).expect(http.StatusOK)
+			expectFeed(alice, "alice-1")
+			expectFeed(bob, "bob-2", "bob-1")
+
+			ts.anonymous().do("GET", "/feed", nil).expect(http.StatusUnauthorized)
+		})
+	}
+}
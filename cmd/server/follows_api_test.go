@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFollowGraph(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+	carol := ts.register("carol")
+
+	tests := []struct {
+		name   string
+		client *testClient
+		method string
+		target string
+		status int
+	}{
+		{"follow", alice, "POST", bob.id, http.StatusCreated},
+		{"follow twice", alice, "POST", bob.id, http.StatusConflict},
+		{"follow yourself", alice, "POST", alice.id, http.StatusBadRequest},
+		{"follow an unknown user", alice, "POST", primitive.NewObjectID().Hex(), http.StatusNotFound},
+		{"follow an invalid ID", alice, "POST", "nope", http.StatusBadRequest},
+		{"another follower", carol, "POST", bob.id, http.StatusCreated},
+		{"follow back", bob, "POST", alice.id, http.StatusCreated},
+		{"unfollow", carol, "DELETE", bob.id, http.StatusOK},
+		{"unfollow twice", carol, "DELETE", bob.id, http.StatusNotFound},
+		{"anonymous", ts.anonymous(), "POST", bob.id, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if res := tt.client.do(tt.method, "/users/"+tt.target+"/follow", nil); res.status != tt.status {
+			t.Fatalf("%s: status %d, want %d: %s", tt.name, res.status, tt.status, res.body)
+		}
+	}
+
+	var profile struct {
+		Username       string `json:"username"`
+		FollowersCount int64  `json:"followers_count"`
+		FollowingCount int64  `json:"following_count"`
+	}
+	ts.anonymous().do("GET", "/users/"+bob.id, nil).expect(http.StatusOK).decode(&profile)
+	if profile.Username != "bob" || profile.FollowersCount != 1 || profile.FollowingCount != 1 {
+		t.Fatalf("profile of bob: %+v, want 1 follower and 1 following", profile)
+	}
+
+	usernames := func(path string) []string {
+		t.Helper()
+		var page struct {
+			Items []struct {
+				Username string `json:"username"`
+			} `json:"items"`
+		}
+		ts.anonymous().do("GET", path, nil).expect(http.StatusOK).decode(&page)
+		names := []string{}
+		for _, item := range page.Items {
+			names = append(names, item.Username)
+		}
+		return names
+	}
+	if got := usernames("/users/" + bob.id + "/followers"); !slices.Equal(got, []string{"alice"}) {
+		t.Errorf("followers of bob: %v, want [alice]", got)
+	}
+	if got := usernames("/users/" + alice.id + "/following"); !slices.Equal(got, []string{"bob"}) {
+		t.Errorf("alice follows %v, want [bob]", got)
+	}
+	if got := usernames("/users/" + carol.id + "/following"); len(got) != 0 {
+		t.Errorf("carol still follows %v", got)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"cms-server/internal/health"
+	"cms-server/internal/store"
+)
+
+func TestHealthProbes(t *testing.T) {
+	checker := health.NewChecker()
+	ts := startTestServer(t, testConfig(), io.Discard, store.NewMemoryStore(), checker)
+	client := ts.anonymous()
+
+	probe := func(status int) health.Report {
+		t.Helper()
+		var report health.Report
+		client.do("GET", "/readyz", nil).expect(status).decode(&report)
+		return report
+	}
+
+	client.do("GET", "/healthz", nil).expect(http.StatusOK)
+	if report := probe(http.StatusOK); report.Status != "ready" || report.Checks["event_bus"].Status != "ok" {
+		t.Errorf("GET /readyz reported %+v, want the event bus ready", report)
+	}
+
+	var failing atomic.Bool
+	checker.Add("mongodb", func(context.Context) error {
+		if failing.Load() {
+			return errors.New("server selection timeout")
+		}
+		return nil
+	})
+	failing.Store(true)
+	report := probe(http.StatusServiceUnavailable)
+	if report.Status != "not_ready" || report.Checks["mongodb"].Error != "server selection timeout" || report.Checks["event_bus"].Status != "ok" {
+		t.Errorf("GET /readyz reported %+v, want mongodb failing", report)
+	}
+
+	failing.Store(false)
+	checker.SetShuttingDown()
+	if report := probe(http.StatusServiceUnavailable); report.Status != "shutting_down" {
+		t.Errorf("GET /readyz reported %+v while shutting down", report)
+	}
+	client.do("GET", "/healthz", nil).expect(http.StatusOK)
+}
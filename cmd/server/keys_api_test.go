@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cms-server/internal/config"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// writeKeyFile writes a key set signing with a new EdDSA key and keeping an
+// HS256 key, and returns its path
+func writeKeyFile(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ed.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"signing_key": "ed-1",
+		"keys": []map[string]string{
+			{"kid": "ed-1", "alg": "EdDSA", "private_key_file": "ed.pem"},
+			{"kid": "hs-1", "alg": "HS256", "secret": "test-secret-of-at-least-32-bytes!"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "keys.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestJWKS(t *testing.T) {
+	type jwks struct {
+		Keys []struct {
+			ID        string `json:"kid"`
+			KeyType   string `json:"kty"`
+			Algorithm string `json:"alg"`
+			X         string `json:"x"`
+		} `json:"keys"`
+	}
+
+	// HS256 secrets are never published
+	var published jwks
+	newTestServer(t).anonymous().do("GET", "/.well-known/jwks.json", nil).expect(http.StatusOK).decode(&published)
+	if len(published.Keys) != 0 {
+		t.Errorf("the JWKS of an HS256 server lists %+v", published.Keys)
+	}
+
+	path := writeKeyFile(t)
+	ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.Auth.KeysFile = path
+		cfg.Auth.JWTSecret = ""
+	})
+	alice := ts.register("alice")
+
+	res := ts.anonymous().do("GET", "/.well-known/jwks.json", nil).expect(http.StatusOK)
+	if res.header.Get("Cache-Control") == "" {
+		t.Error("the JWKS is not cacheable")
+	}
+	res.decode(&published)
+	if len(published.Keys) != 1 || published.Keys[0].ID != "ed-1" || published.Keys[0].KeyType != "OKP" {
+		t.Fatalf("the JWKS lists %+v, want the EdDSA key only", published.Keys)
+	}
+
+	// Other services verify access tokens with the published key alone
+	public, err := base64.RawURLEncoding.DecodeString(published.Keys[0].X)
+	if err != nil {
+		t.Fatalf("decoding the public key: %v", err)
+	}
+	token, err := jwt.Parse(alice.token, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["kid"] != published.Keys[0].ID {
+			t.Errorf("the access token has the kid %v", token.Header["kid"])
+		}
+		return ed25519.PublicKey(public), nil
+	}, jwt.WithValidMethods([]string{published.Keys[0].Algorithm}))
+	if err != nil || !token.Valid {
+		t.Fatalf("the access token does not verify against the JWKS: %v", err)
+	}
+	if claims := token.Claims.(jwt.MapClaims); claims["user_id"] != alice.id {
+		t.Errorf("the access token carries the claims %v", claims)
+	}
+	alice.do("GET", "/sessions", nil).expect(http.StatusOK)
+}
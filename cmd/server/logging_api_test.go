@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"cms-server/internal/config"
+	"cms-server/internal/health"
+	"cms-server/internal/store"
+)
+
+// logBuffer collects the lines logged by a test server
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// requestLine is a request logged by middleware.RequestLogger
+type requestLine struct {
+	Level     string            `json:"level"`
+	Msg       string            `json:"msg"`
+	Method    string            `json:"method"`
+	Route     string            `json:"route"`
+	Path      string            `json:"path"`
+	Status    int               `json:"status"`
+	Bytes     int64             `json:"bytes"`
+	IP        string            `json:"ip"`
+	UserID    string            `json:"user_id"`
+	RequestID string            `json:"request_id"`
+	TraceID   string            `json:"trace_id"`
+	Headers   map[string]string `json:"headers"`
+}
+
+// requests returns the request lines logged so far, and forgets them
+func (b *logBuffer) requests(t *testing.T) []requestLine {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var lines []requestLine
+	for _, raw := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if raw == "" {
+			continue
+		}
+		var line requestLine
+		if err := json.Unmarshal([]byte(raw), &line); err != nil {
+			t.Fatalf("decoding the log line %s: %v", raw, err)
+		}
+		if line.Msg == "request" {
+			lines = append(lines, line)
+		}
+	}
+	b.buf.Reset()
+	return lines
+}
+
+// newLoggedTestServer starts the API like newTestServer, logging to the
+// returned buffer
+func newLoggedTestServer(t *testing.T, configure func(*config.Config)) (*testServer, *logBuffer) {
+	t.Helper()
+	cfg := testConfig()
+	configure(cfg)
+	logs := &logBuffer{}
+	return startTestServer(t, cfg, logs, store.NewMemoryStore(), health.NewChecker()), logs
+}
+
+func TestRequestLogs(t *testing.T) {
+	ts, logs := newLoggedTestServer(t, func(cfg *config.Config) { cfg.Log.Level = "debug" })
+	alice := ts.register("alice")
+	id := alice.createContent("first")
+	logs.requests(t)
+
+	res := alice.do("GET", "/content/"+id+"/comments", nil, "X-Request-ID", "trace-me", "Cookie", "session=abc").
+		expect(http.StatusOK)
+	if res.header.Get("X-Request-ID") != "trace-me" {
+		t.Errorf("answered the request ID %q, want trace-me", res.header.Get("X-Request-ID"))
+	}
+	lines := logs.requests(t)
+	if len(lines) != 1 {
+		t.Fatalf("logged %d request lines, want 1", len(lines))
+	}
+	line := lines[0]
+	want := requestLine{
+		Level:     "INFO",
+		Msg:       "request",
+		Method:    "GET",
+		Route:     "/content/{id}/comments",
+		Path:      "/content/" + id + "/comments",
+		Status:    http.StatusOK,
+		Bytes:     int64(len(res.body)),
+		IP:        "127.0.0.1",
+		UserID:    alice.id,
+		RequestID: "trace-me",
+	}
+	headers := line.Headers
+	line.Headers, line.TraceID = nil, ""
+	if !reflect.DeepEqual(line, want) {
+		t.Errorf("logged %+v, want %+v", line, want)
+	}
+	if headers["Authorization"] != "[redacted]" || headers["Cookie"] != "[redacted]" || headers["X-Request-Id"] != "trace-me" {
+		t.Errorf("logged the headers %v", headers)
+	}
+
+	// A failed login logs neither the password nor the body
+	ts.anonymous().do("POST", "/login", map[string]string{"username": "alice", "password": "hunter2"}).
+		expect(http.StatusUnauthorized)
+	lines = logs.requests(t)
+	if len(lines) != 1 || lines[0].Level != "WARN" || lines[0].UserID != "" || len(lines[0].RequestID) != 32 {
+		t.Errorf("logged the failed login as %+v", lines)
+	}
+}
+
+func TestRequestLogSampling(t *testing.T) {
+	ts, logs := newLoggedTestServer(t, func(cfg *config.Config) {
+		cfg.Log.Level = "info"
+		cfg.Log.SampleRate = 0
+	})
+	client := ts.anonymous()
+
+	for i := 0; i < 5; i++ {
+		client.do("GET", "/contents", nil).expect(http.StatusOK)
+	}
+	client.do("GET", "/nowhere", nil).expect(http.StatusNotFound)
+	lines := logs.requests(t)
+	if len(lines) != 1 || lines[0].Status != http.StatusNotFound || lines[0].Route != "unmatched" {
+		t.Errorf("logged %+v, want the failed request only", lines)
+	}
+}
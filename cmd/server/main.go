@@ -1,67 +1,244 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
+	"cms-server/internal/auth"
+	"cms-server/internal/config"
 	"cms-server/internal/database"
 	"cms-server/internal/handlers"
+	"cms-server/internal/health"
+	"cms-server/internal/logging"
 	"cms-server/internal/middleware"
+	"cms-server/internal/models"
+	"cms-server/internal/ratelimit"
+	"cms-server/internal/store"
+	"cms-server/internal/tracing"
 
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func main() {
-	// Load environment variables from .env file
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
+	// Read the settings from the config file, .env, the environment and the
+	// flags
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
 
-	// Connect to MongoDB
-	database.ConnectMongo()
+	// Log JSON lines, including the lines of the log package
+	logger := logging.New(os.Stderr, cfg.Log)
+	slog.SetDefault(logger)
 
-	// Create a new Gorilla Mux router
-	r := mux.NewRouter()
+	// Export the spans of requests and store operations
+	flushTraces, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Could not set up tracing: %v", err)
+	}
 
-	// Register public routes
-	registerPublicRoutes(r)
+	// "server migrate ..." manages the schema, "server reactions recount"
+	// repairs the reaction counters and "server config" prints the settings
+	// instead of serving
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			os.Exit(migrateCommand(cfg, args[1:]))
+		case "reactions":
+			os.Exit(reactionsCommand(cfg, args[1:]))
+		case "feed":
+			os.Exit(feedCommand(cfg, args[1:]))
+		case "config":
+			fmt.Print(cfg)
+			return
+		}
+		log.Fatalf("Unknown command %q, expected migrate, reactions, feed or config", args[0])
+	}
 
-	// Register private routes
-	registerPrivateRoutes(r)
+	// Build the API on top of the selected store backend
+	checker := health.NewChecker()
+	s, db := newStore(cfg, checker)
+	api, err := newApp(cfg, logger, store.Traced(s), db, checker)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Start the server
-	startServer(r)
+	// Serve until stopped
+	server := &lifecycle{
+		config: cfg.Server,
+		server: newHTTPServer(cfg.Server, api.handler),
+		health: checker,
+		db:     db,
+		hub:    api.hub,
+		bus:    api.bus,
+		traces: flushTraces,
+	}
+	if err := server.run(); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func registerPublicRoutes(r *mux.Router) {
-	r.HandleFunc("/register", handlers.RegisterUserHandler).Methods("POST")
-	r.HandleFunc("/login", handlers.LoginUserHandler).Methods("POST")
-	r.HandleFunc("/logout", handlers.LogoutUserHandler).Methods("POST")
-	r.HandleFunc("/contents", handlers.GetContentsHandler).Methods("GET")
-	r.HandleFunc("/stacks", handlers.GetStacksHandler).Methods("GET")
-}
+// newStore returns the in-memory store when cfg selects it, otherwise it
+// connects to MongoDB, adds its readiness checks to checker and returns the
+// database too. The database is nil with the in-memory store.
+func newStore(cfg *config.Config, checker *health.Checker) (*store.Store, *mongo.Database) {
+	if cfg.Store.Backend == config.MemoryBackend {
+		log.Println("Using in-memory store")
+		return store.NewMemoryStore(), nil
+	}
 
-func registerPrivateRoutes(r *mux.Router) {
-	r.Handle("/content", middleware.AuthMiddleware(http.HandlerFunc(handlers.CreateContentHandler))).Methods("POST")
-	r.Handle("/content", middleware.AuthMiddleware(http.HandlerFunc(handlers.GetContentHandler))).Methods("GET")
-	r.Handle("/content/{id}", middleware.AuthMiddleware(http.HandlerFunc(handlers.EditContentHandler))).Methods("PUT")
-	r.Handle("/content/{id}", middleware.AuthMiddleware(http.HandlerFunc(handlers.DeleteContentHandler))).Methods("DELETE")
+	// Connect to MongoDB
+	db := connectMongo(cfg.Mongo)
+
+	// Bring the indexes up to date before serving; unique indexes are what
+	// keeps usernames, emails and stack names unique
+	migrator := database.NewMigrator(db, database.Migrations)
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+	if err := migrateUp(ctx, migrator); err != nil {
+		log.Fatalf("Could not migrate the database: %v", err)
+	}
 
-	r.Handle("/stacks", middleware.AuthMiddleware(http.HandlerFunc(handlers.CreateStackHandler))).Methods("POST")
-	r.Handle("/stacks/{id}", middleware.AuthMiddleware(http.HandlerFunc(handlers.EditStackHandler))).Methods("PUT")
-	r.Handle("/stacks/{id}", middleware.AuthMiddleware(http.HandlerFunc(handlers.DeleteStackHandler))).Methods("DELETE")
+	checker.Add("mongodb", func(ctx context.Context) error { return database.Ping(ctx, db) })
+	checker.Add("migrations", func(ctx context.Context) error {
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return fmt.Errorf("%d pending migrations", pending)
+		}
+		return nil
+	})
+
+	return store.NewMongoStore(db), db
 }
 
-func startServer(r *mux.Router) {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080" // Default port if not specified
+// newLimitStore returns the store of the rate limits selected by cfg. The
+// mongo one shares db, the database of the mongo store.
+func newLimitStore(cfg config.RateLimit, db *mongo.Database) ratelimit.Store {
+	if cfg.Store == config.MongoLimiter {
+		return ratelimit.NewMongoStore(db)
 	}
+	return ratelimit.NewMemoryStore()
+}
 
-	log.Printf("Server is running on port %s", port)
-	if err := http.ListenAndServe(":"+port, r); err != nil {
+// connectMongo connects to MongoDB, retrying for up to the connect timeout
+// of cfg, and returns the database of cfg
+func connectMongo(cfg config.Mongo) *mongo.Database {
+	db, err := database.ConnectMongo(context.Background(), cfg)
+	if err != nil {
 		log.Fatal(err)
 	}
+	return db
+}
+
+// bootstrapAdmin promotes the user named username to admin as long as there
+// is no admin yet. Registering never grants a role: whoever claimed the
+// username first would get it.
+func bootstrapAdmin(s *store.Store, username string) {
+	if username == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	admins, err := s.Users.CountUsersByRole(ctx, models.RoleAdmin)
+	if err != nil {
+		log.Printf("Could not count admins: %v", err)
+		return
+	}
+	if admins > 0 {
+		return
+	}
+
+	user, err := s.Users.GetUserByUsername(ctx, username)
+	if err != nil {
+		log.Printf("Bootstrap admin %q does not exist: register it and restart", username)
+		return
+	}
+	if _, err := s.Users.SetUserRole(ctx, user.ID, models.RoleAdmin); err != nil {
+		log.Printf("Could not promote %q to admin: %v", username, err)
+		return
+	}
+	log.Printf("Promoted %q to admin", username)
+}
+
+// limitGroups returns the wrappers limiting handlers to the rate of the
+// auth, read and write groups. Authenticated routes limit inside the auth
+// middleware so that users are counted along with addresses.
+func limitGroups(limiter *middleware.RateLimiter) (limitAuth, limitRead, limitWrite func(http.HandlerFunc) http.Handler) {
+	group := func(group middleware.LimitGroup) func(http.HandlerFunc) http.Handler {
+		return func(handler http.HandlerFunc) http.Handler {
+			return limiter.Limit(group, handler)
+		}
+	}
+	return group(middleware.AuthGroup), group(middleware.ReadGroup), group(middleware.WriteGroup)
+}
+
+func registerPublicRoutes(r *mux.Router, h *handlers.Handler, authn *middleware.Authenticator, limiter *middleware.RateLimiter) {
+	limitAuth, limitRead, limitWrite := limitGroups(limiter)
+	r.Handle("/register", limitAuth(h.RegisterUserHandler)).Methods("POST")
+	r.Handle("/login", limitAuth(h.LoginUserHandler)).Methods("POST")
+	r.Handle("/logout", authn.OptionalAuthMiddleware(limitWrite(h.LogoutUserHandler))).Methods("POST")
+	r.Handle("/token/refresh", limitAuth(h.RefreshTokenHandler)).Methods("POST")
+	r.HandleFunc("/.well-known/jwks.json", h.JWKSHandler).Methods("GET")
+	r.Handle("/contents", authn.OptionalAuthMiddleware(limitRead(h.GetContentsHandler))).Methods("GET")
+	r.Handle("/stacks", limitRead(h.GetStacksHandler)).Methods("GET")
+	r.Handle("/content/{id}/comments", authn.OptionalAuthMiddleware(limitRead(h.GetCommentsHandler))).Methods("GET")
+	r.Handle("/search", limitRead(h.SearchHandler)).Methods("GET")
+	r.Handle("/users/{id}", limitRead(h.GetUserProfileHandler)).Methods("GET")
+	r.Handle("/users/{id}/followers", limitRead(h.GetFollowersHandler)).Methods("GET")
+	r.Handle("/users/{id}/following", limitRead(h.GetFollowingHandler)).Methods("GET")
+}
+
+func registerPrivateRoutes(r *mux.Router, h *handlers.Handler, authn *middleware.Authenticator, limiter *middleware.RateLimiter) {
+	_, limitRead, limitWrite := limitGroups(limiter)
+	r.Handle("/content", authn.AuthMiddleware(limitWrite(h.CreateContentHandler))).Methods("POST")
+	r.Handle("/content", authn.AuthMiddleware(limitRead(h.GetContentHandler))).Methods("GET")
+	r.Handle("/content/{id}", authn.AuthMiddleware(limitWrite(h.EditContentHandler))).Methods("PUT")
+	r.Handle("/content/{id}", authn.AuthMiddleware(limitWrite(h.PatchContentHandler))).Methods("PATCH")
+	r.Handle("/content/{id}", authn.AuthMiddleware(limitWrite(h.DeleteContentHandler))).Methods("DELETE")
+	r.Handle("/content/{id}/hide", authn.RequirePermission(auth.HideContent, limitWrite(h.HideContentHandler))).Methods("POST")
+	r.Handle("/content/{id}/hide", authn.RequirePermission(auth.HideContent, limitWrite(h.UnhideContentHandler))).Methods("DELETE")
+
+	r.Handle("/stacks", authn.RequirePermission(auth.ManageStacks, limitWrite(h.CreateStackHandler))).Methods("POST")
+	r.Handle("/stacks/{id}", authn.RequirePermission(auth.ManageStacks, limitWrite(h.EditStackHandler))).Methods("PUT")
+	r.Handle("/stacks/{id}", authn.RequirePermission(auth.ManageStacks, limitWrite(h.PatchStackHandler))).Methods("PATCH")
+	r.Handle("/stacks/{id}", authn.RequirePermission(auth.ManageStacks, limitWrite(h.DeleteStackHandler))).Methods("DELETE")
+
+	r.Handle("/content/{id}/reactions", authn.AuthMiddleware(limitWrite(h.ReactHandler))).Methods("POST")
+	r.Handle("/content/{id}/reactions", authn.AuthMiddleware(limitWrite(h.UnreactHandler))).Methods("DELETE")
+
+	r.Handle("/content/{id}/comments", authn.AuthMiddleware(limitWrite(h.CreateCommentHandler))).Methods("POST")
+	r.Handle("/content/{id}/comments/{commentID}", authn.AuthMiddleware(limitWrite(h.EditCommentHandler))).Methods("PUT")
+	r.Handle("/content/{id}/comments/{commentID}", authn.AuthMiddleware(limitWrite(h.DeleteCommentHandler))).Methods("DELETE")
+
+	r.Handle("/feed", authn.AuthMiddleware(limitRead(h.GetFeedHandler))).Methods("GET")
+
+	r.Handle("/stream", authn.AuthMiddleware(limitRead(h.StreamHandler))).Methods("GET")
+	r.Handle("/ws", authn.AuthMiddleware(limitRead(h.WebSocketHandler))).Methods("GET")
+
+	r.Handle("/notifications", authn.AuthMiddleware(limitRead(h.GetNotificationsHandler))).Methods("GET")
+	r.Handle("/notifications/read", authn.AuthMiddleware(limitWrite(h.MarkNotificationsReadHandler))).Methods("POST")
+
+	r.Handle("/users/{id}/follow", authn.AuthMiddleware(limitWrite(h.FollowUserHandler))).Methods("POST")
+	r.Handle("/users/{id}/follow", authn.AuthMiddleware(limitWrite(h.UnfollowUserHandler))).Methods("DELETE")
+	r.Handle("/users/{id}/role", authn.RequirePermission(auth.ManageRoles, limitWrite(h.SetUserRoleHandler))).Methods("PUT")
+
+	r.Handle("/sessions", authn.AuthMiddleware(limitRead(h.GetSessionsHandler))).Methods("GET")
+	r.Handle("/sessions", authn.AuthMiddleware(limitWrite(h.DeleteSessionsHandler))).Methods("DELETE")
+	r.Handle("/sessions/{id}", authn.AuthMiddleware(limitWrite(h.DeleteSessionHandler))).Methods("DELETE")
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrape returns the series of GET /metrics with their values
+func (c *testClient) scrape() map[string]float64 {
+	c.ts.t.Helper()
+	res := c.do("GET", "/metrics", nil).expect(http.StatusOK)
+	if ct := res.header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		c.ts.t.Fatalf("GET /metrics: Content-Type %q, want the text format", ct)
+	}
+	series := map[string]float64{}
+	for _, line := range strings.Split(string(res.body), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			c.ts.t.Fatalf("GET /metrics: invalid line %q", line)
+		}
+		series[line[:i]] = value
+	}
+	return series
+}
+
+func TestMetrics(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.register("alice")
+	first := alice.createContent("first")
+	second := alice.createContent("second")
+	anonymous := ts.anonymous()
+
+	const (
+		comments   = `cms_http_requests_total{method="GET",route="/content/{id}/comments",status="200"}`
+		unmatched  = `cms_http_requests_total{method="GET",route="unmatched",status="404"}`
+		other      = `cms_http_requests_total{method="other",route="unmatched",status="405"}`
+		durations  = `cms_http_request_duration_seconds_count{method="GET",route="/content/{id}/comments"}`
+		successes  = `cms_auth_logins_total{result="success"}`
+		failures   = `cms_auth_logins_total{result="failure"}`
+		sse        = `cms_stream_connections{transport="sse"}`
+		goroutines = `go_goroutines`
+	)
+	before := anonymous.scrape()
+
+	anonymous.do("GET", "/content/"+first+"/comments", nil).expect(http.StatusOK)
+	anonymous.do("GET", "/content/"+second+"/comments", nil).expect(http.StatusOK)
+	anonymous.do("GET", "/nowhere/"+first, nil).expect(http.StatusNotFound)
+	anonymous.do("BREW", "/contents", nil).expect(http.StatusMethodNotAllowed)
+	ts.login("alice")
+	anonymous.do("POST", "/login", map[string]string{"username": "alice", "password": "wrong"}).expect(http.StatusUnauthorized)
+
+	// Streams are gauged while they are open
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.url+"/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+alice.token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /stream: %v", err)
+	}
+	defer res.Body.Close()
+
+	after := anonymous.scrape()
+	for series, want := range map[string]float64{
+		comments:  2,
+		durations: 2,
+		unmatched: 1,
+		other:     1,
+		successes: 1,
+		failures:  1,
+		sse:       1,
+	} {
+		if got := after[series] - before[series]; got != want {
+			t.Errorf("%s increased by %v, want %v", series, got, want)
+		}
+	}
+	if after[goroutines] == 0 {
+		t.Error("the Go runtime statistics are missing")
+	}
+	for series := range after {
+		if strings.Contains(series, first) || strings.Contains(series, "/nowhere") || strings.Contains(series, "BREW") {
+			t.Errorf("a series is labeled with what the client sent: %s", series)
+		}
+	}
+
+	cancel()
+	eventually(t, func() bool { return anonymous.scrape()[sse] == before[sse] })
+}
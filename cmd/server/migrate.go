@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"cms-server/internal/config"
+	"cms-server/internal/database"
+)
+
+// migrationTimeout bounds a migration run; building indexes on large
+// collections takes a while
+const migrationTimeout = 10 * time.Minute
+
+// migrateUp applies the pending migrations and logs them
+func migrateUp(ctx context.Context, migrator *database.Migrator) error {
+	applied, err := migrator.Up(ctx)
+	for _, migration := range applied {
+		log.Printf("Applied migration %d: %s", migration.Version, migration.Description)
+	}
+	return err
+}
+
+// migrateCommand runs "migrate up", "migrate down [steps]" or
+// "migrate status" against the MongoDB of cfg and returns the exit code
+func migrateCommand(cfg *config.Config, args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: server migrate up | down [steps] | status")
+		return 2
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+
+	if cfg.Store.Backend == config.MemoryBackend {
+		fmt.Fprintln(os.Stderr, "migrate: the in-memory store has no schema, unset STORE_BACKEND")
+		return 1
+	}
+
+	db := connectMongo(cfg.Mongo)
+	defer database.Disconnect(context.Background(), db)
+	migrator := database.NewMigrator(db, database.Migrations)
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	switch args[0] {
+	case "up":
+		if err := migrateUp(ctx, migrator); err != nil {
+			log.Print(err)
+			return 1
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return usage()
+			}
+			steps = n
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, migration := range reverted {
+			log.Printf("Reverted migration %d: %s", migration.Version, migration.Description)
+		}
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-30s  %s\n", status.Version, applied, status.Description)
+		}
+	default:
+		return usage()
+	}
+	return 0
+}
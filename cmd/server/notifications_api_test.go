@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestNotifications(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+	carol := ts.register("carol")
+	dave := ts.register("dave")
+
+	type notification struct {
+		ID         string `json:"id"`
+		Type       string `json:"type"`
+		ActorCount int    `json:"actor_count"`
+		Read       bool   `json:"read"`
+		Message    string `json:"message"`
+	}
+	type inbox struct {
+		Items       []notification `json:"items"`
+		UnreadCount int64          `json:"unread_count"`
+	}
+	read := func(client *testClient, query string) inbox {
+		t.Helper()
+		var body inbox
+		client.do("GET", "/notifications"+query, nil).expect(http.StatusOK).decode(&body)
+		return body
+	}
+	messages := func(body inbox) []string {
+		messages := []string{}
+		for _, n := range body.Items {
+			messages = append(messages, n.Message)
+		}
+		return messages
+	}
+
+	id := alice.createContent("first")
+	alice.do("POST", "/content/"+id+"/reactions", map[string]string{"type": "like"}).expect(http.StatusOK)
+	for _, client := range []*testClient{bob, carol, dave} {
+		client.do("POST", "/content/"+id+"/reactions", map[string]string{"type": "like"}).expect(http.StatusOK)
+	}
+	bob.do("POST", "/users/"+alice.id+"/follow", nil).expect(http.StatusCreated)
+	carol.do("POST", "/content/"+id+"/comments", map[string]string{"body": "ask @Dave, @dave and @dave"}).expect(http.StatusCreated)
+
+	// Reactions on one content group, acting on your own content is silent,
+	// a user mentioned under several spellings is notified once
+	want := []string{
+		"carol commented on your content",
+		"bob started following you",
+		"dave and 2 others reacted to your content",
+	}
+	eventually(t, func() bool { return slices.Equal(messages(read(alice, "")), want) })
+	if got := messages(read(dave, "")); !slices.Equal(got, []string{"carol mentioned you"}) {
+		t.Errorf("dave got %v, want the mention", got)
+	}
+	if got := read(carol, ""); len(got.Items) != 0 || got.UnreadCount != 0 {
+		t.Errorf("carol got %+v, want nothing", got)
+	}
+
+	body := read(alice, "")
+	if body.UnreadCount != 3 {
+		t.Errorf("unread_count %d, want 3", body.UnreadCount)
+	}
+	var unread map[string]int64
+	alice.do("POST", "/notifications/read", map[string]string{"id": body.Items[0].ID}).expect(http.StatusOK).decode(&unread)
+	if unread["unread_count"] != 2 {
+		t.Errorf("unread_count %d after reading one, want 2", unread["unread_count"])
+	}
+	if got := messages(read(alice, "?unread=true")); !slices.Equal(got, want[1:]) {
+		t.Errorf("unread notifications %v, want %v", got, want[1:])
+	}
+	bob.do("POST", "/notifications/read", map[string]string{"id": body.Items[1].ID}).expect(http.StatusNotFound)
+	alice.do("POST", "/notifications/read", map[string]interface{}{}).expect(http.StatusUnprocessableEntity)
+
+	alice.do("POST", "/notifications/read", map[string]bool{"all": true}).expect(http.StatusOK).decode(&unread)
+	if unread["unread_count"] != 0 {
+		t.Errorf("unread_count %d after reading all, want 0", unread["unread_count"])
+	}
+
+	// A new reaction after reading starts a new group
+	alice.do("DELETE", "/content/"+id+"/reactions", nil).expect(http.StatusOK)
+	bob.do("DELETE", "/content/"+id+"/reactions", nil).expect(http.StatusOK)
+	bob.do("POST", "/content/"+id+"/reactions", map[string]string{"type": "love"}).expect(http.StatusOK)
+	eventually(t, func() bool {
+		got := read(alice, "?unread=true")
+		return len(got.Items) == 1 && got.Items[0].ActorCount == 1 && got.Items[0].Message == "bob reacted to your content"
+	})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"testing"
+
+	"cms-server/internal/health"
+	"cms-server/internal/models"
+	"cms-server/internal/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mongoLikeStacks refuses to look up nil names, like the $in of MongoDB
+type mongoLikeStacks struct {
+	store.StackStore
+}
+
+func (s mongoLikeStacks) FindStacksByName(ctx context.Context, names []string) ([]models.Stack, error) {
+	if names == nil {
+		return nil, errors.New("$in needs an array")
+	}
+	return s.StackStore.FindStacksByName(ctx, names)
+}
+
+func TestPatchContent(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.registerAs("admin", models.RoleAdmin)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+	for _, name := range []string{"go", "web"} {
+		admin.do("POST", "/stacks", map[string]string{"name": name, "color": "#000000"}).expect(http.StatusCreated)
+	}
+
+	id := alice.createContent("first", "go")
+	alice.do("PUT", "/content/"+id, map[string]interface{}{
+		"name":        "first",
+		"description": "about go",
+		"url":         "https://example.com/first",
+		"imgUrl":      "https://example.com/first.png",
+		"stack":       []string{"go"},
+	}).expect(http.StatusOK)
+
+	const (
+		merge = "application/merge-patch+json"
+		json  = "application/json-patch+json"
+	)
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		// want checks the content after a successful patch
+		want func(models.Content) bool
+	}{
+		{"a merge patch changes its members only", merge, `{"description":"about Go"}`, http.StatusOK, func(c models.Content) bool {
+			return c.Name == "first" && c.Description == "about Go" && c.ImgUrl != ""
+		}},
+		{"a plain JSON body is a merge patch", "application/json", `{"name":"renamed"}`, http.StatusOK, func(c models.Content) bool {
+			return c.Name == "renamed" && c.Description == "about Go"
+		}},
+		{"null clears a member", merge, `{"imgUrl":null}`, http.StatusOK, func(c models.Content) bool {
+			return c.ImgUrl == "" && c.Description == "about Go"
+		}},
+		{"a JSON patch adds a stack by name", json, `[{"op":"test","path":"/name","value":"renamed"},{"op":"add","path":"/stack/-","value":"web"}]`, http.StatusOK, func(c models.Content) bool {
+			return len(c.Stack) == 2 && c.Stack[1].Name == "web" && !c.Stack[1].ID.IsZero()
+		}},
+		{"remove clears a member", json, `[{"op":"remove","path":"/description"}]`, http.StatusOK, func(c models.Content) bool {
+			return c.Description == "" && c.Name == "renamed"
+		}},
+		{"replacing with null clears a member", json, `[{"op":"add","path":"/description","value":"back"},{"op":"replace","path":"/description","value":null}]`, http.StatusOK, func(c models.Content) bool {
+			return c.Description == ""
+		}},
+		{"a failed test", json, `[{"op":"test","path":"/name","value":"first"},{"op":"replace","path":"/name","value":"lost"}]`, http.StatusConflict, nil},
+		{"a required member removed", merge, `{"name":null}`, http.StatusUnprocessableEntity, nil},
+		{"an invalid result", merge, `{"url":"ftp://example.com"}`, http.StatusUnprocessableEntity, nil},
+		{"an unknown member", merge, `{"owner":"bob"}`, http.StatusUnprocessableEntity, nil},
+		{"a patch that cannot apply", json, `[{"op":"remove","path":"/missing"}]`, http.StatusUnprocessableEntity, nil},
+		{"an unknown stack", json, `[{"op":"add","path":"/stack/-","value":"cobol"}]`, http.StatusUnprocessableEntity, nil},
+		{"another media type", "text/plain", `name=lost`, http.StatusUnsupportedMediaType, nil},
+	}
+	for _, tt := range tests {
+		res := alice.do("PATCH", "/content/"+id, tt.body, "Content-Type", tt.contentType)
+		if res.status != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, res.status, tt.status, res.body)
+			continue
+		}
+		if tt.want == nil {
+			continue
+		}
+		var content models.Content
+		res.decode(&content)
+		if !tt.want(content) {
+			t.Errorf("%s: patched into %+v", tt.name, content)
+		}
+	}
+
+	var contents contentPage
+	alice.do("GET", "/content", nil).expect(http.StatusOK).decode(&contents)
+	if names := contents.names(); !slices.Equal(names, []string{"renamed"}) {
+		t.Errorf("failed patches changed the content: %v", names)
+	}
+	bob.do("PATCH", "/content/"+id, `{"name":"stolen"}`, "Content-Type", merge).expect(http.StatusNotFound)
+	admin.do("PATCH", "/content/"+id, `{"name":"moderated"}`, "Content-Type", merge).expect(http.StatusOK)
+}
+
+func TestClearStacks(t *testing.T) {
+	s := store.NewMemoryStore()
+	s.Stacks = mongoLikeStacks{s.Stacks}
+	ts := startTestServer(t, testConfig(), io.Discard, s, health.NewChecker())
+	admin := ts.registerAs("admin", models.RoleAdmin)
+	alice := ts.register("alice")
+	admin.do("POST", "/stacks", map[string]string{"name": "go", "color": "#000000"}).expect(http.StatusCreated)
+	id := alice.createContent("first", "go")
+	objectID, _ := primitive.ObjectIDFromHex(id)
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+	}{
+		{"a merge patch of a null stack", "PATCH", "application/merge-patch+json", `{"stack":null}`},
+		{"a JSON patch removing the stack", "PATCH", "application/json-patch+json", `[{"op":"remove","path":"/stack"}]`},
+		{"a PUT without stack", "PUT", "application/json", `{"name":"first","url":"https://example.com/first"}`},
+	}
+	for _, tt := range tests {
+		alice.do("PATCH", "/content/"+id, `{"stack":["go"]}`, "Content-Type", "application/merge-patch+json").expect(http.StatusOK)
+		if res := alice.do(tt.method, "/content/"+id, tt.body, "Content-Type", tt.contentType); res.status != http.StatusOK {
+			t.Errorf("%s: status %d: %s", tt.name, res.status, res.body)
+			continue
+		}
+		content, err := s.Contents.GetContent(context.Background(), objectID)
+		if err != nil || len(content.Stack) != 0 {
+			t.Errorf("%s: left the stack %v: %v", tt.name, content.Stack, err)
+		}
+	}
+}
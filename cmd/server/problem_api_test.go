@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestProblemDocuments(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+	id := alice.createContent("first")
+
+	tests := []struct {
+		name   string
+		client *testClient
+		method string
+		path   string
+		body   interface{}
+		status int
+		code   string
+	}{
+		{"an unknown route", alice, "GET", "/nowhere", nil, http.StatusNotFound, "not_found"},
+		{"a method the route does not accept", alice, "DELETE", "/contents", nil, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"no credentials", ts.anonymous(), "GET", "/content", nil, http.StatusUnauthorized, "unauthorized"},
+		{"an invalid token", ts.anonymous(), "GET", "/content", nil, http.StatusUnauthorized, "invalid_token"},
+		{"a missing content", alice, "DELETE", "/content/000000000000000000000000", nil, http.StatusNotFound, "not_found"},
+		{"a content of another user", bob, "DELETE", "/content/" + id, nil, http.StatusNotFound, "not_found"},
+		{"an invalid ID", alice, "DELETE", "/content/42", nil, http.StatusBadRequest, "bad_request"},
+		{"a role without the permission", alice, "POST", "/stacks", map[string]string{"name": "Go", "color": "#000"}, http.StatusForbidden, "forbidden"},
+		{"an invalid cursor", alice, "GET", "/contents?cursor=garbage", nil, http.StatusBadRequest, "invalid_query"},
+	}
+	for _, tt := range tests {
+		headers := []string{"X-Request-ID", "req-" + tt.code}
+		if tt.code == "invalid_token" {
+			headers = append(headers, "Authorization", "Bearer garbage")
+		}
+		res := tt.client.do(tt.method, tt.path, tt.body, headers...)
+		if res.status != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, res.status, tt.status, res.body)
+			continue
+		}
+		if ct := res.header.Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("%s: Content-Type %q, want a problem document", tt.name, ct)
+		}
+		var document struct {
+			Title     string `json:"title"`
+			Status    int    `json:"status"`
+			Code      string `json:"code"`
+			Instance  string `json:"instance"`
+			RequestID string `json:"request_id"`
+		}
+		res.decode(&document)
+		if document.Status != tt.status || document.Code != tt.code || document.Title != http.StatusText(tt.status) {
+			t.Errorf("%s: sent %+v, want %d %s", tt.name, document, tt.status, tt.code)
+		}
+		if document.RequestID != "req-"+tt.code || res.header.Get("X-Request-ID") != document.RequestID {
+			t.Errorf("%s: request ID %q in the document, %q in the header", tt.name, document.RequestID, res.header.Get("X-Request-ID"))
+		}
+	}
+
+	// Successes answer JSON documents too
+	for _, res := range []*testResponse{
+		alice.do("PUT", "/content/"+id, map[string]interface{}{"name": "edited", "url": "https://example.com", "stack": []string{}}),
+		alice.do("DELETE", "/content/"+id, nil),
+	} {
+		res.expect(http.StatusOK)
+		var body map[string]string
+		if res.header.Get("Content-Type") != "application/json" || json.Unmarshal(res.body, &body) != nil || body["message"] == "" {
+			t.Errorf("%s answered %s %s", res.request, res.header.Get("Content-Type"), res.body)
+		}
+	}
+}
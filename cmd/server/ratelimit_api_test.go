@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"cms-server/internal/config"
+)
+
+func TestRateLimits(t *testing.T) {
+	ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.Server.TrustedProxies = []string{"127.0.0.0/8"}
+		cfg.RateLimit.Auth = config.Rate{Requests: 4, Per: time.Minute}
+		cfg.RateLimit.Write = config.Rate{Requests: 3, Per: time.Minute}
+		cfg.RateLimit.LockoutAttempts = 0
+	})
+	// Registering and logging in take the 4 auth tokens of 127.0.0.1
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+
+	type limited struct {
+		remaining  string
+		retryAfter bool
+	}
+	check := func(res *testResponse, status int, want limited) {
+		t.Helper()
+		if res.status != status {
+			t.Errorf("%s: status %d, want %d: %s", res.request, res.status, status, res.body)
+			return
+		}
+		if got := res.header.Get("RateLimit-Remaining"); got != want.remaining {
+			t.Errorf("%s: RateLimit-Remaining %q, want %q", res.request, got, want.remaining)
+		}
+		retryAfter, err := strconv.Atoi(res.header.Get("Retry-After"))
+		if want.retryAfter != (err == nil) || want.retryAfter && (retryAfter < 1 || retryAfter > 20) {
+			t.Errorf("%s: Retry-After %q", res.request, res.header.Get("Retry-After"))
+		}
+		if status == http.StatusTooManyRequests && res.problemCode() != "rate_limited" {
+			t.Errorf("%s: code %s, want rate_limited", res.request, res.problemCode())
+		}
+	}
+
+	// Each address has its own auth bucket
+	login := func(ip string) *testResponse {
+		return ts.anonymous().do("POST", "/login", map[string]string{"username": "alice", "password": "wrong"}, "X-Forwarded-For", ip)
+	}
+	check(ts.anonymous().do("POST", "/login", map[string]string{"username": "alice", "password": "wrong"}), http.StatusTooManyRequests, limited{"0", true})
+	for i := 3; i >= 0; i-- {
+		check(login("203.0.113.1"), http.StatusUnauthorized, limited{strconv.Itoa(i), false})
+	}
+	res := login("203.0.113.1")
+	check(res, http.StatusTooManyRequests, limited{"0", true})
+	// The bucket started refilling when registering took its first token
+	reset, err := strconv.Atoi(res.header.Get("RateLimit-Reset"))
+	if res.header.Get("RateLimit-Limit") != "4" || res.header.Get("RateLimit-Policy") != "4;w=60" || err != nil || reset < 1 || reset > 60 {
+		t.Errorf("answered the limits %v", res.header)
+	}
+	check(login("203.0.113.2"), http.StatusUnauthorized, limited{"3", false})
+
+	// Writes draw from the bucket of the address and of the user
+	write := func(c *testClient, ip string) *testResponse {
+		return c.do("POST", "/content", map[string]interface{}{"name": "x", "url": "https://example.com", "stack": []string{}}, "X-Forwarded-For", ip)
+	}
+	for i := 2; i >= 0; i-- {
+		check(write(alice, "198.51.100.1"), http.StatusCreated, limited{strconv.Itoa(i), false})
+	}
+	check(write(alice, "198.51.100.1"), http.StatusTooManyRequests, limited{"0", true})
+	// bob shares the address of alice
+	check(write(bob, "198.51.100.1"), http.StatusTooManyRequests, limited{"0", true})
+	// and was not charged for it elsewhere
+	check(write(bob, "198.51.100.2"), http.StatusCreated, limited{"2", false})
+	// alice is out of tokens wherever she writes from
+	check(write(alice, "198.51.100.3"), http.StatusTooManyRequests, limited{"0", true})
+
+	// Reads are not limited
+	for i := 0; i < 10; i++ {
+		if res := alice.do("GET", "/contents", nil, "X-Forwarded-For", "198.51.100.1"); res.status != http.StatusOK || res.header.Get("RateLimit-Limit") != "" {
+			t.Fatalf("read %d: status %d, RateLimit-Limit %q", i, res.status, res.header.Get("RateLimit-Limit"))
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.RateLimit.LockoutAttempts = 2
+		cfg.RateLimit.LockoutDelay = time.Minute
+		cfg.RateLimit.LockoutMax = time.Hour
+	})
+	ts.register("alice")
+	ts.register("bob")
+
+	login := func(username, password string) *testResponse {
+		return ts.anonymous().do("POST", "/login", map[string]string{"username": username, "password": password})
+	}
+	login("alice", "wrong").expect(http.StatusUnauthorized)
+	login("Alice", "wrong").expect(http.StatusUnauthorized)
+
+	// Even the right password is refused while the username is locked
+	for _, username := range []string{"alice", "ALICE"} {
+		res := login(username, testPassword).expect(http.StatusTooManyRequests)
+		if res.problemCode() != "login_locked" || res.header.Get("Retry-After") != "60" {
+			t.Errorf("logging in as %s while locked: %s, Retry-After %q", username, res.problemCode(), res.header.Get("Retry-After"))
+		}
+	}
+	login("bob", testPassword).expect(http.StatusOK)
+
+	// A success forgets the failures
+	login("bob", "wrong").expect(http.StatusUnauthorized)
+	login("bob", testPassword).expect(http.StatusOK)
+	login("bob", "wrong").expect(http.StatusUnauthorized)
+	login("bob", testPassword).expect(http.StatusOK)
+}
+
+func TestLoginDoesNotTellUsernames(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("alice")
+
+	// login returns the answer of the fastest of a few logins and its time
+	login := func(username string) (map[string]interface{}, time.Duration) {
+		var fastest time.Duration
+		var answer map[string]interface{}
+		for i := 0; i < 3; i++ {
+			start := time.Now()
+			res := ts.anonymous().do("POST", "/login", map[string]string{"username": username, "password": "wrong"}).expect(http.StatusUnauthorized)
+			if took := time.Since(start); i == 0 || took < fastest {
+				fastest = took
+			}
+			answer = nil
+			res.decode(&answer)
+			delete(answer, "request_id")
+		}
+		return answer, fastest
+	}
+	known, knownTook := login("alice")
+	unknown, unknownTook := login("mallory")
+	if !reflect.DeepEqual(known, unknown) {
+		t.Errorf("a wrong password answered %v, an unknown username %v", known, unknown)
+	}
+	// Both check a bcrypt hash
+	if unknownTook < knownTook/3 {
+		t.Errorf("an unknown username took %s, a wrong password %s", unknownTook, knownTook)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"cms-server/internal/config"
+	"cms-server/internal/database"
+	"cms-server/internal/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recountPageSize is how many contents "reactions recount" loads at once
+const recountPageSize = 100
+
+// reactionsCommand runs "reactions recount [content-id]", which rebuilds the
+// reaction counters of one content, or of every content, from the reactions,
+// and returns the exit code
+func reactionsCommand(cfg *config.Config, args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: server reactions recount [content-id]")
+		return 2
+	}
+	if len(args) == 0 || args[0] != "recount" || len(args) > 2 {
+		return usage()
+	}
+
+	if cfg.Store.Backend == config.MemoryBackend {
+		fmt.Fprintln(os.Stderr, "reactions: the in-memory store keeps its counters exact, unset STORE_BACKEND")
+		return 1
+	}
+
+	db := connectMongo(cfg.Mongo)
+	defer database.Disconnect(context.Background(), db)
+	s := store.NewMongoStore(db)
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	if len(args) == 2 {
+		id, err := primitive.ObjectIDFromHex(args[1])
+		if err != nil {
+			return usage()
+		}
+		if err := s.Reactions.RecountReactions(ctx, id); err != nil {
+			log.Print(err)
+			return 1
+		}
+		return 0
+	}
+
+	opts := store.ListOptions{Limit: recountPageSize, Sort: store.SortOldest}
+	recounted := 0
+	for {
+		page, err := s.Contents.FindContents(ctx, store.ContentFilter{IncludeHidden: true}, opts)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		for _, content := range page.Items {
+			if err := s.Reactions.RecountReactions(ctx, content.ID); err != nil {
+				log.Printf("Could not recount the reactions of %s: %v", content.ID.Hex(), err)
+				return 1
+			}
+			recounted++
+		}
+		if !page.HasMore {
+			break
+		}
+		opts.After = &store.Cursor{ID: page.Items[len(page.Items)-1].ID}
+	}
+	log.Printf("Recounted the reactions of %d contents", recounted)
+	return 0
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"testing"
+
+	"cms-server/internal/models"
+)
+
+func TestReactions(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.registerAs("admin", models.RoleAdmin)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+
+	id := alice.createContent("first")
+	hidden := alice.createContent("hidden")
+	admin.do("POST", "/content/"+hidden+"/hide", map[string]string{"reason": "spam"}).expect(http.StatusOK)
+
+	type summary struct {
+		Reactions      map[string]int64 `json:"reactions"`
+		ViewerReaction string           `json:"viewer_reaction"`
+	}
+	tests := []struct {
+		name   string
+		client *testClient
+		method string
+		body   interface{}
+		want   summary
+	}{
+		{"a first reaction", bob, "POST", map[string]string{"type": "like"}, summary{map[string]int64{"like": 1}, "like"}},
+		{"the same reaction again", bob, "POST", map[string]string{"type": "like"}, summary{map[string]int64{"like": 1}, "like"}},
+		{"another user reacts", alice, "POST", map[string]string{"type": "like"}, summary{map[string]int64{"like": 2}, "like"}},
+		{"another type replaces it", bob, "POST", map[string]string{"type": "love"}, summary{map[string]int64{"like": 1, "love": 1}, "love"}},
+		{"unreacting", bob, "DELETE", nil, summary{map[string]int64{"like": 1}, ""}},
+		{"unreacting without a reaction", bob, "DELETE", nil, summary{map[string]int64{"like": 1}, ""}},
+		{"the last reaction goes", alice, "DELETE", nil, summary{map[string]int64{}, ""}},
+	}
+	for _, tt := range tests {
+		var got summary
+		tt.client.do(tt.method, "/content/"+id+"/reactions", tt.body).expect(http.StatusOK).decode(&got)
+		if !maps.Equal(got.Reactions, tt.want.Reactions) || got.ViewerReaction != tt.want.ViewerReaction {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	if code := bob.do("POST", "/content/"+id+"/reactions", map[string]string{"type": "angry"}).
+		expect(http.StatusUnprocessableEntity).problemCode(); code != "validation_failed" {
+		t.Errorf("an unknown type: code %q, want validation_failed", code)
+	}
+	bob.do("POST", "/content/"+hidden+"/reactions", map[string]string{"type": "like"}).expect(http.StatusNotFound)
+	ts.anonymous().do("POST", "/content/"+id+"/reactions", map[string]string{"type": "like"}).expect(http.StatusUnauthorized)
+
+	// Listings carry the counters, and the reaction of the caller
+	bob.do("POST", "/content/"+id+"/reactions", map[string]string{"type": "insightful"}).expect(http.StatusOK)
+	var page contentPage
+	bob.do("GET", "/contents", nil).expect(http.StatusOK).decode(&page)
+	if len(page.Items) != 1 || page.Items[0].ViewerReaction != "insightful" || page.Items[0].Reactions["insightful"] != 1 {
+		t.Errorf("GET /contents as the reacting user listed %+v", page.Items)
+	}
+	var anonymous contentPage
+	ts.anonymous().do("GET", "/contents", nil).expect(http.StatusOK).decode(&anonymous)
+	if len(anonymous.Items) != 1 || anonymous.Items[0].ViewerReaction != "" {
+		t.Errorf("GET /contents without a token listed %+v", anonymous.Items)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"cms-server/internal/config"
+	"cms-server/internal/models"
+)
+
+func TestRoles(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.registerAs("admin", models.RoleAdmin)
+	moderator := ts.registerAs("moderator", models.RoleModerator)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+
+	id := alice.createContent("first")
+	content := map[string]interface{}{"name": "edited", "url": "https://example.com", "stack": []string{}}
+	tests := []struct {
+		name   string
+		client *testClient
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"a user cannot create stacks", alice, "POST", "/stacks", map[string]string{"name": "Go", "color": "#00ADD8"}, http.StatusForbidden},
+		{"a moderator cannot create stacks", moderator, "POST", "/stacks", map[string]string{"name": "Go", "color": "#00ADD8"}, http.StatusForbidden},
+		{"an admin creates stacks", admin, "POST", "/stacks", map[string]string{"name": "Go", "color": "#00ADD8"}, http.StatusCreated},
+		{"a user cannot hide contents", bob, "POST", "/content/" + id + "/hide", map[string]string{"reason": "spam"}, http.StatusForbidden},
+		{"a moderator cannot edit the contents of others", moderator, "PUT", "/content/" + id, content, http.StatusNotFound},
+		{"a moderator hides contents", moderator, "POST", "/content/" + id + "/hide", map[string]string{"reason": "spam"}, http.StatusOK},
+		{"an admin edits the contents of others", admin, "PUT", "/content/" + id, content, http.StatusOK},
+		{"a moderator cannot change roles", moderator, "PUT", "/users/" + bob.id + "/role", map[string]string{"role": "admin"}, http.StatusForbidden},
+		{"an admin cannot change its own role", admin, "PUT", "/users/" + admin.id + "/role", map[string]string{"role": "user"}, http.StatusBadRequest},
+		{"an unknown role", admin, "PUT", "/users/" + bob.id + "/role", map[string]string{"role": "owner"}, http.StatusUnprocessableEntity},
+		{"an admin changes roles", admin, "PUT", "/users/" + bob.id + "/role", map[string]string{"role": "moderator"}, http.StatusOK},
+		{"a role change signs the user out", bob, "DELETE", "/content/" + id + "/hide", nil, http.StatusUnauthorized},
+		{"anonymous", ts.anonymous(), "POST", "/stacks", map[string]string{"name": "Rust", "color": "#000000"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		res := tt.client.do(tt.method, tt.path, tt.body)
+		if res.status != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, res.status, tt.status, res.body)
+		}
+	}
+
+	bob.token = ts.login("bob").AccessToken
+	bob.do("DELETE", "/content/"+id+"/hide", nil).expect(http.StatusOK)
+}
+
+func TestDemotedAdmin(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.registerAs("admin", models.RoleAdmin)
+	demoted := ts.registerAs("demoted", models.RoleAdmin)
+
+	demoted.do("POST", "/stacks", map[string]string{"name": "Go", "color": "#00ADD8"}).expect(http.StatusCreated)
+	var page struct {
+		Items []models.Stack `json:"items"`
+	}
+	ts.anonymous().do("GET", "/stacks", nil).expect(http.StatusOK).decode(&page)
+	if len(page.Items) != 1 {
+		t.Fatalf("listed %d stacks, want 1", len(page.Items))
+	}
+	path := "/stacks/" + page.Items[0].ID.Hex()
+	stack := map[string]string{"name": "Golang", "color": "#00ADD8"}
+
+	admin.do("PUT", "/users/"+demoted.id+"/role", map[string]string{"role": "user"}).expect(http.StatusOK)
+
+	// The token issued while an admin no longer works, nor does refreshing it
+	demoted.do("PUT", path, stack).expect(http.StatusUnauthorized)
+	demoted.token = ts.login("demoted").AccessToken
+	demoted.do("PUT", path, stack).expect(http.StatusForbidden)
+	// The admin is still signed in
+	admin.do("PUT", path, stack).expect(http.StatusOK)
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	ts := newTestServer(t, func(cfg *config.Config) { cfg.Auth.BootstrapAdmin = "root" })
+	ctx := context.Background()
+	role := func(username string) string {
+		t.Helper()
+		user, err := ts.store.Users.GetUserByUsername(ctx, username)
+		if err != nil {
+			t.Fatalf("GetUserByUsername: %v", err)
+		}
+		return user.EffectiveRole()
+	}
+
+	// Claiming the name of the bootstrap admin grants nothing
+	root := ts.register("root")
+	if got := role("root"); got != models.RoleUser {
+		t.Fatalf("registering as the bootstrap admin gave the role %q", got)
+	}
+	root.do("POST", "/stacks", map[string]string{"name": "Go", "color": "#00ADD8"}).expect(http.StatusForbidden)
+
+	// It is promoted at the next start, as long as there is no admin
+	bootstrapAdmin(ts.store, "root")
+	if got := role("root"); got != models.RoleAdmin {
+		t.Fatalf("the bootstrap admin has the role %q after a restart", got)
+	}
+	root.token = ts.login("root").AccessToken
+	root.do("POST", "/stacks", map[string]string{"name": "Go", "color": "#00ADD8"}).expect(http.StatusCreated)
+
+	ts.register("mallory")
+	bootstrapAdmin(ts.store, "mallory")
+	if got := role("mallory"); got != models.RoleUser {
+		t.Errorf("a second bootstrap admin was promoted to %q", got)
+	}
+}
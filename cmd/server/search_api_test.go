@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"cms-server/internal/models"
+)
+
+func TestSearch(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.registerAs("admin", models.RoleAdmin)
+	alice := ts.register("alice")
+
+	admin.do("POST", "/stacks", map[string]string{"name": "Go", "color": "#00ADD8"}).expect(http.StatusCreated)
+	server := alice.createContent("Web server", "Go")
+	alice.createContent("Go notes")
+	hidden := alice.createContent("Go secrets")
+	alice.createContent("Cooking")
+	admin.do("POST", "/content/"+hidden+"/hide", map[string]string{"reason": "spam"}).expect(http.StatusOK)
+
+	type hit struct {
+		Content    models.Content    `json:"content"`
+		Highlights map[string]string `json:"highlights"`
+	}
+	search := func(query string) []hit {
+		t.Helper()
+		var body struct {
+			Items []hit `json:"items"`
+		}
+		ts.anonymous().do("GET", "/search?"+url.Values{"q": {query}}.Encode(), nil).expect(http.StatusOK).decode(&body)
+		return body.Items
+	}
+	names := func(hits []hit) []string {
+		names := []string{}
+		for _, hit := range hits {
+			names = append(names, hit.Content.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// the name outweighs the stack, hidden contents never show
+		{"go", []string{"Go notes", "Web server"}},
+		{"serv*", []string{"Web server"}},
+		{`"web server"`, []string{"Web server"}},
+		{"go cooking", []string{}},
+	}
+	for _, tt := range tests {
+		if got := names(search(tt.query)); !slices.Equal(got, tt.want) {
+			t.Errorf("search %q found %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if hits := search("web"); len(hits) != 1 || hits[0].Highlights["name"] != "<mark>Web</mark> server" {
+		t.Errorf("search web highlighted %+v", hits)
+	}
+
+	// Edits are searchable at once
+	alice.do("PUT", "/content/"+server, map[string]interface{}{"name": "HTTP daemon", "url": "https://example.com", "stack": []string{"Go"}}).expect(http.StatusOK)
+	if got := names(search("daemon")); !slices.Equal(got, []string{"HTTP daemon"}) {
+		t.Errorf("search daemon found %v after the edit", got)
+	}
+	if got := names(search("server")); len(got) != 0 {
+		t.Errorf("search server found %v after the edit", got)
+	}
+
+	// The limit keeps the best matches, not the newest
+	admin.do("POST", "/stacks", map[string]string{"name": "Deployment", "color": "#000000"}).expect(http.StatusCreated)
+	alice.createContent("Deploy")
+	for _, name := range []string{"Blog", "Shop", "Wiki"} {
+		alice.createContent(name, "Deployment")
+	}
+	var body struct {
+		Items []hit `json:"items"`
+	}
+	ts.anonymous().do("GET", "/search?q=deploy*&limit=2", nil).expect(http.StatusOK).decode(&body)
+	if got := names(body.Items); len(got) != 2 || got[0] != "Deploy" {
+		t.Errorf("search deploy* with a limit of 2 found %v, want Deploy first", got)
+	}
+
+	for _, path := range []string{"/search", "/search?q=%22%22", "/search?q=go&limit=0"} {
+		if code := ts.anonymous().do("GET", path, nil).expect(http.StatusBadRequest).problemCode(); code != "invalid_query" {
+			t.Errorf("GET %s: code %q, want invalid_query", path, code)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"cms-server/internal/config"
+	"cms-server/internal/database"
+	"cms-server/internal/events"
+	"cms-server/internal/health"
+	"cms-server/internal/realtime"
+	"cms-server/internal/tlscert"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// certificateCheckInterval is how often the TLS files are checked for a
+// renewed certificate
+const certificateCheckInterval = time.Minute
+
+// newHTTPServer returns the server of handler, listening on the port of
+// cfg with its timeouts. Streams lift their own deadlines, so the write
+// timeout only bounds regular responses.
+func newHTTPServer(cfg config.Server, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Port),
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// lifecycle is what has to be stopped, in order, when the server shuts down
+type lifecycle struct {
+	config config.Server
+	server *http.Server
+	health *health.Checker
+	// db is the database of the mongo store, nil with the in-memory one
+	db  *mongo.Database
+	hub *realtime.Hub
+	bus *events.Bus
+	// traces flushes the spans still buffered
+	traces func(context.Context) error
+}
+
+// run serves until SIGINT or SIGTERM, then reports not ready for the
+// shutdown delay so the orchestrator stops routing traffic, and shuts down
+// within the shutdown timeout. TLS is enabled by a certificate and key
+// file; the certificate is reloaded when the files change or on SIGHUP.
+func (l *lifecycle) run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Streams end as soon as the shutdown starts, they would hold it up
+	l.server.RegisterOnShutdown(l.hub.Close)
+
+	serveErr := make(chan error, 1)
+	if l.config.TLSCertFile != "" {
+		certs, err := tlscert.NewReloader(l.config.TLSCertFile, l.config.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		go certs.Watch(ctx, certificateCheckInterval)
+		go reloadOnHangup(ctx, certs)
+
+		l.server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate}
+		log.Printf("Server is running on port %s with TLS", l.server.Addr[1:])
+		go func() { serveErr <- l.server.ListenAndServeTLS("", "") }()
+	} else {
+		log.Printf("Server is running on port %s", l.server.Addr[1:])
+		go func() { serveErr <- l.server.ListenAndServe() }()
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	// A second signal kills the process right away
+	stop()
+	l.health.SetShuttingDown()
+	if delay := l.config.ShutdownDelay; delay > 0 {
+		log.Printf("Shutting down in %s", delay)
+		time.Sleep(delay)
+	}
+	log.Println("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), l.config.ShutdownTimeout)
+	defer cancel()
+	return l.shutdown(shutdownCtx)
+}
+
+// shutdown stops accepting requests and closes the streams, waits for the
+// requests in flight and the WebSockets, delivers the queued events,
+// disconnects from MongoDB, then exports the last spans
+func (l *lifecycle) shutdown(ctx context.Context) error {
+	var errs []error
+
+	if err := l.server.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("draining requests: %w", err))
+	}
+	if err := l.hub.Wait(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("closing streams: %w", err))
+	}
+
+	busClosed := make(chan struct{})
+	go func() {
+		l.bus.Close()
+		close(busClosed)
+	}()
+	select {
+	case <-busClosed:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("delivering queued events: %w", ctx.Err()))
+	}
+
+	if err := database.Disconnect(ctx, l.db); err != nil {
+		errs = append(errs, fmt.Errorf("disconnecting from MongoDB: %w", err))
+	}
+	if err := l.traces(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("exporting spans: %w", err))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	log.Println("Server stopped")
+	return nil
+}
+
+// reloadOnHangup reloads the TLS certificate on every SIGHUP
+func reloadOnHangup(ctx context.Context, certs *tlscert.Reloader) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if err := certs.Reload(); err != nil {
+				log.Printf("Could not reload the TLS certificate: %v", err)
+				continue
+			}
+			log.Println("Reloaded the TLS certificate")
+		}
+	}
+}
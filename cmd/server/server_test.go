@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"cms-server/internal/health"
+	"cms-server/internal/logging"
+)
+
+func TestShutdown(t *testing.T) {
+	cfg := testConfig()
+	cfg.Server.ReadHeaderTimeout = 200 * time.Millisecond
+	cfg.Server.WriteTimeout = 300 * time.Millisecond
+
+	// Users sign up on a server without timeouts, hashing their passwords
+	// may take longer than the write timeout
+	users := newTestServer(t)
+	alice := users.register("alice")
+	bob := users.register("bob")
+
+	checker := health.NewChecker()
+	api, err := newApp(cfg, logging.New(io.Discard, cfg.Log), users.store, nil, checker)
+	if err != nil {
+		t.Fatalf("newApp: %v", err)
+	}
+	server := httptest.NewUnstartedServer(api.handler)
+	server.Config = newHTTPServer(cfg.Server, api.handler)
+	server.Start()
+	t.Cleanup(server.Close)
+	l := &lifecycle{
+		config: cfg.Server,
+		server: server.Config,
+		health: checker,
+		hub:    api.hub,
+		bus:    api.bus,
+		traces: func(context.Context) error { return nil },
+	}
+	server.Config.RegisterOnShutdown(api.hub.Close)
+
+	ts := &testServer{t: t, url: server.URL, store: users.store}
+	alice = &testClient{ts: ts, id: alice.id, token: alice.token}
+	bob = &testClient{ts: ts, id: bob.id, token: bob.token}
+	bob.do("POST", "/users/"+alice.id+"/follow", nil).expect(http.StatusCreated)
+
+	// Streams outlive the write timeout
+	events := bob.stream("")
+	time.Sleep(2 * cfg.Server.WriteTimeout)
+	alice.createContent("late")
+	if event := next(t, events); event.typ != "content" {
+		t.Errorf("got the event %+v after the write timeout, want the new content", event)
+	}
+
+	// Clients too slow to send their headers are dropped
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /healthz HTTP/1.1\r\n")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadAll(conn); errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Error("a connection sending half its headers was kept open")
+	}
+
+	// Shutting down ends the streams and stops serving
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := l.shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("the stream sent an event after the shutdown")
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("the stream is still open after the shutdown")
+	}
+	if res, err := http.Get(server.URL + "/healthz"); err == nil {
+		res.Body.Close()
+		t.Errorf("GET /healthz answered %d after the shutdown", res.StatusCode)
+	}
+}
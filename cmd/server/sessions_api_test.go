@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSessions(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+
+	// as returns a client of alice using accessToken
+	as := func(accessToken string) *testClient {
+		return &testClient{ts: ts, id: alice.id, token: accessToken}
+	}
+	sessions := func(client *testClient) []sessionItem {
+		t.Helper()
+		var body struct {
+			Items []sessionItem `json:"items"`
+		}
+		client.do("GET", "/sessions", nil).expect(http.StatusOK).decode(&body)
+		return body.Items
+	}
+	rejected := func(client *testClient, name string) {
+		t.Helper()
+		if code := client.do("GET", "/sessions", nil).expect(http.StatusUnauthorized).problemCode(); code != "invalid_token" {
+			t.Errorf("%s: code %q, want invalid_token", name, code)
+		}
+	}
+
+	laptop := ts.login("alice")
+	if got := sessions(alice); len(got) != 2 || got[0].Current == got[1].Current {
+		t.Fatalf("GET /sessions listed %+v, want two sessions, one current", got)
+	}
+
+	// Refresh tokens rotate, the access tokens of the session stay valid
+	var rotated tokenPair
+	ts.anonymous().do("POST", "/token/refresh", map[string]string{"refresh_token": laptop.RefreshToken}).
+		expect(http.StatusOK).decode(&rotated)
+	if rotated.RefreshToken == "" || rotated.RefreshToken == laptop.RefreshToken {
+		t.Fatalf("the refresh token was not rotated: %+v", rotated)
+	}
+	as(laptop.AccessToken).do("GET", "/sessions", nil).expect(http.StatusOK)
+	as(rotated.AccessToken).do("GET", "/sessions", nil).expect(http.StatusOK)
+
+	// Replaying a rotated token revokes the whole session
+	ts.anonymous().do("POST", "/token/refresh", map[string]string{"refresh_token": laptop.RefreshToken}).
+		expect(http.StatusUnauthorized)
+	rejected(as(rotated.AccessToken), "the access token of a replayed session")
+	ts.anonymous().do("POST", "/token/refresh", map[string]string{"refresh_token": rotated.RefreshToken}).
+		expect(http.StatusUnauthorized)
+	if got := sessions(alice); len(got) != 1 || !got[0].Current {
+		t.Fatalf("GET /sessions listed %+v after the replay, want the current session only", got)
+	}
+
+	// Users revoke their other sessions, one or all of them
+	phone := ts.login("alice")
+	tablet := ts.login("alice")
+	var phoneSession string
+	for _, session := range sessions(as(phone.AccessToken)) {
+		if session.Current {
+			phoneSession = session.ID
+		}
+	}
+	bob.do("DELETE", "/sessions/"+phoneSession, nil).expect(http.StatusNotFound)
+	alice.do("DELETE", "/sessions/"+phoneSession, nil).expect(http.StatusOK)
+	rejected(as(phone.AccessToken), "the access token of a deleted session")
+	alice.do("DELETE", "/sessions/"+phoneSession, nil).expect(http.StatusNotFound)
+
+	alice.do("DELETE", "/sessions", nil).expect(http.StatusOK)
+	rejected(as(tablet.AccessToken), "the access token of another session")
+	alice.do("GET", "/sessions", nil).expect(http.StatusOK)
+	bob.do("GET", "/sessions", nil).expect(http.StatusOK)
+
+	// Logging out revokes the session of the access token
+	alice.do("POST", "/logout", nil).expect(http.StatusOK)
+	rejected(alice, "the access token of a logged out session")
+}
+
+// sessionItem is a session listed by GET /sessions
+type sessionItem struct {
+	ID      string `json:"id"`
+	Current bool   `json:"current"`
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"cms-server/internal/models"
+)
+
+func TestStackChangesReachContents(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.registerAs("admin", models.RoleAdmin)
+	alice := ts.register("alice")
+
+	// listStacks returns the IDs of the stacks by name
+	listStacks := func() map[string]string {
+		t.Helper()
+		var page struct {
+			Items []models.Stack `json:"items"`
+		}
+		ts.anonymous().do("GET", "/stacks?limit=100", nil).expect(http.StatusOK).decode(&page)
+		ids := map[string]string{}
+		for _, stack := range page.Items {
+			ids[stack.Name] = stack.ID.Hex()
+		}
+		return ids
+	}
+	for _, name := range []string{"Go", "Rust", "Web"} {
+		admin.do("POST", "/stacks", map[string]string{"name": name, "color": "#000000"}).expect(http.StatusCreated)
+	}
+	stackIDs := listStacks()
+	alice.createContent("server", "Go", "Web")
+	alice.createContent("tool", "Go")
+	hidden := alice.createContent("engine", "Rust")
+	admin.do("POST", "/content/"+hidden+"/hide", map[string]string{"reason": "spam"}).expect(http.StatusOK)
+
+	// stacks describes the stacks of every content of alice, as the owner
+	// sees them, e.g. "server:Go#000000,Web#000000"
+	stacks := func() []string {
+		t.Helper()
+		var page contentPage
+		alice.do("GET", "/content?sort=name", nil).expect(http.StatusOK).decode(&page)
+		described := []string{}
+		for _, content := range page.Items {
+			names := []string{}
+			for _, stack := range content.Stack {
+				names = append(names, stack.Name+stack.Color)
+			}
+			described = append(described, content.Name+":"+strings.Join(names, ","))
+		}
+		return described
+	}
+	check := func(step string, want ...string) {
+		t.Helper()
+		if got := stacks(); !slices.Equal(got, want) {
+			t.Errorf("after %s, the contents have the stacks %q, want %q", step, got, want)
+		}
+	}
+
+	admin.do("PUT", "/stacks/"+stackIDs["Go"], map[string]string{"name": "Golang", "color": "#00ADD8"}).expect(http.StatusOK)
+	check("a rename", "engine:Rust#000000", "server:Golang#00ADD8,Web#000000", "tool:Golang#00ADD8")
+	admin.do("PATCH", "/stacks/"+stackIDs["Rust"], map[string]string{"color": "#DEA584"}, "Content-Type", "application/merge-patch+json").
+		expect(http.StatusOK)
+	check("a patch", "engine:Rust#DEA584", "server:Golang#00ADD8,Web#000000", "tool:Golang#00ADD8")
+
+	// The search index follows the contents
+	var found struct {
+		Items []struct {
+			Content models.Content `json:"content"`
+		} `json:"items"`
+	}
+	ts.anonymous().do("GET", "/search?q=golang", nil).expect(http.StatusOK).decode(&found)
+	if len(found.Items) != 2 {
+		t.Errorf("searching the new stack name found %d contents, want 2", len(found.Items))
+	}
+
+	// Deleting a stack in use is refused unless a policy says what to do
+	var blocked struct {
+		Code     string `json:"code"`
+		Contents int    `json:"contents"`
+	}
+	admin.do("DELETE", "/stacks/"+stackIDs["Rust"], nil).expect(http.StatusConflict).decode(&blocked)
+	if blocked.Code != "stack_in_use" || blocked.Contents != 1 {
+		t.Errorf("deleting a stack in use answered %+v", blocked)
+	}
+	admin.do("DELETE", "/stacks/"+stackIDs["Rust"]+"?policy=drop", nil).expect(http.StatusBadRequest)
+	admin.do("DELETE", "/stacks/"+stackIDs["Rust"]+"?policy=reassign&reassign_to=Rust", nil).expect(http.StatusBadRequest)
+	admin.do("DELETE", "/stacks/"+stackIDs["Rust"]+"?policy=reassign&reassign_to=Java", nil).expect(http.StatusBadRequest)
+
+	deleted := func(name, query string, updated int) {
+		t.Helper()
+		var body struct {
+			Updated int `json:"contents_updated"`
+		}
+		admin.do("DELETE", "/stacks/"+stackIDs[name]+query, nil).expect(http.StatusOK).decode(&body)
+		if body.Updated != updated {
+			t.Errorf("deleting %s updated %d contents, want %d", name, body.Updated, updated)
+		}
+	}
+	deleted("Go", "?policy=reassign&reassign_to="+stackIDs["Web"], 2)
+	check("a reassignment", "engine:Rust#DEA584", "server:Web#000000", "tool:Web#000000")
+	deleted("Rust", "?policy=cascade", 1)
+	check("a cascade", "engine:", "server:Web#000000", "tool:Web#000000")
+
+	// Unused stacks go whatever the policy
+	admin.do("POST", "/stacks", map[string]string{"name": "Unused", "color": "#000000"}).expect(http.StatusCreated)
+	admin.do("DELETE", "/stacks/"+listStacks()["Unused"], nil).expect(http.StatusOK)
+	if left := listStacks(); len(left) != 1 || left["Web"] == "" {
+		t.Errorf("GET /stacks listed %v after the deletions, want Web only", left)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"cms-server/internal/models"
+	"cms-server/internal/realtime"
+
+	"github.com/gorilla/websocket"
+)
+
+// streamEvent is one Server-Sent Event
+type streamEvent struct {
+	typ  string
+	data string
+}
+
+// stream opens GET /stream?query as the client and returns its events, until
+// the test ends
+func (c *testClient) stream(query string) <-chan streamEvent {
+	c.ts.t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	c.ts.t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.ts.url+"/stream?"+query, nil)
+	if err != nil {
+		c.ts.t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.ts.t.Fatalf("GET /stream: %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		c.ts.t.Fatalf("GET /stream: status %d", res.StatusCode)
+	}
+
+	events := make(chan streamEvent)
+	go func() {
+		defer res.Body.Close()
+		defer close(events)
+		var event streamEvent
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event.typ = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.data = strings.TrimPrefix(line, "data: ")
+			case line == "" && event.typ != "":
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+				event = streamEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+// next waits for the next event of the stream
+func next(t *testing.T, events <-chan streamEvent) streamEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("the stream ended")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event within 2s")
+	}
+	return streamEvent{}
+}
+
+func TestStream(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.registerAs("admin", models.RoleAdmin)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+
+	visible := alice.createContent("visible")
+	hidden := alice.createContent("hidden")
+	admin.do("POST", "/content/"+hidden+"/hide", map[string]string{"reason": "spam"}).expect(http.StatusOK)
+	bob.do("POST", "/users/"+alice.id+"/follow", nil).expect(http.StatusCreated)
+
+	ts.anonymous().do("GET", "/stream", nil).expect(http.StatusUnauthorized)
+	events := bob.stream("content=" + hidden + "," + visible + ",nope")
+
+	// Events are delivered in order: the counters of the hidden content
+	// would come first if bob watched it
+	admin.do("POST", "/content/"+hidden+"/reactions", map[string]string{"type": "like"}).expect(http.StatusOK)
+	alice.do("POST", "/content/"+visible+"/reactions", map[string]string{"type": "love"}).expect(http.StatusOK)
+	event := next(t, events)
+	var counts realtimeCounts
+	if err := json.Unmarshal([]byte(event.data), &counts); err != nil || event.typ != "counts" {
+		t.Fatalf("got the event %+v, want counts", event)
+	}
+	if counts.ContentID != visible || counts.Reactions["love"] != 1 {
+		t.Errorf("got the counts %+v, want those of the visible content", counts)
+	}
+
+	// New contents of followed users and notifications are pushed too
+	alice.createContent("second")
+	if event := next(t, events); event.typ != "content" || !strings.Contains(event.data, `"name":"second"`) {
+		t.Errorf("got the event %+v, want the new content", event)
+	}
+	alice.do("POST", "/users/"+bob.id+"/follow", nil).expect(http.StatusCreated)
+	if event := next(t, events); event.typ != "notification" || !strings.Contains(event.data, `"type":"follow"`) {
+		t.Errorf("got the event %+v, want the follow notification", event)
+	}
+}
+
+func TestWebSocketWatch(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.registerAs("admin", models.RoleAdmin)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+
+	visible := alice.createContent("visible")
+	hidden := alice.createContent("hidden")
+	admin.do("POST", "/content/"+hidden+"/hide", map[string]string{"reason": "spam"}).expect(http.StatusOK)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.url, "http")+"/ws?topics=notifications",
+		http.Header{"Authorization": {"Bearer " + bob.token}})
+	if err != nil {
+		t.Fatalf("dialing /ws: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(map[string]interface{}{"action": "watch", "content_ids": []string{hidden, visible}}); err != nil {
+		t.Fatalf("sending the watch command: %v", err)
+	}
+
+	type message struct {
+		Type string         `json:"type"`
+		Data realtimeCounts `json:"data"`
+	}
+	messages := make(chan message, 16)
+	go func() {
+		defer close(messages)
+		for {
+			var msg message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			messages <- msg
+		}
+	}()
+
+	// The command is applied in the background: react until counters come,
+	// and each user changes its reaction, so that every one is an event
+	reactions, reacted := []string{"like", "love"}, map[*testClient]int{}
+	react := func(client *testClient, id string) {
+		reacted[client]++
+		client.do("POST", "/content/"+id+"/reactions", map[string]string{"type": reactions[reacted[client]%2]}).expect(http.StatusOK)
+	}
+	for i := 0; ; i++ {
+		if i == 20 {
+			t.Fatal("no counters after the watch command")
+		}
+		react(alice, visible)
+		select {
+		case <-messages:
+		case <-time.After(100 * time.Millisecond):
+			continue
+		}
+		break
+	}
+
+	// Events are delivered in order: the counters of the hidden content
+	// would come first if bob watched it
+	react(admin, hidden)
+	react(alice, visible)
+	select {
+	case msg := <-messages:
+		if msg.Type != "counts" || msg.Data.ContentID != visible {
+			t.Errorf("got %+v, want the counters of the visible content %s", msg, visible)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no counters within 2s")
+	}
+}
+
+func TestStreamContentHiddenOnceWatched(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.registerAs("admin", models.RoleAdmin)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+
+	watched := alice.createContent("watched")
+	other := alice.createContent("other")
+	query := "topics=feed&content=" + watched + "," + other
+	streams := map[string]<-chan streamEvent{"alice": alice.stream(query), "bob": bob.stream(query), "admin": admin.stream(query)}
+	admin.do("POST", "/content/"+watched+"/hide", map[string]string{"reason": "spam"}).expect(http.StatusOK)
+
+	// Events are delivered in order: the counters of the hidden content
+	// come first to the ones who may still see it
+	admin.do("POST", "/content/"+watched+"/reactions", map[string]string{"type": "like"}).expect(http.StatusOK)
+	bob.do("POST", "/content/"+other+"/reactions", map[string]string{"type": "like"}).expect(http.StatusOK)
+	for name, want := range map[string]string{"alice": watched, "admin": watched, "bob": other} {
+		event := next(t, streams[name])
+		var counts realtimeCounts
+		if err := json.Unmarshal([]byte(event.data), &counts); err != nil || event.typ != "counts" || counts.ContentID != want {
+			t.Errorf("%s got the event %+v, want the counts of %s", name, event, want)
+		}
+	}
+}
+
+// realtimeCounts is the data of a counts message
+type realtimeCounts struct {
+	ContentID string           `json:"content_id"`
+	Reactions map[string]int64 `json:"reactions"`
+}
+
+func TestStreamLimits(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.register("alice")
+
+	ids := make([]string, realtime.MaxWatched+1)
+	for i := range ids {
+		content := models.Content{UserID: alice.id, Name: "content", Url: "https://example.com", Stack: []models.Stack{}}
+		if err := ts.store.Contents.CreateContent(context.Background(), &content); err != nil {
+			t.Fatalf("CreateContent: %v", err)
+		}
+		ids[i] = content.ID.Hex()
+	}
+
+	for _, query := range []string{"topics=feed,bogus", "content=" + strings.Join(ids, ",")} {
+		if res := alice.do("GET", "/stream?"+query, nil); res.status != http.StatusBadRequest || res.problemCode() != "invalid_query" {
+			t.Errorf("GET /stream?%.40s...: status %d, code %s", query, res.status, res.problemCode())
+		}
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.url, "http")+"/ws?topics=notifications",
+		http.Header{"Authorization": {"Bearer " + alice.token}})
+	if err != nil {
+		t.Fatalf("dialing /ws: %v", err)
+	}
+	defer conn.Close()
+	expectError := func(action string) {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var msg struct {
+			Type string                `json:"type"`
+			Data realtime.CommandError `json:"data"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("reading the error of %s: %v", action, err)
+		}
+		if msg.Type != "error" || msg.Data.Action != action {
+			t.Errorf("got %+v, want an error for %s", msg, action)
+		}
+	}
+	send := func(cmd map[string]interface{}) {
+		t.Helper()
+		if err := conn.WriteJSON(cmd); err != nil {
+			t.Fatalf("sending %v: %v", cmd["action"], err)
+		}
+	}
+
+	send(map[string]interface{}{"action": "subscribe", "topics": []string{"feed", "bogus"}})
+	expectError("subscribe")
+	// Commands are applied in order: only the one over the limit is refused
+	send(map[string]interface{}{"action": "watch", "content_ids": ids[:100]})
+	send(map[string]interface{}{"action": "watch", "content_ids": ids[100:200]})
+	send(map[string]interface{}{"action": "watch", "content_ids": ids[:1]})
+	send(map[string]interface{}{"action": "watch", "content_ids": ids[200:]})
+	send(map[string]interface{}{"action": "subscribe", "topics": []string{"bogus"}})
+	expectError("watch")
+	expectError("subscribe")
+}
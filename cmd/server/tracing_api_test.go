@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"cms-server/internal/health"
+	"cms-server/internal/store"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	recordSpans sync.Once
+	// spans records the spans of every test, which tell theirs apart by
+	// trace ID
+	spans = tracetest.NewSpanRecorder()
+)
+
+// traceSpans returns the ended spans of traceID, recording the spans of the
+// process from the first call
+func traceSpans(traceID trace.TraceID) []sdktrace.ReadOnlySpan {
+	recordSpans.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	var found []sdktrace.ReadOnlySpan
+	for _, span := range spans.Ended() {
+		if span.SpanContext().TraceID() == traceID {
+			found = append(found, span)
+		}
+	}
+	return found
+}
+
+func TestTracing(t *testing.T) {
+	// Record the spans before the server starts
+	traceSpans(trace.TraceID{})
+	cfg := testConfig()
+	cfg.Log.Level = "info"
+	logs := &logBuffer{}
+	ts := startTestServer(t, cfg, logs, store.Traced(store.NewMemoryStore()), health.NewChecker())
+	alice := ts.register("alice")
+	id := alice.createContent("first")
+	logs.requests(t)
+
+	// Every run continues a trace of its own
+	random := make([]byte, 24)
+	rand.Read(random)
+	callerTrace, callerSpan := hex.EncodeToString(random[:16]), hex.EncodeToString(random[16:])
+	res := ts.anonymous().do("GET", "/content/"+id+"/comments", nil, "traceparent", "00-"+callerTrace+"-"+callerSpan+"-01").
+		expect(http.StatusOK)
+
+	// The trace of the caller goes on, and back in the response
+	traceparent := strings.Split(res.header.Get("traceparent"), "-")
+	if len(traceparent) != 4 || traceparent[1] != callerTrace || traceparent[2] == callerSpan {
+		t.Fatalf("answered the traceparent %q, want a span of the trace of the caller", res.header.Get("traceparent"))
+	}
+	traceID, _ := trace.TraceIDFromHex(callerTrace)
+
+	var server sdktrace.ReadOnlySpan
+	var operations []string
+	eventually(t, func() bool {
+		server, operations = nil, nil
+		found := traceSpans(traceID)
+		for _, span := range found {
+			if span.SpanKind() == trace.SpanKindServer {
+				server = span
+			}
+		}
+		for _, span := range found {
+			if server != nil && span.Parent().SpanID() == server.SpanContext().SpanID() {
+				operations = append(operations, span.Name())
+			}
+		}
+		return server != nil && len(operations) == len(found)-1
+	})
+	if server.Name() != "GET /content/{id}/comments" || server.Parent().SpanID().String() != callerSpan || server.SpanContext().SpanID().String() != traceparent[2] {
+		t.Errorf("served in the span %s, child of %s", server.Name(), server.Parent().SpanID())
+	}
+	attributes := map[string]string{}
+	for _, attribute := range server.Attributes() {
+		attributes[string(attribute.Key)] = attribute.Value.Emit()
+	}
+	if attributes["http.route"] != "/content/{id}/comments" || attributes["http.response.status_code"] != "200" || attributes["request.id"] != res.header.Get("X-Request-ID") {
+		t.Errorf("the server span has the attributes %v", attributes)
+	}
+	// Store operations and the encoding of the response are timed apart
+	slices.Sort(operations)
+	if len(operations) < 2 || operations[0] != "encode response" || !strings.HasPrefix(operations[1], "store.") {
+		t.Errorf("the request has the child spans %v, want its store operations and the response encoding", operations)
+	}
+
+	// The request is logged with its trace
+	if lines := logs.requests(t); len(lines) != 1 || lines[0].TraceID != callerTrace {
+		t.Errorf("logged %+v, want the trace ID of the caller", lines)
+	}
+
+	// Requests without a traceparent start a trace
+	res = ts.anonymous().do("GET", "/nowhere", nil).expect(http.StatusNotFound)
+	traceparent = strings.Split(res.header.Get("traceparent"), "-")
+	if len(traceparent) != 4 || traceparent[1] == callerTrace {
+		t.Fatalf("answered the traceparent %q, want a new trace", res.header.Get("traceparent"))
+	}
+	traceID, _ = trace.TraceIDFromHex(traceparent[1])
+	eventually(t, func() bool { return len(traceSpans(traceID)) == 1 })
+	if span := traceSpans(traceID)[0]; span.Name() != "GET" || span.Parent().IsValid() {
+		t.Errorf("an unmatched request was served in the span %s, child of %v", span.Name(), span.Parent().SpanID())
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"cms-server/internal/models"
+)
+
+func TestUniqueness(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.registerAs("admin", models.RoleAdmin)
+	ts.register("alice")
+
+	tests := []struct {
+		name     string
+		username string
+		email    string
+		status   int
+	}{
+		{"a taken username", "alice", "other@example.com", http.StatusConflict},
+		{"a taken email", "other", "alice@example.com", http.StatusConflict},
+		{"free username and email", "other", "other@example.com", http.StatusOK},
+	}
+	for _, tt := range tests {
+		res := ts.anonymous().do("POST", "/register", map[string]string{
+			"username": tt.username,
+			"email":    tt.email,
+			"password": testPassword,
+		})
+		if res.status != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, res.status, tt.status, res.body)
+		} else if tt.status == http.StatusConflict && res.problemCode() != "conflict" {
+			t.Errorf("%s: code %s, want conflict", tt.name, res.problemCode())
+		}
+	}
+
+	// Concurrent creations of a stack leave one of them
+	const attempts = 8
+	statuses := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- admin.do("POST", "/stacks", map[string]string{"name": "Go", "color": "#000000"}).status
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusCreated] != 1 || counts[http.StatusConflict] != attempts-1 {
+		t.Errorf("concurrent creations of a stack answered %v, want one 201 and %d 409", counts, attempts-1)
+	}
+
+	// Renaming a stack to a taken name conflicts too
+	admin.do("POST", "/stacks", map[string]string{"name": "Rust", "color": "#000000"}).expect(http.StatusCreated)
+	var stacks struct {
+		Items []models.Stack `json:"items"`
+	}
+	ts.anonymous().do("GET", "/stacks", nil).expect(http.StatusOK).decode(&stacks)
+	for _, stack := range stacks.Items {
+		if stack.Name == "Rust" {
+			admin.do("PUT", "/stacks/"+stack.ID.Hex(), map[string]string{"name": "Go", "color": "#000000"}).expect(http.StatusConflict)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cms-server/internal/models"
+)
+
+func TestRequestValidation(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.registerAs("admin", models.RoleAdmin)
+
+	type fieldError struct {
+		Field string `json:"field"`
+		Code  string `json:"code"`
+	}
+	type rejection struct {
+		Code   string       `json:"code"`
+		Fields []fieldError `json:"fields"`
+	}
+	tests := []struct {
+		name   string
+		client *testClient
+		path   string
+		body   interface{}
+		status int
+		want   rejection
+	}{
+		{"every invalid field is reported", ts.anonymous(), "/register",
+			map[string]string{"username": "a b", "email": "alice@localhost", "password": "password"},
+			http.StatusUnprocessableEntity, rejection{"validation_failed", []fieldError{{"username", "username"}, {"email", "email"}, {"password", "password"}}}},
+		{"missing fields", ts.anonymous(), "/register", map[string]string{},
+			http.StatusUnprocessableEntity, rejection{"validation_failed", []fieldError{{"username", "required"}, {"email", "required"}, {"password", "required"}}}},
+		{"an unknown field", ts.anonymous(), "/register",
+			map[string]string{"username": "alice", "email": "alice@example.com", "password": testPassword, "role": "admin"},
+			http.StatusBadRequest, rejection{"unknown_field", []fieldError{{"role", "unknown"}}}},
+		{"a wrong type", ts.anonymous(), "/login", map[string]interface{}{"username": 1, "password": "x"},
+			http.StatusBadRequest, rejection{"invalid_json", []fieldError{{"username", "type"}}}},
+		{"invalid JSON", ts.anonymous(), "/login", `{"username":`, http.StatusBadRequest, rejection{"invalid_json", nil}},
+		{"a URL scheme outside the allow-list", admin, "/content",
+			map[string]interface{}{"name": "x", "url": "javascript:alert(1)", "stack": []string{}},
+			http.StatusUnprocessableEntity, rejection{"validation_failed", []fieldError{{"url", "url"}}}},
+		{"duplicate and empty stacks", admin, "/content",
+			map[string]interface{}{"name": "x", "url": "https://example.com", "stack": []string{"go", "go", ""}},
+			http.StatusUnprocessableEntity, rejection{"validation_failed", []fieldError{{"stack", "unique"}}}},
+		{"an empty stack name", admin, "/content",
+			map[string]interface{}{"name": "x", "url": "https://example.com", "stack": []string{"go", ""}},
+			http.StatusUnprocessableEntity, rejection{"validation_failed", []fieldError{{"stack[1]", "required"}}}},
+		{"a stack color that is not hex", admin, "/stacks", map[string]string{"name": "Go", "color": "blue"},
+			http.StatusUnprocessableEntity, rejection{"validation_failed", []fieldError{{"color", "hexcolor"}}}},
+		{"a name too long", admin, "/stacks", map[string]string{"name": strings.Repeat("g", 51), "color": "#000"},
+			http.StatusUnprocessableEntity, rejection{"validation_failed", []fieldError{{"name", "max"}}}},
+		{"a body too large", admin, "/stacks", `{"name":"` + strings.Repeat("g", 1<<20) + `","color":"#000"}`,
+			http.StatusRequestEntityTooLarge, rejection{"body_too_large", nil}},
+	}
+	for _, tt := range tests {
+		res := tt.client.do("POST", tt.path, tt.body)
+		if res.status != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, res.status, tt.status, res.body)
+			continue
+		}
+		if ct := res.header.Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("%s: Content-Type %q, want a problem document", tt.name, ct)
+		}
+		var got rejection
+		res.decode(&got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: rejected with %+v, want %+v", tt.name, got, tt.want)
+		}
+		// The error envelope repeats the code and the fields
+		var envelope struct {
+			Error rejection `json:"error"`
+		}
+		res.decode(&envelope)
+		if len(envelope.Error.Fields) == 0 {
+			envelope.Error.Fields = nil
+		}
+		if !reflect.DeepEqual(envelope.Error, tt.want) {
+			t.Errorf("%s: the error envelope is %+v, want %+v", tt.name, envelope.Error, tt.want)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"cms-server/internal/config"
+	"cms-server/internal/models"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Supported signing algorithms
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// minSecretLength is the shortest HS256 secret accepted, in bytes
+const minSecretLength = 32
+
+// Key is a signing or verification key identified by its kid. Keys loaded
+// with only public material can verify tokens but not sign them.
+type Key struct {
+	ID        string
+	Algorithm string
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewHMACKey returns an HS256 key for secret
+func NewHMACKey(kid string, secret []byte) (Key, error) {
+	if len(secret) < minSecretLength {
+		return Key{}, fmt.Errorf("key %q: HS256 secrets must be at least %d bytes", kid, minSecretLength)
+	}
+	return Key{ID: kid, Algorithm: HS256, signKey: secret, verifyKey: secret}, nil
+}
+
+// GenerateEd25519Key returns a new random EdDSA key
+func GenerateEd25519Key(kid string) (Key, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{ID: kid, Algorithm: EdDSA, signKey: private, verifyKey: public}, nil
+}
+
+// CanSign reports whether the key holds private material
+func (k Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// KeySet signs access tokens with its current key and verifies them with any
+// of its keys, chosen by the kid header. The algorithm of a token must be the
+// one of its key, so a public key can never be used as an HMAC secret.
+type KeySet struct {
+	current string
+	keys    map[string]Key
+}
+
+// NewKeySet returns a KeySet signing with the key named current
+func NewKeySet(current string, keys ...Key) (*KeySet, error) {
+	set := &KeySet{current: current, keys: make(map[string]Key, len(keys))}
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("every key needs a kid")
+		}
+		if _, exists := set.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate kid %q", key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+
+	signing, ok := set.keys[current]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q is not in the key set", current)
+	}
+	if !signing.CanSign() {
+		return nil, fmt.Errorf("signing key %q has no private key", current)
+	}
+	return set, nil
+}
+
+// keyFile is the JSON layout of a key set file. Paths are relative to the
+// file. HS256 keys take a secret, RS256 and EdDSA keys a PEM private key,
+// or only a public key for retired keys that still verify tokens.
+type keyFile struct {
+	SigningKey string `json:"signing_key"`
+	Keys       []struct {
+		ID             string `json:"kid"`
+		Algorithm      string `json:"alg"`
+		Secret         string `json:"secret"`
+		SecretFile     string `json:"secret_file"`
+		PrivateKeyFile string `json:"private_key_file"`
+		PublicKeyFile  string `json:"public_key_file"`
+	} `json:"keys"`
+}
+
+// LoadKeySet reads a key set file
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	readFile := func(name string) ([]byte, error) {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		return os.ReadFile(name)
+	}
+
+	keys := make([]Key, 0, len(file.Keys))
+	for _, entry := range file.Keys {
+		var key Key
+		switch entry.Algorithm {
+		case HS256:
+			secret := []byte(entry.Secret)
+			if entry.SecretFile != "" {
+				if secret, err = readFile(entry.SecretFile); err != nil {
+					return nil, err
+				}
+				// Files written by echo end with a newline that the same
+				// secret set in the environment does not have
+				if secret = bytes.TrimSpace(secret); len(secret) == 0 {
+					return nil, fmt.Errorf("key %q: %s is empty", entry.ID, entry.SecretFile)
+				}
+			}
+			key, err = NewHMACKey(entry.ID, secret)
+		case RS256, EdDSA:
+			key, err = loadAsymmetricKey(entry.ID, entry.Algorithm, entry.PrivateKeyFile, entry.PublicKeyFile, readFile)
+		default:
+			err = fmt.Errorf("key %q: unsupported algorithm %q", entry.ID, entry.Algorithm)
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return NewKeySet(file.SigningKey, keys...)
+}
+
+// LoadKeys returns the signing keys of cfg: its key set file, a single
+// HS256 key from its secret, or a throwaway EdDSA key that only lives as
+// long as the process. Config validation only lets the in-memory store run
+// without a key, since its sessions do not outlive the process either.
+func LoadKeys(cfg config.Auth) (*KeySet, error) {
+	if cfg.KeysFile != "" {
+		return LoadKeySet(cfg.KeysFile)
+	}
+	if cfg.JWTSecret != "" {
+		key, err := NewHMACKey("default", []byte(cfg.JWTSecret))
+		if err != nil {
+			return nil, err
+		}
+		return NewKeySet(key.ID, key)
+	}
+
+	log.Println("No JWT_KEYS_FILE or JWT_SECRET set, signing tokens with an ephemeral key")
+	key, err := GenerateEd25519Key(fmt.Sprintf("ephemeral-%d", time.Now().Unix()))
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySet(key.ID, key)
+}
+
+// loadAsymmetricKey reads the PEM files of an RS256 or EdDSA key
+func loadAsymmetricKey(kid, alg, privateFile, publicFile string, readFile func(string) ([]byte, error)) (Key, error) {
+	key := Key{ID: kid, Algorithm: alg}
+	switch {
+	case privateFile != "":
+		data, err := readFile(privateFile)
+		if err != nil {
+			return Key{}, err
+		}
+		if alg == RS256 {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+			if err != nil {
+				return Key{}, fmt.Errorf("key %q: %w", kid, err)
+			}
+			key.signKey, key.verifyKey = private, &private.PublicKey
+		} else {
+			private, err := jwt.ParseEdPrivateKeyFromPEM(data)
+			if err != nil {
+				return Key{}, fmt.Errorf("key %q: %w", kid, err)
+			}
+			key.signKey, key.verifyKey = private, private.(ed25519.PrivateKey).Public()
+		}
+	case publicFile != "":
+		data, err := readFile(publicFile)
+		if err != nil {
+			return Key{}, err
+		}
+		if alg == RS256 {
+			key.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(data)
+		} else {
+			key.verifyKey, err = jwt.ParseEdPublicKeyFromPEM(data)
+		}
+		if err != nil {
+			return Key{}, fmt.Errorf("key %q: %w", kid, err)
+		}
+	default:
+		return Key{}, fmt.Errorf("key %q: private_key_file or public_key_file is required", kid)
+	}
+	return key, nil
+}
+
+// IssueAccessToken signs a short-lived token for the user of a session. The
+// role is embedded, so a role change applies from the next refresh.
+func (k *KeySet) IssueAccessToken(user models.User, sessionID string) (string, time.Time, error) {
+	now := time.Now()
+	expirationTime := now.Add(AccessTokenTTL)
+	claims := &Claims{
+		UserID:    user.ID.Hex(),
+		Username:  user.Username,
+		Role:      user.EffectiveRole(),
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+		},
+	}
+
+	key := k.keys[k.current]
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	tokenString, err := token.SignedString(key.signKey)
+	return tokenString, expirationTime, err
+}
+
+// ParseAccessToken verifies a token against the key named by its kid and
+// returns its claims
+func (k *KeySet) ParseAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := k.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method %s for kid %q", token.Method.Alg(), kid)
+		}
+		return key.verifyKey, nil
+	}, jwt.WithValidMethods([]string{HS256, RS256, EdDSA}))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return claims, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys of the set; HS256 secrets are never published
+func (k *KeySet) JWKS() []JWK {
+	keys := []JWK{}
+	for _, key := range k.keys {
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, JWK{
+				KeyType:   "RSA",
+				ID:        key.ID,
+				Algorithm: key.Algorithm,
+				Use:       "sig",
+				N:         base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, JWK{
+				KeyType:   "OKP",
+				ID:        key.ID,
+				Algorithm: key.Algorithm,
+				Use:       "sig",
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+	slices.SortFunc(keys, func(a, b JWK) int { return strings.Compare(a.ID, b.ID) })
+	return keys
+}
@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cms-server/internal/config"
+	"cms-server/internal/models"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testSecret = "a-test-secret-of-at-least-32-bytes"
+
+// writePEM writes block to name in dir and returns the PEM bytes
+func writePEM(t *testing.T, dir, name, typ string, der []byte) []byte {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// testKeyFile writes a key set file signing with an EdDSA key, with a retired
+// RS256 key left to verify older tokens and an HS256 key, and returns its
+// path and the PEM public key of the RS256 key
+func testKeyFile(t *testing.T) (string, []byte) {
+	t.Helper()
+	dir := t.TempDir()
+
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, "ed.pem", "PRIVATE KEY", der)
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err = x509.MarshalPKIXPublicKey(&rsaPrivate.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPublic := writePEM(t, dir, "rs.pub.pem", "PUBLIC KEY", der)
+
+	file := map[string]interface{}{
+		"signing_key": "ed-2",
+		"keys": []map[string]string{
+			{"kid": "ed-2", "alg": EdDSA, "private_key_file": "ed.pem"},
+			{"kid": "rs-1", "alg": RS256, "public_key_file": "rs.pub.pem"},
+			{"kid": "hs-1", "alg": HS256, "secret": testSecret},
+		},
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "keys.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path, rsaPublic
+}
+
+func testUser() models.User {
+	return models.User{ID: primitive.NewObjectID(), Username: "alice", Role: models.RoleUser}
+}
+
+// signed returns a token of claims signed by method with key, under kid
+func signed(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParseAccessToken(t *testing.T) {
+	path, rsaPublic := testKeyFile(t)
+	keys, err := LoadKeySet(path)
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	valid, _, err := keys.IssueAccessToken(testUser(), "session")
+	if err != nil {
+		t.Fatalf("IssueAccessToken: %v", err)
+	}
+
+	claims := func(expires time.Time) *Claims {
+		return &Claims{UserID: "someone", RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(expires)}}
+	}
+	later := time.Now().Add(time.Hour)
+	_, foreign, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"a token of the signing key", valid, true},
+		{"a token of another key of the set", signed(t, jwt.SigningMethodHS256, "hs-1", []byte(testSecret), claims(later)), true},
+		{"an expired token", signed(t, jwt.SigningMethodHS256, "hs-1", []byte(testSecret), claims(time.Now().Add(-time.Minute))), false},
+		{"an unknown kid", signed(t, jwt.SigningMethodHS256, "hs-2", []byte(testSecret), claims(later)), false},
+		{"no kid", signed(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(later)), false},
+		{"another key under a known kid", signed(t, jwt.SigningMethodEdDSA, "ed-2", foreign, claims(later)), false},
+		// the public key of an RS256 key must not verify HMAC signatures
+		{"an RS256 public key used as an HS256 secret", signed(t, jwt.SigningMethodHS256, "rs-1", rsaPublic, claims(later)), false},
+		{"an HS256 key used with another algorithm", signed(t, jwt.SigningMethodHS512, "hs-1", []byte(testSecret), claims(later)), false},
+		{"an unsigned token", signed(t, jwt.SigningMethodNone, "hs-1", jwt.UnsafeAllowNoneSignatureType, claims(later)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := keys.ParseAccessToken(tt.token)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ParseAccessToken: %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old, err := NewHMACKey("old", []byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := GenerateEd25519Key("next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := NewKeySet("old", old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := before.IssueAccessToken(testUser(), "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens of the previous key stay valid while it is in the set
+	after, err := NewKeySet("next", old, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := after.ParseAccessToken(token); err != nil {
+		t.Errorf("a token of the previous key: %v", err)
+	}
+	fresh, _, err := after.IssueAccessToken(testUser(), "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := before.ParseAccessToken(fresh); err == nil {
+		t.Error("a set without the new key accepted its token")
+	}
+
+	retired, err := NewKeySet("next", next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := retired.ParseAccessToken(token); err == nil {
+		t.Error("a token of a removed key was accepted")
+	}
+}
+
+func TestNewKeySet(t *testing.T) {
+	hmac, err := NewHMACKey("hs", []byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyOnly := Key{ID: "public", Algorithm: EdDSA, verifyKey: ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))}
+
+	tests := []struct {
+		name    string
+		current string
+		keys    []Key
+		ok      bool
+	}{
+		{"a signing key", "hs", []Key{hmac}, true},
+		{"a missing signing key", "other", []Key{hmac}, false},
+		{"a signing key without a private key", "public", []Key{hmac, verifyOnly}, false},
+		{"a duplicate kid", "hs", []Key{hmac, hmac}, false},
+		{"a key without a kid", "hs", []Key{hmac, {Algorithm: HS256}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeySet(tt.current, tt.keys...); (err == nil) != tt.ok {
+				t.Fatalf("NewKeySet: %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+
+	if _, err := NewHMACKey("short", []byte("too short")); err == nil {
+		t.Error("NewHMACKey accepted a short secret")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	path, _ := testKeyFile(t)
+	keys, err := LoadKeySet(path)
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+
+	jwks := keys.JWKS()
+	if len(jwks) != 2 {
+		t.Fatalf("JWKS published %+v, want the EdDSA and RS256 keys only", jwks)
+	}
+	ed, rs := jwks[0], jwks[1]
+	if ed.ID != "ed-2" || ed.KeyType != "OKP" || ed.Curve != "Ed25519" || ed.X == "" || ed.Use != "sig" {
+		t.Errorf("the EdDSA key is published as %+v", ed)
+	}
+	if rs.ID != "rs-1" || rs.KeyType != "RSA" || rs.Algorithm != RS256 || rs.N == "" || rs.E != "AQAB" {
+		t.Errorf("the RS256 key is published as %+v", rs)
+	}
+}
+
+func TestSecretFile(t *testing.T) {
+	dir := t.TempDir()
+	load := func(secret string) (*KeySet, error) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "secret"), []byte(secret), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		data := `{"signing_key": "default", "keys": [{"kid": "default", "alg": "HS256", "secret_file": "secret"}]}`
+		path := filepath.Join(dir, "keys.json")
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return LoadKeySet(path)
+	}
+
+	// The file written by echo signs the tokens of the secret set in the
+	// environment
+	fromFile, err := load(testSecret + "\n")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	fromEnv, err := LoadKeys(config.Auth{JWTSecret: testSecret})
+	if err != nil {
+		t.Fatalf("LoadKeys: %v", err)
+	}
+	token, _, err := fromFile.IssueAccessToken(testUser(), "session")
+	if err != nil {
+		t.Fatalf("IssueAccessToken: %v", err)
+	}
+	if _, err := fromEnv.ParseAccessToken(token); err != nil {
+		t.Errorf("a token signed with the secret file was refused: %v", err)
+	}
+
+	if _, err := load(" \n"); err == nil {
+		t.Error("LoadKeySet accepted an empty secret file")
+	}
+}
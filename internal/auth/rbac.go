@@ -0,0 +1,41 @@
+package auth
+
+import "cms-server/internal/models"
+
+// Permission is an action a role may be granted
+type Permission string
+
+const (
+	// ManageStacks allows creating, renaming and deleting stacks
+	ManageStacks Permission = "stacks:manage"
+	// ManageAnyContent allows editing and deleting the contents and comments of others
+	ManageAnyContent Permission = "content:manage_any"
+	// HideContent allows hiding contents from everyone but their owner
+	HideContent Permission = "content:hide"
+	// ManageRoles allows changing the role of users
+	ManageRoles Permission = "users:manage_roles"
+)
+
+// rolePermissions lists what each role may do beyond the actions every
+// user can take on their own resources
+var rolePermissions = map[string][]Permission{
+	models.RoleUser:      {},
+	models.RoleModerator: {HideContent},
+	models.RoleAdmin:     {ManageStacks, ManageAnyContent, HideContent, ManageRoles},
+}
+
+// ValidRole reports whether role is a known role
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Can reports whether role was granted permission
+func Can(role string, permission Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
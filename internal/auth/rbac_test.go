@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"testing"
+
+	"cms-server/internal/models"
+)
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		role       string
+		permission Permission
+		want       bool
+	}{
+		{models.RoleUser, HideContent, false},
+		{models.RoleUser, ManageStacks, false},
+		{models.RoleModerator, HideContent, true},
+		{models.RoleModerator, ManageAnyContent, false},
+		{models.RoleModerator, ManageRoles, false},
+		{models.RoleAdmin, ManageStacks, true},
+		{models.RoleAdmin, ManageAnyContent, true},
+		{models.RoleAdmin, HideContent, true},
+		{models.RoleAdmin, ManageRoles, true},
+		{"", HideContent, false},
+		{"owner", ManageRoles, false},
+	}
+	for _, tt := range tests {
+		if got := Can(tt.role, tt.permission); got != tt.want {
+			t.Errorf("Can(%q, %q) = %v, want %v", tt.role, tt.permission, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Package auth issues and verifies the access and refresh tokens of the API.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// AccessTokenTTL is the lifetime of an access token
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long an unused session stays valid
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+type Claims struct {
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// NewRefreshToken returns a random opaque refresh token and the hash under
+// which it is stored; the token itself is never persisted
+func NewRefreshToken() (token, hash string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(raw)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the stored form of a refresh token
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
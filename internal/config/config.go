@@ -0,0 +1,253 @@
+// Package config holds the settings of the server. They are read, from
+// lowest to highest precedence, from the defaults, an optional YAML or
+// TOML file, the .env file, the environment and the command-line flags:
+//
+//	server -config cms.yaml -port 9090
+//
+// Every setting has a key in the file, an environment variable and a flag
+// derived from the variable: MONGO_URI is mongo.uri in the file and
+// -mongo-uri on the command line.
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the whole configuration of the server
+type Config struct {
+	Server    Server    `yaml:"server" toml:"server"`
+	Store     Store     `yaml:"store" toml:"store"`
+	Mongo     Mongo     `yaml:"mongo" toml:"mongo"`
+	Auth      Auth      `yaml:"auth" toml:"auth"`
+	Feed      Feed      `yaml:"feed" toml:"feed"`
+	Reactions Reactions `yaml:"reactions" toml:"reactions"`
+	Log       Log       `yaml:"log" toml:"log"`
+	Tracing   Tracing   `yaml:"tracing" toml:"tracing"`
+	RateLimit RateLimit `yaml:"rate_limit" toml:"rate_limit"`
+}
+
+// Server configures the HTTP server
+type Server struct {
+	Port              int           `yaml:"port" toml:"port" env:"PORT" usage:"port to listen on"`
+	TrustedProxies    []string      `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES" usage:"CIDRs of the proxies whose X-Forwarded-For is trusted"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" usage:"time to read the request headers"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"HTTP_READ_TIMEOUT" usage:"time to read a whole request"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" usage:"time to write a response"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" usage:"time an idle keep-alive connection is kept"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" usage:"time the graceful shutdown may take"`
+	ShutdownDelay     time.Duration `yaml:"shutdown_delay" toml:"shutdown_delay" env:"SHUTDOWN_DELAY" usage:"time reported not ready before shutting down"`
+	TLSCertFile       string        `yaml:"tls_cert_file" toml:"tls_cert_file" env:"TLS_CERT_FILE" usage:"PEM certificate to serve HTTPS with"`
+	TLSKeyFile        string        `yaml:"tls_key_file" toml:"tls_key_file" env:"TLS_KEY_FILE" usage:"PEM private key of the certificate"`
+}
+
+// Store backends
+const (
+	MongoBackend  = "mongo"
+	MemoryBackend = "memory"
+)
+
+// Store selects where the data lives
+type Store struct {
+	Backend string `yaml:"backend" toml:"backend" env:"STORE_BACKEND" usage:"mongo, or memory for an in-process store"`
+}
+
+// Mongo configures the MongoDB connection
+type Mongo struct {
+	URI            URI           `yaml:"uri" toml:"uri" env:"MONGO_URI" usage:"MongoDB connection string"`
+	Database       string        `yaml:"database" toml:"database" env:"MONGO_DBNAME" usage:"MongoDB database name"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout" toml:"connect_timeout" env:"MONGO_CONNECT_TIMEOUT" usage:"time to keep retrying to reach MongoDB at startup"`
+}
+
+// Auth configures the access tokens
+type Auth struct {
+	KeysFile       string   `yaml:"keys_file" toml:"keys_file" env:"JWT_KEYS_FILE" usage:"JSON key set to sign and verify tokens with"`
+	JWTSecret      Secret   `yaml:"jwt_secret" toml:"jwt_secret" env:"JWT_SECRET" usage:"HS256 secret of at least 32 bytes, when there is no key set"`
+	TokenSources   []string `yaml:"token_sources" toml:"token_sources" env:"AUTH_TOKEN_SOURCES" usage:"where access tokens are read from, in order: header, cookie"`
+	BootstrapAdmin string   `yaml:"bootstrap_admin" toml:"bootstrap_admin" env:"BOOTSTRAP_ADMIN" usage:"username made the first admin"`
+}
+
+// Feed configures the home feeds
+type Feed struct {
+	Strategy          string `yaml:"strategy" toml:"strategy" env:"FEED_STRATEGY" usage:"hybrid, read or write: when home feeds are assembled"`
+	TimelineThreshold int    `yaml:"timeline_threshold" toml:"timeline_threshold" env:"FEED_TIMELINE_THRESHOLD" usage:"followed users from which an account gets a timeline, with the hybrid strategy"`
+}
+
+// Reactions configures the reactions to content
+type Reactions struct {
+	Types []string `yaml:"types" toml:"types" env:"REACTION_TYPES" usage:"reactions users can leave on content"`
+}
+
+// Log configures the logs
+type Log struct {
+	Level      string   `yaml:"level" toml:"level" env:"LOG_LEVEL" usage:"lowest level logged: debug, info, warn or error"`
+	SampleRate float64  `yaml:"sample_rate" toml:"sample_rate" env:"LOG_SAMPLE_RATE" usage:"share of successful requests logged, from 0 to 1"`
+	Redact     []string `yaml:"redact" toml:"redact" env:"LOG_REDACT" usage:"keys redacted in logs, besides passwords, tokens and cookies"`
+}
+
+// Trace exporters
+const (
+	NoExporter     = "none"
+	OTLPExporter   = "otlp"
+	StdoutExporter = "stdout"
+	FileExporter   = "file"
+)
+
+// Tracing configures the OpenTelemetry traces
+type Tracing struct {
+	Exporter     string  `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER" usage:"where spans go: none, otlp, stdout or file"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint" toml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT" usage:"OTLP/HTTP collector URL, such as http://localhost:4318"`
+	File         string  `yaml:"file" toml:"file" env:"TRACING_FILE" usage:"file the file exporter appends spans to"`
+	SampleRatio  float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" usage:"share of new traces recorded, from 0 to 1"`
+	ServiceName  string  `yaml:"service_name" toml:"service_name" env:"TRACING_SERVICE_NAME" usage:"service name reported with the spans"`
+}
+
+// Rate limit stores
+const (
+	MemoryLimiter = "memory"
+	MongoLimiter  = "mongo"
+)
+
+// RateLimit configures the request rate limits and the login lockout
+type RateLimit struct {
+	Store           string        `yaml:"store" toml:"store" env:"RATE_LIMIT_STORE" usage:"where limits are counted: memory, or mongo to share them between replicas"`
+	Auth            Rate          `yaml:"auth" toml:"auth" env:"RATE_LIMIT_AUTH" usage:"requests to register, log in and refresh tokens, per client"`
+	Write           Rate          `yaml:"write" toml:"write" env:"RATE_LIMIT_WRITE" usage:"requests changing data, per client"`
+	Read            Rate          `yaml:"read" toml:"read" env:"RATE_LIMIT_READ" usage:"requests reading data, per client"`
+	LockoutAttempts int           `yaml:"lockout_attempts" toml:"lockout_attempts" env:"LOGIN_LOCKOUT_ATTEMPTS" usage:"failed logins of a username before it is locked, 0 to never lock"`
+	LockoutDelay    time.Duration `yaml:"lockout_delay" toml:"lockout_delay" env:"LOGIN_LOCKOUT_DELAY" usage:"first lock of a username, doubled on every further failure"`
+	LockoutMax      time.Duration `yaml:"lockout_max" toml:"lockout_max" env:"LOGIN_LOCKOUT_MAX" usage:"longest lock of a username; failures older than this are forgotten"`
+}
+
+// Default returns the configuration used for anything left unset
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:              8080,
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Store: Store{Backend: MongoBackend},
+		Mongo: Mongo{ConnectTimeout: 2 * time.Minute},
+		Auth:  Auth{TokenSources: []string{"header", "cookie"}},
+		Feed:  Feed{Strategy: "hybrid", TimelineThreshold: 100},
+		Reactions: Reactions{
+			Types: []string{"like", "love", "insightful"},
+		},
+		Log: Log{Level: "info", SampleRate: 1},
+		Tracing: Tracing{
+			Exporter:    NoExporter,
+			SampleRatio: 1,
+			ServiceName: "cms-server",
+		},
+		RateLimit: RateLimit{
+			Store:           MemoryLimiter,
+			Auth:            Rate{Requests: 10, Per: time.Minute},
+			Write:           Rate{Requests: 60, Per: time.Minute},
+			Read:            Rate{Requests: 300, Per: time.Minute},
+			LockoutAttempts: 5,
+			LockoutDelay:    time.Minute,
+			LockoutMax:      time.Hour,
+		},
+	}
+}
+
+// String renders the configuration as YAML with its secrets redacted
+func (c Config) String() string {
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return err.Error()
+	}
+	return string(out)
+}
+
+// redacted replaces secrets when printed
+const redacted = "[redacted]"
+
+// Secret is a setting that is never printed
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// MarshalText keeps the secret out of YAML and JSON output
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// URI is a connection string whose password is never printed
+type URI string
+
+func (u URI) String() string {
+	parsed, err := url.Parse(string(u))
+	if err != nil {
+		// Unparsable, it may still hold a password
+		if u == "" {
+			return ""
+		}
+		return redacted
+	}
+	return parsed.Redacted()
+}
+
+// MarshalText keeps the password out of YAML and JSON output
+func (u URI) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// Rate is a number of requests allowed per period, written "10/1m". A
+// rate of 0 requests, written "0" or "off", allows any number.
+type Rate struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Unlimited reports a rate allowing any number of requests
+func (r Rate) Unlimited() bool {
+	return r.Requests == 0
+}
+
+func (r Rate) String() string {
+	if r.Unlimited() {
+		return "off"
+	}
+	return strconv.Itoa(r.Requests) + "/" + r.Per.String()
+}
+
+// MarshalText writes the rate as it is configured
+func (r Rate) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText parses "10/1m", or "0" or "off" for no limit
+func (r *Rate) UnmarshalText(text []byte) error {
+	raw := strings.TrimSpace(string(text))
+	if raw == "0" || raw == "off" {
+		*r = Rate{}
+		return nil
+	}
+
+	count, period, ok := strings.Cut(raw, "/")
+	requests, err := strconv.Atoi(count)
+	if !ok || err != nil || requests < 1 {
+		return fmt.Errorf("%q is not a rate such as 10/1m", raw)
+	}
+	per, err := time.ParseDuration(period)
+	if err != nil || per <= 0 {
+		return fmt.Errorf("%q is not a rate such as 10/1m", raw)
+	}
+	*r = Rate{Requests: requests, Per: per}
+	return nil
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// fileVariable names the configuration file when there is no -config flag
+const fileVariable = "CONFIG_FILE"
+
+// dotEnvFile is read from the working directory when it exists
+const dotEnvFile = ".env"
+
+// setting is one leaf of Config
+type setting struct {
+	key   string // dotted key of the file, such as server.port
+	env   string
+	usage string
+	value reflect.Value
+}
+
+// flag is the command-line flag of the setting
+func (s setting) flag() string {
+	return strings.ReplaceAll(strings.ToLower(s.env), "_", "-")
+}
+
+// settings lists the leaves of cfg, addressable so they can be set
+func settings(cfg *Config) []setting {
+	var list []setting
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			key := prefix + field.Tag.Get("yaml")
+			if field.Type.Kind() == reflect.Struct && !isText(v.Field(i)) {
+				walk(v.Field(i), key+".")
+				continue
+			}
+			list = append(list, setting{key: key, env: field.Tag.Get("env"), usage: field.Tag.Get("usage"), value: v.Field(i)})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+	return list
+}
+
+// isText reports the settings parsed by their UnmarshalText method
+func isText(v reflect.Value) bool {
+	_, ok := v.Addr().Interface().(encoding.TextUnmarshaler)
+	return ok
+}
+
+// Load reads the configuration for the command-line arguments args, which
+// exclude the program name, and validates it. It returns the arguments
+// left after the flags.
+func Load(args []string) (*Config, []string, error) {
+	cfg := Default()
+	list := settings(&cfg)
+
+	// Flags are parsed first to learn the file to read, but applied last
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	configFile := flags.String("config", "", "YAML or TOML configuration `file` (default $"+fileVariable+")")
+	fromFlags := map[string]string{}
+	for _, s := range list {
+		env := s.env
+		flags.Func(s.flag(), s.usage+" ($"+env+")", func(raw string) error {
+			fromFlags[env] = raw
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	dotEnv, err := godotenv.Read(dotEnvFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("%s: %w", dotEnvFile, err)
+	}
+
+	path := *configFile
+	if path == "" {
+		path = os.Getenv(fileVariable)
+	}
+	if path == "" {
+		path = dotEnv[fileVariable]
+	}
+	if path != "" {
+		if err := readFile(path, &cfg); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sources := []struct {
+		name   string
+		lookup func(string) (string, bool)
+	}{
+		{dotEnvFile, mapLookup(dotEnv)},
+		{"the environment", os.LookupEnv},
+		{"the command line", mapLookup(fromFlags)},
+	}
+	for _, source := range sources {
+		for _, s := range list {
+			// An empty value leaves the setting alone, like an unset one
+			raw, ok := source.lookup(s.env)
+			if !ok || strings.TrimSpace(raw) == "" {
+				continue
+			}
+			if err := set(s.value, raw); err != nil {
+				return nil, nil, fmt.Errorf("%s from %s: %w", s.env, source.name, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return &cfg, flags.Args(), nil
+}
+
+func mapLookup(values map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	}
+}
+
+// readFile decodes a YAML or TOML file, chosen by its extension, over cfg.
+// Unknown keys are rejected so that typos do not go unnoticed.
+func readFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("%s: configuration files must be .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// set parses raw into the setting v. Lists are comma separated.
+func set(v reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	if isText(v) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	}
+
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", raw)
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
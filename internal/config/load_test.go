@@ -0,0 +1,136 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// inTempDir runs the test from an empty directory, where Load looks for
+// .env, and clears the variables Load reads
+func inTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Chdir: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	t.Setenv(fileVariable, "")
+	cfg := Default()
+	for _, s := range settings(&cfg) {
+		t.Setenv(s.env, "")
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name   string
+		dotEnv string
+		env    string
+		args   []string
+		want   int
+	}{
+		{"the file over the defaults", "", "", nil, 1001},
+		{".env over the file", "PORT=1002", "", nil, 1002},
+		{"the environment over .env", "PORT=1002", "1003", nil, 1003},
+		{"flags over the environment", "PORT=1002", "1003", []string{"-port", "1004"}, 1004},
+		{"an empty variable leaves the setting alone", "PORT=", "", nil, 1001},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := inTempDir(t)
+			writeFile(t, "config.yaml", "server:\n  port: 1001\nstore:\n  backend: memory\n")
+			writeFile(t, ".env", "CONFIG_FILE="+filepath.Join(dir, "config.yaml")+"\n"+tt.dotEnv+"\n")
+			t.Setenv("PORT", tt.env)
+
+			cfg, args, err := Load(append(tt.args, "migrate", "status"))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Server.Port != tt.want {
+				t.Errorf("port %d, want %d", cfg.Server.Port, tt.want)
+			}
+			if strings.Join(args, " ") != "migrate status" {
+				t.Errorf("left the arguments %q", args)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string // name and content, separated by a newline
+		env   map[string]string
+		args  []string
+		check func(*Config) bool
+		err   string
+	}{
+		{"a TOML file", "config.toml\n[store]\nbackend = \"memory\"\n[rate_limit]\nauth = \"5/30s\"\n", nil, nil,
+			func(c *Config) bool { return c.RateLimit.Auth == Rate{Requests: 5, Per: 30 * time.Second} }, ""},
+		{"lists, durations and rates from the environment", "", map[string]string{
+			"STORE_BACKEND":          "memory",
+			"REACTION_TYPES":         " clap, ,boo ",
+			"SHUTDOWN_DELAY":         "5s",
+			"RATE_LIMIT_WRITE":       "off",
+			"TRACING_SAMPLE_RATIO":   "0.5",
+			"AUTH_TOKEN_SOURCES":     "header",
+			"LOGIN_LOCKOUT_ATTEMPTS": "3",
+		}, nil, func(c *Config) bool {
+			return strings.Join(c.Reactions.Types, ",") == "clap,boo" && c.Server.ShutdownDelay == 5*time.Second &&
+				c.RateLimit.Write.Unlimited() && c.Tracing.SampleRatio == 0.5 && len(c.Auth.TokenSources) == 1 && c.RateLimit.LockoutAttempts == 3
+		}, ""},
+		{"the file of the flag", "other.yml\nstore:\n  backend: memory\nlog:\n  level: debug\n", nil, []string{"-config", "other.yml"},
+			func(c *Config) bool { return c.Log.Level == "debug" }, ""},
+		{"an unknown key of a YAML file", "config.yaml\nserver:\n  prot: 80\n", nil, nil, nil, "field prot not found"},
+		{"an unknown key of a TOML file", "config.toml\n[server]\nprot = 80\n", nil, nil, nil, "unknown key server.prot"},
+		{"another file format", "config.json\n{}\n", nil, nil, nil, "must be .yaml, .yml or .toml"},
+		{"a value of the wrong type", "", map[string]string{"PORT": "http"}, nil, nil, `PORT from the environment: "http" is not a whole number`},
+		{"an invalid flag", "", nil, []string{"-http-read-timeout", "soon"}, nil, `HTTP_READ_TIMEOUT from the command line: "soon" is not a duration`},
+		{"an invalid rate", "", map[string]string{"RATE_LIMIT_READ": "10 per minute"}, nil, nil, "is not a rate such as 10/1m"},
+		{"an invalid configuration", "", nil, nil, nil, "mongo.uri (MONGO_URI) is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t)
+			if name, content, ok := strings.Cut(tt.file, "\n"); ok {
+				writeFile(t, name, content)
+				if tt.args == nil {
+					t.Setenv(fileVariable, name)
+				}
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, _, err := Load(tt.args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Load: %v, want an error mentioning %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("loaded %+v", cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// minSecretLength is the shortest HS256 secret accepted, in bytes
+const minSecretLength = 32
+
+// Validate reports every invalid setting at once, naming each by its file
+// key and its environment variable
+func (c *Config) Validate() error {
+	envs := map[string]string{}
+	for _, s := range settings(c) {
+		envs[s.key] = s.env
+	}
+	var errs []error
+	fail := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s (%s) %s", key, envs[key], fmt.Sprintf(format, args...)))
+	}
+	oneOf := func(key, value string, allowed ...string) {
+		if !slices.Contains(allowed, value) {
+			fail(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+		}
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		fail("server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	for key, d := range map[string]time.Duration{
+		"server.read_header_timeout": c.Server.ReadHeaderTimeout,
+		"server.read_timeout":        c.Server.ReadTimeout,
+		"server.write_timeout":       c.Server.WriteTimeout,
+		"server.idle_timeout":        c.Server.IdleTimeout,
+		"server.shutdown_delay":      c.Server.ShutdownDelay,
+	} {
+		if d < 0 {
+			fail(key, "must not be negative, got %s", d)
+		}
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		fail("server.shutdown_timeout", "must be positive, got %s", c.Server.ShutdownTimeout)
+	}
+	for _, cidr := range c.Server.TrustedProxies {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			fail("server.trusted_proxies", "must list CIDRs such as 10.0.0.0/8, got %q", cidr)
+		}
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		fail("server.tls_cert_file", "and server.tls_key_file (TLS_KEY_FILE) must be set together")
+	}
+
+	oneOf("store.backend", c.Store.Backend, MongoBackend, MemoryBackend)
+	if c.Store.Backend == MongoBackend {
+		if c.Mongo.URI == "" {
+			fail("mongo.uri", "is required by the mongo store")
+		} else if u, err := url.Parse(string(c.Mongo.URI)); err != nil || (u.Scheme != "mongodb" && u.Scheme != "mongodb+srv") {
+			fail("mongo.uri", "must be a mongodb:// or mongodb+srv:// connection string")
+		}
+		if c.Mongo.Database == "" {
+			fail("mongo.database", "is required by the mongo store")
+		}
+		if c.Mongo.ConnectTimeout <= 0 {
+			fail("mongo.connect_timeout", "must be positive, got %s", c.Mongo.ConnectTimeout)
+		}
+	}
+
+	// Without a key, tokens are signed with one generated at startup, so
+	// they stop verifying on restart and differ between replicas while
+	// their sessions live on in MongoDB
+	if c.Store.Backend == MongoBackend && c.Auth.KeysFile == "" && c.Auth.JWTSecret == "" {
+		fail("auth.keys_file", "or auth.jwt_secret (JWT_SECRET) is required by the mongo store")
+	}
+	if c.Auth.JWTSecret != "" && len(c.Auth.JWTSecret) < minSecretLength {
+		fail("auth.jwt_secret", "must be at least %d bytes", minSecretLength)
+	}
+	if len(c.Auth.TokenSources) == 0 {
+		fail("auth.token_sources", "must list at least one source")
+	}
+	for _, source := range c.Auth.TokenSources {
+		oneOf("auth.token_sources", strings.ToLower(source), "header", "cookie")
+	}
+
+	oneOf("feed.strategy", c.Feed.Strategy, "hybrid", "read", "write")
+	if c.Feed.Strategy == "hybrid" && c.Feed.TimelineThreshold < 1 {
+		fail("feed.timeline_threshold", "must be at least 1, got %d", c.Feed.TimelineThreshold)
+	}
+	if len(c.Reactions.Types) == 0 {
+		fail("reactions.types", "must list at least one reaction")
+	}
+
+	oneOf("log.level", c.Log.Level, "debug", "info", "warn", "error")
+	if c.Log.SampleRate < 0 || c.Log.SampleRate > 1 {
+		fail("log.sample_rate", "must be between 0 and 1, got %g", c.Log.SampleRate)
+	}
+
+	oneOf("tracing.exporter", c.Tracing.Exporter, NoExporter, OTLPExporter, StdoutExporter, FileExporter)
+	if c.Tracing.Exporter == FileExporter && c.Tracing.File == "" {
+		fail("tracing.file", "is required by the file exporter")
+	}
+	if c.Tracing.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.Tracing.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("tracing.otlp_endpoint", "must be an http:// or https:// URL")
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sample_ratio", "must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+	if c.Tracing.ServiceName == "" {
+		fail("tracing.service_name", "must not be empty")
+	}
+
+	oneOf("rate_limit.store", c.RateLimit.Store, MemoryLimiter, MongoLimiter)
+	if c.RateLimit.Store == MongoLimiter && c.Store.Backend != MongoBackend {
+		fail("rate_limit.store", "can only be mongo with the mongo store")
+	}
+	if c.RateLimit.LockoutAttempts < 0 {
+		fail("rate_limit.lockout_attempts", "must not be negative, got %d", c.RateLimit.LockoutAttempts)
+	}
+	if c.RateLimit.LockoutAttempts > 0 {
+		if c.RateLimit.LockoutDelay <= 0 {
+			fail("rate_limit.lockout_delay", "must be positive, got %s", c.RateLimit.LockoutDelay)
+		}
+		if c.RateLimit.LockoutMax < c.RateLimit.LockoutDelay {
+			fail("rate_limit.lockout_max", "must not be shorter than rate_limit.lockout_delay (LOGIN_LOCKOUT_DELAY)")
+		}
+	}
+
+	// Map iteration shuffles the duration errors
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
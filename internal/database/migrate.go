@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrationsCollection records the applied migrations, one document per
+// version
+const migrationsCollection = "schema_migrations"
+
+// Migration is one versioned change of the schema. Up and Down must be
+// idempotent, so a migration interrupted halfway can simply be run again.
+type Migration struct {
+	Version     int
+	Description string
+	Up          migrationStep
+	Down        migrationStep
+}
+
+// MigrationStatus tells whether a migration was applied, and when
+type MigrationStatus struct {
+	Version     int        `json:"version"`
+	Description string     `json:"description"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+}
+
+type appliedMigration struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// Migrator applies migrations to a database in version order
+type Migrator struct {
+	db         *mongo.Database
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator running migrations, which it sorts by version
+func NewMigrator(db *mongo.Database, migrations []Migration) *Migrator {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return &Migrator{db: db, migrations: sorted}
+}
+
+// applied returns the applied migrations by version
+func (m *Migrator) applied(ctx context.Context) (map[int]appliedMigration, error) {
+	cursor, err := m.db.Collection(migrationsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []appliedMigration
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]appliedMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// Up applies every pending migration and returns them
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := migration.Up(ctx, m.db); err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+		}
+
+		record := appliedMigration{Version: migration.Version, Description: migration.Description, AppliedAt: time.Now().UTC()}
+		_, err := m.db.Collection(migrationsCollection).ReplaceOne(ctx, bson.M{"_id": migration.Version}, record, options.Replace().SetUpsert(true))
+		if err != nil {
+			return done, fmt.Errorf("recording migration %d: %w", migration.Version, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns
+// them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if err := migration.Down(ctx, m.db); err != nil {
+			return done, fmt.Errorf("reverting migration %d (%s): %w", migration.Version, migration.Description, err)
+		}
+		if _, err := m.db.Collection(migrationsCollection).DeleteOne(ctx, bson.M{"_id": migration.Version}); err != nil {
+			return done, fmt.Errorf("unrecording migration %d: %w", migration.Version, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Status lists every known migration with the time it was applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Description: migration.Description}
+		if record, ok := applied[migration.Version]; ok {
+			appliedAt := record.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Pending counts the migrations that are not applied yet
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending, nil
+}
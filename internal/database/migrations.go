@@ -0,0 +1,228 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migrations is the schema of the server, in version order. Released
+// migrations must never change; add a new one instead.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "unique usernames and emails",
+		Up: inOrder(
+			// Registration never checked for taken names before this
+			// migration, so existing users may share one
+			rejectDuplicates("users", "username", "email"),
+			createIndexes("users",
+				mongo.IndexModel{Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetName("users_username").SetUnique(true)},
+				mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetName("users_email").SetUnique(true)},
+			),
+		),
+		Down: dropIndexes("users", "users_username", "users_email"),
+	},
+	{
+		Version:     2,
+		Description: "unique stack names",
+		Up: inOrder(
+			rejectDuplicates("stacks", "name"),
+			createIndexes("stacks",
+				mongo.IndexModel{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetName("stacks_name").SetUnique(true)},
+			),
+		),
+		Down: dropIndexes("stacks", "stacks_name"),
+	},
+	{
+		Version:     3,
+		Description: "content author, stack and text indexes",
+		Up: createIndexes("contents",
+			mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: -1}}, Options: options.Index().SetName("contents_user_id")},
+			mongo.IndexModel{Keys: bson.D{{Key: "stack._id", Value: 1}}, Options: options.Index().SetName("contents_stack_id")},
+			// The weights match the ones of store.ContentFields
+			mongo.IndexModel{
+				Keys: bson.D{
+					{Key: "name", Value: "text"},
+					{Key: "description", Value: "text"},
+					{Key: "stack.name", Value: "text"},
+				},
+				Options: options.Index().
+					SetName("contents_text").
+					SetDefaultLanguage("none").
+					SetWeights(bson.M{"name": 10, "stack.name": 5, "description": 1}),
+			},
+		),
+		Down: dropIndexes("contents", "contents_user_id", "contents_stack_id", "contents_text"),
+	},
+	{
+		Version:     4,
+		Description: "unique follows and reactions",
+		Up: inOrder(
+			createIndexes("follows",
+				mongo.IndexModel{Keys: bson.D{{Key: "follower_id", Value: 1}, {Key: "followee_id", Value: 1}}, Options: options.Index().SetName("follows_edge").SetUnique(true)},
+				mongo.IndexModel{Keys: bson.D{{Key: "followee_id", Value: 1}, {Key: "_id", Value: -1}}, Options: options.Index().SetName("follows_followee_id")},
+			),
+			createIndexes("reactions",
+				mongo.IndexModel{Keys: bson.D{{Key: "content_id", Value: 1}, {Key: "user_id", Value: 1}}, Options: options.Index().SetName("reactions_user").SetUnique(true)},
+			),
+		),
+		Down: inOrder(
+			dropIndexes("follows", "follows_edge", "follows_followee_id"),
+			dropIndexes("reactions", "reactions_user"),
+		),
+	},
+	{
+		Version:     5,
+		Description: "session, comment, notification and timeline lookups",
+		Up: inOrder(
+			createIndexes("sessions",
+				mongo.IndexModel{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetName("sessions_token_hash")},
+				mongo.IndexModel{Keys: bson.D{{Key: "used_hashes", Value: 1}}, Options: options.Index().SetName("sessions_used_hashes")},
+				mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetName("sessions_user_id")},
+			),
+			createIndexes("comments",
+				mongo.IndexModel{Keys: bson.D{{Key: "content_id", Value: 1}, {Key: "parent_id", Value: 1}, {Key: "_id", Value: -1}}, Options: options.Index().SetName("comments_thread")},
+			),
+			createIndexes("notifications",
+				mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "activity_id", Value: -1}}, Options: options.Index().SetName("notifications_activity")},
+				mongo.IndexModel{
+					Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "group_key", Value: 1}},
+					Options: options.Index().
+						SetName("notifications_unread_group").
+						SetUnique(true).
+						SetPartialFilterExpression(bson.M{"read": false}),
+				},
+			),
+			createIndexes("timelines",
+				mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "content_id", Value: -1}}, Options: options.Index().SetName("timelines_entry").SetUnique(true)},
+				mongo.IndexModel{Keys: bson.D{{Key: "content_id", Value: 1}}, Options: options.Index().SetName("timelines_content_id")},
+			),
+		),
+		Down: inOrder(
+			dropIndexes("sessions", "sessions_token_hash", "sessions_used_hashes", "sessions_user_id"),
+			dropIndexes("comments", "comments_thread"),
+			dropIndexes("notifications", "notifications_activity", "notifications_unread_group"),
+			dropIndexes("timelines", "timelines_entry", "timelines_content_id"),
+		),
+	},
+	{
+		Version:     6,
+		Description: "expiry of rate limit buckets and login failures",
+		Up: inOrder(
+			createIndexes("rate_limits",
+				mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetName("rate_limits_expires_at").SetExpireAfterSeconds(0)},
+			),
+			createIndexes("login_failures",
+				mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetName("login_failures_expires_at").SetExpireAfterSeconds(0)},
+			),
+		),
+		Down: inOrder(
+			dropIndexes("rate_limits", "rate_limits_expires_at"),
+			dropIndexes("login_failures", "login_failures_expires_at"),
+		),
+	},
+}
+
+// maxDuplicatesListed bounds the values named by a duplicate error
+const maxDuplicatesListed = 20
+
+// rejectDuplicates fails, naming the clashing values, when documents of a
+// collection share a value of one of the fields about to get a unique
+// index. Which document to keep is left to the operator, since removing
+// users or stacks loses what refers to them.
+func rejectDuplicates(collection string, fields ...string) migrationStep {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, field := range fields {
+			cursor, err := db.Collection(collection).Aggregate(ctx, mongo.Pipeline{
+				{{Key: "$group", Value: bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}}},
+				{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+				{{Key: "$limit", Value: maxDuplicatesListed + 1}},
+			}, options.Aggregate().SetAllowDiskUse(true))
+			if err != nil {
+				return err
+			}
+			var duplicates []struct {
+				Value interface{} `bson:"_id"`
+			}
+			if err := cursor.All(ctx, &duplicates); err != nil {
+				return err
+			}
+			if len(duplicates) > 0 {
+				values := make([]interface{}, len(duplicates))
+				for i, duplicate := range duplicates {
+					values[i] = duplicate.Value
+				}
+				return duplicateError(collection, field, values)
+			}
+		}
+		return nil
+	}
+}
+
+// duplicateError names the values shared by several documents
+func duplicateError(collection, field string, values []interface{}) error {
+	listed := make([]string, 0, len(values))
+	for i, value := range values {
+		if i == maxDuplicatesListed {
+			listed = append(listed, "...")
+			break
+		}
+		listed = append(listed, fmt.Sprintf("%q", fmt.Sprint(value)))
+	}
+	return fmt.Errorf("several %s share the %s %s, rename or remove them and migrate again",
+		collection, field, strings.Join(listed, ", "))
+}
+
+// migrationStep is the Up or Down function of a migration
+type migrationStep = func(ctx context.Context, db *mongo.Database) error
+
+// inOrder runs steps one after the other, stopping at the first failure
+func inOrder(steps ...migrationStep) migrationStep {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, step := range steps {
+			if err := step(ctx, db); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// createIndexes creates named indexes; creating an existing index with the
+// same definition does nothing
+func createIndexes(collection string, indexes ...mongo.IndexModel) migrationStep {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes)
+		return err
+	}
+}
+
+// dropIndexes drops indexes by name, ignoring the ones that are gone
+func dropIndexes(collection string, names ...string) migrationStep {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, name := range names {
+			_, err := db.Collection(collection).Indexes().DropOne(ctx, name)
+			if err != nil && !isMissing(err) {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// isMissing reports the errors of dropping an index or a collection that
+// does not exist
+func isMissing(err error) bool {
+	var commandError mongo.CommandError
+	if errors.As(err, &commandError) {
+		// IndexNotFound and NamespaceNotFound
+		return commandError.Code == 27 || commandError.Code == 26
+	}
+	return false
+}
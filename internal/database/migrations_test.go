@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMigrations(t *testing.T) {
+	for i, migration := range Migrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration %d has the version %d, want versions 1, 2, 3...", i, migration.Version)
+		}
+		if migration.Description == "" || migration.Up == nil || migration.Down == nil {
+			t.Errorf("migration %d lacks a description, an Up or a Down", migration.Version)
+		}
+	}
+}
+
+func TestNewMigratorSortsByVersion(t *testing.T) {
+	migrator := NewMigrator(nil, []Migration{{Version: 3}, {Version: 1}, {Version: 2}})
+	for i, migration := range migrator.migrations {
+		if migration.Version != i+1 {
+			t.Fatalf("migrations in the order %v", migrator.migrations)
+		}
+	}
+}
+
+func TestInOrder(t *testing.T) {
+	var ran []int
+	step := func(n int, err error) migrationStep {
+		return func(ctx context.Context, db *mongo.Database) error {
+			ran = append(ran, n)
+			return err
+		}
+	}
+	failure := errors.New("failed")
+
+	err := inOrder(step(1, nil), step(2, failure), step(3, nil))(context.Background(), nil)
+	if !errors.Is(err, failure) || len(ran) != 2 {
+		t.Errorf("inOrder ran %v and returned %v, want the first two steps and the failure", ran, err)
+	}
+}
+
+func TestIsMissing(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{mongo.CommandError{Code: 27, Name: "IndexNotFound"}, true},
+		{mongo.CommandError{Code: 26, Name: "NamespaceNotFound"}, true},
+		{mongo.CommandError{Code: 85, Name: "IndexOptionsConflict"}, false},
+		{errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := isMissing(tt.err); got != tt.want {
+			t.Errorf("isMissing(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestDuplicateError(t *testing.T) {
+	err := duplicateError("users", "email", []interface{}{"a@example.com", "b@example.com"})
+	want := `several users share the email "a@example.com", "b@example.com", rename or remove them and migrate again`
+	if err.Error() != want {
+		t.Errorf("duplicateError() = %q, want %q", err, want)
+	}
+
+	values := make([]interface{}, maxDuplicatesListed+1)
+	for i := range values {
+		values[i] = i
+	}
+	if err := duplicateError("stacks", "name", values); !strings.HasSuffix(err.Error(), `"19", ..., rename or remove them and migrate again`) {
+		t.Errorf("duplicateError() of %d values = %q, want the first %d and an ellipsis", len(values), err, maxDuplicatesListed)
+	}
+}
@@ -2,36 +2,78 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"os"
+	"math/rand/v2"
 	"time"
 
+	"cms-server/internal/config"
+	"cms-server/internal/metrics"
+
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+const (
+	// pingTimeout bounds one attempt at reaching MongoDB
+	pingTimeout = 5 * time.Second
+	// Delays between connection attempts double from minRetryDelay up to
+	// maxRetryDelay
+	minRetryDelay = 500 * time.Millisecond
+	maxRetryDelay = 30 * time.Second
 )
 
-var MongoClient *mongo.Client
+// ConnectMongo connects to cfg.URI and waits until the server answers,
+// retrying with exponential backoff for up to cfg.ConnectTimeout or until
+// ctx is done, and returns the database of cfg. An invalid URI is not
+// retried. Every command is timed by the metrics package.
+func ConnectMongo(ctx context.Context, cfg config.Mongo) (*mongo.Database, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
 
-func ConnectMongo() {
-    uri := os.Getenv("MONGO_URI")
-    client, err := mongo.NewClient(options.Client().ApplyURI(uri))
-    if err != nil {
-        log.Fatal(err)
-    }
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(string(cfg.URI)).SetMonitor(metrics.MongoMonitor()))
+	if err != nil {
+		return nil, err
+	}
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-    defer cancel()
+	delay := minRetryDelay
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+		err = client.Ping(pingCtx, readpref.Primary())
+		cancel()
+		if err == nil {
+			break
+		}
 
-    err = client.Connect(ctx)
-    if err != nil {
-        log.Fatal(err)
-    }
+		// Jitter keeps restarted replicas from retrying in lockstep
+		wait := delay/2 + rand.N(delay/2+1)
+		log.Printf("MongoDB is not reachable (attempt %d), retrying in %s: %v", attempt, wait.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			client.Disconnect(context.Background())
+			return nil, fmt.Errorf("could not reach MongoDB after %d attempts: %w", attempt, err)
+		case <-time.After(wait):
+		}
+		delay = min(2*delay, maxRetryDelay)
+	}
+
+	log.Println("Connected to MongoDB!")
+	return client.Database(cfg.Database), nil
+}
 
-    MongoClient = client
-    log.Println("Connected to MongoDB!")
+// Ping checks that the server of db answers; it is a readiness check
+func Ping(ctx context.Context, db *mongo.Database) error {
+	if db == nil {
+		return fmt.Errorf("not connected to MongoDB")
+	}
+	return db.Client().Ping(ctx, readpref.Primary())
 }
 
-func GetCollection(collectionName string) *mongo.Collection {
-    dbName := os.Getenv("MONGO_DBNAME")
-    return MongoClient.Database(dbName).Collection(collectionName)
+// Disconnect closes the connections of the client of db, if there is one
+func Disconnect(ctx context.Context, db *mongo.Database) error {
+	if db == nil {
+		return nil
+	}
+	return db.Client().Disconnect(ctx)
 }
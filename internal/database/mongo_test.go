@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"cms-server/internal/config"
+)
+
+func TestConnectMongoRetries(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the connection attempts to time out")
+	}
+	cfg := config.Mongo{
+		// Nothing listens on port 1, every ping fails quickly
+		URI:            "mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=50",
+		Database:       "test",
+		ConnectTimeout: 1500 * time.Millisecond,
+	}
+	start := time.Now()
+	db, err := ConnectMongo(context.Background(), cfg)
+	if err == nil {
+		t.Fatal("ConnectMongo reached a closed port")
+	}
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 5*time.Second {
+		t.Errorf("ConnectMongo gave up after %s, want about the connect timeout", elapsed)
+	}
+	if strings.Contains(err.Error(), "after 1 attempts") {
+		t.Errorf("ConnectMongo did not retry: %v", err)
+	}
+	if db != nil {
+		t.Error("ConnectMongo returned the database of a failed connection")
+	}
+	if err := Ping(context.Background(), db); err == nil {
+		t.Error("Ping succeeded without a connection")
+	}
+
+	// Invalid URIs fail right away
+	start = time.Now()
+	cfg.URI = "postgres://127.0.0.1"
+	if _, err := ConnectMongo(context.Background(), cfg); err == nil || time.Since(start) > 100*time.Millisecond {
+		t.Errorf("ConnectMongo of an invalid URI: %v after %s", err, time.Since(start))
+	}
+}
@@ -0,0 +1,188 @@
+// Package events decouples the handlers producing domain events from the
+// subsystems reacting to them (feeds, notifications, ...).
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"cms-server/internal/models"
+)
+
+// Type names a kind of domain event
+type Type string
+
+const (
+	ContentCreated  Type = "content.created"
+	ContentDeleted  Type = "content.deleted"
+	UserFollowed    Type = "user.followed"
+	UserUnfollowed  Type = "user.unfollowed"
+	ReactionAdded   Type = "reaction.added"
+	ReactionRemoved Type = "reaction.removed"
+	CommentCreated  Type = "comment.created"
+	CommentDeleted  Type = "comment.deleted"
+)
+
+// Event is something that happened in the system. Only the fields relevant
+// to its Type are set.
+type Event struct {
+	Type    Type
+	ActorID string
+	At      time.Time
+
+	Content    *models.Content
+	Comment    *models.Comment
+	Reaction   string
+	FolloweeID string
+}
+
+// Handler reacts to an event
+type Handler func(ctx context.Context, event Event) error
+
+// subscriber receives the events on its own queue and worker, so that a
+// slow subscriber never holds back the others
+type subscriber struct {
+	name    string
+	handler Handler
+	queue   chan Event
+}
+
+// handlerTimeout bounds the delivery of one event to one subscriber
+const handlerTimeout = 10 * time.Second
+
+// Bus delivers published events to every subscriber, in order, on one
+// background worker per subscriber so that publishers never wait for
+// subscribers, nor subscribers for each other
+type Bus struct {
+	size int
+
+	mu          sync.RWMutex
+	subscribers []*subscriber
+	closed      bool
+	// closing is closed by Close. The queues themselves are never closed, so
+	// that no lock has to be held while a publisher waits for room in one.
+	closing   chan struct{}
+	closeOnce sync.Once
+	workers   sync.WaitGroup
+}
+
+// NewBus returns a bus buffering up to size events for each subscriber
+func NewBus(size int) *Bus {
+	return &Bus{size: size, closing: make(chan struct{})}
+}
+
+// Subscribe registers handler for every event published afterwards. It does
+// nothing once the bus is closed.
+func (b *Bus) Subscribe(name string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	sub := &subscriber{name: name, handler: handler, queue: make(chan Event, b.size)}
+	b.subscribers = append(b.subscribers, sub)
+	b.workers.Add(1)
+	go b.run(sub)
+}
+
+// Publish queues an event for every subscriber. It blocks only while the
+// buffer of a subscriber is full and drops the event once the bus is closed,
+// even while blocked.
+func (b *Bus) Publish(event Event) {
+	if event.At.IsZero() {
+		event.At = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	for _, sub := range subscribers {
+		select {
+		case <-b.closing:
+		default:
+			select {
+			case sub.queue <- event:
+				continue
+			case <-b.closing:
+			}
+		}
+		log.Printf("Event bus closed, dropping %s event", event.Type)
+		return
+	}
+}
+
+// Close stops accepting events and waits until the queued ones are delivered
+func (b *Bus) Close() {
+	b.closeOnce.Do(func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.closed = true
+		close(b.closing)
+	})
+	b.workers.Wait()
+}
+
+// Check fails once the bus is closed, or while the buffer of a subscriber is
+// full, which means it falls behind publishers. It is a readiness check.
+func (b *Bus) Check(ctx context.Context) error {
+	select {
+	case <-b.closing:
+		return errors.New("event bus is closed")
+	default:
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, sub := range b.subscribers {
+		if len(sub.queue) == cap(sub.queue) {
+			return fmt.Errorf("event queue of %s is full (%d events)", sub.name, cap(sub.queue))
+		}
+	}
+	return nil
+}
+
+// run delivers the events queued for sub until the bus is closed
+func (b *Bus) run(sub *subscriber) {
+	defer b.workers.Done()
+
+	for {
+		select {
+		case event := <-sub.queue:
+			b.deliver(sub, event)
+		case <-b.closing:
+			// Deliver what was queued before closing
+			for {
+				select {
+				case event := <-sub.queue:
+					b.deliver(sub, event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver runs one subscriber, isolating the bus from its errors and panics
+func (b *Bus) deliver(sub *subscriber, event Event) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("Event subscriber %s panicked on %s: %v", sub.name, event.Type, p)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), handlerTimeout)
+	defer cancel()
+
+	if err := sub.handler(ctx, event); err != nil {
+		log.Printf("Event subscriber %s failed on %s: %v", sub.name, event.Type, err)
+	}
+}
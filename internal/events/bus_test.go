@@ -0,0 +1,122 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBusDeliversInOrderAndDrainsOnClose(t *testing.T) {
+	bus := NewBus(16)
+
+	var mu sync.Mutex
+	var got []string
+	bus.Subscribe("recorder", func(ctx context.Context, event Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, event.ActorID)
+		return nil
+	})
+
+	for _, actor := range []string{"a", "b", "c"} {
+		bus.Publish(Event{Type: ContentCreated, ActorID: actor})
+	}
+	bus.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Fatalf("delivered %v, want [a b c]", got)
+	}
+}
+
+func TestBusCloseDoesNotDeadlockWithFullQueue(t *testing.T) {
+	bus := NewBus(1)
+
+	// The subscriber holds the worker until released, so the queue fills up
+	// and the next publisher blocks
+	release := make(chan struct{})
+	bus.Subscribe("slow", func(ctx context.Context, event Event) error {
+		<-release
+		return nil
+	})
+	bus.Publish(Event{Type: ContentCreated})
+	bus.Publish(Event{Type: ContentCreated})
+
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(Event{Type: ContentCreated})
+		close(published)
+	}()
+
+	closed := make(chan struct{})
+	go func() {
+		bus.Close()
+		close(closed)
+	}()
+
+	// The blocked publisher gives up once the bus closes
+	select {
+	case <-published:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Publish stayed blocked after Close")
+	}
+	if err := bus.Check(context.Background()); err == nil {
+		t.Fatal("Check passed on a closed bus")
+	}
+
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not return")
+	}
+}
+
+func TestBusDropsEventsAfterClose(t *testing.T) {
+	bus := NewBus(4)
+	delivered := 0
+	bus.Subscribe("counter", func(ctx context.Context, event Event) error {
+		delivered++
+		return nil
+	})
+	bus.Close()
+	bus.Publish(Event{Type: ContentCreated})
+	bus.Close()
+
+	if delivered != 0 {
+		t.Fatalf("delivered %d events after Close, want 0", delivered)
+	}
+}
+
+func TestBusSubscribersDoNotWaitForEachOther(t *testing.T) {
+	bus := NewBus(4)
+
+	release := make(chan struct{})
+	bus.Subscribe("slow", func(ctx context.Context, event Event) error {
+		<-release
+		return nil
+	})
+	delivered := make(chan string, 4)
+	bus.Subscribe("fast", func(ctx context.Context, event Event) error {
+		delivered <- event.ActorID
+		return nil
+	})
+
+	bus.Publish(Event{Type: UserFollowed, ActorID: "a"})
+	bus.Publish(Event{Type: CommentCreated, ActorID: "b"})
+	for _, want := range []string{"a", "b"} {
+		select {
+		case got := <-delivered:
+			if got != want {
+				t.Fatalf("delivered %s, want %s", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("a slow subscriber held back the others")
+		}
+	}
+
+	close(release)
+	bus.Close()
+}
@@ -0,0 +1,368 @@
+// Package feed builds the personalized home feed of a user: the contents
+// of the users they follow plus their own, newest first.
+package feed
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cms-server/internal/config"
+	"cms-server/internal/events"
+	"cms-server/internal/models"
+	"cms-server/internal/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Strategy decides when the home feed is assembled
+type Strategy interface {
+	// Publish is called after content has been created
+	Publish(ctx context.Context, content models.Content) error
+	// Retract is called after content has been deleted
+	Retract(ctx context.Context, content models.Content) error
+	// Follow is called after followerID started following followeeID
+	Follow(ctx context.Context, followerID, followeeID string) error
+	// Unfollow is called after followerID stopped following followeeID
+	Unfollow(ctx context.Context, followerID, followeeID string) error
+	// Feed returns one page of the home feed of userID, newest first
+	Feed(ctx context.Context, userID string, opts store.ListOptions) (store.Page[models.Content], error)
+}
+
+const (
+	// FanOutOnRead queries the contents of the followed authors on every read.
+	// Cheap writes, best for accounts following few people.
+	FanOutOnRead = "read"
+	// FanOutOnWrite pushes every new content to the timeline of each
+	// follower. Cheap reads, best for heavy readers.
+	FanOutOnWrite = "write"
+	// FanOutHybrid assembles the feed of an account on read until it follows
+	// a threshold of users, then gives it a timeline kept up on write
+	FanOutHybrid = "hybrid"
+)
+
+// BackfillLimit is how many of the latest contents of an author enter a
+// timeline when its owner follows them. Older ones stay out of the feed.
+const BackfillLimit = 500
+
+// pageSize is how many contents are read at once while changing a timeline
+const pageSize = 100
+
+const (
+	// backfillTimeout bounds the backfill of a follow. It replaces the
+	// deadline of the event, too short for BackfillLimit contents.
+	backfillTimeout = time.Minute
+	// backfillAttempts is how many times a failing backfill is run
+	backfillAttempts = 3
+	// backfillRetryDelay is the wait before the second attempt, doubled for
+	// each next one
+	backfillRetryDelay = time.Second
+)
+
+// New returns the strategy named by cfg; an empty name selects FanOutOnRead
+func New(cfg config.Feed, s *store.Store) (Strategy, error) {
+	switch cfg.Strategy {
+	case "", FanOutOnRead:
+		return &fanOutOnRead{store: s}, nil
+	case FanOutOnWrite:
+		return &fanOutOnWrite{store: s}, nil
+	case FanOutHybrid:
+		return &hybrid{
+			store:     s,
+			threshold: int64(cfg.TimelineThreshold),
+			onRead:    &fanOutOnRead{store: s},
+			onWrite:   &fanOutOnWrite{store: s},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown feed strategy %q", cfg.Strategy)
+}
+
+type fanOutOnRead struct {
+	store *store.Store
+}
+
+func (f *fanOutOnRead) Publish(ctx context.Context, content models.Content) error {
+	return nil
+}
+
+func (f *fanOutOnRead) Retract(ctx context.Context, content models.Content) error {
+	return nil
+}
+
+func (f *fanOutOnRead) Follow(ctx context.Context, followerID, followeeID string) error {
+	return nil
+}
+
+func (f *fanOutOnRead) Unfollow(ctx context.Context, followerID, followeeID string) error {
+	return nil
+}
+
+func (f *fanOutOnRead) Feed(ctx context.Context, userID string, opts store.ListOptions) (store.Page[models.Content], error) {
+	authors, err := f.store.Follows.FollowingIDs(ctx, userID)
+	if err != nil {
+		return store.Page[models.Content]{}, err
+	}
+	authors = append(authors, userID)
+
+	opts.Sort = store.SortNewest
+	return f.store.Contents.FindContents(ctx, store.ContentFilter{UserIDs: authors}, opts)
+}
+
+type fanOutOnWrite struct {
+	store *store.Store
+}
+
+func (f *fanOutOnWrite) Publish(ctx context.Context, content models.Content) error {
+	followers, err := f.store.Follows.FollowerIDs(ctx, content.UserID)
+	if err != nil {
+		return err
+	}
+	return f.store.Timelines.AddToTimelines(ctx, append(followers, content.UserID), content.ID)
+}
+
+func (f *fanOutOnWrite) Retract(ctx context.Context, content models.Content) error {
+	return f.store.Timelines.RemoveFromTimelines(ctx, content.ID)
+}
+
+// Follow backfills the timeline of followerID, retrying as it is idempotent.
+// A backfill that still fails leaves the timeline partly filled until it is
+// rebuilt.
+func (f *fanOutOnWrite) Follow(ctx context.Context, followerID, followeeID string) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), backfillTimeout)
+	defer cancel()
+
+	delay := backfillRetryDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = backfill(ctx, f.store, followerID, followeeID); err == nil {
+			return nil
+		}
+		if attempt == backfillAttempts || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return fmt.Errorf("the timeline of %s misses contents of %s, run \"feed rebuild %s\": %w", followerID, followeeID, followerID, err)
+}
+
+func (f *fanOutOnWrite) Unfollow(ctx context.Context, followerID, followeeID string) error {
+	// Every content of the followee goes, not only the backfilled ones
+	return eachContentPage(ctx, f.store, followeeID, 0, func(ids []primitive.ObjectID) error {
+		return f.store.Timelines.RemoveFromTimeline(ctx, followerID, ids)
+	})
+}
+
+func (f *fanOutOnWrite) Feed(ctx context.Context, userID string, opts store.ListOptions) (store.Page[models.Content], error) {
+	opts.Sort = store.SortNewest
+	entries, err := f.store.Timelines.ListTimeline(ctx, userID, opts)
+	if err != nil {
+		return store.Page[models.Content]{}, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(entries.Items))
+	for _, entry := range entries.Items {
+		ids = append(ids, entry.ContentID)
+	}
+	contents, err := f.store.Contents.GetContentsByID(ctx, ids)
+	if err != nil {
+		return store.Page[models.Content]{}, err
+	}
+
+	// Keep the timeline order and skip contents deleted or hidden in the meantime
+	byID := make(map[primitive.ObjectID]models.Content, len(contents))
+	for _, content := range contents {
+		if !content.Hidden {
+			byID[content.ID] = content
+		}
+	}
+	items := make([]models.Content, 0, len(ids))
+	for _, id := range ids {
+		if content, ok := byID[id]; ok {
+			items = append(items, content)
+		}
+	}
+
+	return store.Page[models.Content]{
+		Items:      items,
+		NextCursor: entries.NextCursor,
+		HasMore:    entries.HasMore,
+	}, nil
+}
+
+// hybrid serves the accounts with a timeline like fanOutOnWrite and the
+// others like fanOutOnRead. Timelines are only changed by the feed
+// subscriber, one event at a time, so an account gets its timeline between
+// two events and misses none of them.
+type hybrid struct {
+	store     *store.Store
+	threshold int64
+	onRead    *fanOutOnRead
+	onWrite   *fanOutOnWrite
+}
+
+// hasTimeline reports whether the feed of userID is read from its timeline
+func (f *hybrid) hasTimeline(ctx context.Context, userID string) (bool, error) {
+	owners, err := f.store.Timelines.TimelineOwners(ctx, []string{userID})
+	return len(owners) > 0, err
+}
+
+func (f *hybrid) Publish(ctx context.Context, content models.Content) error {
+	followers, err := f.store.Follows.FollowerIDs(ctx, content.UserID)
+	if err != nil {
+		return err
+	}
+	owners, err := f.store.Timelines.TimelineOwners(ctx, append(followers, content.UserID))
+	if err != nil {
+		return err
+	}
+	return f.store.Timelines.AddToTimelines(ctx, owners, content.ID)
+}
+
+func (f *hybrid) Retract(ctx context.Context, content models.Content) error {
+	return f.onWrite.Retract(ctx, content)
+}
+
+// Follow backfills the timeline of followerID, or gives them one once they
+// follow enough users
+func (f *hybrid) Follow(ctx context.Context, followerID, followeeID string) error {
+	has, err := f.hasTimeline(ctx, followerID)
+	if err != nil {
+		return err
+	}
+	if has {
+		return f.onWrite.Follow(ctx, followerID, followeeID)
+	}
+
+	// Building a timeline backfills every followed author
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), backfillTimeout)
+	defer cancel()
+	_, err = Promote(ctx, f.store, followerID, f.threshold)
+	return err
+}
+
+// Unfollow leaves the timeline of an account that falls back under the
+// threshold in place, so that accounts hovering around it are not rebuilt
+// over and over
+func (f *hybrid) Unfollow(ctx context.Context, followerID, followeeID string) error {
+	has, err := f.hasTimeline(ctx, followerID)
+	if err != nil || !has {
+		return err
+	}
+	return f.onWrite.Unfollow(ctx, followerID, followeeID)
+}
+
+func (f *hybrid) Feed(ctx context.Context, userID string, opts store.ListOptions) (store.Page[models.Content], error) {
+	has, err := f.hasTimeline(ctx, userID)
+	if err != nil {
+		return store.Page[models.Content]{}, err
+	}
+	if has {
+		return f.onWrite.Feed(ctx, userID, opts)
+	}
+	return f.onRead.Feed(ctx, userID, opts)
+}
+
+// eachContentPage calls fn with the IDs of the contents of authorID, newest
+// first, one page at a time, until limit contents were read; a zero limit
+// reads them all. Hidden contents are included, since the feed filters them
+// when it is read and they may be restored.
+func eachContentPage(ctx context.Context, s *store.Store, authorID string, limit int, fn func(ids []primitive.ObjectID) error) error {
+	filter := store.ContentFilter{UserID: authorID, IncludeHidden: true}
+	opts := store.ListOptions{Limit: pageSize, Sort: store.SortNewest}
+	read := 0
+	for {
+		if limit > 0 {
+			opts.Limit = min(pageSize, limit-read)
+		}
+		page, err := s.Contents.FindContents(ctx, filter, opts)
+		if err != nil {
+			return err
+		}
+		if len(page.Items) == 0 {
+			return nil
+		}
+
+		ids := make([]primitive.ObjectID, 0, len(page.Items))
+		for _, content := range page.Items {
+			ids = append(ids, content.ID)
+		}
+		if err := fn(ids); err != nil {
+			return err
+		}
+
+		read += len(ids)
+		if !page.HasMore || (limit > 0 && read >= limit) {
+			return nil
+		}
+		opts.After = &store.Cursor{ID: ids[len(ids)-1]}
+	}
+}
+
+// backfill adds the latest contents of authorID to the timeline of userID
+func backfill(ctx context.Context, s *store.Store, userID, authorID string) error {
+	return eachContentPage(ctx, s, authorID, BackfillLimit, func(ids []primitive.ObjectID) error {
+		return s.Timelines.BackfillTimeline(ctx, userID, ids)
+	})
+}
+
+// Rebuild replaces the timeline of userID by the latest contents of the
+// users they follow and their own, as fan-out on write would have built it.
+// Run it for every user before switching from FanOutOnRead to FanOutOnWrite,
+// or to repair timelines that missed events.
+func Rebuild(ctx context.Context, s *store.Store, userID string) error {
+	authors, err := s.Follows.FollowingIDs(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.Timelines.ClearTimeline(ctx, userID); err != nil {
+		return err
+	}
+	for _, authorID := range append(authors, userID) {
+		if err := backfill(ctx, s, userID, authorID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Promote rebuilds the timeline of userID if they have one, or gives them
+// one if they follow at least threshold users, for FanOutHybrid. It reports
+// whether userID has a timeline. The timeline is built before it is
+// enabled, so that the feed is never read from a partial one.
+func Promote(ctx context.Context, s *store.Store, userID string, threshold int64) (bool, error) {
+	owners, err := s.Timelines.TimelineOwners(ctx, []string{userID})
+	if err != nil {
+		return false, err
+	}
+	if len(owners) == 0 {
+		following, err := s.Follows.CountFollowing(ctx, userID)
+		if err != nil || following < threshold {
+			return false, err
+		}
+	}
+	if err := Rebuild(ctx, s, userID); err != nil {
+		return false, err
+	}
+	return true, s.Timelines.EnableTimeline(ctx, userID)
+}
+
+// Subscriber keeps the feeds of strategy up to date from the event bus
+func Subscriber(strategy Strategy) events.Handler {
+	return func(ctx context.Context, event events.Event) error {
+		switch event.Type {
+		case events.ContentCreated:
+			return strategy.Publish(ctx, *event.Content)
+		case events.ContentDeleted:
+			return strategy.Retract(ctx, *event.Content)
+		case events.UserFollowed:
+			return strategy.Follow(ctx, event.ActorID, event.FolloweeID)
+		case events.UserUnfollowed:
+			return strategy.Unfollow(ctx, event.ActorID, event.FolloweeID)
+		}
+		return nil
+	}
+}
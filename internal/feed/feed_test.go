@@ -0,0 +1,178 @@
+package feed
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"cms-server/internal/config"
+	"cms-server/internal/models"
+	"cms-server/internal/store"
+)
+
+func TestRebuild(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+
+	create := func(userID, name string) models.Content {
+		t.Helper()
+		content := models.Content{UserID: userID, Name: name}
+		if err := s.Contents.CreateContent(ctx, &content); err != nil {
+			t.Fatalf("CreateContent: %v", err)
+		}
+		return content
+	}
+	timeline := func(userID string) []string {
+		t.Helper()
+		f, err := New(config.Feed{Strategy: FanOutOnWrite}, s)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		page, err := f.Feed(ctx, userID, store.ListOptions{})
+		if err != nil {
+			t.Fatalf("Feed: %v", err)
+		}
+		names := []string{}
+		for _, content := range page.Items {
+			names = append(names, content.Name)
+		}
+		return names
+	}
+
+	// The contents were created while feeds were assembled on read, so the
+	// timelines know nothing of them, and a stale entry is left behind
+	create("bob", "bob-1")
+	create("alice", "alice-1")
+	stale := create("carol", "carol-1")
+	create("bob", "bob-2")
+	if _, err := s.Follows.Follow(ctx, "alice", "bob"); err != nil {
+		t.Fatalf("Follow: %v", err)
+	}
+	if err := s.Timelines.AddToTimelines(ctx, []string{"alice"}, stale.ID); err != nil {
+		t.Fatalf("AddToTimelines: %v", err)
+	}
+
+	tests := []struct {
+		userID string
+		want   []string
+	}{
+		{"alice", []string{"bob-2", "alice-1", "bob-1"}},
+		{"bob", []string{"bob-2", "bob-1"}},
+		{"dave", []string{}},
+	}
+	for _, tt := range tests {
+		if err := Rebuild(ctx, s, tt.userID); err != nil {
+			t.Fatalf("Rebuild(%s): %v", tt.userID, err)
+		}
+		if got := timeline(tt.userID); !slices.Equal(got, tt.want) {
+			t.Errorf("timeline of %s is %v, want %v", tt.userID, got, tt.want)
+		}
+		// Rebuilding again changes nothing
+		if err := Rebuild(ctx, s, tt.userID); err != nil {
+			t.Fatalf("Rebuild(%s): %v", tt.userID, err)
+		}
+		if got := timeline(tt.userID); !slices.Equal(got, tt.want) {
+			t.Errorf("timeline of %s is %v after a second rebuild, want %v", tt.userID, got, tt.want)
+		}
+	}
+}
+
+func TestBackfillIsBounded(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	for i := 0; i < BackfillLimit+pageSize/2; i++ {
+		content := models.Content{UserID: "bob"}
+		if err := s.Contents.CreateContent(ctx, &content); err != nil {
+			t.Fatalf("CreateContent: %v", err)
+		}
+	}
+
+	strategy, _ := New(config.Feed{Strategy: FanOutOnWrite}, s)
+	if err := strategy.Follow(ctx, "alice", "bob"); err != nil {
+		t.Fatalf("Follow: %v", err)
+	}
+	page, err := s.Timelines.ListTimeline(ctx, "alice", store.ListOptions{})
+	if err != nil {
+		t.Fatalf("ListTimeline: %v", err)
+	}
+	if len(page.Items) != BackfillLimit {
+		t.Fatalf("backfilled %d contents, want %d", len(page.Items), BackfillLimit)
+	}
+
+	if err := strategy.Unfollow(ctx, "alice", "bob"); err != nil {
+		t.Fatalf("Unfollow: %v", err)
+	}
+	page, _ = s.Timelines.ListTimeline(ctx, "alice", store.ListOptions{})
+	if len(page.Items) != 0 {
+		t.Fatalf("%d contents left after unfollowing", len(page.Items))
+	}
+}
+
+func TestHybridGivesTimelinesToHeavyReaders(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	f, err := New(config.Feed{Strategy: FanOutHybrid, TimelineThreshold: 2}, s)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	create := func(userID, name string) {
+		t.Helper()
+		content := models.Content{UserID: userID, Name: name}
+		if err := s.Contents.CreateContent(ctx, &content); err != nil {
+			t.Fatalf("CreateContent: %v", err)
+		}
+		if err := f.Publish(ctx, content); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	follow := func(followerID, followeeID string) {
+		t.Helper()
+		if _, err := s.Follows.Follow(ctx, followerID, followeeID); err != nil {
+			t.Fatalf("Follow: %v", err)
+		}
+		if err := f.Follow(ctx, followerID, followeeID); err != nil {
+			t.Fatalf("Follow: %v", err)
+		}
+	}
+	check := func(userID string, timeline bool, want ...string) {
+		t.Helper()
+		owners, err := s.Timelines.TimelineOwners(ctx, []string{userID})
+		if err != nil || (len(owners) > 0) != timeline {
+			t.Errorf("%s has a timeline: %v (%v), want %v", userID, owners, err, timeline)
+		}
+		page, err := f.Feed(ctx, userID, store.ListOptions{})
+		if err != nil {
+			t.Fatalf("Feed: %v", err)
+		}
+		names := []string{}
+		for _, content := range page.Items {
+			names = append(names, content.Name)
+		}
+		if !slices.Equal(names, want) {
+			t.Errorf("the feed of %s is %v, want %v", userID, names, want)
+		}
+	}
+
+	create("bob", "bob-1")
+	create("carol", "carol-1")
+	follow("alice", "bob")
+	check("alice", false, "bob-1")
+
+	// Crossing the threshold builds the timeline from the contents so far
+	follow("alice", "carol")
+	check("alice", true, "carol-1", "bob-1")
+	// which is kept up from then on
+	create("bob", "bob-2")
+	check("alice", true, "bob-2", "carol-1", "bob-1")
+	check("bob", false, "bob-2", "bob-1")
+
+	// Falling back under the threshold keeps the timeline
+	if err := s.Follows.Unfollow(ctx, "alice", "bob"); err != nil {
+		t.Fatalf("Unfollow: %v", err)
+	}
+	if err := f.Unfollow(ctx, "alice", "bob"); err != nil {
+		t.Fatalf("Unfollow: %v", err)
+	}
+	check("alice", true, "carol-1")
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"cms-server/internal/auth"
+	"cms-server/internal/events"
+	"cms-server/internal/models"
+	"cms-server/internal/problem"
+	"cms-server/internal/store"
+	"cms-server/internal/validation"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxCommentDepth is the deepest reply level; top level comments have depth 0
+const maxCommentDepth = 5
+
+// commentRequest is the body of comment creation and edition requests
+type commentRequest struct {
+	Body     string `json:"body" validate:"required,max=2000"`
+	ParentID string `json:"parent_id"`
+}
+
+// decodeCommentBody reads and validates a comment request
+func decodeCommentBody(w http.ResponseWriter, r *http.Request) (commentRequest, error) {
+	var requestBody commentRequest
+	if err := validation.DecodeJSON(w, r, &requestBody); err != nil {
+		return requestBody, err
+	}
+	requestBody.Body = strings.TrimSpace(requestBody.Body)
+	return requestBody, validation.Struct(&requestBody)
+}
+
+// findComment loads the comment named by the {commentID} path parameter and
+// ensures it belongs to content
+func (h *Handler) findComment(r *http.Request, content models.Content) (models.Comment, error) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["commentID"])
+	if err != nil {
+		return models.Comment{}, problem.BadRequest("Invalid comment ID")
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	comment, err := h.store.Comments.GetComment(ctx, id)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && comment.ContentID != content.ID) {
+		return models.Comment{}, problem.NotFound("Comment not found")
+	}
+	if err != nil {
+		return models.Comment{}, problem.Internal("Error fetching comment", err)
+	}
+	return comment, nil
+}
+
+// CreateCommentHandler comments on a content, or replies to a comment when
+// parent_id is set
+func (h *Handler) CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
+		return
+	}
+
+	requestBody, err := decodeCommentBody(w, r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	content, err := h.findContent(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	comment := models.Comment{
+		ContentID: content.ID,
+		UserID:    userID,
+		Body:      requestBody.Body,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	// Replies go one level below their parent, up to maxCommentDepth
+	if requestBody.ParentID != "" {
+		parentID, err := primitive.ObjectIDFromHex(requestBody.ParentID)
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest("Invalid parent comment ID"))
+			return
+		}
+		parent, err := h.store.Comments.GetComment(ctx, parentID)
+		if errors.Is(err, store.ErrNotFound) || (err == nil && parent.ContentID != content.ID) {
+			problem.Write(w, r, problem.NotFound("Parent comment not found"))
+			return
+		}
+		if err != nil {
+			problem.Write(w, r, problem.Internal("Error fetching comment", err))
+			return
+		}
+		if parent.Depth >= maxCommentDepth {
+			problem.Write(w, r, problem.BadRequest("Maximum reply depth reached"))
+			return
+		}
+		comment.ParentID = &parent.ID
+		comment.Depth = parent.Depth + 1
+	}
+
+	if err := h.store.Comments.CreateComment(ctx, &comment); err != nil {
+		problem.Write(w, r, problem.Internal("Error creating comment", err))
+		return
+	}
+
+	h.bus.Publish(events.Event{Type: events.CommentCreated, ActorID: userID, Comment: &comment})
+
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, r, comment)
+}
+
+// GetCommentsHandler lists the top level comments of a content, or the
+// replies of the comment given by parent_id
+func (h *Handler) GetCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	content, err := h.findContent(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	var parentID primitive.ObjectID
+	if raw := r.URL.Query().Get("parent_id"); raw != "" {
+		if parentID, err = primitive.ObjectIDFromHex(raw); err != nil {
+			problem.Write(w, r, problem.BadRequest("Invalid parent comment ID"))
+			return
+		}
+	}
+
+	opts, err := parseListOptions(r, datedOrders)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	page, err := h.store.Comments.ListComments(ctx, content.ID, parentID, opts)
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error fetching comments", err))
+		return
+	}
+
+	writeJSON(w, r, page)
+}
+
+// EditCommentHandler lets the author of a comment change its body
+func (h *Handler) EditCommentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
+		return
+	}
+
+	requestBody, err := decodeCommentBody(w, r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	content, err := h.findContent(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	comment, err := h.findComment(r, content)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if comment.UserID != userID {
+		problem.Write(w, r, problem.Forbidden("Only the author can edit a comment"))
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	comment, err = h.store.Comments.UpdateCommentBody(ctx, comment.ID, requestBody.Body)
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, problem.NotFound("Comment not found"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error updating comment", err))
+		return
+	}
+
+	writeJSON(w, r, comment)
+}
+
+// DeleteCommentHandler lets the author of a comment or the owner of the
+// content delete a comment. The comment is tombstoned to keep its replies.
+func (h *Handler) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
+		return
+	}
+
+	content, err := h.findContent(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	comment, err := h.findComment(r, content)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if comment.UserID != userID && content.UserID != userID && !can(r, auth.ManageAnyContent) {
+		problem.Write(w, r, problem.Forbidden("Only the author or the content owner can delete a comment"))
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	err = h.store.Comments.DeleteComment(ctx, comment.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, problem.NotFound("Comment not found"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error deleting comment", err))
+		return
+	}
+
+	h.bus.Publish(events.Event{Type: events.CommentDeleted, ActorID: userID, Comment: &comment})
+
+	writeJSON(w, r, map[string]string{"message": "Comment deleted successfully"})
+}
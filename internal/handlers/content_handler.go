@@ -1,140 +1,107 @@
 package handlers
 
 import (
-	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
 	"net/http"
-	"time"
 
-	"cms-server/internal/database"
+	"cms-server/internal/auth"
+	"cms-server/internal/events"
 	"cms-server/internal/models"
+	"cms-server/internal/problem"
+	"cms-server/internal/store"
+	"cms-server/internal/validation"
 
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// Helper to get collection
-func getContentCollection() *mongo.Collection {
-	return database.GetCollection("contents")
-}
-
-func getStackCollection() *mongo.Collection {
-	return database.GetCollection("stacks")
-}
-
-// handleError sends an error response
-func handleError(w http.ResponseWriter, message string, statusCode int) {
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
-}
-
 // getUserIDFromContext retrieves the user ID from the request context
 func getUserIDFromContext(r *http.Request) (string, bool) {
 	userID, ok := r.Context().Value("userID").(string)
 	return userID, ok
 }
 
-// createContent inserts the content into the database
-func createContent(content models.Content) error {
-	collection := database.GetCollection("contents")
-	_, err := collection.InsertOne(context.TODO(), content)
-	return err
+// getRoleFromContext retrieves the role of the authenticated user
+func getRoleFromContext(r *http.Request) string {
+	role, _ := r.Context().Value("role").(string)
+	return role
 }
 
-// fetchContents retrieves content based on a filter
-func fetchContents(filter interface{}) ([]models.Content, error) {
-	collection := getContentCollection()
+// can reports whether the authenticated user was granted permission
+func can(r *http.Request, permission auth.Permission) bool {
+	return auth.Can(getRoleFromContext(r), permission)
+}
 
-	// Set up a context with a timeout for querying MongoDB
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// fetchStacks checks if all stack names exist and returns their details
+func (h *Handler) fetchStacks(r *http.Request, stackNames []string) ([]models.Stack, error) {
+	// No stacks, nothing to look up: MongoDB refuses the null $in of nil names
+	if len(stackNames) == 0 {
+		return []models.Stack{}, nil
+	}
 
-	var contents []models.Content
+	ctx, cancel := dbContext(r)
+	defer cancel()
 
-	// Retrieve documents based on the filter
-	cursor, err := collection.Find(ctx, filter)
+	// Find the stack documents based on the provided names
+	stackDetails, err := h.store.Stacks.FindStacksByName(ctx, stackNames)
 	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	// Decode documents into the contents slice
-	for cursor.Next(ctx) {
-		var content models.Content
-		if err := cursor.Decode(&content); err != nil {
-			return nil, err
-		}
-		contents = append(contents, content)
+		return nil, problem.Internal("Error fetching stacks", err)
 	}
 
-	// Check if there was an error during the cursor iteration
-	if err := cursor.Err(); err != nil {
-		return nil, err
+	// Check if we found all the stacks
+	if len(stackDetails) != len(stackNames) {
+		return nil, validation.Fields(validation.FieldError{
+			Field:   "stack",
+			Code:    "exists",
+			Message: "one or more stacks not found",
+		})
 	}
 
-	return contents, nil
+	return stackDetails, nil
 }
 
-// fetchStacks checks if all stack names exist and returns their details
-func fetchStacks(stackNames []string) ([]models.Stack, error) {
-	var stackDetails []models.Stack
+// findOwnedContent loads a content by its hex ID and ensures it belongs to
+// userID, unless the caller may manage any content
+func (h *Handler) findOwnedContent(r *http.Request, contentID, userID string) (models.Content, error) {
+	// Convert string contentID to ObjectID
+	objectID, err := primitive.ObjectIDFromHex(contentID)
+	if err != nil {
+		return models.Content{}, problem.BadRequest("Invalid content ID")
+	}
 
-	// Get the collection
-	collection := getStackCollection()
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := dbContext(r)
 	defer cancel()
 
-	// Find the stack documents based on the provided names
-	cursor, err := collection.Find(ctx, bson.M{"name": bson.M{"$in": stackNames}})
-	if err != nil {
-		return nil, err
+	content, err := h.store.Contents.GetContent(ctx, objectID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && content.UserID != userID && !can(r, auth.ManageAnyContent)) {
+		return models.Content{}, problem.NotFound("Content not found or unauthorized")
 	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var stack models.Stack
-		if err := cursor.Decode(&stack); err != nil {
-			return nil, err
-		}
-		stackDetails = append(stackDetails, stack)
-	}
-
-	// Check if we found all the stacks
-	if len(stackDetails) != len(stackNames) {
-		return nil, fmt.Errorf("one or more stacks not found")
+	if err != nil {
+		return models.Content{}, problem.Internal("Error fetching content", err)
 	}
 
-	return stackDetails, nil
+	return content, nil
 }
 
 // CreateContentHandler handles the creation of new content
-func CreateContentHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateContentHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := getUserIDFromContext(r)
 	if !ok {
-		handleError(w, "Unable to retrieve user ID", http.StatusInternalServerError)
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
 		return
 	}
 
-	var requestBody struct {
-		Name        string   `json:"name"`
-		Description string   `json:"description"`
-		Url         string   `json:"url"`
-		ImgUrl      string   `json:"imgUrl"`
-		Stack       []string `json:"stack"` // Array of stack IDs
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		handleError(w, "Invalid request", http.StatusBadRequest)
+	var requestBody contentDocument
+	if err := validation.Decode(w, r, &requestBody); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 
 	// Validate and fetch the stack data
-	stackDetails, err := fetchStacks(requestBody.Stack)
+	stackDetails, err := h.fetchStacks(r, requestBody.Stack)
 	if err != nil {
-		handleError(w, err.Error(), http.StatusBadRequest)
+		problem.Write(w, r, err)
 		return
 	}
 
@@ -147,149 +114,150 @@ func CreateContentHandler(w http.ResponseWriter, r *http.Request) {
 		Stack:       stackDetails, // Use the fetched stack details
 	}
 
-	if err := createContent(content); err != nil {
-		handleError(w, "Error creating content", http.StatusInternalServerError)
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	if err := h.store.Contents.CreateContent(ctx, &content); err != nil {
+		problem.Write(w, r, problem.Internal("Error creating content", err))
 		return
 	}
 
+	h.bus.Publish(events.Event{Type: events.ContentCreated, ActorID: userID, Content: &content})
+
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Content created successfully"})
+	writeJSON(w, r, map[string]string{"message": "Content created successfully"})
 }
 
 // GetContentHandler retrieves content for a specific user
-func GetContentHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetContentHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	userID, ok := getUserIDFromContext(r)
 	if !ok {
-		handleError(w, "Unable to retrieve user ID", http.StatusInternalServerError)
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
 		return
 	}
 
-	filter := bson.D{{Key: "user_id", Value: userID}}
-	contents, err := fetchContents(filter)
+	filter, err := parseContentFilter(r)
 	if err != nil {
-		handleError(w, "Error fetching content", http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
+	filter.UserID = userID
+	// Owners keep seeing what moderators hid
+	filter.IncludeHidden = true
 
-	json.NewEncoder(w).Encode(contents)
+	h.writeContents(w, r, filter)
 }
 
 // GetContentsHandler retrieves all the content from the database
-func GetContentsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetContentsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	contents, err := fetchContents(bson.M{})
+	filter, err := parseContentFilter(r)
 	if err != nil {
-		handleError(w, "Error fetching content", http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
+	filter.IncludeHidden = can(r, auth.HideContent)
 
-	json.NewEncoder(w).Encode(contents)
+	h.writeContents(w, r, filter)
 }
 
-func EditContentHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	// Get the user ID from the context
-	userID, ok := getUserIDFromContext(r)
-	if !ok {
-		handleError(w, "Unable to retrieve user ID", http.StatusInternalServerError)
+// writeContents sends one page of the contents matching filter
+func (h *Handler) writeContents(w http.ResponseWriter, r *http.Request, filter store.ContentFilter) {
+	opts, err := parseListOptions(r, namedOrders)
+	if err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 
-	// Extract the content ID from the request URL (assuming it's passed as a path parameter)
-	contentID := mux.Vars(r)["id"]
-
-	// Check if content exists and belongs to the user
-	collection := database.GetCollection("contents")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := dbContext(r)
 	defer cancel()
 
-	// Convert string contentID to ObjectID
-	objectID, err := primitive.ObjectIDFromHex(contentID)
+	page, err := h.store.Contents.FindContents(ctx, filter, opts)
 	if err != nil {
-		handleError(w, "Invalid content ID", http.StatusBadRequest)
+		problem.Write(w, r, problem.Internal("Error fetching content", err))
+		return
+	}
+	if err := h.addViewerReactions(ctx, r, page.Items); err != nil {
+		problem.Write(w, r, problem.Internal("Error fetching reactions", err))
 		return
 	}
 
-	// Find the content by ID and user ID to ensure ownership
-	filter := bson.M{"_id": objectID, "user_id": userID}
-	var content models.Content
-	err = collection.FindOne(ctx, filter).Decode(&content)
-	if err != nil {
-		handleError(w, "Content not found or unauthorized", http.StatusNotFound)
+	writeJSON(w, r, page)
+}
+
+func (h *Handler) EditContentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get the user ID from the context
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
 		return
 	}
 
-	// Decode the new content data from the request body
-	var updatedContent models.Content
-	err = json.NewDecoder(r.Body).Decode(&updatedContent)
+	// Find the content by ID and user ID to ensure ownership
+	content, err := h.findOwnedContent(r, mux.Vars(r)["id"], userID)
 	if err != nil {
-		handleError(w, "Invalid request body", http.StatusBadRequest)
+		problem.Write(w, r, err)
 		return
 	}
 
-	// Update the content in the database
-	update := bson.M{
-		"$set": bson.M{
-			"name":   updatedContent.Name,
-			"url":    updatedContent.Url,
-			"imgUrl": updatedContent.ImgUrl,
-			"stack":  updatedContent.Stack,
-		},
+	// Decode the new content data from the request body; PUT replaces every
+	// editable field, use PATCH to change only some of them
+	var doc contentDocument
+	if err := validation.DecodeJSON(w, r, &doc); err != nil {
+		problem.Write(w, r, err)
+		return
 	}
-	_, err = collection.UpdateOne(ctx, filter, update)
-	if err != nil {
-		handleError(w, "Error updating content", http.StatusInternalServerError)
+
+	if _, err := h.saveContentDocument(r, content, doc); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Content updated successfully"))
+	writeJSON(w, r, map[string]string{"message": "Content updated successfully"})
 }
 
-func DeleteContentHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteContentHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Get the user ID from the context
 	userID, ok := getUserIDFromContext(r)
 	if !ok {
-		handleError(w, "Unable to retrieve user ID", http.StatusInternalServerError)
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
 		return
 	}
 
-	// Extract the content ID from the request URL
-	contentID := mux.Vars(r)["id"]
-
-	// Convert the contentID to ObjectID
-	objectID, err := primitive.ObjectIDFromHex(contentID)
+	// Find the content by ID and ensure it belongs to the current user
+	content, err := h.findOwnedContent(r, mux.Vars(r)["id"], userID)
 	if err != nil {
-		handleError(w, "Invalid content ID", http.StatusBadRequest)
+		problem.Write(w, r, err)
 		return
 	}
 
-	collection := database.GetCollection("contents")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := dbContext(r)
 	defer cancel()
 
-	// Find the content by ID and ensure it belongs to the current user
-	filter := bson.M{"_id": objectID, "user_id": userID}
-	var content models.Content
-	err = collection.FindOne(ctx, filter).Decode(&content)
-	if err != nil {
-		handleError(w, "Content not found or unauthorized", http.StatusNotFound)
+	// Delete the content
+	if err := h.store.Contents.DeleteContent(ctx, content.ID); err != nil {
+		problem.Write(w, r, problem.Internal("Error deleting content", err))
 		return
 	}
 
-	// Delete the content
-	_, err = collection.DeleteOne(ctx, filter)
-	if err != nil {
-		handleError(w, "Error deleting content", http.StatusInternalServerError)
-		return
+	h.bus.Publish(events.Event{Type: events.ContentDeleted, ActorID: userID, Content: &content})
+
+	// The content is gone, its reactions and comments must follow
+	cleanupCtx, cancelCleanup := detachedContext(ctx)
+	defer cancelCleanup()
+	if err := h.store.Reactions.DeleteContentReactions(cleanupCtx, content.ID); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting reactions of content", "content_id", content.ID.Hex(), "error", err)
+	}
+	if err := h.store.Comments.DeleteContentComments(cleanupCtx, content.ID); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting comments of content", "content_id", content.ID.Hex(), "error", err)
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Content deleted successfully"))
+	writeJSON(w, r, map[string]string{"message": "Content deleted successfully"})
 }
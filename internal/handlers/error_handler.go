@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"net/http"
+
+	"cms-server/internal/problem"
+)
+
+// NotFoundHandler answers requests matching no route
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, problem.NotFound("No route matches "+r.URL.Path))
+}
+
+// MethodNotAllowedHandler answers requests using a method their route does
+// not accept
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, problem.New(http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "The route does not accept "+r.Method))
+}
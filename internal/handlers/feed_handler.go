@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+
+	"cms-server/internal/problem"
+)
+
+// GetFeedHandler returns the home feed of the authenticated user: contents
+// of the users they follow and their own, newest first
+func (h *Handler) GetFeedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
+		return
+	}
+
+	// The feed lists newest first only, and its cursors are bound to that
+	opts, err := parseListOptions(r, newestOnly)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	page, err := h.feed.Feed(ctx, userID, opts)
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error fetching feed", err))
+		return
+	}
+	if err := h.addViewerReactions(ctx, r, page.Items); err != nil {
+		problem.Write(w, r, problem.Internal("Error fetching reactions", err))
+		return
+	}
+
+	writeJSON(w, r, page)
+}
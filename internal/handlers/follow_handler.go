@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"cms-server/internal/events"
+	"cms-server/internal/models"
+	"cms-server/internal/problem"
+	"cms-server/internal/store"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// userProfile is the public view of a user
+type userProfile struct {
+	ID             string `json:"id"`
+	Username       string `json:"username"`
+	FollowersCount int64  `json:"followers_count"`
+	FollowingCount int64  `json:"following_count"`
+}
+
+// followEntry is one row of a followers or following listing
+type followEntry struct {
+	UserID     string    `json:"user_id"`
+	Username   string    `json:"username"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// findUser loads the user named by the {id} path parameter
+func (h *Handler) findUser(r *http.Request) (models.User, error) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		return models.User{}, problem.BadRequest("Invalid user ID")
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	user, err := h.store.Users.GetUserByID(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return models.User{}, problem.NotFound("User not found")
+	}
+	if err != nil {
+		return models.User{}, problem.Internal("Error fetching user", err)
+	}
+	return user, nil
+}
+
+// GetUserProfileHandler returns the public profile of a user with follow counts
+func (h *Handler) GetUserProfileHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, err := h.findUser(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	userID := user.ID.Hex()
+	followers, err := h.store.Follows.CountFollowers(ctx, userID)
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error counting followers", err))
+		return
+	}
+	following, err := h.store.Follows.CountFollowing(ctx, userID)
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error counting following", err))
+		return
+	}
+
+	writeJSON(w, r, userProfile{
+		ID:             userID,
+		Username:       user.Username,
+		FollowersCount: followers,
+		FollowingCount: following,
+	})
+}
+
+// FollowUserHandler makes the authenticated user follow another user
+func (h *Handler) FollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
+		return
+	}
+
+	followee, err := h.findUser(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if followee.ID.Hex() == userID {
+		problem.Write(w, r, problem.BadRequest("You cannot follow yourself"))
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	follow, err := h.store.Follows.Follow(ctx, userID, followee.ID.Hex())
+	if errors.Is(err, store.ErrDuplicate) {
+		problem.Write(w, r, problem.Conflict("You already follow this user"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error following user", err))
+		return
+	}
+
+	h.bus.Publish(events.Event{Type: events.UserFollowed, ActorID: userID, FolloweeID: follow.FolloweeID})
+
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, r, follow)
+}
+
+// UnfollowUserHandler removes a follow of the authenticated user
+func (h *Handler) UnfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
+		return
+	}
+
+	followeeID := mux.Vars(r)["id"]
+	if _, err := primitive.ObjectIDFromHex(followeeID); err != nil {
+		problem.Write(w, r, problem.BadRequest("Invalid user ID"))
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	err := h.store.Follows.Unfollow(ctx, userID, followeeID)
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, problem.NotFound("You do not follow this user"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error unfollowing user", err))
+		return
+	}
+
+	h.bus.Publish(events.Event{Type: events.UserUnfollowed, ActorID: userID, FolloweeID: followeeID})
+
+	writeJSON(w, r, map[string]string{"message": "User unfollowed successfully"})
+}
+
+// GetFollowersHandler lists the users following a user
+func (h *Handler) GetFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	h.writeFollows(w, r, h.store.Follows.ListFollowers, func(f models.Follow) string { return f.FollowerID })
+}
+
+// GetFollowingHandler lists the users a user follows
+func (h *Handler) GetFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	h.writeFollows(w, r, h.store.Follows.ListFollowing, func(f models.Follow) string { return f.FolloweeID })
+}
+
+// writeFollows sends one page of follows, resolving the other side of each edge
+func (h *Handler) writeFollows(
+	w http.ResponseWriter,
+	r *http.Request,
+	list func(ctx context.Context, userID string, opts store.ListOptions) (store.Page[models.Follow], error),
+	other func(models.Follow) string,
+) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, err := h.findUser(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	opts, err := parseListOptions(r, datedOrders)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	page, err := list(ctx, user.ID.Hex(), opts)
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error fetching follows", err))
+		return
+	}
+
+	// Resolve usernames of the listed users in a single query
+	ids := make([]primitive.ObjectID, 0, len(page.Items))
+	for _, follow := range page.Items {
+		if id, err := primitive.ObjectIDFromHex(other(follow)); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	users, err := h.store.Users.GetUsersByID(ctx, ids)
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error fetching users", err))
+		return
+	}
+	usernames := make(map[string]string, len(users))
+	for _, u := range users {
+		usernames[u.ID.Hex()] = u.Username
+	}
+
+	entries := make([]followEntry, 0, len(page.Items))
+	for _, follow := range page.Items {
+		entries = append(entries, followEntry{
+			UserID:     other(follow),
+			Username:   usernames[other(follow)],
+			FollowedAt: follow.CreatedAt,
+		})
+	}
+
+	writeJSON(w, r, store.Page[followEntry]{
+		Items:      entries,
+		NextCursor: page.NextCursor,
+		HasMore:    page.HasMore,
+	})
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"cms-server/internal/auth"
+	"cms-server/internal/config"
+	"cms-server/internal/events"
+	"cms-server/internal/feed"
+	"cms-server/internal/ratelimit"
+	"cms-server/internal/realtime"
+	"cms-server/internal/store"
+
+	"go.opentelemetry.io/otel"
+)
+
+// tracer starts the spans of the handlers
+var tracer = otel.Tracer("cms-server/internal/handlers")
+
+// Handler serves the HTTP API on top of the injected stores
+type Handler struct {
+	store         *store.Store
+	feed          feed.Strategy
+	reactionTypes []string
+	bus           *events.Bus
+	hub           *realtime.Hub
+	keys          *auth.KeySet
+	logins        *ratelimit.Lockout
+}
+
+// Deps are the services a Handler works with
+type Deps struct {
+	// Store is read and written by every handler
+	Store *store.Store
+	// Feed assembles the home feeds
+	Feed feed.Strategy
+	// Bus receives what happened
+	Bus *events.Bus
+	// Hub streams to the connected clients
+	Hub *realtime.Hub
+	// Keys sign the access tokens
+	Keys *auth.KeySet
+	// Logins locks usernames out after repeated failed logins
+	Logins *ratelimit.Lockout
+}
+
+// NewHandler returns a Handler working with deps. It accepts the reaction
+// types of cfg.
+func NewHandler(cfg *config.Config, deps Deps) *Handler {
+	reactionTypes := cfg.Reactions.Types
+	if len(reactionTypes) == 0 {
+		reactionTypes = DefaultReactionTypes
+	}
+	return &Handler{
+		store:         deps.Store,
+		feed:          deps.Feed,
+		reactionTypes: reactionTypes,
+		bus:           deps.Bus,
+		hub:           deps.Hub,
+		keys:          deps.Keys,
+		logins:        deps.Logins,
+	}
+}
+
+// dbTimeout bounds the store operations of a request
+const dbTimeout = 10 * time.Second
+
+// dbContext bounds the store operations of a request. It derives from the
+// request context, so that they stop when the client goes away and their
+// spans belong to the trace of the request.
+func dbContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), dbTimeout)
+}
+
+// detachedContext bounds the writes that have to complete once a change is
+// committed, even when the client goes away. It keeps the trace of ctx.
+func detachedContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), dbTimeout)
+}
+
+// writeJSON encodes v as the response body in a span of its own, since
+// large pages take a while to encode
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	_, span := tracer.Start(r.Context(), "encode response")
+	defer span.End()
+	json.NewEncoder(w).Encode(v)
+}
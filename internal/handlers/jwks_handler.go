@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// JWKSHandler publishes the public keys verifying access tokens so other
+// services can check them without sharing a secret
+func (h *Handler) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, r, map[string]interface{}{"keys": h.keys.JWKS()})
+}
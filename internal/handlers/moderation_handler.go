@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"cms-server/internal/problem"
+	"cms-server/internal/store"
+	"cms-server/internal/validation"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// HideContentHandler takes a content down for everyone but its owner and moderators
+func (h *Handler) HideContentHandler(w http.ResponseWriter, r *http.Request) {
+	h.setContentHidden(w, r, true)
+}
+
+// UnhideContentHandler restores a hidden content
+func (h *Handler) UnhideContentHandler(w http.ResponseWriter, r *http.Request) {
+	h.setContentHidden(w, r, false)
+}
+
+func (h *Handler) setContentHidden(w http.ResponseWriter, r *http.Request, hidden bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
+		return
+	}
+
+	contentID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest("Invalid content ID"))
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	content, err := h.store.Contents.SetContentHidden(ctx, contentID, hidden, userID, time.Now().UTC())
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, problem.NotFound("Content not found"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error updating content", err))
+		return
+	}
+
+	writeJSON(w, r, content)
+}
+
+// SetUserRoleHandler changes the role of a user
+func (h *Handler) SetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
+		return
+	}
+
+	targetID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest("Invalid user ID"))
+		return
+	}
+	// Admins cannot demote themselves and leave the server without one
+	if targetID.Hex() == userID {
+		problem.Write(w, r, problem.BadRequest("You cannot change your own role"))
+		return
+	}
+
+	var requestBody struct {
+		Role string `json:"role" validate:"required,oneof=user|moderator|admin"`
+	}
+	if err := validation.Decode(w, r, &requestBody); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	user, err := h.store.Users.SetUserRole(ctx, targetID, requestBody.Role)
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, problem.NotFound("User not found"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error updating user", err))
+		return
+	}
+	// Access tokens carry the role: sign the user out so that the next one
+	// carries the new role
+	if err := h.store.Sessions.RevokeUserSessions(ctx, targetID.Hex(), primitive.NilObjectID, time.Now().UTC()); err != nil {
+		problem.Write(w, r, problem.Internal("Error revoking sessions", err))
+		return
+	}
+
+	writeJSON(w, r, map[string]string{"id": user.ID.Hex(), "username": user.Username, "role": user.EffectiveRole()})
+}
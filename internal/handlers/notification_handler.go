@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"cms-server/internal/models"
+	"cms-server/internal/problem"
+	"cms-server/internal/store"
+	"cms-server/internal/validation"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// shownActors is how many actors of a group are resolved to usernames
+const shownActors = 3
+
+// notificationActions completes "<actors> ..." for every notification type
+var notificationActions = map[string]string{
+	models.NotificationFollow:   "started following you",
+	models.NotificationReaction: "reacted to your content",
+	models.NotificationComment:  "commented on your content",
+	models.NotificationReply:    "replied to your comment",
+	models.NotificationMention:  "mentioned you",
+}
+
+type actorView struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// notificationView is a notification with its actors resolved and a
+// human readable summary such as "alice and 4 others reacted to your content"
+type notificationView struct {
+	models.Notification
+	Actors  []actorView `json:"actors"`
+	Message string      `json:"message"`
+}
+
+// notificationMessage summarizes who did what
+func notificationMessage(n models.Notification, actors []actorView) string {
+	name := "Someone"
+	if len(actors) > 0 {
+		name = actors[0].Username
+	}
+	switch {
+	case n.ActorCount == 2 && len(actors) > 1:
+		name += " and " + actors[1].Username
+	case n.ActorCount == 2:
+		name += " and 1 other"
+	case n.ActorCount > 2:
+		name += fmt.Sprintf(" and %d others", n.ActorCount-1)
+	}
+	return name + " " + notificationActions[n.Type]
+}
+
+// GetNotificationsHandler lists the notifications of the authenticated user,
+// newest first, with the number of unread ones
+func (h *Handler) GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
+		return
+	}
+
+	opts, err := parseListOptions(r, newestOnly)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	page, err := h.store.Notifications.ListNotifications(ctx, userID, unreadOnly, opts)
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error fetching notifications", err))
+		return
+	}
+	unread, err := h.store.Notifications.CountUnread(ctx, userID)
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error counting notifications", err))
+		return
+	}
+
+	// Resolve the displayed actors of the whole page in a single query
+	var ids []primitive.ObjectID
+	for _, n := range page.Items {
+		for _, actorID := range n.ActorIDs[:min(len(n.ActorIDs), shownActors)] {
+			if id, err := primitive.ObjectIDFromHex(actorID); err == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+	users, err := h.store.Users.GetUsersByID(ctx, ids)
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error fetching users", err))
+		return
+	}
+	usernames := make(map[string]string, len(users))
+	for _, u := range users {
+		usernames[u.ID.Hex()] = u.Username
+	}
+
+	views := make([]notificationView, 0, len(page.Items))
+	for _, n := range page.Items {
+		actors := []actorView{}
+		for _, actorID := range n.ActorIDs[:min(len(n.ActorIDs), shownActors)] {
+			if username, ok := usernames[actorID]; ok {
+				actors = append(actors, actorView{ID: actorID, Username: username})
+			}
+		}
+		views = append(views, notificationView{Notification: n, Actors: actors, Message: notificationMessage(n, actors)})
+	}
+
+	writeJSON(w, r, struct {
+		store.Page[notificationView]
+		UnreadCount int64 `json:"unread_count"`
+	}{
+		Page:        store.Page[notificationView]{Items: views, NextCursor: page.NextCursor, HasMore: page.HasMore},
+		UnreadCount: unread,
+	})
+}
+
+// MarkNotificationsReadHandler marks one notification, or all of them, as read
+func (h *Handler) MarkNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
+		return
+	}
+
+	var requestBody struct {
+		ID  string `json:"id"`
+		All bool   `json:"all"`
+	}
+	if err := validation.DecodeJSON(w, r, &requestBody); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if (requestBody.ID == "") == !requestBody.All {
+		problem.Write(w, r, validation.Fields(validation.FieldError{
+			Field:   "id",
+			Code:    "required",
+			Message: "provide either an id or all: true",
+		}))
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	if requestBody.All {
+		if err := h.store.Notifications.MarkAllRead(ctx, userID); err != nil {
+			problem.Write(w, r, problem.Internal("Error updating notifications", err))
+			return
+		}
+	} else {
+		id, err := primitive.ObjectIDFromHex(requestBody.ID)
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest("Invalid notification ID"))
+			return
+		}
+		err = h.store.Notifications.MarkRead(ctx, userID, id)
+		if errors.Is(err, store.ErrNotFound) {
+			problem.Write(w, r, problem.NotFound("Notification not found"))
+			return
+		}
+		if err != nil {
+			problem.Write(w, r, problem.Internal("Error updating notification", err))
+			return
+		}
+	}
+
+	unread, err := h.store.Notifications.CountUnread(ctx, userID)
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error counting notifications", err))
+		return
+	}
+	writeJSON(w, r, map[string]int64{"unread_count": unread})
+}
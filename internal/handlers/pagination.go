@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"cms-server/internal/problem"
+	"cms-server/internal/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// invalidQuery rejects a malformed query string parameter
+func invalidQuery(format string, args ...interface{}) error {
+	return problem.New(http.StatusBadRequest, problem.CodeInvalidQuery, fmt.Sprintf(format, args...))
+}
+
+// Sort orders offered by listings. Only documents with a name can be
+// listed by name; the others would sort and page on an empty key.
+var (
+	newestOnly  = []store.SortOrder{store.SortNewest}
+	datedOrders = []store.SortOrder{store.SortNewest, store.SortOldest}
+	namedOrders = []store.SortOrder{store.SortNewest, store.SortOldest, store.SortName}
+)
+
+// parseListOptions reads limit, sort and cursor from the query string,
+// accepting the sort orders of the listing
+func parseListOptions(r *http.Request, orders []store.SortOrder) (store.ListOptions, error) {
+	query := r.URL.Query()
+
+	opts := store.ListOptions{Limit: defaultPageLimit}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return opts, invalidQuery("limit must be a positive integer")
+		}
+		opts.Limit = min(limit, maxPageLimit)
+	}
+
+	order, err := store.ParseSortOrder(query.Get("sort"))
+	if err != nil || !slices.Contains(orders, order) {
+		return opts, invalidSort(orders)
+	}
+	opts.Sort = order
+
+	if token := query.Get("cursor"); token != "" {
+		after, err := store.DecodeCursor(order, token)
+		if err != nil {
+			return opts, invalidQuery("cursor is invalid or does not match the sort order")
+		}
+		opts.After = after
+	}
+
+	return opts, nil
+}
+
+// invalidSort rejects a sort order the listing does not offer
+func invalidSort(orders []store.SortOrder) error {
+	if len(orders) == 1 {
+		return invalidQuery("sort must be %s", orders[0])
+	}
+	names := make([]string, len(orders))
+	for i, order := range orders {
+		names[i] = string(order)
+	}
+	return invalidQuery("sort must be one of %s", strings.Join(names, ", "))
+}
+
+// parseTimeParam accepts either an RFC 3339 timestamp or a plain date
+func parseTimeParam(name, raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return t, nil
+	}
+	return time.Time{}, invalidQuery("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", name)
+}
+
+// parseContentFilter reads user_id, stack, from and to from the query string.
+// stack matches either a stack ID or a stack name.
+func parseContentFilter(r *http.Request) (store.ContentFilter, error) {
+	query := r.URL.Query()
+
+	filter := store.ContentFilter{UserID: query.Get("user_id")}
+	if stack := query.Get("stack"); stack != "" {
+		if id, err := primitive.ObjectIDFromHex(stack); err == nil {
+			filter.StackID = id
+		} else {
+			filter.StackName = stack
+		}
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam("from", query.Get("from")); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTimeParam("to", query.Get("to")); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
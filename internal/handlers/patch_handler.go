@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"reflect"
+
+	"cms-server/internal/models"
+	"cms-server/internal/patch"
+	"cms-server/internal/problem"
+	"cms-server/internal/store"
+	"cms-server/internal/validation"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// acceptPatch lists the patch formats accepted by PATCH routes
+const acceptPatch = patch.MergePatchType + ", " + patch.JSONPatchType
+
+// contentDocument is the editable part of a content. Stacks are referenced
+// by name and resolved on the server.
+type contentDocument struct {
+	Name        string   `json:"name" validate:"required,max=200"`
+	Description string   `json:"description" validate:"max=5000"`
+	Url         string   `json:"url" validate:"required,max=2048,url=http|https"`
+	ImgUrl      string   `json:"imgUrl" validate:"max=2048,url=http|https"`
+	Stack       []string `json:"stack" validate:"max=20,unique,dive,required,max=50"`
+}
+
+func newContentDocument(content models.Content) contentDocument {
+	doc := contentDocument{
+		Name:        content.Name,
+		Description: content.Description,
+		Url:         content.Url,
+		ImgUrl:      content.ImgUrl,
+		Stack:       []string{},
+	}
+	for _, stack := range content.Stack {
+		doc.Stack = append(doc.Stack, stack.Name)
+	}
+	return doc
+}
+
+// stackDocument is the editable part of a stack
+type stackDocument struct {
+	Name  string `json:"name" validate:"required,max=50"`
+	Color string `json:"color" validate:"required,hexcolor"`
+}
+
+// applyPatch patches the JSON form of doc with the body of the request,
+// decodes the result back into doc and validates it. Members doc does not
+// have are rejected. doc is cleared before decoding, so that members the
+// patch removes or sets to null end up empty rather than unchanged. Every
+// failure is a *validation.Error.
+func applyPatch(w http.ResponseWriter, r *http.Request, doc interface{}) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	// A plain JSON object is read as a merge patch
+	if err == nil && mediaType == "application/json" {
+		mediaType = patch.MergePatchType
+	}
+	if err != nil || (mediaType != patch.MergePatchType && mediaType != patch.JSONPatchType) {
+		return &validation.Error{
+			Status:  http.StatusUnsupportedMediaType,
+			Code:    "unsupported_media_type",
+			Message: "The body must be " + patch.MergePatchType + " or " + patch.JSONPatchType,
+		}
+	}
+
+	var body json.RawMessage
+	if err := validation.DecodeJSON(w, r, &body); err != nil {
+		return err
+	}
+
+	original, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	patched, err := patch.Apply(mediaType, original, body)
+	if errors.Is(err, patch.ErrTestFailed) {
+		return &validation.Error{Status: http.StatusConflict, Code: "test_failed", Message: err.Error()}
+	}
+	if err != nil {
+		return &validation.Error{Status: http.StatusUnprocessableEntity, Code: "invalid_patch", Message: err.Error()}
+	}
+
+	current := reflect.ValueOf(doc).Elem()
+	current.Set(reflect.Zero(current.Type()))
+	if err := validation.Unmarshal(patched, doc); err != nil {
+		return err
+	}
+	return validation.Struct(doc)
+}
+
+// saveContentDocument validates doc, resolves its stacks and writes it into
+// content, then returns the stored content
+func (h *Handler) saveContentDocument(r *http.Request, content models.Content, doc contentDocument) (models.Content, error) {
+	if err := validation.Struct(&doc); err != nil {
+		return models.Content{}, err
+	}
+	stacks, err := h.fetchStacks(r, doc.Stack)
+	if err != nil {
+		return models.Content{}, err
+	}
+
+	content.Name = doc.Name
+	content.Description = doc.Description
+	content.Url = doc.Url
+	content.ImgUrl = doc.ImgUrl
+	content.Stack = stacks
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	if err := h.store.Contents.UpdateContent(ctx, content); err != nil {
+		return models.Content{}, problem.Internal("Error updating content", err)
+	}
+	updated, err := h.store.Contents.GetContent(ctx, content.ID)
+	if err != nil {
+		return models.Content{}, problem.Internal("Error fetching content", err)
+	}
+	return updated, nil
+}
+
+// PatchContentHandler applies a JSON Merge Patch or a JSON Patch to the
+// name, description, url, imgUrl and stack names of a content
+func (h *Handler) PatchContentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Accept-Patch", acceptPatch)
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
+		return
+	}
+
+	content, err := h.findOwnedContent(r, mux.Vars(r)["id"], userID)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	doc := newContentDocument(content)
+	if err := applyPatch(w, r, &doc); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	updated, err := h.saveContentDocument(r, content, doc)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, updated)
+}
+
+// PatchStackHandler applies a JSON Merge Patch or a JSON Patch to the name
+// and color of a stack and propagates them to the contents using it
+func (h *Handler) PatchStackHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Accept-Patch", acceptPatch)
+
+	stackID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest("Invalid stack ID"))
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	stack, err := h.store.Stacks.GetStack(ctx, stackID)
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, problem.NotFound("Stack not found"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error fetching stack", err))
+		return
+	}
+
+	doc := stackDocument{Name: stack.Name, Color: stack.Color}
+	if err := applyPatch(w, r, &doc); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	// Stack names are unique
+	stack.Name, stack.Color = doc.Name, doc.Color
+	err = h.store.Stacks.UpdateStack(ctx, stack)
+	if errors.Is(err, store.ErrDuplicate) {
+		problem.Write(w, r, problem.Conflict("Stack with the same name already exists"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error updating stack", err))
+		return
+	}
+	if _, err := h.store.Contents.UpdateEmbeddedStack(ctx, stack); err != nil {
+		problem.Write(w, r, problem.Internal("Error updating the contents of the stack", err))
+		return
+	}
+
+	writeJSON(w, r, stack)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"cms-server/internal/auth"
+	"cms-server/internal/events"
+	"cms-server/internal/models"
+	"cms-server/internal/problem"
+	"cms-server/internal/store"
+	"cms-server/internal/validation"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultReactionTypes are the reactions accepted when none are configured
+var DefaultReactionTypes = []string{"like", "love", "insightful"}
+
+// reactionSummary is returned after a reaction changed
+type reactionSummary struct {
+	Reactions      models.ReactionCounts `json:"reactions"`
+	ViewerReaction string                `json:"viewer_reaction"`
+}
+
+// findContent loads the content named by the {id} path parameter
+func (h *Handler) findContent(r *http.Request) (models.Content, error) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		return models.Content{}, problem.BadRequest("Invalid content ID")
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	content, err := h.store.Contents.GetContent(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return models.Content{}, problem.NotFound("Content not found")
+	}
+	if err != nil {
+		return models.Content{}, problem.Internal("Error fetching content", err)
+	}
+
+	// Hidden contents only exist for their owner and moderators
+	if content.Hidden {
+		userID, _ := getUserIDFromContext(r)
+		if content.UserID != userID && !can(r, auth.HideContent) {
+			return models.Content{}, problem.NotFound("Content not found")
+		}
+	}
+	return content, nil
+}
+
+// addViewerReactions fills ViewerReaction for the authenticated user, if any
+func (h *Handler) addViewerReactions(ctx context.Context, r *http.Request, contents []models.Content) error {
+	userID, ok := getUserIDFromContext(r)
+	if !ok || len(contents) == 0 {
+		return nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(contents))
+	for _, content := range contents {
+		ids = append(ids, content.ID)
+	}
+	reactions, err := h.store.Reactions.UserReactions(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+	for i := range contents {
+		contents[i].ViewerReaction = reactions[contents[i].ID]
+	}
+	return nil
+}
+
+// writeReactionSummary sends the fresh counters of a content
+func (h *Handler) writeReactionSummary(w http.ResponseWriter, r *http.Request, contentID primitive.ObjectID, viewerReaction string) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	content, err := h.store.Contents.GetContent(ctx, contentID)
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error fetching content", err))
+		return
+	}
+	writeJSON(w, r, reactionSummary{Reactions: content.Reactions, ViewerReaction: viewerReaction})
+}
+
+// ReactHandler sets the reaction of the authenticated user on a content.
+// Reacting again with the same type is a no-op, another type replaces it.
+func (h *Handler) ReactHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
+		return
+	}
+
+	var requestBody struct {
+		Type string `json:"type" validate:"required"`
+	}
+	if err := validation.Decode(w, r, &requestBody); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	// The reaction types are configured, so they cannot be declared in a tag
+	if !slices.Contains(h.reactionTypes, requestBody.Type) {
+		problem.Write(w, r, validation.Fields(validation.FieldError{
+			Field:   "type",
+			Code:    "oneof",
+			Message: "must be one of " + strings.Join(h.reactionTypes, ", "),
+		}))
+		return
+	}
+
+	content, err := h.findContent(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	previous, err := h.store.Reactions.React(ctx, content.ID, userID, requestBody.Type)
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error saving reaction", err))
+		return
+	}
+	if previous != requestBody.Type {
+		h.bus.Publish(events.Event{Type: events.ReactionAdded, ActorID: userID, Content: &content, Reaction: requestBody.Type})
+	}
+
+	h.writeReactionSummary(w, r, content.ID, requestBody.Type)
+}
+
+// UnreactHandler removes the reaction of the authenticated user from a content
+func (h *Handler) UnreactHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Internal("Unable to retrieve user ID", nil))
+		return
+	}
+
+	content, err := h.findContent(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	previous, err := h.store.Reactions.Unreact(ctx, content.ID, userID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, problem.Internal("Error removing reaction", err))
+		return
+	}
+	if previous != "" {
+		h.bus.Publish(events.Event{Type: events.ReactionRemoved, ActorID: userID, Content: &content, Reaction: previous})
+	}
+
+	h.writeReactionSummary(w, r, content.ID, "")
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"cms-server/internal/models"
+	"cms-server/internal/problem"
+	"cms-server/internal/search"
+	"cms-server/internal/store"
+)
+
+// searchHit is a single search result with its highlighted snippets
+type searchHit struct {
+	Content    models.Content    `json:"content"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// highlightContent builds the snippets of every field matching the query
+func highlightContent(content models.Content, query search.Query) map[string]string {
+	highlights := map[string]string{}
+	for _, field := range store.ContentFields(content) {
+		for _, value := range field.Values {
+			if snippet, ok := search.Highlight(value, query); ok {
+				if previous, exists := highlights[field.Name]; exists {
+					snippet = previous + ", " + snippet
+				}
+				highlights[field.Name] = snippet
+			}
+		}
+	}
+	return highlights
+}
+
+// SearchHandler searches content names, descriptions and stack names
+func (h *Handler) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := search.ParseQuery(r.URL.Query().Get("q"))
+	if query.Empty() {
+		problem.Write(w, r, invalidQuery("q must not be empty"))
+		return
+	}
+
+	limit := defaultPageLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			problem.Write(w, r, invalidQuery("limit must be a positive integer"))
+			return
+		}
+		limit = min(parsed, maxPageLimit)
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	results, err := h.store.Contents.SearchContents(ctx, query, limit)
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error searching content", err))
+		return
+	}
+
+	hits := make([]searchHit, 0, len(results))
+	for _, result := range results {
+		hits = append(hits, searchHit{
+			Content:    result.Content,
+			Score:      result.Score,
+			Highlights: highlightContent(result.Content, query),
+		})
+	}
+
+	writeJSON(w, r, map[string]interface{}{"items": hits})
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"cms-server/internal/auth"
+	"cms-server/internal/models"
+	"cms-server/internal/problem"
+	"cms-server/internal/store"
+	"cms-server/internal/validation"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	refreshCookieName = "refresh_token"
+	maxDeviceLength   = 256
+)
+
+// sessionView is a session as shown to its owner
+type sessionView struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// tokenResponse carries a token pair to clients that do not use cookies
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func newTokenResponse(accessToken, refreshToken string) tokenResponse {
+	return tokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+	}
+}
+
+// getSessionIDFromContext retrieves the session ID of the access token
+func getSessionIDFromContext(r *http.Request) string {
+	sessionID, _ := r.Context().Value("sessionID").(string)
+	return sessionID
+}
+
+// clientIP returns the address the request came from, as resolved by the
+// ClientIP middleware
+func clientIP(r *http.Request) string {
+	if client, ok := r.Context().Value("clientIP").(string); ok {
+		return client
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// startSession opens a session for the device making the request and returns
+// it with its first refresh token
+func (h *Handler) startSession(ctx context.Context, r *http.Request, userID string) (models.Session, string, error) {
+	refreshToken, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		return models.Session{}, "", err
+	}
+
+	device := r.UserAgent()
+	if len(device) > maxDeviceLength {
+		device = device[:maxDeviceLength]
+	}
+
+	now := time.Now().UTC()
+	session := models.Session{
+		UserID:     userID,
+		TokenHash:  hash,
+		UsedHashes: []string{},
+		Device:     device,
+		IP:         clientIP(r),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(auth.RefreshTokenTTL),
+	}
+	if err := h.store.Sessions.CreateSession(ctx, &session); err != nil {
+		return models.Session{}, "", err
+	}
+	return session, refreshToken, nil
+}
+
+// setAuthCookies stores a token pair in the cookies of the client
+func setAuthCookies(w http.ResponseWriter, accessToken string, accessExpires time.Time, refreshToken string, refreshExpires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:    "token",
+		Value:   accessToken,
+		Path:    "/",
+		Expires: accessExpires,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    refreshToken,
+		Path:     "/",
+		Expires:  refreshExpires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearAuthCookies removes both tokens from the client
+func clearAuthCookies(w http.ResponseWriter) {
+	for _, name := range []string{"token", refreshCookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:   name,
+			Value:  "",
+			Path:   "/",
+			MaxAge: -1,
+		})
+	}
+}
+
+// revokeRequestSession revokes the session identified by the refresh token
+// cookie of the request, or failing that by its access token
+func (h *Handler) revokeRequestSession(ctx context.Context, r *http.Request) error {
+	var sessionID primitive.ObjectID
+	if cookie, err := r.Cookie(refreshCookieName); err == nil && cookie.Value != "" {
+		session, err := h.store.Sessions.FindSessionByTokenHash(ctx, auth.HashRefreshToken(cookie.Value))
+		if err == nil {
+			sessionID = session.ID
+		}
+	}
+	if sessionID.IsZero() {
+		id, err := primitive.ObjectIDFromHex(getSessionIDFromContext(r))
+		if err != nil {
+			return nil
+		}
+		sessionID = id
+	}
+
+	err := h.store.Sessions.RevokeSession(ctx, sessionID, time.Now().UTC())
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// detectRefreshReuse revokes the session a rotated refresh token belonged
+// to: a replayed token means it was stolen, so the whole family goes
+func (h *Handler) detectRefreshReuse(ctx context.Context, hash string) {
+	// The revocation must not be cut short by the client going away
+	ctx, cancel := detachedContext(ctx)
+	defer cancel()
+
+	session, err := h.store.Sessions.FindSessionByUsedHash(ctx, hash)
+	if err != nil {
+		return
+	}
+
+	slog.WarnContext(ctx, "Refresh token reuse detected", "session_id", session.ID.Hex(), "user_id", session.UserID)
+	if err := h.store.Sessions.RevokeSession(ctx, session.ID, time.Now().UTC()); err != nil && !errors.Is(err, store.ErrNotFound) {
+		slog.ErrorContext(ctx, "Could not revoke session", "session_id", session.ID.Hex(), "error", err)
+	}
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new token pair. The
+// token is read from the refresh_token cookie or a {"refresh_token"} body;
+// body clients get the new pair back in the response.
+func (h *Handler) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if r.ContentLength != 0 {
+		if err := validation.DecodeJSON(w, r, &body); err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+	}
+	refreshToken := body.RefreshToken
+	fromBody := refreshToken != ""
+	if !fromBody {
+		if cookie, err := r.Cookie(refreshCookieName); err == nil {
+			refreshToken = cookie.Value
+		}
+	}
+	if refreshToken == "" {
+		problem.Write(w, r, problem.Unauthorized("Missing refresh token"))
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	newToken, newHash, err := auth.NewRefreshToken()
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error generating token", err))
+		return
+	}
+
+	hash := auth.HashRefreshToken(refreshToken)
+	now := time.Now().UTC()
+	session, err := h.store.Sessions.RotateRefreshToken(ctx, hash, newHash, now, now.Add(auth.RefreshTokenTTL))
+	if errors.Is(err, store.ErrNotFound) {
+		h.detectRefreshReuse(ctx, hash)
+		clearAuthCookies(w)
+		problem.Write(w, r, problem.Unauthorized("Invalid refresh token"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error refreshing token", err))
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(session.UserID)
+	if err != nil {
+		problem.Write(w, r, problem.Unauthorized("Invalid refresh token"))
+		return
+	}
+	user, err := h.store.Users.GetUserByID(ctx, userID)
+	if err != nil {
+		problem.Write(w, r, problem.Unauthorized("Invalid refresh token"))
+		return
+	}
+
+	accessToken, expirationTime, err := h.keys.IssueAccessToken(user, session.ID.Hex())
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error generating token", err))
+		return
+	}
+
+	setAuthCookies(w, accessToken, expirationTime, newToken, session.ExpiresAt)
+	if !fromBody {
+		writeJSON(w, r, map[string]string{"message": "Token refreshed successfully"})
+		return
+	}
+	writeJSON(w, r, newTokenResponse(accessToken, newToken))
+}
+
+// GetSessionsHandler lists the active sessions of the caller
+func (h *Handler) GetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized("User ID not found in context"))
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	sessions, err := h.store.Sessions.ListActiveSessions(ctx, userID, time.Now().UTC())
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error fetching sessions", err))
+		return
+	}
+
+	current := getSessionIDFromContext(r)
+	views := make([]sessionView, 0, len(sessions))
+	for _, session := range sessions {
+		views = append(views, sessionView{Session: session, Current: session.ID.Hex() == current})
+	}
+	writeJSON(w, r, map[string]interface{}{"items": views})
+}
+
+// DeleteSessionHandler revokes one session of the caller
+func (h *Handler) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized("User ID not found in context"))
+		return
+	}
+
+	sessionID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest("Invalid session ID"))
+		return
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	// Sessions of other users are reported as missing
+	session, err := h.store.Sessions.GetSession(ctx, sessionID)
+	if err != nil || session.UserID != userID || session.RevokedAt != nil {
+		problem.Write(w, r, problem.NotFound("Session not found"))
+		return
+	}
+
+	if err := h.store.Sessions.RevokeSession(ctx, sessionID, time.Now().UTC()); err != nil && !errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, problem.Internal("Error revoking session", err))
+		return
+	}
+	if sessionID.Hex() == getSessionIDFromContext(r) {
+		clearAuthCookies(w)
+	}
+
+	writeJSON(w, r, map[string]string{"message": "Session revoked successfully"})
+}
+
+// DeleteSessionsHandler revokes every session of the caller but the current one
+func (h *Handler) DeleteSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized("User ID not found in context"))
+		return
+	}
+
+	// A token without a session keeps nothing alive
+	current, _ := primitive.ObjectIDFromHex(getSessionIDFromContext(r))
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	if err := h.store.Sessions.RevokeUserSessions(ctx, userID, current, time.Now().UTC()); err != nil {
+		problem.Write(w, r, problem.Internal("Error revoking sessions", err))
+		return
+	}
+
+	writeJSON(w, r, map[string]string{"message": "Other sessions revoked successfully"})
+}
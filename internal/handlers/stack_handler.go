@@ -2,180 +2,262 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
-	"time"
 
-	"cms-server/internal/database"
 	"cms-server/internal/models"
+	"cms-server/internal/problem"
+	"cms-server/internal/store"
+	"cms-server/internal/validation"
 
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // CreateStackHandler handles the creation of a new stack
-func CreateStackHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateStackHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Create a new instance of Stack
-	var stack models.Stack
-
-	// Decode the request body into the stack struct
-	err := json.NewDecoder(r.Body).Decode(&stack)
-	if err != nil || stack.Name == "" || stack.Color == "" {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	// Decode and validate the request body
+	var doc stackDocument
+	if err := validation.Decode(w, r, &doc); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
-
-	// Get the stacks collection
-	collection := database.GetCollection("stacks")
+	stack := models.Stack{Name: doc.Name, Color: doc.Color}
 
 	// Set a timeout context for the database operation
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := dbContext(r)
 	defer cancel()
 
-	// Check if the stack name already exists
-	var existingStack models.Stack
-	err = collection.FindOne(ctx, bson.M{"name": stack.Name}).Decode(&existingStack)
-	if err == nil {
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Stack with the same name already exists"})
-		return
-	}
-
 	// Assign a new ObjectID to the stack
 	stack.ID = primitive.NewObjectID()
 
-	// Insert the stack into the database
-	_, err = collection.InsertOne(ctx, stack)
+	// Insert the stack into the database; the unique index on the name
+	// rejects a taken name, even when two requests race
+	err := h.store.Stacks.CreateStack(ctx, &stack)
+	if errors.Is(err, store.ErrDuplicate) {
+		problem.Write(w, r, problem.Conflict("Stack with the same name already exists"))
+		return
+	}
 	if err != nil {
-		http.Error(w, "Error inserting stack", http.StatusInternalServerError)
+		problem.Write(w, r, problem.Internal("Error inserting stack", err))
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(stack)
+	writeJSON(w, r, stack)
 }
 
-// GetStacksHandler retrieves all stacks from the database
-func GetStacksHandler(w http.ResponseWriter, r *http.Request) {
+// GetStacksHandler retrieves a page of stacks from the database
+func (h *Handler) GetStacksHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get the stacks collection
-	collection := database.GetCollection("stacks")
-
-	// Set up a context with a timeout for querying MongoDB
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// Create a slice to hold the stack documents
-	var stacks []models.Stack
-
-	// Retrieve all documents
-	cursor, err := collection.Find(ctx, bson.M{})
+	// Read the requested page from the query string
+	opts, err := parseListOptions(r, namedOrders)
 	if err != nil {
-		http.Error(w, "Error fetching stacks", http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
 
-	// Decode documents into the stacks slice
-	for cursor.Next(ctx) {
-		var stack models.Stack
-		if err := cursor.Decode(&stack); err != nil {
-			http.Error(w, "Error decoding stack", http.StatusInternalServerError)
-			return
-		}
-		stacks = append(stacks, stack)
-	}
+	// Set up a context with a timeout for querying the store
+	ctx, cancel := dbContext(r)
+	defer cancel()
 
-	// Check for cursor iteration errors
-	if err := cursor.Err(); err != nil {
-		http.Error(w, "Error fetching stacks", http.StatusInternalServerError)
+	// Retrieve one page of documents
+	stacks, err := h.store.Stacks.ListStacks(ctx, opts)
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error fetching stacks", err))
 		return
 	}
 
 	// Return the stacks as JSON
-	json.NewEncoder(w).Encode(stacks)
+	writeJSON(w, r, stacks)
 }
 
 // EditStackHandler updates an existing stack by ID
-func EditStackHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) EditStackHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Extract stack ID from the request URL
 	params := mux.Vars(r)
 	stackID, err := primitive.ObjectIDFromHex(params["id"])
 	if err != nil {
-		http.Error(w, "Invalid stack ID", http.StatusBadRequest)
+		problem.Write(w, r, problem.BadRequest("Invalid stack ID"))
 		return
 	}
 
-	// Decode the request body into a stack struct
-	var updatedStack models.Stack
-	err = json.NewDecoder(r.Body).Decode(&updatedStack)
-	if err != nil || updatedStack.Name == "" || updatedStack.Color == "" {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	// Decode and validate the request body
+	var doc stackDocument
+	if err := validation.Decode(w, r, &doc); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 
-	// Set the update fields
-	update := bson.M{
-		"$set": bson.M{
-			"name":  updatedStack.Name,
-			"color": updatedStack.Color,
-		},
-	}
-
-	// Get the stacks collection
-	collection := database.GetCollection("stacks")
+	updatedStack := models.Stack{ID: stackID, Name: doc.Name, Color: doc.Color}
 
 	// Set a timeout context for the database operation
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := dbContext(r)
 	defer cancel()
 
 	// Update the stack in the database
-	_, err = collection.UpdateOne(ctx, bson.M{"_id": stackID}, update)
+	err = h.store.Stacks.UpdateStack(ctx, updatedStack)
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, problem.NotFound("Stack not found"))
+		return
+	}
+	if errors.Is(err, store.ErrDuplicate) {
+		problem.Write(w, r, problem.Conflict("Stack with the same name already exists"))
+		return
+	}
 	if err != nil {
-		http.Error(w, "Error updating stack", http.StatusInternalServerError)
+		problem.Write(w, r, problem.Internal("Error updating stack", err))
 		return
 	}
 
-	updatedStack.ID = stackID
+	// Contents embed copies of the stack, bring them up to date; repeating
+	// the request finishes a propagation that failed halfway
+	if _, err := h.store.Contents.UpdateEmbeddedStack(ctx, updatedStack); err != nil {
+		problem.Write(w, r, problem.Internal("Error updating the contents of the stack", err))
+		return
+	}
 
 	// Return the updated stack as a response
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(updatedStack)
+	writeJSON(w, r, updatedStack)
 }
 
-// DeleteStackHandler deletes a stack by ID
-func DeleteStackHandler(w http.ResponseWriter, r *http.Request) {
+// Policies deciding what happens to the contents using a deleted stack
+const (
+	// StackDeleteBlock refuses to delete a stack used by any content
+	StackDeleteBlock = "block"
+	// StackDeleteCascade removes the stack from the contents using it
+	StackDeleteCascade = "cascade"
+	// StackDeleteReassign moves the contents to another stack
+	StackDeleteReassign = "reassign"
+)
+
+// findStack loads a stack by its ID or, failing that, by its name
+func (h *Handler) findStack(ctx context.Context, idOrName string) (models.Stack, error) {
+	if id, err := primitive.ObjectIDFromHex(idOrName); err == nil {
+		stack, err := h.store.Stacks.GetStack(ctx, id)
+		if !errors.Is(err, store.ErrNotFound) {
+			return stack, err
+		}
+	}
+	return h.store.Stacks.GetStackByName(ctx, idOrName)
+}
+
+// DeleteStackHandler deletes a stack by ID. The policy query parameter
+// decides what happens to the contents using it: block (default), cascade,
+// or reassign to the stack given by reassign_to.
+func (h *Handler) DeleteStackHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Extract stack ID from the request URL
 	params := mux.Vars(r)
 	stackID, err := primitive.ObjectIDFromHex(params["id"])
 	if err != nil {
-		http.Error(w, "Invalid stack ID", http.StatusBadRequest)
+		problem.Write(w, r, problem.BadRequest("Invalid stack ID"))
 		return
 	}
 
-	// Get the stacks collection
-	collection := database.GetCollection("stacks")
+	policy := r.URL.Query().Get("policy")
+	if policy == "" {
+		policy = StackDeleteBlock
+	}
+	if policy != StackDeleteBlock && policy != StackDeleteCascade && policy != StackDeleteReassign {
+		problem.Write(w, r, problem.BadRequest("Invalid policy, expected block, cascade or reassign"))
+		return
+	}
 
 	// Set a timeout context for the database operation
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := dbContext(r)
 	defer cancel()
 
-	// Delete the stack from the database
-	_, err = collection.DeleteOne(ctx, bson.M{"_id": stackID})
+	_, err = h.store.Stacks.GetStack(ctx, stackID)
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, problem.NotFound("Stack not found"))
+		return
+	}
 	if err != nil {
-		http.Error(w, "Error deleting stack", http.StatusInternalServerError)
+		problem.Write(w, r, problem.Internal("Error fetching stack", err))
 		return
 	}
 
+	var target models.Stack
+	if policy == StackDeleteReassign {
+		target, err = h.findStack(ctx, r.URL.Query().Get("reassign_to"))
+		if errors.Is(err, store.ErrNotFound) {
+			problem.Write(w, r, problem.BadRequest("Stack to reassign to not found"))
+			return
+		}
+		if err != nil {
+			problem.Write(w, r, problem.Internal("Error fetching stack", err))
+			return
+		}
+		if target.ID == stackID {
+			problem.Write(w, r, problem.BadRequest("Cannot reassign a stack to itself"))
+			return
+		}
+	}
+
+	// A used stack is never deleted under the block policy. The other
+	// policies update the contents before deleting the stack, so that a
+	// failure leaves the stack in place and the request can be retried.
+	var updated int64
+	switch policy {
+	case StackDeleteBlock:
+		used, err := h.store.Contents.CountContents(ctx, store.ContentFilter{StackID: stackID, IncludeHidden: true})
+		if err != nil {
+			problem.Write(w, r, problem.Internal("Error counting contents", err))
+			return
+		}
+		if used > 0 {
+			problem.Write(w, r, problem.New(http.StatusConflict, "stack_in_use",
+				"Stack is used by contents, delete it with policy=cascade or policy=reassign").With("contents", used))
+			return
+		}
+	case StackDeleteCascade, StackDeleteReassign:
+		if updated, err = h.store.Contents.ReplaceEmbeddedStack(ctx, stackID, replacement(target)); err != nil {
+			problem.Write(w, r, problem.Internal("Error updating the contents of the stack", err))
+			return
+		}
+	}
+
+	err = h.store.Stacks.DeleteStack(ctx, stackID)
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, problem.NotFound("Stack not found"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error deleting stack", err))
+		return
+	}
+
+	// Contents written while the stack was being deleted may still embed
+	// it, sweep them once more now that no new content can pick it up
+	if policy != StackDeleteBlock {
+		sweepCtx, cancelSweep := detachedContext(ctx)
+		defer cancelSweep()
+		late, err := h.store.Contents.ReplaceEmbeddedStack(sweepCtx, stackID, replacement(target))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error updating the contents of a deleted stack", "stack_id", stackID.Hex(), "error", err)
+		}
+		updated += late
+	}
+
 	// Return success message
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Stack deleted successfully"})
+	writeJSON(w, r, map[string]interface{}{"message": "Stack deleted successfully", "contents_updated": updated})
+}
+
+// replacement is the stack taking the place of a deleted one in its
+// contents, nil to remove it
+func replacement(target models.Stack) *models.Stack {
+	if target.ID.IsZero() {
+		return nil
+	}
+	return &target
 }
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cms-server/internal/auth"
+	"cms-server/internal/metrics"
+	"cms-server/internal/problem"
+	"cms-server/internal/realtime"
+
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// heartbeatInterval is how often idle streams are pinged
+	heartbeatInterval = 25 * time.Second
+	// streamWriteTimeout bounds a single WebSocket write
+	streamWriteTimeout = 10 * time.Second
+	// pongTimeout is how long a WebSocket client may stay silent
+	pongTimeout = 2 * heartbeatInterval
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Failed handshakes are answered with a problem document as well
+	Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		problem.Write(w, r, problem.FromStatus(status, "The WebSocket handshake failed"))
+	},
+}
+
+// streamCommand is a subscription change sent by WebSocket clients, e.g.
+// {"action": "watch", "content_ids": ["..."]}
+type streamCommand struct {
+	Action     string   `json:"action"`
+	Topics     []string `json:"topics"`
+	ContentIDs []string `json:"content_ids"`
+}
+
+// splitList parses a comma separated query parameter
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseContentIDs keeps the valid ObjectIDs of ids
+func parseContentIDs(ids []string) []primitive.ObjectID {
+	var objectIDs []primitive.ObjectID
+	for _, id := range ids {
+		if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+			objectIDs = append(objectIDs, objectID)
+		}
+	}
+	return objectIDs
+}
+
+// visibleContentIDs keeps the ids of the contents that exist and that the
+// user of r may see, so that a stream never leaks the counters of a hidden
+// content. Hidden contents are visible to their owner and moderators only;
+// the hub checks it again for contents hidden once watched.
+func (h *Handler) visibleContentIDs(r *http.Request, ids []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	contents, err := h.store.Contents.GetContentsByID(ctx, ids)
+	if err != nil {
+		return nil, problem.Internal("Error fetching contents", err)
+	}
+
+	userID, _ := getUserIDFromContext(r)
+	moderator := can(r, auth.HideContent)
+	visible := make([]primitive.ObjectID, 0, len(contents))
+	for _, content := range contents {
+		if !content.Hidden || content.UserID == userID || moderator {
+			visible = append(visible, content.ID)
+		}
+	}
+	return visible, nil
+}
+
+// registerStreamClient connects the authenticated user to the hub with the
+// topics and contents of the query string. topics defaults to every topic,
+// content lists up to realtime.MaxWatched contents whose counters are pushed;
+// contents that do not exist or that the user may not see are left out.
+func (h *Handler) registerStreamClient(r *http.Request) (*realtime.Client, error) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		return nil, problem.Internal("Unable to retrieve user ID", nil)
+	}
+
+	topics := splitList(r.URL.Query().Get("topics"))
+	if len(topics) == 0 {
+		topics = []string{realtime.TopicFeed, realtime.TopicNotifications}
+	}
+
+	contentIDs := splitList(r.URL.Query().Get("content"))
+	if len(contentIDs) > realtime.MaxWatched {
+		return nil, invalidQuery("content may list at most %d contents", realtime.MaxWatched)
+	}
+	watched, err := h.visibleContentIDs(r, parseContentIDs(contentIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := h.hub.Register(userID, can(r, auth.HideContent), topics...)
+	if errors.Is(err, realtime.ErrUnknownTopic) {
+		return nil, invalidQuery("%s", err.Error())
+	}
+	if err != nil {
+		return nil, problem.New(http.StatusServiceUnavailable, problem.CodeUnavailable, "Server is shutting down")
+	}
+	// Within the limit, since the client watches nothing yet
+	client.Watch(watched...)
+	return client, nil
+}
+
+// StreamHandler pushes events to the authenticated user as Server-Sent Events
+func (h *Handler) StreamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		problem.Write(w, r, problem.Internal("Streaming unsupported", nil))
+		return
+	}
+
+	client, err := h.registerStreamClient(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	defer h.hub.Unregister(client)
+	connections := metrics.StreamConnections.WithLabelValues(metrics.TransportSSE)
+	connections.Inc()
+	defer connections.Dec()
+
+	// The stream outlives the read and write timeouts of the server: lift
+	// the read deadline and bound each write instead
+	controller := http.NewResponseController(w)
+	controller.SetReadDeadline(time.Time{})
+	controller.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client.Done():
+			return
+		case <-heartbeat.C:
+			controller.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			fmt.Fprint(w, ": ping\n\n")
+		case msg := <-client.Messages():
+			data, err := json.Marshal(msg.Data)
+			if err != nil {
+				continue
+			}
+			controller.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
+// WebSocketHandler pushes events to the authenticated user over a WebSocket.
+// Clients may change their subscription by sending stream commands.
+func (h *Handler) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	client, err := h.registerStreamClient(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	defer h.hub.Unregister(client)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	connections := metrics.StreamConnections.WithLabelValues(metrics.TransportWebSocket)
+	connections.Inc()
+	defer connections.Dec()
+
+	go h.readStreamCommands(r, conn, client)
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-client.Done():
+			conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "stream closed"),
+				time.Now().Add(streamWriteTimeout),
+			)
+			return
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		case msg := <-client.Messages():
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readStreamCommands applies subscription changes until the connection drops.
+// Contents are watched only if the user of r may see them. Refused commands
+// are answered with an error message.
+func (h *Handler) readStreamCommands(r *http.Request, conn *websocket.Conn, client *realtime.Client) {
+	defer client.Close()
+
+	conn.SetReadLimit(4096)
+	conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
+
+	for {
+		var cmd streamCommand
+		if err := conn.ReadJSON(&cmd); err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(pongTimeout))
+
+		switch cmd.Action {
+		case "subscribe":
+			if err := client.Subscribe(cmd.Topics...); err != nil {
+				client.RejectCommand(cmd.Action, err)
+			}
+		case "unsubscribe":
+			client.Unsubscribe(cmd.Topics...)
+		case "watch":
+			if len(cmd.ContentIDs) > realtime.MaxWatched {
+				client.RejectCommand(cmd.Action, realtime.ErrTooManyWatched)
+				continue
+			}
+			watched, err := h.visibleContentIDs(r, parseContentIDs(cmd.ContentIDs))
+			if err != nil {
+				continue
+			}
+			if err := client.Watch(watched...); err != nil {
+				client.RejectCommand(cmd.Action, err)
+			}
+		case "unwatch":
+			client.Unwatch(parseContentIDs(cmd.ContentIDs)...)
+		}
+	}
+}
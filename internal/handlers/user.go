@@ -2,45 +2,56 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
-	"time"
+	"sync"
 
-	"cms-server/internal/database"
+	"cms-server/internal/metrics"
 	"cms-server/internal/models"
+	"cms-server/internal/problem"
+	"cms-server/internal/ratelimit"
+	"cms-server/internal/store"
+	"cms-server/internal/validation"
 
-	"github.com/dgrijalva/jwt-go"
-	"go.mongodb.org/mongo-driver/bson"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtKey = []byte("my_secret_key")
-
 type Credentials struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required,username"`
+	Email    string `json:"email" validate:"required,max=254,email"`
+	Password string `json:"password" validate:"required,password"`
 }
 
-type Claims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
-	jwt.StandardClaims
+// loginRequest is the body of /login. The password is only checked against
+// the stored hash, accounts created before the strength rules still log in.
+type loginRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+	// ReturnToken asks /login to return the token pair in the body, for
+	// clients sending it in the Authorization header instead of cookies
+	ReturnToken bool `json:"return_token,omitempty"`
 }
 
+// dummyPasswordHash is compared against the password of a login with an
+// unknown username, to take as long as checking a real one
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a password of anyone"), bcrypt.DefaultCost)
+	return string(hash)
+})
+
 // Register a new user
-func RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
 	var creds Credentials
-	err := json.NewDecoder(r.Body).Decode(&creds)
-	if err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	if err := validation.Decode(w, r, &creds); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcrypt.DefaultCost)
 	if err != nil {
-		http.Error(w, "Could not create user", http.StatusInternalServerError)
+		problem.Write(w, r, problem.Internal("Could not create user", err))
 		return
 	}
 
@@ -48,76 +59,121 @@ func RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
 		Username: creds.Username,
 		Email:    creds.Email,
 		Password: string(hashedPassword),
+		Role:     models.RoleUser,
 	}
 
-	collection := database.GetCollection("users")
-	_, err = collection.InsertOne(context.TODO(), user)
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	// The unique indexes of the users collection reject taken usernames and
+	// emails, even when two registrations race
+	err = h.store.Users.CreateUser(ctx, &user)
+	if errors.Is(err, store.ErrDuplicate) {
+		problem.Write(w, r, problem.Conflict("Username or email is already taken"))
+		return
+	}
 	if err != nil {
-		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		problem.Write(w, r, problem.Internal("Error creating user", err))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "User registered successfully"})
+	writeJSON(w, r, map[string]string{"message": "User registered successfully"})
 }
 
 // Log in a user and return JWT
-func LoginUserHandler(w http.ResponseWriter, r *http.Request) {
-	var creds Credentials
-	err := json.NewDecoder(r.Body).Decode(&creds)
-	if err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+func (h *Handler) LoginUserHandler(w http.ResponseWriter, r *http.Request) {
+	var creds loginRequest
+	if err := validation.Decode(w, r, &creds); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 
-	collection := database.GetCollection("users")
-	var user models.User
-	err = collection.FindOne(context.TODO(), bson.M{"username": creds.Username}).Decode(&user)
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	// A locked out username is not even checked, so guesses cannot go on.
+	// When the lockout store fails the login goes ahead.
+	locked, err := h.logins.Locked(ctx, creds.Username)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusUnauthorized)
+		slog.WarnContext(r.Context(), "Could not check the login lockout", "error", err)
+	}
+	if locked > 0 {
+		metrics.RateLimited.WithLabelValues(metrics.LockoutGroup).Inc()
+		w.Header().Set("Retry-After", ratelimit.DeltaSeconds(locked))
+		problem.Write(w, r, problem.New(http.StatusTooManyRequests, problem.CodeLoginLocked, "Too many failed logins for this username, retry later"))
 		return
 	}
 
-	// Compare the password
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password))
-	if err != nil {
-		http.Error(w, "Incorrect password", http.StatusUnauthorized)
+	// Unknown usernames are compared against a dummy hash and answered like
+	// wrong passwords, so that neither the answer nor its time tell which
+	// usernames exist
+	user, err := h.store.Users.GetUserByUsername(ctx, creds.Username)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, problem.Internal("Error fetching user", err))
 		return
 	}
+	known := err == nil
+	hash := user.Password
+	if !known {
+		hash = dummyPasswordHash()
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(creds.Password)); err != nil || !known {
+		h.loginFailed(ctx, r, creds.Username)
+		problem.Write(w, r, problem.Unauthorized("Invalid username or password"))
+		return
+	}
+	if err := h.logins.Reset(ctx, creds.Username); err != nil {
+		slog.WarnContext(r.Context(), "Could not reset the failed logins", "error", err)
+	}
 
-	// Create JWT token with user ID
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		UserID:   user.ID.Hex(), // Convert ObjectID to string
-		Username: creds.Username,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+	// Open a session for this device and hand out its first token pair
+	session, refreshToken, err := h.startSession(ctx, r, user.ID.Hex())
+	if err != nil {
+		problem.Write(w, r, problem.Internal("Error creating session", err))
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	tokenString, expirationTime, err := h.keys.IssueAccessToken(user, session.ID.Hex())
 	if err != nil {
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		problem.Write(w, r, problem.Internal("Error generating token", err))
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:    "token",
-		Value:   tokenString,
-		Expires: expirationTime,
-	})
+	metrics.Logins.WithLabelValues(metrics.LoginSuccess).Inc()
+	setAuthCookies(w, tokenString, expirationTime, refreshToken, session.ExpiresAt)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "User login successfully"})
+	if creds.ReturnToken {
+		writeJSON(w, r, newTokenResponse(tokenString, refreshToken))
+		return
+	}
+	writeJSON(w, r, map[string]string{"message": "User login successfully"})
+}
+
+// loginFailed counts a failed login of username towards its lockout. Unknown
+// usernames count too, so the lockout does not tell which ones exist.
+func (h *Handler) loginFailed(ctx context.Context, r *http.Request, username string) {
+	metrics.Logins.WithLabelValues(metrics.LoginFailure).Inc()
+	locked, err := h.logins.Fail(ctx, username)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Could not record the failed login", "error", err)
+		return
+	}
+	if locked > 0 {
+		slog.WarnContext(r.Context(), "Username locked out after failed logins", "username", username, "locked_for", locked.String())
+	}
 }
 
-// LogoutUserHandler handles user logout
-func LogoutUserHandler(w http.ResponseWriter, r *http.Request) {
-	http.SetCookie(w, &http.Cookie{
-		Name:   "token",
-		Value:  "",
-		MaxAge: -1,
-	})
+// LogoutUserHandler revokes the session of the caller and clears its cookies
+func (h *Handler) LogoutUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	if err := h.revokeRequestSession(ctx, r); err != nil {
+		slog.WarnContext(r.Context(), "Could not revoke session on logout", "error", err)
+	}
+
+	clearAuthCookies(w)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "User logged out successfully"})
+	writeJSON(w, r, map[string]string{"message": "User logged out successfully"})
 }
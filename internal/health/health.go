@@ -0,0 +1,141 @@
+// Package health answers the liveness and readiness probes of the
+// orchestrator. Liveness only tells that the process serves requests;
+// readiness runs a check per dependency and fails while one of them fails
+// or while the server shuts down.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkTimeout bounds every check of a readiness probe
+const checkTimeout = 2 * time.Second
+
+// Check reports whether a dependency is usable
+type Check func(ctx context.Context) error
+
+// Result is the outcome of one check
+type Result struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report is the body of the readiness probe
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker holds the readiness checks of the server
+type Checker struct {
+	mu           sync.RWMutex
+	checks       map[string]Check
+	shuttingDown atomic.Bool
+}
+
+// NewChecker returns a Checker without checks
+func NewChecker() *Checker {
+	return &Checker{checks: map[string]Check{}}
+}
+
+// Add registers check under name, replacing any check of that name
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// SetShuttingDown makes every later readiness probe fail so that traffic
+// moves away before the server stops
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Run runs every check concurrently and returns the report
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mu.RUnlock()
+
+	results := make([]Result, len(names))
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = run(ctx, checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	report := Report{Status: "ready", Checks: make(map[string]Result, len(names))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != "ok" {
+			report.Status = "not_ready"
+		}
+	}
+	if c.shuttingDown.Load() {
+		report.Status = "shutting_down"
+	}
+	return report
+}
+
+// run runs one check within checkTimeout, turning panics into failures
+func run(ctx context.Context, check Check) (result Result) {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		if p := recover(); p != nil {
+			result = Result{Status: "failing", Error: "check panicked"}
+		}
+		result.DurationMS = time.Since(start).Milliseconds()
+	}()
+
+	err := check(ctx)
+	if err == nil {
+		return Result{Status: "ok"}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Result{Status: "failing", Error: "timed out"}
+	}
+	return Result{Status: "failing", Error: err.Error()}
+}
+
+// LiveHandler answers /healthz: the process is up and serving
+func (c *Checker) LiveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ReadyHandler answers /readyz with the result of every check, and 503
+// when one of them fails or the server is shutting down
+func (c *Checker) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != "ready" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,85 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name  string
+		check Check
+		want  Result
+	}{
+		{"a passing check", func(context.Context) error { return nil }, Result{Status: "ok"}},
+		{"a failing check", func(context.Context) error { return errors.New("unreachable") }, Result{Status: "failing", Error: "unreachable"}},
+		{"a check timing out", func(context.Context) error { return context.DeadlineExceeded }, Result{Status: "failing", Error: "timed out"}},
+		{"a check panicking", func(context.Context) error { panic("boom") }, Result{Status: "failing", Error: "check panicked"}},
+		{"a check with a deadline", func(ctx context.Context) error {
+			if _, ok := ctx.Deadline(); !ok {
+				return errors.New("no deadline")
+			}
+			return nil
+		}, Result{Status: "ok"}},
+	}
+	for _, tt := range tests {
+		c := NewChecker()
+		c.Add("ok", func(context.Context) error { return nil })
+		c.Add("dependency", tt.check)
+		report := c.Run(context.Background())
+
+		got := report.Checks["dependency"]
+		got.DurationMS = 0
+		if got != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.name, got, tt.want)
+		}
+		wantStatus := "ready"
+		if tt.want.Status != "ok" {
+			wantStatus = "not_ready"
+		}
+		if report.Status != wantStatus || len(report.Checks) != 2 {
+			t.Errorf("%s: reported %+v, want %s", tt.name, report, wantStatus)
+		}
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	c := NewChecker()
+	failure := error(nil)
+	c.Add("dependency", func(context.Context) error { return failure })
+
+	probe := func() (int, Report) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		c.ReadyHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+		var report Report
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("decoding %s: %v", w.Body, err)
+		}
+		return w.Code, report
+	}
+
+	if status, report := probe(); status != http.StatusOK || report.Status != "ready" {
+		t.Errorf("probe with passing checks: %d %+v", status, report)
+	}
+	failure = errors.New("unreachable")
+	if status, report := probe(); status != http.StatusServiceUnavailable || report.Status != "not_ready" {
+		t.Errorf("probe with a failing check: %d %+v", status, report)
+	}
+	failure = nil
+	c.SetShuttingDown()
+	if status, report := probe(); status != http.StatusServiceUnavailable || report.Status != "shutting_down" {
+		t.Errorf("probe while shutting down: %d %+v", status, report)
+	}
+
+	// Liveness does not depend on the checks
+	w := httptest.NewRecorder()
+	c.LiveHandler(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("live probe while shutting down: %d", w.Code)
+	}
+}
@@ -0,0 +1,85 @@
+// Package logging sets up the structured logger of the server. Records are
+// written as JSON lines; the ones logged with the context of a request
+// carry its request ID and trace ID, and the values of sensitive keys such
+// as passwords, tokens and cookies are redacted wherever they appear.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"cms-server/internal/config"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redacted replaces the values of sensitive keys
+const redacted = "[redacted]"
+
+// sensitiveKeys are always redacted, matched case-insensitively; the
+// configuration adds to them
+var sensitiveKeys = []string{
+	"password",
+	"authorization",
+	"cookie",
+	"set-cookie",
+	"token",
+	"access_token",
+	"refresh_token",
+	"secret",
+	"jwt_secret",
+}
+
+// Levels by name, as configured
+var levels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// New returns a JSON logger writing to w at the level of cfg, redacting the
+// sensitive keys and the ones listed by cfg
+func New(w io.Writer, cfg config.Log) *slog.Logger {
+	redact := map[string]bool{}
+	for _, key := range append(sensitiveKeys, cfg.Redact...) {
+		redact[strings.ToLower(key)] = true
+	}
+
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: levels[cfg.Level],
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if redact[strings.ToLower(attr.Key)] {
+				return slog.String(attr.Key, redacted)
+			}
+			return attr
+		},
+	})
+	return slog.New(contextHandler{handler})
+}
+
+// contextHandler adds the request ID and the trace and span IDs of the
+// context to records
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID, ok := ctx.Value("requestID").(string); ok {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
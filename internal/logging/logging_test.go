@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"cms-server/internal/config"
+)
+
+func TestNew(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(&out, config.Log{Level: "info", Redact: []string{"Email"}})
+	ctx := context.WithValue(context.Background(), "requestID", "req-1")
+
+	logger.DebugContext(ctx, "dropped")
+	logger.InfoContext(ctx, "kept",
+		"user", "alice",
+		"Password", "hunter2",
+		"email", "alice@example.com",
+		slog.Group("headers", "Authorization", "Bearer abc", "Accept", "*/*"),
+	)
+	logger.Warn("without a request")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2:\n%s", len(lines), out.String())
+	}
+	var record struct {
+		Msg       string            `json:"msg"`
+		User      string            `json:"user"`
+		Password  string            `json:"Password"`
+		Email     string            `json:"email"`
+		Headers   map[string]string `json:"headers"`
+		RequestID string            `json:"request_id"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("decoding %s: %v", lines[0], err)
+	}
+	if record.Msg != "kept" || record.User != "alice" || record.RequestID != "req-1" || record.Headers["Accept"] != "*/*" {
+		t.Errorf("logged %s", lines[0])
+	}
+	for _, value := range []string{record.Password, record.Email, record.Headers["Authorization"]} {
+		if value != redacted {
+			t.Errorf("a sensitive value was logged as %q", value)
+		}
+	}
+	if strings.Contains(lines[1], "request_id") {
+		t.Errorf("a record without a request logged %s", lines[1])
+	}
+}
@@ -0,0 +1,120 @@
+// Package metrics defines the Prometheus collectors of the server and
+// serves them on /metrics in the text exposition format. HTTP requests are
+// recorded by middleware.Metrics, MongoDB commands by MongoMonitor, rate
+// limited requests by middleware.RateLimiter, and logins and live streams by
+// the handlers.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the metrics of the server
+const namespace = "cms"
+
+// Registry holds every collector served by Handler
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts the requests served by method, route template and
+	// status code
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes the time taken to serve requests by
+	// method and route template. Streams count for as long as they last.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve HTTP requests, by method and route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// Logins counts the login attempts by result, success or failure
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_logins_total",
+		Help:      "Login attempts, by result.",
+	}, []string{"result"})
+
+	// RateLimited counts the requests rejected for exceeding the rate of
+	// their route group, auth, write or read, or for a locked out username
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected by the rate limits, by route group.",
+	}, []string{"group"})
+
+	// MongoCommandDuration observes the time taken by MongoDB commands by
+	// collection and command name
+	MongoCommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongo_command_duration_seconds",
+		Help:      "Time taken by MongoDB commands, by collection and command.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"collection", "command"})
+
+	// MongoCommandFailures counts the MongoDB commands that failed by
+	// collection and command name
+	MongoCommandFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mongo_command_failures_total",
+		Help:      "MongoDB commands that failed, by collection and command.",
+	}, []string{"collection", "command"})
+
+	// StreamConnections gauges the open live streams by transport, sse or
+	// websocket
+	StreamConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stream_connections",
+		Help:      "Open live update streams, by transport.",
+	}, []string{"transport"})
+)
+
+// Login results
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+// LockoutGroup labels the logins rejected for a locked out username
+const LockoutGroup = "lockout"
+
+// Stream transports
+const (
+	TransportSSE       = "sse"
+	TransportWebSocket = "websocket"
+)
+
+func init() {
+	Registry.MustRegister(
+		// Go runtime and process statistics
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+
+		HTTPRequests,
+		HTTPRequestDuration,
+		Logins,
+		RateLimited,
+		MongoCommandDuration,
+		MongoCommandFailures,
+		StreamConnections,
+	)
+
+	// Report both results from the start, so rates work before the first
+	// failure
+	Logins.WithLabelValues(LoginSuccess)
+	Logins.WithLabelValues(LoginFailure)
+}
+
+// Handler serves the collectors of Registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
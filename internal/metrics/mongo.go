@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// MongoMonitor returns a command monitor observing every command of the
+// MongoDB client it is set on. The collection of a command is only known
+// when it starts, so it is kept by request ID until the command finishes.
+func MongoMonitor() *event.CommandMonitor {
+	var collections sync.Map
+
+	finished := func(e event.CommandFinishedEvent, failed bool) {
+		collection, ok := collections.LoadAndDelete(e.RequestID)
+		if !ok {
+			return
+		}
+		MongoCommandDuration.WithLabelValues(collection.(string), e.CommandName).Observe(e.Duration.Seconds())
+		if failed {
+			MongoCommandFailures.WithLabelValues(collection.(string), e.CommandName).Inc()
+		}
+	}
+
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			// CRUD commands name their collection as their first value,
+			// getMore in its collection field. Other commands, such as ping
+			// or hello, are not tied to a collection and are not observed.
+			value := e.Command.Lookup(e.CommandName)
+			if e.CommandName == "getMore" {
+				value = e.Command.Lookup("collection")
+			}
+			if collection, ok := value.StringValueOK(); ok {
+				collections.Store(e.RequestID, collection)
+			}
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			finished(e.CommandFinishedEvent, false)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			finished(e.CommandFinishedEvent, true)
+		},
+	}
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// observed returns the value of the series of name with labels: the value
+// of a counter or gauge, the number of observations of a histogram
+func observed(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	series:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue series
+				}
+			}
+			switch {
+			case metric.GetHistogram() != nil:
+				return float64(metric.GetHistogram().GetSampleCount())
+			case metric.GetCounter() != nil:
+				return metric.GetCounter().GetValue()
+			case metric.GetGauge() != nil:
+				return metric.GetGauge().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestMongoMonitor(t *testing.T) {
+	monitor := MongoMonitor()
+	ctx := context.Background()
+	var requestID int64
+
+	// run sends the events of one command to the monitor
+	run := func(command bson.D, failed bool) {
+		t.Helper()
+		raw, err := bson.Marshal(command)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		requestID++
+		name := command[0].Key
+		monitor.Started(ctx, &event.CommandStartedEvent{Command: raw, CommandName: name, RequestID: requestID})
+		finished := event.CommandFinishedEvent{CommandName: name, RequestID: requestID, Duration: time.Millisecond}
+		if failed {
+			monitor.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: finished})
+		} else {
+			monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: finished})
+		}
+	}
+
+	tests := []struct {
+		name       string
+		command    bson.D
+		failed     bool
+		collection string
+	}{
+		{"a find", bson.D{{Key: "find", Value: "users"}, {Key: "filter", Value: bson.D{}}}, false, "users"},
+		{"a failed insert", bson.D{{Key: "insert", Value: "stacks"}}, true, "stacks"},
+		{"a getMore", bson.D{{Key: "getMore", Value: int64(42)}, {Key: "collection", Value: "contents"}}, false, "contents"},
+		{"a ping", bson.D{{Key: "ping", Value: 1}}, false, ""},
+	}
+	for _, tt := range tests {
+		command := tt.command[0].Key
+		labels := map[string]string{"collection": tt.collection, "command": command}
+		durations := observed(t, "cms_mongo_command_duration_seconds", labels)
+		failures := observed(t, "cms_mongo_command_failures_total", labels)
+
+		run(tt.command, tt.failed)
+
+		wantDurations, wantFailures := durations+1, failures
+		if tt.failed {
+			wantFailures++
+		}
+		if tt.collection == "" {
+			wantDurations = durations
+		}
+		if got := observed(t, "cms_mongo_command_duration_seconds", labels); got != wantDurations {
+			t.Errorf("%s: %v durations, want %v", tt.name, got, wantDurations)
+		}
+		if got := observed(t, "cms_mongo_command_failures_total", labels); got != wantFailures {
+			t.Errorf("%s: %v failures, want %v", tt.name, got, wantFailures)
+		}
+	}
+
+	// A command finishing without having started is not observed
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 1000}})
+	if got := observed(t, "cms_mongo_command_duration_seconds", map[string]string{"collection": "users", "command": "find"}); got != 1 {
+		t.Errorf("%v finds observed, want 1", got)
+	}
+}
@@ -2,54 +2,225 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"cms-server/internal/auth"
+	"cms-server/internal/models"
+	"cms-server/internal/problem"
+	"cms-server/internal/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-var jwtKey = []byte("my_secret_key")
+// TokenSource is a place of the request an access token is read from
+type TokenSource string
 
-type Claims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
-	jwt.StandardClaims
-}
+const (
+	// HeaderSource reads "Authorization: Bearer <token>"
+	HeaderSource TokenSource = "header"
+	// CookieSource reads the token cookie set by /login
+	CookieSource TokenSource = "cookie"
+)
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("token")
+// DefaultTokenSources checks the Authorization header before the cookie
+var DefaultTokenSources = []TokenSource{HeaderSource, CookieSource}
 
-		if err != nil {
-			if err == http.ErrNoCookie {
-				w.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-			w.WriteHeader(http.StatusBadRequest)
-			return
+var (
+	errMissingToken   = errors.New("missing token")
+	errMalformedToken = errors.New("malformed Authorization header")
+	errRevokedSession = errors.New("revoked session")
+	errSessionLookup  = errors.New("session lookup failed")
+)
+
+// sessionTimeout bounds the session lookup of a request
+const sessionTimeout = 2 * time.Second
+
+// SessionLookup finds the session an access token was issued for
+type SessionLookup interface {
+	GetSession(ctx context.Context, id primitive.ObjectID) (models.Session, error)
+}
+
+// ParseTokenSources parses a precedence list of source names such as
+// ["cookie", "header"]; an empty list yields DefaultTokenSources
+func ParseTokenSources(names []string) ([]TokenSource, error) {
+	var sources []TokenSource
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		source := TokenSource(name)
+		if source != HeaderSource && source != CookieSource {
+			return nil, fmt.Errorf("unknown token source %q", name)
 		}
+		sources = append(sources, source)
+	}
+	if len(sources) == 0 {
+		return DefaultTokenSources, nil
+	}
+	return sources, nil
+}
 
-		tokenString := cookie.Value
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
+// Authenticator verifies the access token of requests, looking for it in
+// its sources in order. The first source carrying a token decides; an
+// invalid token is not retried from the next source. A token whose session
+// was revoked is invalid.
+type Authenticator struct {
+	keys     *auth.KeySet
+	sessions SessionLookup
+	sources  []TokenSource
+}
 
-		if err != nil {
-			if err == jwt.ErrSignatureInvalid {
-				w.WriteHeader(http.StatusUnauthorized)
-				return
+// NewAuthenticator returns an Authenticator verifying tokens with keys,
+// checking their session in sessions and reading them from sources, or from
+// DefaultTokenSources when none are given
+func NewAuthenticator(keys *auth.KeySet, sessions SessionLookup, sources ...TokenSource) *Authenticator {
+	if len(sources) == 0 {
+		sources = DefaultTokenSources
+	}
+	return &Authenticator{keys: keys, sessions: sessions, sources: sources}
+}
+
+// token returns the raw token of the request from the first source carrying one
+func (a *Authenticator) token(r *http.Request) (string, error) {
+	for _, source := range a.sources {
+		switch source {
+		case HeaderSource:
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				continue
+			}
+			scheme, token, ok := strings.Cut(header, " ")
+			token = strings.TrimSpace(token)
+			if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+				return "", errMalformedToken
+			}
+			return token, nil
+		case CookieSource:
+			if cookie, err := r.Cookie("token"); err == nil && cookie.Value != "" {
+				return cookie.Value, nil
 			}
-			w.WriteHeader(http.StatusUnauthorized)
-			return
 		}
+	}
+	return "", errMissingToken
+}
 
-		if !token.Valid {
-			w.WriteHeader(http.StatusUnauthorized)
+// parseToken validates the token of the request and its session, and
+// returns its claims
+func (a *Authenticator) parseToken(r *http.Request) (*auth.Claims, error) {
+	tokenString, err := a.token(r)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := a.keys.ParseAccessToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkSession(r, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkSession returns errRevokedSession unless the session of claims
+// exists, belongs to its user and was not revoked, and errSessionLookup
+// when the session cannot be read.
+func (a *Authenticator) checkSession(r *http.Request, claims *auth.Claims) error {
+	sessionID, err := primitive.ObjectIDFromHex(claims.SessionID)
+	if err != nil {
+		return errRevokedSession
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), sessionTimeout)
+	defer cancel()
+
+	session, err := a.sessions.GetSession(ctx, sessionID)
+	if errors.Is(err, store.ErrNotFound) {
+		return errRevokedSession
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", errSessionLookup, err)
+	}
+	if session.UserID != claims.UserID || session.RevokedAt != nil {
+		return errRevokedSession
+	}
+	return nil
+}
+
+// challenge rejects a request with a Bearer challenge (RFC 6750) and a
+// problem document
+func challenge(w http.ResponseWriter, r *http.Request, err error) {
+	header := `Bearer realm="cms-server"`
+	rejection := problem.Unauthorized("Authentication required")
+	switch {
+	case errors.Is(err, errSessionLookup):
+		// The token may well be valid: do not ask for another one
+		problem.Write(w, r, problem.Internal("Unable to check the session", err))
+		return
+	case errors.Is(err, errMissingToken):
+	case errors.Is(err, errMalformedToken):
+		header += `, error="invalid_request", error_description="malformed Authorization header"`
+		rejection = problem.BadRequest("Malformed Authorization header")
+	case errors.Is(err, errRevokedSession):
+		header += `, error="invalid_token", error_description="the session of the access token was revoked"`
+		rejection = problem.New(http.StatusUnauthorized, problem.CodeInvalidToken, "The session was revoked")
+	default:
+		header += `, error="invalid_token", error_description="the access token is invalid or expired"`
+		rejection = problem.New(http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid or expired token")
+	}
+
+	w.Header().Set("WWW-Authenticate", header)
+	problem.Write(w, r, rejection)
+}
+
+// withClaims attaches the user ID, role and session ID of claims to the
+// request context, and reports the user to the request log
+func withClaims(r *http.Request, claims *auth.Claims) *http.Request {
+	annotateRequestLog(r, claims.UserID)
+	ctx := context.WithValue(r.Context(), "userID", claims.UserID)
+	ctx = context.WithValue(ctx, "role", claims.Role)
+	ctx = context.WithValue(ctx, "sessionID", claims.SessionID)
+	return r.WithContext(ctx)
+}
+
+// AuthMiddleware rejects requests without a valid access token
+func (a *Authenticator) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := a.parseToken(r)
+		if err != nil {
+			challenge(w, r, err)
 			return
 		}
 
 		// Attach user ID to the request context
-		ctx := context.WithValue(r.Context(), "userID", claims.UserID)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, withClaims(r, claims))
 	})
 }
+
+// OptionalAuthMiddleware attaches the user ID when the request carries a
+// valid token and lets anonymous requests through otherwise
+func (a *Authenticator) OptionalAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims, err := a.parseToken(r); err == nil {
+			r = withClaims(r, claims)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission rejects requests without a valid access token, or whose
+// role was not granted permission
+func (a *Authenticator) RequirePermission(permission auth.Permission, next http.Handler) http.Handler {
+	return a.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, _ := r.Context().Value("role").(string)
+		if !auth.Can(role, permission) {
+			problem.Write(w, r, problem.Forbidden("Your role does not allow this action"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
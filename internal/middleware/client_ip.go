@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParseTrustedProxies parses the CIDRs of the proxies in front of the server
+func ParseTrustedProxies(cidrs []string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", cidr, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// ClientIP attaches to each request the address of its client. Behind the
+// trusted proxies it is the last address of X-Forwarded-For that is not
+// one of them; a client can prepend anything to the header but not what
+// the proxies append. Without trusted proxies it is the peer address.
+func ClientIP(proxies []netip.Prefix, next http.Handler) http.Handler {
+	trusted := func(address string) bool {
+		ip, err := netip.ParseAddr(address)
+		if err != nil {
+			return false
+		}
+		ip = ip.Unmap()
+		for _, proxy := range proxies {
+			if proxy.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := peerIP(r)
+		if trusted(client) {
+			forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+			for i := len(forwarded) - 1; i >= 0; i-- {
+				hop := strings.TrimSpace(forwarded[i])
+				if hop == "" {
+					continue
+				}
+				client = hop
+				if !trusted(hop) {
+					break
+				}
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), "clientIP", client)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientIP returns the address attached by ClientIP, or the peer address
+func clientIP(r *http.Request) string {
+	if client, ok := r.Context().Value("clientIP").(string); ok {
+		return client
+	}
+	return peerIP(r)
+}
+
+// peerIP returns the address of the peer of r
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"cms-server/internal/config"
+)
+
+// requestLog collects what inner middleware learn about a request, for the
+// line logged once it is served
+type requestLog struct {
+	userID string
+}
+
+// annotateRequestLog records the user of an authenticated request
+func annotateRequestLog(r *http.Request, userID string) {
+	if entry, ok := r.Context().Value("requestLog").(*requestLog); ok {
+		entry.userID = userID
+	}
+}
+
+// RequestLogger logs one line per request: errors, client errors as
+// warnings, and a sample of the rest
+type RequestLogger struct {
+	logger     *slog.Logger
+	sampleRate float64
+}
+
+// NewRequestLogger returns a RequestLogger writing to logger, keeping the
+// share of successful requests given by cfg
+func NewRequestLogger(logger *slog.Logger, cfg config.Log) *RequestLogger {
+	return &RequestLogger{logger: logger, sampleRate: cfg.SampleRate}
+}
+
+// Middleware logs the requests served by next. It runs inside RequestID and
+// RouteTemplate.
+func (l *RequestLogger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := &requestLog{}
+		ctx := context.WithValue(r.Context(), "requestLog", entry)
+		recorder := recordResponse(w)
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		status := recorder.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		case l.sampleRate < 1 && rand.Float64() >= l.sampleRate:
+			return
+		}
+		if !l.logger.Enabled(ctx, level) {
+			return
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", Route(r)),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("bytes", recorder.bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("ip", clientIP(r)),
+			slog.String("user_agent", r.UserAgent()),
+		}
+		if entry.userID != "" {
+			attrs = append(attrs, slog.String("user_id", entry.userID))
+		}
+		if l.logger.Enabled(ctx, slog.LevelDebug) {
+			attrs = append(attrs, headersAttr(r.Header))
+		}
+		l.logger.LogAttrs(ctx, level, "request", attrs...)
+	})
+}
+
+// headersAttr groups the request headers, one key per header, so that the
+// sensitive ones are redacted by the logger
+func headersAttr(header http.Header) slog.Attr {
+	attrs := make([]any, 0, len(header))
+	for name, values := range header {
+		if len(values) == 1 {
+			attrs = append(attrs, slog.String(name, values[0]))
+		} else {
+			attrs = append(attrs, slog.Any(name, values))
+		}
+	}
+	return slog.Group("headers", attrs...)
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"cms-server/internal/metrics"
+)
+
+// methodLabel returns the method of r, or "other" for methods HTTP does not
+// define, so that made up methods cannot blow up the number of series
+func methodLabel(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return r.Method
+	}
+	return "other"
+}
+
+// Metrics counts and times requests by route template and status code. It
+// runs inside RouteTemplate.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, route := methodLabel(r), Route(r)
+		recorder := recordResponse(w)
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r)
+
+		metrics.HTTPRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		metrics.HTTPRequests.WithLabelValues(method, route, strconv.Itoa(recorder.Status())).Inc()
+	})
+}
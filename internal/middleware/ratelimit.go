@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cms-server/internal/config"
+	"cms-server/internal/metrics"
+	"cms-server/internal/problem"
+	"cms-server/internal/ratelimit"
+)
+
+// LimitGroup names the routes sharing a rate limit
+type LimitGroup string
+
+const (
+	// AuthGroup registers, logs in and refreshes tokens
+	AuthGroup LimitGroup = "auth"
+	// WriteGroup changes data
+	WriteGroup LimitGroup = "write"
+	// ReadGroup reads data
+	ReadGroup LimitGroup = "read"
+)
+
+// limitTimeout bounds the store lookup of a request, which must not hold it
+// up for long
+const limitTimeout = 2 * time.Second
+
+// RateLimiter limits the requests of each client to the rate of the route
+// group, counting them in token buckets of a ratelimit.Store
+type RateLimiter struct {
+	store ratelimit.Store
+	rates map[LimitGroup]config.Rate
+}
+
+// NewRateLimiter returns a RateLimiter enforcing the rates of cfg
+func NewRateLimiter(store ratelimit.Store, cfg config.RateLimit) *RateLimiter {
+	return &RateLimiter{
+		store: store,
+		rates: map[LimitGroup]config.Rate{
+			AuthGroup:  cfg.Auth,
+			WriteGroup: cfg.Write,
+			ReadGroup:  cfg.Read,
+		},
+	}
+}
+
+// clientKeys identifies the client of r in group by the buckets it draws
+// from: its address, and its user as well when the request was
+// authenticated. Users behind one address therefore share its bucket, and
+// one user cannot exceed the rate by spreading its requests over many
+// addresses. Authenticated routes wrap Limit in the auth middleware.
+func clientKeys(r *http.Request, group LimitGroup) []string {
+	keys := []string{string(group) + ":ip:" + clientIP(r)}
+	if userID, ok := r.Context().Value("userID").(string); ok && userID != "" {
+		keys = append(keys, string(group)+":user:"+userID)
+	}
+	return keys
+}
+
+// tighter returns the more restrictive of two results of the same rate
+func tighter(a, b ratelimit.Result) ratelimit.Result {
+	if a.Allowed != b.Allowed {
+		if !a.Allowed {
+			return a
+		}
+		return b
+	}
+	if a.Remaining != b.Remaining {
+		if a.Remaining < b.Remaining {
+			return a
+		}
+		return b
+	}
+	if a.Reset >= b.Reset {
+		return a
+	}
+	return b
+}
+
+// take draws a token from every bucket of keys and returns the tightest
+// result. A denied bucket stops the draw, so that the next ones are not
+// charged for a rejected request. Buckets the store fails to check are
+// skipped; ok is false when none could be checked.
+func (l *RateLimiter) take(r *http.Request, group LimitGroup, keys []string, rate config.Rate) (res ratelimit.Result, ok bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), limitTimeout)
+	defer cancel()
+
+	now := time.Now()
+	for _, key := range keys {
+		bucket, err := l.store.Take(ctx, key, rate, now)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Could not check the rate limit", "group", group, "error", err)
+			continue
+		}
+		if ok {
+			res = tighter(res, bucket)
+		} else {
+			res, ok = bucket, true
+		}
+		if !bucket.Allowed {
+			break
+		}
+	}
+	return res, ok
+}
+
+// Limit serves the requests of a client while it stays within the rate of
+// group in every bucket it draws from, and rejects the others with 429 Too
+// Many Requests and Retry-After. Every response carries the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers of the tightest bucket.
+// When the store fails the request is served: an outage of the limits must
+// not become one of the API.
+func (l *RateLimiter) Limit(group LimitGroup, next http.Handler) http.Handler {
+	rate := l.rates[group]
+	if rate.Unlimited() {
+		return next
+	}
+	policy := strconv.Itoa(rate.Requests) + ";w=" + strconv.FormatInt(int64(rate.Per.Seconds()), 10)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, ok := l.take(r, group, clientKeys(r, group), rate)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Set("RateLimit-Policy", policy)
+		header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		header.Set("RateLimit-Reset", ratelimit.DeltaSeconds(res.Reset))
+		if !res.Allowed {
+			metrics.RateLimited.WithLabelValues(string(group)).Inc()
+			header.Set("Retry-After", ratelimit.DeltaSeconds(res.RetryAfter))
+			problem.Write(w, r, problem.TooManyRequests("Too many requests, retry later"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+)
+
+// requestIDPattern bounds the request IDs accepted from clients and proxies
+var requestIDPattern = regexp.MustCompile(`^[\w.:-]{1,128}$`)
+
+// newRequestID returns 16 random bytes in hex
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestID tags every request with the ID of its X-Request-ID header, or a
+// new one when it is missing or unusable. The ID is echoed in the response
+// header and attached to the request context for error documents and logs.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+		ctx := context.WithValue(r.Context(), "requestID", requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	tests := []struct {
+		header string
+		kept   bool
+	}{
+		{"3f9c2e1a-77b0-4c5e-9d1e-0a1b2c3d4e5f", true},
+		{"Root=1-67891233-abcdef012345678912345678", false},
+		{"proxy.example:42_a", true},
+		{"", false},
+		{"two words", false},
+		{"<script>", false},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		var fromContext string
+		handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fromContext, _ = r.Context().Value("requestID").(string)
+		}))
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set("X-Request-ID", tt.header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		sent := w.Header().Get("X-Request-ID")
+		if sent != fromContext {
+			t.Errorf("%q: sent %q, attached %q", tt.header, sent, fromContext)
+		}
+		if tt.kept && sent != tt.header {
+			t.Errorf("%q was replaced by %q", tt.header, sent)
+		}
+		if !tt.kept && !generated.MatchString(sent) {
+			t.Errorf("%q was answered with %q, want a new ID", tt.header, sent)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// responseRecorder remembers the status code and size of a response. It
+// keeps the Flusher and Hijacker of the writer it wraps for streams and
+// WebSockets.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *responseRecorder) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack hands the connection over to a WebSocket, which answers 101 on
+// its own
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the deadlines of the
+// connection
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status is the status code sent, 200 when the handler wrote nothing
+func (w *responseRecorder) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// recordResponse returns the recorder of w, wrapping w unless an outer
+// middleware already did
+func recordResponse(w http.ResponseWriter) *responseRecorder {
+	if recorder, ok := w.(*responseRecorder); ok {
+		return recorder
+	}
+	return &responseRecorder{ResponseWriter: w}
+}
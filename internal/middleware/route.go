@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// unmatchedRoute labels the requests no route matched, so that scanners
+// probing random paths cannot blow up the number of series or log keys
+const unmatchedRoute = "unmatched"
+
+// RouteTemplate attaches to each request the path template of the route of
+// router matching it, such as /content/{id}, for the middleware reporting
+// on requests. It has to wrap them since the router only resolves the
+// route for the handlers.
+func RouteTemplate(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := unmatchedRoute
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			if template, err := match.Route.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), "route", route)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Route returns the route template attached by RouteTemplate
+func Route(r *http.Request) string {
+	if route, ok := r.Context().Value("route").(string); ok {
+		return route
+	}
+	return unmatchedRoute
+}
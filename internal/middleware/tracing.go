@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the server spans of requests
+var tracer = otel.Tracer("cms-server/internal/middleware")
+
+// Tracing serves each request in a server span named after its route
+// template, continuing the trace of its traceparent header when it has one.
+// The traceparent of the span is sent back in the response headers. It
+// runs inside RouteTemplate.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		name, route := methodLabel(r), Route(r)
+		if route != unmatchedRoute {
+			name += " " + route
+		}
+		ctx, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("client.address", clientIP(r)),
+				attribute.String("user_agent.original", r.UserAgent()),
+			),
+		)
+		defer span.End()
+		if requestID, ok := ctx.Value("requestID").(string); ok {
+			span.SetAttributes(attribute.String("request.id", requestID))
+		}
+
+		// Only the trace context goes back, not the baggage of the caller
+		propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(w.Header()))
+
+		recorder := recordResponse(w)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		status := recorder.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Comment struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	ContentID primitive.ObjectID  `bson:"content_id" json:"content_id"`
+	UserID    string              `bson:"user_id" json:"user_id"`
+	ParentID  *primitive.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+	// Depth is 0 for comments on the content and grows by one per reply level
+	Depth      int        `bson:"depth" json:"depth"`
+	Body       string     `bson:"body" json:"body"`
+	ReplyCount int64      `bson:"reply_count" json:"reply_count"`
+	Deleted    bool       `bson:"deleted" json:"deleted"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt  *time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
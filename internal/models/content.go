@@ -1,6 +1,11 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type Stack struct {
 	ID    primitive.ObjectID `bson:"_id,omitempty" json:"id"`
@@ -16,4 +21,30 @@ type Content struct {
 	Url         string             `json:"url" bson:"url"`
 	ImgUrl      string             `json:"imgUrl" bson:"imgUrl"`
 	Stack       []Stack            `json:"stack" bson:"stack"`
+
+	// CommentCount counts the comments that were not deleted
+	CommentCount int64 `json:"comment_count" bson:"comment_count"`
+	// Reactions counts the reactions of every type
+	Reactions ReactionCounts `json:"reactions" bson:"reactions,omitempty"`
+	// Hidden contents were taken down by a moderator; only their owner and
+	// moderators still see them
+	Hidden   bool       `json:"hidden,omitempty" bson:"hidden,omitempty"`
+	HiddenBy string     `json:"hidden_by,omitempty" bson:"hidden_by,omitempty"`
+	HiddenAt *time.Time `json:"hidden_at,omitempty" bson:"hidden_at,omitempty"`
+	// ViewerReaction is the reaction of the authenticated user, filled per request
+	ViewerReaction string `json:"viewer_reaction,omitempty" bson:"-"`
+}
+
+// ReactionCounts counts reactions by type. It is sent as an object of the
+// types that have reactions, {} when there are none.
+type ReactionCounts map[string]int64
+
+func (c ReactionCounts) MarshalJSON() ([]byte, error) {
+	counts := make(map[string]int64, len(c))
+	for reaction, count := range c {
+		if count != 0 {
+			counts[reaction] = count
+		}
+	}
+	return json.Marshal(counts)
 }
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Follow struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	FollowerID string             `bson:"follower_id" json:"follower_id"`
+	FolloweeID string             `bson:"followee_id" json:"followee_id"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	NotificationFollow   = "follow"
+	NotificationReaction = "reaction"
+	NotificationComment  = "comment"
+	NotificationReply    = "reply"
+	NotificationMention  = "mention"
+)
+
+// Notification tells a user that others interacted with them. Unread
+// notifications about the same target are grouped: ActorIDs holds the most
+// recent actors and ActorCount all of them. ActivityID is renewed with every
+// actor, so that notifications list by latest activity.
+type Notification struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	ActivityID primitive.ObjectID  `bson:"activity_id" json:"-"`
+	UserID     string              `bson:"user_id" json:"user_id"`
+	Type       string              `bson:"type" json:"type"`
+	GroupKey   string              `bson:"group_key" json:"-"`
+	ActorIDs   []string            `bson:"actor_ids" json:"actor_ids"`
+	ActorCount int                 `bson:"actor_count" json:"actor_count"`
+	ContentID  *primitive.ObjectID `bson:"content_id,omitempty" json:"content_id,omitempty"`
+	CommentID  *primitive.ObjectID `bson:"comment_id,omitempty" json:"comment_id,omitempty"`
+	Reaction   string              `bson:"reaction,omitempty" json:"reaction,omitempty"`
+	Read       bool                `bson:"read" json:"read"`
+	CreatedAt  time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time           `bson:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Reaction struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ContentID primitive.ObjectID `bson:"content_id" json:"content_id"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	Type      string             `bson:"type" json:"type"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
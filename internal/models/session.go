@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is a login on one device. Its refresh token rotates on every use;
+// the hashes of the previous ones are kept to detect replays.
+type Session struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     string             `bson:"user_id" json:"user_id"`
+	TokenHash  string             `bson:"token_hash" json:"-"`
+	UsedHashes []string           `bson:"used_hashes" json:"-"`
+	Device     string             `bson:"device" json:"device"`
+	IP         string             `bson:"ip" json:"ip"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	LastUsedAt time.Time          `bson:"last_used_at" json:"last_used_at"`
+	ExpiresAt  time.Time          `bson:"expires_at" json:"expires_at"`
+	RevokedAt  *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,10 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// TimelineEntry is a precomputed home feed item of a user
+type TimelineEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	ContentID primitive.ObjectID `bson:"content_id" json:"content_id"`
+}
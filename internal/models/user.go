@@ -2,9 +2,26 @@ package models
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+// Roles a user can hold; users created before roles existed have none and
+// count as RoleUser
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
 type User struct {
 	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	Username string             `bson:"username" json:"username"`
 	Email    string             `bson:"email" json:"email"`
 	Password string             `bson:"password" json:"-"`
+	Role     string             `bson:"role,omitempty" json:"role,omitempty"`
+}
+
+// EffectiveRole returns the role of the user, defaulting to RoleUser
+func (u User) EffectiveRole() string {
+	if u.Role == "" {
+		return RoleUser
+	}
+	return u.Role
 }
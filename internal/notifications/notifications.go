@@ -0,0 +1,169 @@
+// Package notifications turns domain events into entries of the
+// notification inbox of the users concerned.
+package notifications
+
+import (
+	"context"
+	"errors"
+	"regexp"
+
+	"cms-server/internal/events"
+	"cms-server/internal/models"
+	"cms-server/internal/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mentionPattern matches @username mentions
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w{1,64})`)
+
+// Service records notifications from the event bus
+type Service struct {
+	store    *store.Store
+	onCreate func(models.Notification)
+}
+
+// NewService returns a Service writing to the notification store of s.
+// onCreate, when not nil, is called with every stored notification.
+func NewService(s *store.Store, onCreate func(models.Notification)) *Service {
+	return &Service{store: s, onCreate: onCreate}
+}
+
+// HandleEvent is the event bus subscriber of the service
+func (s *Service) HandleEvent(ctx context.Context, event events.Event) error {
+	switch event.Type {
+	case events.UserFollowed:
+		return s.notify(ctx, event, models.Notification{
+			UserID:   event.FolloweeID,
+			Type:     models.NotificationFollow,
+			GroupKey: models.NotificationFollow,
+		})
+
+	case events.ReactionAdded:
+		contentID := event.Content.ID
+		return s.notify(ctx, event, models.Notification{
+			UserID:    event.Content.UserID,
+			Type:      models.NotificationReaction,
+			GroupKey:  models.NotificationReaction + ":" + contentID.Hex(),
+			ContentID: &contentID,
+			Reaction:  event.Reaction,
+		})
+
+	case events.ContentCreated:
+		contentID := event.Content.ID
+		text := event.Content.Name + " " + event.Content.Description
+		return s.notifyMentions(ctx, event, text, models.Notification{
+			ContentID: &contentID,
+			GroupKey:  models.NotificationMention + ":" + contentID.Hex(),
+		})
+
+	case events.CommentCreated:
+		return s.handleComment(ctx, event)
+	}
+	return nil
+}
+
+// handleComment notifies the parent comment author of a reply, the content
+// owner of a new comment and everyone mentioned in the comment
+func (s *Service) handleComment(ctx context.Context, event events.Event) error {
+	comment := event.Comment
+	contentID, commentID := comment.ContentID, comment.ID
+
+	notified := map[string]bool{}
+	if comment.ParentID != nil {
+		parent, err := s.store.Comments.GetComment(ctx, *comment.ParentID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		if err == nil {
+			notified[parent.UserID] = true
+			err = s.notify(ctx, event, models.Notification{
+				UserID:    parent.UserID,
+				Type:      models.NotificationReply,
+				GroupKey:  models.NotificationReply + ":" + parent.ID.Hex(),
+				ContentID: &contentID,
+				CommentID: &parent.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := s.store.Contents.GetContent(ctx, contentID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	if err == nil && !notified[content.UserID] {
+		err = s.notify(ctx, event, models.Notification{
+			UserID:    content.UserID,
+			Type:      models.NotificationComment,
+			GroupKey:  models.NotificationComment + ":" + contentID.Hex(),
+			ContentID: &contentID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.notifyMentions(ctx, event, comment.Body, models.Notification{
+		ContentID: &contentID,
+		CommentID: &commentID,
+		GroupKey:  models.NotificationMention + ":" + commentID.Hex(),
+	})
+}
+
+// notifyMentions sends template to every existing user mentioned in text
+func (s *Service) notifyMentions(ctx context.Context, event events.Event, text string, template models.Notification) error {
+	// Usernames are case sensitive, so each spelling is looked up and the
+	// users found are notified once
+	looked, notified := map[string]bool{}, map[primitive.ObjectID]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		username := match[1]
+		if looked[username] {
+			continue
+		}
+		looked[username] = true
+
+		user, err := s.store.Users.GetUserByUsername(ctx, username)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if notified[user.ID] {
+			continue
+		}
+		notified[user.ID] = true
+
+		n := template
+		n.UserID = user.ID.Hex()
+		n.Type = models.NotificationMention
+		if err := s.notify(ctx, event, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notify stores n for its recipient unless they are the actor
+func (s *Service) notify(ctx context.Context, event events.Event, n models.Notification) error {
+	if n.UserID == "" || n.UserID == event.ActorID {
+		return nil
+	}
+	if _, err := primitive.ObjectIDFromHex(n.UserID); err != nil {
+		return nil
+	}
+
+	n.ActorIDs = []string{event.ActorID}
+	n.UpdatedAt = event.At
+	stored, err := s.store.Notifications.AddNotification(ctx, n)
+	if err != nil {
+		return err
+	}
+	if s.onCreate != nil {
+		s.onCreate(stored)
+	}
+	return nil
+}
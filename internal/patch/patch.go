@@ -0,0 +1,355 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON values.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Media types of the two patch formats
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// ErrTestFailed is returned when a JSON Patch "test" operation does not match
+var ErrTestFailed = errors.New("test operation failed")
+
+// Apply patches doc according to the media type of the patch
+func Apply(contentType string, doc, patch []byte) ([]byte, error) {
+	switch contentType {
+	case MergePatchType:
+		return MergePatch(doc, patch)
+	case JSONPatchType:
+		return JSONPatch(doc, patch)
+	default:
+		return nil, fmt.Errorf("unsupported patch type %q", contentType)
+	}
+}
+
+// decode parses JSON keeping numbers exact
+func decode(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// MergePatch applies an RFC 7396 merge patch: objects are merged member by
+// member, null removes a member and anything else replaces the target
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	changes, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+	return json.Marshal(mergeValue(target, changes))
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergeValue(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
+
+// Operation is one step of an RFC 6902 JSON Patch. Value holds the raw
+// JSON, so that a null value is told apart from a missing one.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch applies the operations of an RFC 6902 patch in order; the
+// patch fails as a whole when any operation fails
+func JSONPatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	var operations []Operation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, fmt.Errorf("invalid JSON patch: %w", err)
+	}
+
+	for i, operation := range operations {
+		if target, err = apply(target, operation); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, operation.Op, operation.Path, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+// apply runs a single operation and returns the new document
+func apply(doc interface{}, operation Operation) (interface{}, error) {
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if operation.Op == "add" || operation.Op == "replace" || operation.Op == "test" {
+		if len(operation.Value) == 0 {
+			return nil, errors.New("missing value")
+		}
+		if value, err = decode(operation.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch operation.Op {
+	case "add":
+		return add(doc, path, value)
+	case "remove":
+		doc, _, err = remove(doc, path)
+		return doc, err
+	case "replace":
+		if doc, _, err = remove(doc, path); err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "move", "copy":
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, err
+		}
+		if operation.Op == "move" {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, errors.New("cannot move a value into itself")
+			}
+			if doc, value, err = remove(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			if value, err = get(doc, from); err != nil {
+				return nil, err
+			}
+			value = deepCopy(value)
+		}
+		return add(doc, path, value)
+	case "test":
+		current, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(current, value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unknown operation %q", operation.Op)
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex parses an array index token; "-" means past the end when allowed
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	limit := length - 1
+	if allowEnd {
+		limit = length
+	}
+	if index > limit {
+		return 0, fmt.Errorf("array index %d out of range", index)
+	}
+	return index, nil
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	current := doc
+	for _, token := range path {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			current = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("cannot descend into %q", token)
+		}
+	}
+	return current, nil
+}
+
+// add inserts value at path and returns the new document
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return doc, nil
+	case []interface{}:
+		index, err := arrayIndex(last, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node, nil)
+		copy(node[index+1:], node[index:])
+		node[index] = value
+		return set(doc, path[:len(path)-1], node)
+	default:
+		return nil, fmt.Errorf("cannot add to %q", last)
+	}
+}
+
+// remove deletes the value at path and returns the new document and the value
+func remove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		value, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q not found", last)
+		}
+		delete(node, last)
+		return doc, value, nil
+	case []interface{}:
+		index, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := node[index]
+		node = append(node[:index:index], node[index+1:]...)
+		doc, err = set(doc, path[:len(path)-1], node)
+		return doc, value, err
+	default:
+		return nil, nil, fmt.Errorf("cannot remove from %q", last)
+	}
+}
+
+// set replaces the value at an existing path; arrays change identity when
+// they grow or shrink, so their parent has to point at the new slice
+func set(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		index, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = value
+	}
+	return doc, nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch node := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(node))
+		for name, member := range node {
+			copied[name] = deepCopy(member)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(node))
+		for i, item := range node {
+			copied[i] = deepCopy(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
+
+// equal compares JSON values, numbers by their numeric value
+func equal(a, b interface{}) bool {
+	numberA, okA := a.(json.Number)
+	numberB, okB := b.(json.Number)
+	if okA && okB {
+		floatA, errA := numberA.Float64()
+		floatB, errB := numberB.Float64()
+		return errA == nil && errB == nil && floatA == floatB
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,135 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// sameJSON reports whether a and b hold the same JSON value
+func sameJSON(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var valueA, valueB interface{}
+	if err := json.Unmarshal(a, &valueA); err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &valueB); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+	return reflect.DeepEqual(valueA, valueB)
+}
+
+// The cases of RFC 7396, appendix A
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		// numbers keep their exact value
+		{`{"n":1}`, `{"m":12345678901234567890}`, `{"n":1,"m":12345678901234567890}`},
+	}
+	for _, tt := range tests {
+		got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("MergePatch(%s, %s): %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if !sameJSON(t, got, []byte(tt.want)) {
+			t.Errorf("MergePatch(%s, %s) = %s, want %s", tt.doc, tt.patch, got, tt.want)
+		}
+	}
+
+	if _, err := MergePatch([]byte(`{}`), []byte(`{`)); err == nil {
+		t.Error("MergePatch accepted an invalid patch")
+	}
+}
+
+// Mostly the cases of RFC 6902, appendix A
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		doc, patch string
+		want       string
+		err        bool
+	}{
+		{"add a member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, false},
+		{"add an array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, false},
+		{"append to an array", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":"qux"}]`, `{"foo":["bar","qux"]}`, false},
+		{"add a null value", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":null}]`, `{"baz":null,"foo":"bar"}`, false},
+		{"remove a member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, false},
+		{"remove an array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, false},
+		{"replace a value", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, false},
+		{"replace with null", `{"baz":"qux"}`, `[{"op":"replace","path":"/baz","value":null}]`, `{"baz":null}`, false},
+		{"move a value", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, false},
+		{"move an array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, false},
+		{"copy a value", `{"a":{"b":[1]}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/b/-","value":2}]`, `{"a":{"b":[1]},"c":{"b":[1,2]}}`, false},
+		{"test a value", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`, `{"baz":"qux","foo":["a",2,"c"]}`, false},
+		{"escaped pointers", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, `{"~1":10}`, false},
+		{"add a nested member", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`, false},
+		{"replace the whole document", `{"foo":"bar"}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`, false},
+
+		{"a failed test", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", true},
+		{"a missing member", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, "", true},
+		{"a missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "", true},
+		{"an index out of range", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":"qux"}]`, "", true},
+		{"an index with a leading zero", `{"foo":["bar","baz"]}`, `[{"op":"remove","path":"/foo/01"}]`, "", true},
+		{"an end index outside add", `{"foo":["bar"]}`, `[{"op":"remove","path":"/foo/-"}]`, "", true},
+		{"a missing value", `{"foo":"bar"}`, `[{"op":"add","path":"/baz"}]`, "", true},
+		{"an unknown operation", `{"foo":"bar"}`, `[{"op":"merge","path":"/foo","value":1}]`, "", true},
+		{"a pointer without a slash", `{"foo":"bar"}`, `[{"op":"remove","path":"foo"}]`, "", true},
+		{"a move into itself", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, "", true},
+		{"a patch that is not an array", `{"foo":"bar"}`, `{"op":"remove","path":"/foo"}`, "", true},
+		// the patch applies as a whole or not at all
+		{"a failure after a change", `{"foo":"bar"}`, `[{"op":"remove","path":"/foo"},{"op":"test","path":"/foo","value":"bar"}]`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JSONPatch([]byte(tt.doc), []byte(tt.patch))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("JSONPatch = %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("JSONPatch: %v", err)
+			}
+			if !sameJSON(t, got, []byte(tt.want)) {
+				t.Fatalf("JSONPatch = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	_, err := JSONPatch([]byte(`{"a":1}`), []byte(`[{"op":"test","path":"/a","value":2}]`))
+	if !errors.Is(err, ErrTestFailed) {
+		t.Errorf("a failed test: %v, want ErrTestFailed", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	doc := []byte(`{"a":1}`)
+	if got, err := Apply(MergePatchType, doc, []byte(`{"a":null}`)); err != nil || string(got) != `{}` {
+		t.Errorf("Apply(%s) = %s, %v", MergePatchType, got, err)
+	}
+	if got, err := Apply(JSONPatchType, doc, []byte(`[{"op":"remove","path":"/a"}]`)); err != nil || string(got) != `{}` {
+		t.Errorf("Apply(%s) = %s, %v", JSONPatchType, got, err)
+	}
+	if _, err := Apply("application/json", doc, []byte(`{}`)); err == nil {
+		t.Error("Apply accepted application/json")
+	}
+}
@@ -0,0 +1,219 @@
+// Package problem defines the errors returned by the API and renders them as
+// RFC 7807 application/problem+json documents:
+//
+//	{
+//	    "type": "about:blank",
+//	    "title": "Not Found",
+//	    "status": 404,
+//	    "detail": "Content not found",
+//	    "instance": "/content/6650...",
+//	    "code": "not_found",
+//	    "request_id": "3f9c..."
+//	}
+//
+// code is stable and meant for clients; detail is meant for people. Every
+// document also carries the error envelope validation errors were first
+// sent as, {"error": {"code", "message", "fields"}}, for the clients
+// reading it.
+// Handlers return typed errors and Write maps them, together with store and
+// validation errors, to a document. Causes of server errors are logged
+// with the request ID and never sent.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"cms-server/internal/store"
+	"cms-server/internal/validation"
+)
+
+// ContentType is the media type of problem documents
+const ContentType = "application/problem+json"
+
+// Stable error codes. Validation failures use the codes of the validation
+// package.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeInvalidQuery     = "invalid_query"
+	CodeUnauthorized     = "unauthorized"
+	CodeInvalidToken     = "invalid_token"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeRateLimited      = "rate_limited"
+	CodeLoginLocked      = "login_locked"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "unavailable"
+)
+
+// Error is an API error with its HTTP status and stable code
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	// Fields lists the rejected fields of a request body
+	Fields []validation.FieldError
+	// Extensions are additional members of the document
+	Extensions map[string]interface{}
+
+	cause error
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Detail + ": " + e.cause.Error()
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// With adds an extension member to the document
+func (e *Error) With(name string, value interface{}) *Error {
+	if e.Extensions == nil {
+		e.Extensions = map[string]interface{}{}
+	}
+	e.Extensions[name] = value
+	return e
+}
+
+// New returns an error with the given status, code and detail
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// FromStatus returns an error with the code matching status, for failures
+// reported by libraries as a bare status
+func FromStatus(status int, detail string) *Error {
+	code := CodeBadRequest
+	switch status {
+	case http.StatusUnauthorized:
+		code = CodeUnauthorized
+	case http.StatusForbidden:
+		code = CodeForbidden
+	case http.StatusNotFound:
+		code = CodeNotFound
+	case http.StatusMethodNotAllowed:
+		code = CodeMethodNotAllowed
+	case http.StatusConflict:
+		code = CodeConflict
+	case http.StatusTooManyRequests:
+		code = CodeRateLimited
+	case http.StatusServiceUnavailable:
+		code = CodeUnavailable
+	}
+	if status >= http.StatusInternalServerError && status != http.StatusServiceUnavailable {
+		code = CodeInternal
+	}
+	return New(status, code, detail)
+}
+
+// BadRequest is a request the server cannot make sense of
+func BadRequest(detail string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, detail)
+}
+
+// Unauthorized is a request lacking valid credentials
+func Unauthorized(detail string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, detail)
+}
+
+// Forbidden is a request the caller is not allowed to make
+func Forbidden(detail string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, detail)
+}
+
+// NotFound is a missing resource, or one the caller may not see
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+// Conflict is a request clashing with the current state of a resource
+func Conflict(detail string) *Error {
+	return New(http.StatusConflict, CodeConflict, detail)
+}
+
+// TooManyRequests is a request over the rate the caller is allowed
+func TooManyRequests(detail string) *Error {
+	return New(http.StatusTooManyRequests, CodeRateLimited, detail)
+}
+
+// Internal is a server failure. Only detail is sent, cause is logged.
+func Internal(detail string, cause error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Detail: detail, cause: cause}
+}
+
+// From maps any error to an *Error. Errors the API does not know about
+// become internal errors.
+func From(err error) *Error {
+	var apiError *Error
+	var validationError *validation.Error
+
+	switch {
+	case errors.As(err, &apiError):
+		return apiError
+	case errors.As(err, &validationError):
+		return &Error{
+			Status: validationError.Status,
+			Code:   validationError.Code,
+			Detail: validationError.Message,
+			Fields: validationError.Fields,
+		}
+	case errors.Is(err, store.ErrNotFound):
+		return NotFound("The resource does not exist")
+	case errors.Is(err, store.ErrDuplicate):
+		return Conflict("The resource already exists")
+	case errors.Is(err, store.ErrInvalidCursor):
+		return New(http.StatusBadRequest, CodeInvalidQuery, "cursor is invalid or does not match the sort order")
+	default:
+		return Internal("The server could not complete the request", err)
+	}
+}
+
+// RequestID returns the ID the request was tagged with by the RequestID
+// middleware
+func RequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value("requestID").(string)
+	return requestID
+}
+
+// Write sends err as a problem document
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	p := From(err)
+	requestID := RequestID(r)
+
+	if p.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "Request failed", "method", r.Method, "path", r.URL.Path, "error", p)
+	}
+
+	document := map[string]interface{}{}
+	for name, value := range p.Extensions {
+		document[name] = value
+	}
+	document["type"] = "about:blank"
+	document["title"] = http.StatusText(p.Status)
+	document["status"] = p.Status
+	document["detail"] = p.Detail
+	document["instance"] = r.URL.Path
+	document["code"] = p.Code
+	if requestID != "" {
+		document["request_id"] = requestID
+	}
+	fields := p.Fields
+	if len(fields) > 0 {
+		document["fields"] = fields
+	} else {
+		fields = []validation.FieldError{}
+	}
+	document["error"] = map[string]interface{}{"code": p.Code, "message": p.Detail, "fields": fields}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(document)
+}
@@ -0,0 +1,114 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cms-server/internal/store"
+	"cms-server/internal/validation"
+)
+
+func TestFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"an API error", Forbidden("no"), http.StatusForbidden, CodeForbidden},
+		{"a wrapped API error", fmt.Errorf("saving: %w", Conflict("taken")), http.StatusConflict, CodeConflict},
+		{"a validation error", &validation.Error{Status: http.StatusUnprocessableEntity, Code: "validation_failed"}, http.StatusUnprocessableEntity, "validation_failed"},
+		{"a missing document", fmt.Errorf("finding: %w", store.ErrNotFound), http.StatusNotFound, CodeNotFound},
+		{"a duplicate key", store.ErrDuplicate, http.StatusConflict, CodeConflict},
+		{"an invalid cursor", store.ErrInvalidCursor, http.StatusBadRequest, CodeInvalidQuery},
+		{"any other error", errors.New("connection reset"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, tt := range tests {
+		p := From(tt.err)
+		if p.Status != tt.status || p.Code != tt.code {
+			t.Errorf("From(%s) = %d %s, want %d %s", tt.name, p.Status, p.Code, tt.status, tt.code)
+		}
+	}
+}
+
+func TestFromStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		code   string
+	}{
+		{http.StatusBadRequest, CodeBadRequest},
+		{http.StatusUnauthorized, CodeUnauthorized},
+		{http.StatusNotFound, CodeNotFound},
+		{http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+		{http.StatusTooManyRequests, CodeRateLimited},
+		{http.StatusServiceUnavailable, CodeUnavailable},
+		{http.StatusBadGateway, CodeInternal},
+		{http.StatusTeapot, CodeBadRequest},
+	}
+	for _, tt := range tests {
+		if p := FromStatus(tt.status, ""); p.Code != tt.code {
+			t.Errorf("FromStatus(%d) has the code %s, want %s", tt.status, p.Code, tt.code)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	write := func(err error) (*httptest.ResponseRecorder, map[string]interface{}) {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/content/42", nil)
+		r = r.WithContext(context.WithValue(r.Context(), "requestID", "req-1"))
+		w := httptest.NewRecorder()
+		Write(w, r, err)
+		var document map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &document); err != nil {
+			t.Fatalf("decoding %s: %v", w.Body, err)
+		}
+		return w, document
+	}
+
+	w, document := write(NotFound("Content not found").With("content_id", "42"))
+	want := map[string]interface{}{
+		"type":       "about:blank",
+		"title":      "Not Found",
+		"status":     float64(http.StatusNotFound),
+		"detail":     "Content not found",
+		"instance":   "/content/42",
+		"code":       CodeNotFound,
+		"request_id": "req-1",
+		"content_id": "42",
+		"error": map[string]interface{}{
+			"code":    CodeNotFound,
+			"message": "Content not found",
+			"fields":  []interface{}{},
+		},
+	}
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != ContentType {
+		t.Errorf("Write answered %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !reflect.DeepEqual(document, want) {
+		t.Errorf("Write sent %v, want %v", document, want)
+	}
+
+	// Extensions cannot override the standard members
+	_, document = write(BadRequest("bad").With("status", 200).With("code", "ok"))
+	if document["status"] != float64(http.StatusBadRequest) || document["code"] != CodeBadRequest {
+		t.Errorf("an extension overrode the standard members: %v", document)
+	}
+
+	// The causes of server errors are not sent
+	w, document = write(fmt.Errorf("finding: %w", errors.New("mongo: secret host unreachable")))
+	if w.Code != http.StatusInternalServerError || document["code"] != CodeInternal || strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("a server error was sent as %d %s", w.Code, w.Body)
+	}
+	_, document = write(Internal("Error deleting content", errors.New("secret")))
+	if document["detail"] != "Error deleting content" {
+		t.Errorf("an internal error was sent with the detail %v", document["detail"])
+	}
+}
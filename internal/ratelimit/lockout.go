@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"cms-server/internal/config"
+)
+
+// Lockout locks a username out after repeated failed logins. Once the
+// failures reach the configured attempts, every further failure locks the
+// username twice as long as the previous one, up to the configured maximum.
+// The failures are forgotten once that maximum goes by without another.
+type Lockout struct {
+	store    Store
+	attempts int
+	delay    time.Duration
+	max      time.Duration
+}
+
+// NewLockout returns a Lockout counting failures in store. It never locks
+// when cfg.LockoutAttempts is 0.
+func NewLockout(store Store, cfg config.RateLimit) *Lockout {
+	return &Lockout{store: store, attempts: cfg.LockoutAttempts, delay: cfg.LockoutDelay, max: cfg.LockoutMax}
+}
+
+// key is the failures key of a username; the case of a guess does not
+// give it another set of attempts
+func (l *Lockout) key(username string) string {
+	return "login:" + strings.ToLower(username)
+}
+
+// Locked returns how long username stays locked out, 0 when it is not
+func (l *Lockout) Locked(ctx context.Context, username string) (time.Duration, error) {
+	if l.attempts == 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	failures, err := l.store.Failures(ctx, l.key(username), now, l.max)
+	if err != nil {
+		return 0, err
+	}
+	return l.remaining(failures, now), nil
+}
+
+// Fail records a failed login of username and returns how long it is now
+// locked out
+func (l *Lockout) Fail(ctx context.Context, username string) (time.Duration, error) {
+	if l.attempts == 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	failures, err := l.store.AddFailure(ctx, l.key(username), now, l.max)
+	if err != nil {
+		return 0, err
+	}
+	return l.remaining(failures, now), nil
+}
+
+// Reset forgets the failures of username after it logged in
+func (l *Lockout) Reset(ctx context.Context, username string) error {
+	if l.attempts == 0 {
+		return nil
+	}
+	return l.store.ResetFailures(ctx, l.key(username))
+}
+
+// remaining is the rest of the lock earned by failures at now
+func (l *Lockout) remaining(failures Failures, now time.Time) time.Duration {
+	if failures.Count < l.attempts {
+		return 0
+	}
+	lock := l.delay
+	for i := l.attempts; i < failures.Count && lock < l.max; i++ {
+		lock *= 2
+	}
+	lock = min(lock, l.max)
+	return max(0, failures.Last.Add(lock).Sub(now))
+}
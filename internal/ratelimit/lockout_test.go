@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cms-server/internal/config"
+)
+
+func TestLockoutRemaining(t *testing.T) {
+	l := NewLockout(NewMemoryStore(), config.RateLimit{
+		LockoutAttempts: 3,
+		LockoutDelay:    time.Minute,
+		LockoutMax:      10 * time.Minute,
+	})
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		failures Failures
+		want     time.Duration
+	}{
+		{"no failure", Failures{}, 0},
+		{"under the attempts", Failures{Count: 2, Last: now}, 0},
+		{"at the attempts", Failures{Count: 3, Last: now}, time.Minute},
+		{"one more failure", Failures{Count: 4, Last: now}, 2 * time.Minute},
+		{"two more failures", Failures{Count: 5, Last: now}, 4 * time.Minute},
+		{"three more failures", Failures{Count: 6, Last: now}, 8 * time.Minute},
+		{"up to the maximum", Failures{Count: 7, Last: now}, 10 * time.Minute},
+		{"far over the attempts", Failures{Count: 1000, Last: now}, 10 * time.Minute},
+		{"a lock partly served", Failures{Count: 4, Last: now.Add(-90 * time.Second)}, 30 * time.Second},
+		{"a lock served", Failures{Count: 4, Last: now.Add(-3 * time.Minute)}, 0},
+	}
+	for _, tt := range tests {
+		if got := l.remaining(tt.failures, now); got != tt.want {
+			t.Errorf("%s: locked for %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLockout(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.RateLimit{LockoutAttempts: 2, LockoutDelay: time.Minute, LockoutMax: time.Hour}
+	l := NewLockout(NewMemoryStore(), cfg)
+
+	if lock, _ := l.Fail(ctx, "alice"); lock != 0 {
+		t.Errorf("the first failure locked alice for %s", lock)
+	}
+	if lock, _ := l.Fail(ctx, "ALICE"); lock <= 59*time.Second || lock > time.Minute {
+		t.Errorf("the second failure locked alice for %s, want a minute whatever the case", lock)
+	}
+	if lock, _ := l.Locked(ctx, "alice"); lock == 0 {
+		t.Error("alice is not locked")
+	}
+	if lock, _ := l.Locked(ctx, "bob"); lock != 0 {
+		t.Errorf("bob is locked for %s by the failures of alice", lock)
+	}
+	l.Reset(ctx, "Alice")
+	if lock, _ := l.Locked(ctx, "alice"); lock != 0 {
+		t.Errorf("alice is still locked for %s after a reset", lock)
+	}
+
+	// No attempts, no lock
+	cfg.LockoutAttempts = 0
+	l = NewLockout(NewMemoryStore(), cfg)
+	for i := 0; i < 10; i++ {
+		if lock, _ := l.Fail(ctx, "alice"); lock != 0 {
+			t.Fatalf("failure %d locked alice without attempts configured", i+1)
+		}
+	}
+}
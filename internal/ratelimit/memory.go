@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cms-server/internal/config"
+)
+
+// sweepInterval is how often the memory store drops the buckets and
+// failures that expired
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// expires is when the bucket is full again, and the same as missing
+	expires time.Time
+}
+
+type failureRecord struct {
+	Failures
+	expires time.Time
+}
+
+// MemoryStore keeps the counts in the process. Every replica of the server
+// then enforces its own limits.
+type MemoryStore struct {
+	mu       sync.Mutex
+	buckets  map[string]bucket
+	failures map[string]failureRecord
+	swept    time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  map[string]bucket{},
+		failures: map[string]failureRecord{},
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, rate config.Rate, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	tokens := float64(rate.Requests)
+	if ok {
+		tokens = refill(b.tokens, now.Sub(b.updated), rate)
+	}
+
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	s.buckets[key] = bucket{tokens: tokens, updated: now, expires: now.Add(rate.Per)}
+	return result(tokens, allowed, rate), nil
+}
+
+func (s *MemoryStore) AddFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Failures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	failures := recent(s.failures[key].Failures, now, window)
+	failures.Count++
+	failures.Last = now
+	s.failures[key] = failureRecord{Failures: failures, expires: now.Add(window)}
+	return failures, nil
+}
+
+func (s *MemoryStore) Failures(ctx context.Context, key string, now time.Time, window time.Duration) (Failures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return recent(s.failures[key].Failures, now, window), nil
+}
+
+func (s *MemoryStore) ResetFailures(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failures, key)
+	return nil
+}
+
+// sweep drops what expired, at most once per sweepInterval. The caller
+// holds the lock.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < sweepInterval {
+		return
+	}
+	s.swept = now
+	for key, b := range s.buckets {
+		if now.After(b.expires) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, f := range s.failures {
+		if now.After(f.expires) {
+			delete(s.failures, key)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"cms-server/internal/config"
+)
+
+func TestMemoryTake(t *testing.T) {
+	rate := config.Rate{Requests: 3, Per: 3 * time.Second}
+	start := time.Now()
+
+	tests := []struct {
+		name string
+		key  string
+		at   time.Duration
+		want Result
+	}{
+		{"a full bucket", "a", 0, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+		{"a second token", "a", 0, Result{Allowed: true, Limit: 3, Remaining: 1, Reset: 2 * time.Second}},
+		{"the last token", "a", 0, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+		{"an empty bucket", "a", 0, Result{Allowed: false, Limit: 3, Remaining: 0, RetryAfter: time.Second, Reset: 3 * time.Second}},
+		{"another key", "b", 0, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+		{"half a token later", "a", 500 * time.Millisecond, Result{Allowed: false, Limit: 3, Remaining: 0, RetryAfter: 500 * time.Millisecond, Reset: 2500 * time.Millisecond}},
+		{"a refilled token", "a", time.Second, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+		{"a clock going back", "a", 0, Result{Allowed: false, Limit: 3, Remaining: 0, RetryAfter: time.Second, Reset: 3 * time.Second}},
+		{"a bucket refilled long ago", "a", time.Hour, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+	}
+	s := NewMemoryStore()
+	for _, tt := range tests {
+		got, err := s.Take(context.Background(), tt.key, rate, start.Add(tt.at))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryTakeConcurrently(t *testing.T) {
+	s := NewMemoryStore()
+	rate := config.Rate{Requests: 50, Per: time.Hour}
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, _ := s.Take(context.Background(), "key", rate, now)
+			if res.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != rate.Requests {
+		t.Errorf("%d requests took a token, want %d", allowed, rate.Requests)
+	}
+}
+
+func TestMemoryFailures(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Now()
+	window := time.Minute
+
+	for i := 1; i <= 3; i++ {
+		failures, _ := s.AddFailure(ctx, "key", now.Add(time.Duration(i)*time.Second), window)
+		if failures.Count != i {
+			t.Fatalf("failure %d counted %d", i, failures.Count)
+		}
+	}
+	if failures, _ := s.Failures(ctx, "key", now.Add(time.Minute), window); failures.Count != 3 {
+		t.Errorf("%d failures within the window, want 3", failures.Count)
+	}
+	if failures, _ := s.Failures(ctx, "key", now.Add(2*time.Minute), window); failures.Count != 0 {
+		t.Errorf("%d failures after the window, want 0", failures.Count)
+	}
+	if failures, _ := s.AddFailure(ctx, "key", now.Add(2*time.Minute), window); failures.Count != 1 {
+		t.Errorf("a failure after the window counted %d, want a fresh start", failures.Count)
+	}
+	s.ResetFailures(ctx, "key")
+	if failures, _ := s.Failures(ctx, "key", now.Add(2*time.Minute), window); failures.Count != 0 {
+		t.Errorf("%d failures after a reset", failures.Count)
+	}
+}
+
+func TestDeltaSeconds(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		0:                       "0",
+		time.Millisecond:        "1",
+		time.Second:             "1",
+		1500 * time.Millisecond: "2",
+		time.Minute:             "60",
+	} {
+		if got := DeltaSeconds(d); got != want {
+			t.Errorf("DeltaSeconds(%s) = %s, want %s", d, got, want)
+		}
+	}
+}
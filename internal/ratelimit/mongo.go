@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cms-server/internal/config"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore shares the counts between the replicas of the server. Each
+// operation is a single pipeline update, so replicas never race on a key.
+// The TTL indexes of the expires_at fields drop the documents nobody
+// touched for a while.
+type MongoStore struct {
+	buckets  *mongo.Collection
+	failures *mongo.Collection
+}
+
+// NewMongoStore returns a MongoStore keeping its documents in db
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{
+		buckets:  db.Collection("rate_limits"),
+		failures: db.Collection("login_failures"),
+	}
+}
+
+type bucketDocument struct {
+	Tokens  float64 `bson:"tokens"`
+	Allowed bool    `bson:"allowed"`
+}
+
+type failuresDocument struct {
+	Count int       `bson:"count"`
+	Last  time.Time `bson:"last"`
+}
+
+func (s *MongoStore) Take(ctx context.Context, key string, rate config.Rate, now time.Time) (Result, error) {
+	capacity := rate.Requests
+	elapsed := bson.M{"$max": bson.A{0, bson.M{"$divide": bson.A{
+		bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updated_at", now}}}},
+		1000,
+	}}}}
+	refilled := bson.M{"$min": bson.A{capacity, bson.M{"$add": bson.A{
+		bson.M{"$ifNull": bson.A{"$tokens", capacity}},
+		bson.M{"$multiply": bson.A{elapsed, perSecond(rate)}},
+	}}}}
+	pipeline := bson.A{
+		bson.M{"$set": bson.M{"tokens": refilled, "updated_at": now}},
+		bson.M{"$set": bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}},
+		bson.M{"$set": bson.M{
+			"tokens":     bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+			"expires_at": now.Add(rate.Per),
+		}},
+	}
+
+	var doc bucketDocument
+	if err := upsert(ctx, s.buckets, key, pipeline, &doc); err != nil {
+		return Result{}, err
+	}
+	return result(doc.Tokens, doc.Allowed, rate), nil
+}
+
+func (s *MongoStore) AddFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Failures, error) {
+	forgotten := bson.M{"$gt": bson.A{
+		bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$last", time.Time{}}}}},
+		window.Milliseconds(),
+	}}
+	pipeline := bson.A{
+		bson.M{"$set": bson.M{
+			"count":      bson.M{"$cond": bson.A{forgotten, 1, bson.M{"$add": bson.A{"$count", 1}}}},
+			"last":       now,
+			"expires_at": now.Add(window),
+		}},
+	}
+
+	var doc failuresDocument
+	if err := upsert(ctx, s.failures, key, pipeline, &doc); err != nil {
+		return Failures{}, err
+	}
+	return Failures{Count: doc.Count, Last: doc.Last}, nil
+}
+
+func (s *MongoStore) Failures(ctx context.Context, key string, now time.Time, window time.Duration) (Failures, error) {
+	var doc failuresDocument
+	err := s.failures.FindOne(ctx, bson.M{"_id": key}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Failures{}, nil
+	}
+	if err != nil {
+		return Failures{}, err
+	}
+	return recent(Failures{Count: doc.Count, Last: doc.Last}, now, window), nil
+}
+
+func (s *MongoStore) ResetFailures(ctx context.Context, key string) error {
+	_, err := s.failures.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+// upsert applies pipeline to the document of key, creating it when missing,
+// and decodes the result into doc. Two first requests of a key may both
+// try to insert it; the loser retries as an update.
+func upsert(ctx context.Context, collection *mongo.Collection, key string, pipeline bson.A, doc interface{}) error {
+	findOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, findOptions).Decode(doc)
+	if mongo.IsDuplicateKeyError(err) {
+		err = collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, findOptions).Decode(doc)
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+// Package ratelimit counts requests in token buckets and failed logins in a
+// Store, either local to one server or shared by its replicas through
+// MongoDB.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"cms-server/internal/config"
+)
+
+// Result is the state of a bucket after a request took a token from it
+type Result struct {
+	Allowed bool
+	// Limit is the capacity of the bucket
+	Limit int
+	// Remaining is the number of whole tokens left
+	Remaining int
+	// RetryAfter is the wait for the next token of a denied request
+	RetryAfter time.Duration
+	// Reset is the wait until the bucket is full again
+	Reset time.Duration
+}
+
+// Failures are the failed attempts recorded for a key
+type Failures struct {
+	Count int
+	Last  time.Time
+}
+
+// Store keeps the buckets and the failures. Its operations are atomic, so
+// that concurrent requests never take the same token twice.
+type Store interface {
+	// Take takes a token from the bucket of key, which holds rate.Requests
+	// tokens and refills them over rate.Per. A missing bucket is full.
+	Take(ctx context.Context, key string, rate config.Rate, now time.Time) (Result, error)
+	// AddFailure records a failure of key at now and returns the failures of
+	// key, forgetting them once window went by without another
+	AddFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Failures, error)
+	// Failures returns the failures of key still within window of now
+	Failures(ctx context.Context, key string, now time.Time, window time.Duration) (Failures, error)
+	// ResetFailures forgets the failures of key
+	ResetFailures(ctx context.Context, key string) error
+}
+
+// perSecond is the refill rate of the bucket of rate
+func perSecond(rate config.Rate) float64 {
+	return float64(rate.Requests) / rate.Per.Seconds()
+}
+
+// refill adds the tokens earned over elapsed to tokens, up to the capacity
+func refill(tokens float64, elapsed time.Duration, rate config.Rate) float64 {
+	if elapsed < 0 {
+		// Replicas with skewed clocks must not drain the bucket
+		elapsed = 0
+	}
+	return math.Min(float64(rate.Requests), tokens+elapsed.Seconds()*perSecond(rate))
+}
+
+// result describes a bucket left with tokens, after allowed told whether
+// the request got one
+func result(tokens float64, allowed bool, rate config.Rate) Result {
+	per := perSecond(rate)
+	res := Result{
+		Allowed:   allowed,
+		Limit:     rate.Requests,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(rate.Requests) - tokens) / per),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / per)
+	}
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// recent drops failures older than window
+func recent(failures Failures, now time.Time, window time.Duration) Failures {
+	if failures.Count == 0 || now.Sub(failures.Last) > window {
+		return Failures{}
+	}
+	return failures
+}
+
+// DeltaSeconds formats d as the whole seconds of the Retry-After and
+// RateLimit-Reset headers, rounded up so that clients never retry early
+func DeltaSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
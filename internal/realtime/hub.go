@@ -0,0 +1,376 @@
+// Package realtime pushes feed items, notifications and live counters to
+// connected clients over Server-Sent Events and WebSocket.
+package realtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"cms-server/internal/events"
+	"cms-server/internal/models"
+	"cms-server/internal/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrClosed is returned when registering on a hub that is shutting down
+	ErrClosed = errors.New("realtime hub closed")
+	// ErrUnknownTopic is returned when subscribing to a topic the hub never
+	// publishes
+	ErrUnknownTopic = errors.New("unknown topic")
+	// ErrTooManyWatched is returned when a client would watch more than
+	// MaxWatched contents
+	ErrTooManyWatched = fmt.Errorf("a stream may watch at most %d contents", MaxWatched)
+)
+
+const (
+	// TopicFeed carries new contents of followed users and of the user
+	TopicFeed = "feed"
+	// TopicNotifications carries new notifications of the user
+	TopicNotifications = "notifications"
+)
+
+// MaxWatched is how many contents a client may watch at once
+const MaxWatched = 200
+
+// checkTopics returns ErrUnknownTopic if one of topics is not published
+func checkTopics(topics []string) error {
+	for _, topic := range topics {
+		if topic != TopicFeed && topic != TopicNotifications {
+			return fmt.Errorf("%w %q", ErrUnknownTopic, topic)
+		}
+	}
+	return nil
+}
+
+// Message is one pushed event
+type Message struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// Counts is the payload of "counts" messages
+type Counts struct {
+	ContentID    primitive.ObjectID    `json:"content_id"`
+	Reactions    models.ReactionCounts `json:"reactions"`
+	CommentCount int64                 `json:"comment_count"`
+}
+
+// sendBuffer is how many messages may wait for a slow client before it is
+// disconnected
+const sendBuffer = 64
+
+// Client is one connection. Its topics and watched contents can change
+// while it is connected.
+type Client struct {
+	UserID string
+	// seesHidden is set for moderators, who see the hidden contents of others
+	seesHidden bool
+
+	mu       sync.RWMutex
+	topics   map[string]bool
+	contents map[primitive.ObjectID]bool
+
+	send      chan Message
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Messages returns the channel of messages to write to the connection
+func (c *Client) Messages() <-chan Message {
+	return c.send
+}
+
+// Done is closed when the client must disconnect
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Subscribe adds topics to the client. None is added if one of them is
+// unknown.
+func (c *Client) Subscribe(topics ...string) error {
+	if err := checkTopics(topics); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, topic := range topics {
+		c.topics[topic] = true
+	}
+	return nil
+}
+
+// Unsubscribe removes topics from the client
+func (c *Client) Unsubscribe(topics ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, topic := range topics {
+		delete(c.topics, topic)
+	}
+}
+
+// Watch starts pushing the counters of the given contents. None is watched
+// if the client would watch more than MaxWatched contents.
+func (c *Client) Watch(ids ...primitive.ObjectID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	added := map[primitive.ObjectID]bool{}
+	for _, id := range ids {
+		if !c.contents[id] {
+			added[id] = true
+		}
+	}
+	if len(c.contents)+len(added) > MaxWatched {
+		return ErrTooManyWatched
+	}
+	for id := range added {
+		c.contents[id] = true
+	}
+	return nil
+}
+
+// Unwatch stops pushing the counters of the given contents
+func (c *Client) Unwatch(ids ...primitive.ObjectID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, id := range ids {
+		delete(c.contents, id)
+	}
+}
+
+func (c *Client) subscribed(topic string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.topics[topic]
+}
+
+func (c *Client) watching(id primitive.ObjectID) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.contents[id]
+}
+
+// maySee reports whether the user of c may see content: hidden contents are
+// visible to their owner and moderators only
+func (c *Client) maySee(content models.Content) bool {
+	return !content.Hidden || content.UserID == c.UserID || c.seesHidden
+}
+
+// CommandError is the payload of "error" messages, sent when a stream
+// command is refused
+type CommandError struct {
+	Action string `json:"action"`
+	Detail string `json:"detail"`
+}
+
+// RejectCommand tells the client that its command action was not applied
+func (c *Client) RejectCommand(action string, err error) {
+	c.push(Message{Type: "error", Data: CommandError{Action: action, Detail: err.Error()}})
+}
+
+// push queues a message without blocking; a client that cannot keep up is
+// disconnected and expected to reconnect and resync
+func (c *Client) push(msg Message) {
+	select {
+	case <-c.done:
+	case c.send <- msg:
+	default:
+		c.Close()
+	}
+}
+
+// Close asks the connection serving the client to stop
+func (c *Client) Close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// Hub tracks the connected clients and routes events to them
+type Hub struct {
+	store *store.Store
+
+	mu      sync.RWMutex
+	clients map[string]map[*Client]bool
+	closed  bool
+	// drained is closed once the hub is closed and every client is gone
+	drained   chan struct{}
+	drainOnce sync.Once
+}
+
+// NewHub returns a hub resolving followers and counters through s
+func NewHub(s *store.Store) *Hub {
+	return &Hub{store: s, clients: map[string]map[*Client]bool{}, drained: make(chan struct{})}
+}
+
+// Register connects a new client of userID subscribed to topics. seesHidden
+// is set for moderators, who receive the counters of hidden contents.
+func (h *Hub) Register(userID string, seesHidden bool, topics ...string) (*Client, error) {
+	if err := checkTopics(topics); err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrClosed
+	}
+
+	c := &Client{
+		UserID:     userID,
+		seesHidden: seesHidden,
+		topics:     map[string]bool{},
+		contents:   map[primitive.ObjectID]bool{},
+		send:       make(chan Message, sendBuffer),
+		done:       make(chan struct{}),
+	}
+	for _, topic := range topics {
+		c.topics[topic] = true
+	}
+
+	if h.clients[userID] == nil {
+		h.clients[userID] = map[*Client]bool{}
+	}
+	h.clients[userID][c] = true
+	return c, nil
+}
+
+// Unregister disconnects a client
+func (h *Hub) Unregister(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c.Close()
+	delete(h.clients[c.UserID], c)
+	if len(h.clients[c.UserID]) == 0 {
+		delete(h.clients, c.UserID)
+	}
+	h.checkDrained()
+}
+
+// checkDrained signals Wait once the hub is closed and empty; h.mu is held
+func (h *Hub) checkDrained() {
+	if h.closed && len(h.clients) == 0 {
+		h.drainOnce.Do(func() { close(h.drained) })
+	}
+}
+
+// Close disconnects every client and refuses new ones
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for _, clients := range h.clients {
+		for c := range clients {
+			c.Close()
+		}
+	}
+	h.checkDrained()
+}
+
+// Wait blocks until every connection has unregistered after Close, or ctx
+// expires
+func (h *Hub) Wait(ctx context.Context) error {
+	select {
+	case <-h.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Connections returns the number of connected clients
+func (h *Hub) Connections() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	count := 0
+	for _, clients := range h.clients {
+		count += len(clients)
+	}
+	return count
+}
+
+// pushToUsers sends msg to the clients of userIDs subscribed to topic
+func (h *Hub) pushToUsers(userIDs []string, topic string, msg Message) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, userID := range userIDs {
+		for c := range h.clients[userID] {
+			if c.subscribed(topic) {
+				c.push(msg)
+			}
+		}
+	}
+}
+
+// pushToWatchers sends msg to every client watching content that may still
+// see it, since a content may be hidden after it was watched
+func (h *Hub) pushToWatchers(content models.Content, msg Message) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, clients := range h.clients {
+		for c := range clients {
+			if c.watching(content.ID) && c.maySee(content) {
+				c.push(msg)
+			}
+		}
+	}
+}
+
+// PushNotification sends a freshly stored notification to its recipient
+func (h *Hub) PushNotification(n models.Notification) {
+	h.pushToUsers([]string{n.UserID}, TopicNotifications, Message{Type: "notification", Data: n})
+}
+
+// HandleEvent is the event bus subscriber of the hub
+func (h *Hub) HandleEvent(ctx context.Context, event events.Event) error {
+	switch event.Type {
+	case events.ContentCreated:
+		if h.Connections() == 0 {
+			return nil
+		}
+		followers, err := h.store.Follows.FollowerIDs(ctx, event.Content.UserID)
+		if err != nil {
+			return err
+		}
+		h.pushToUsers(append(followers, event.Content.UserID), TopicFeed, Message{Type: "content", Data: event.Content})
+
+	case events.ReactionAdded, events.ReactionRemoved:
+		return h.pushCounts(ctx, event.Content.ID)
+
+	case events.CommentCreated, events.CommentDeleted:
+		return h.pushCounts(ctx, event.Comment.ContentID)
+	}
+	return nil
+}
+
+// pushCounts sends the current counters of a content to its watchers
+func (h *Hub) pushCounts(ctx context.Context, contentID primitive.ObjectID) error {
+	content, err := h.store.Contents.GetContent(ctx, contentID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	h.pushToWatchers(content, Message{Type: "counts", Data: Counts{
+		ContentID:    content.ID,
+		Reactions:    content.Reactions,
+		CommentCount: content.CommentCount,
+	}})
+	return nil
+}
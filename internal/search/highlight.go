@@ -0,0 +1,103 @@
+package search
+
+import (
+	"html"
+	"strings"
+)
+
+const (
+	// snippetContext is the number of words kept before the first match
+	snippetContext = 8
+	// snippetWords is the maximum number of words in a snippet
+	snippetWords = 30
+)
+
+// Highlight returns a snippet of text around the first match of q with every
+// matching word wrapped in <mark> tags. The text is HTML escaped. ok is false
+// when nothing in text matches.
+func Highlight(text string, q Query) (snippet string, ok bool) {
+	tokens := Tokenize(text)
+
+	marked := make([]bool, len(tokens))
+	first := -1
+	for _, clause := range q.Clauses {
+		for i := range tokens {
+			if !clauseMatchesAt(clause, tokens, i) {
+				continue
+			}
+			for j := range clause.Tokens {
+				marked[i+j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	start := max(0, first-snippetContext)
+	end := min(len(tokens), start+snippetWords)
+
+	var b strings.Builder
+	from := tokens[start].Start
+	if start == 0 {
+		from = 0
+	} else {
+		b.WriteString("…")
+	}
+	for i := start; i < end; i++ {
+		b.WriteString(html.EscapeString(text[from:tokens[i].Start]))
+		word := html.EscapeString(text[tokens[i].Start:tokens[i].End])
+		if marked[i] {
+			b.WriteString("<mark>" + word + "</mark>")
+		} else {
+			b.WriteString(word)
+		}
+		from = tokens[i].End
+	}
+	if end == len(tokens) {
+		b.WriteString(html.EscapeString(text[from:]))
+	} else {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+// clauseMatchesAt reports whether the clause matches the words starting at i
+func clauseMatchesAt(clause Clause, tokens []Token, i int) bool {
+	if i+len(clause.Tokens) > len(tokens) {
+		return false
+	}
+	for j := range clause.Tokens {
+		if !clause.matches(j, tokens[i+j].Text) {
+			return false
+		}
+	}
+	return true
+}
+
+// Score ranks fields against q without an index, for backends that cannot
+// score a query themselves. It returns zero when a clause does not match.
+func Score(fields []Field, q Query) float64 {
+	total := 0.0
+	for _, clause := range q.Clauses {
+		clauseScore := 0.0
+		for _, field := range fields {
+			for _, value := range field.Values {
+				tokens := Tokenize(value)
+				for i := range tokens {
+					if clauseMatchesAt(clause, tokens, i) {
+						clauseScore += field.Weight
+					}
+				}
+			}
+		}
+		if clauseScore == 0 {
+			return 0
+		}
+		total += clauseScore
+	}
+	return total
+}
@@ -0,0 +1,206 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// positionGap separates the values of a multi-valued field so that
+// phrases never match across two values
+const positionGap = 100
+
+// Field is a weighted, possibly multi-valued, part of a document
+type Field struct {
+	Name   string
+	Weight float64
+	Values []string
+}
+
+// Result is a document matching a query and its relevance score
+type Result struct {
+	ID    string
+	Score float64
+}
+
+type posting struct {
+	field    string
+	weight   float64
+	position int
+}
+
+// Index is a thread-safe in-memory inverted index
+type Index struct {
+	mu       sync.RWMutex
+	postings map[string]map[string][]posting
+	docTerms map[string][]string
+}
+
+// NewIndex returns an empty index
+func NewIndex() *Index {
+	return &Index{
+		postings: map[string]map[string][]posting{},
+		docTerms: map[string][]string{},
+	}
+}
+
+// Add indexes a document, replacing any previous version with the same ID
+func (idx *Index) Add(id string, fields []Field) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+
+	var terms []string
+	for _, field := range fields {
+		position := 0
+		for _, value := range field.Values {
+			for _, token := range Tokenize(value) {
+				docs, ok := idx.postings[token.Text]
+				if !ok {
+					docs = map[string][]posting{}
+					idx.postings[token.Text] = docs
+				}
+				if _, seen := docs[id]; !seen {
+					terms = append(terms, token.Text)
+				}
+				docs[id] = append(docs[id], posting{field: field.Name, weight: field.Weight, position: position})
+				position++
+			}
+			position += positionGap
+		}
+	}
+	idx.docTerms[id] = terms
+}
+
+// Remove drops a document from the index
+func (idx *Index) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+}
+
+func (idx *Index) remove(id string) {
+	for _, term := range idx.docTerms[id] {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.docTerms, id)
+}
+
+// Search returns the documents satisfying every clause of q, best first
+func (idx *Index) Search(q Query, limit int) []Result {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if q.Empty() {
+		return nil
+	}
+
+	var scores map[string]float64
+	for _, clause := range q.Clauses {
+		clauseScores := idx.searchClause(clause)
+		if scores == nil {
+			scores = clauseScores
+			continue
+		}
+		for id, score := range scores {
+			if extra, ok := clauseScores[id]; ok {
+				scores[id] = score + extra
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, Result{ID: id, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID > results[j].ID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// expand lists the indexed terms matching the i-th token of the clause
+func (idx *Index) expand(clause Clause, i int) []string {
+	if !(clause.Prefix && i == len(clause.Tokens)-1) {
+		if _, ok := idx.postings[clause.Tokens[i]]; ok {
+			return []string{clause.Tokens[i]}
+		}
+		return nil
+	}
+	var terms []string
+	for term := range idx.postings {
+		if strings.HasPrefix(term, clause.Tokens[i]) {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// idf weights rare terms higher than common ones
+func (idx *Index) idf(term string) float64 {
+	return math.Log(1 + float64(len(idx.docTerms))/float64(len(idx.postings[term])))
+}
+
+// searchClause scores every document matching a single clause
+func (idx *Index) searchClause(clause Clause) map[string]float64 {
+	scores := map[string]float64{}
+
+	// Single words score every occurrence
+	if len(clause.Tokens) == 1 {
+		for _, term := range idx.expand(clause, 0) {
+			idf := idx.idf(term)
+			for id, postings := range idx.postings[term] {
+				for _, p := range postings {
+					scores[id] += p.weight * idf
+				}
+			}
+		}
+		return scores
+	}
+
+	// Phrases need every token at consecutive positions of the same field
+	positions := make([]map[string]map[posting]bool, len(clause.Tokens))
+	idf := 0.0
+	for i := range clause.Tokens {
+		positions[i] = map[string]map[posting]bool{}
+		for _, term := range idx.expand(clause, i) {
+			idf += idx.idf(term)
+			for id, postings := range idx.postings[term] {
+				if positions[i][id] == nil {
+					positions[i][id] = map[posting]bool{}
+				}
+				for _, p := range postings {
+					positions[i][id][p] = true
+				}
+			}
+		}
+	}
+
+	for id, starts := range positions[0] {
+		for start := range starts {
+			matched := true
+			for i := 1; i < len(clause.Tokens) && matched; i++ {
+				next := posting{field: start.field, weight: start.weight, position: start.position + i}
+				matched = positions[i][id][next]
+			}
+			if matched {
+				scores[id] += start.weight * idf
+			}
+		}
+	}
+	return scores
+}
@@ -0,0 +1,98 @@
+// Package search implements the query language, inverted index and
+// highlighting used by the content search endpoint.
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Token is a normalized word together with its byte offsets in the source text
+type Token struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// Tokenize splits text into lowercase words made of letters and digits
+func Tokenize(text string) []Token {
+	var tokens []Token
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		}
+		if !isWord && start >= 0 {
+			tokens = append(tokens, Token{Text: strings.ToLower(text[start:i]), Start: start, End: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, Token{Text: strings.ToLower(text[start:]), Start: start, End: len(text)})
+	}
+	return tokens
+}
+
+// Clause is one required part of a query: a single word or a quoted phrase.
+// When Prefix is set the last token matches any word starting with it.
+type Clause struct {
+	Tokens []string
+	Prefix bool
+}
+
+// Query is a parsed search query; a document must satisfy every clause
+type Query struct {
+	Clauses []Clause
+}
+
+// Empty reports whether the query has nothing to search for
+func (q Query) Empty() bool {
+	return len(q.Clauses) == 0
+}
+
+// ParseQuery parses the user facing syntax: bare words, "quoted phrases"
+// and trailing * for prefix matching, e.g. `"web server" mongo go*`
+func ParseQuery(raw string) Query {
+	var q Query
+	for raw != "" {
+		raw = strings.TrimLeftFunc(raw, unicode.IsSpace)
+		if raw == "" {
+			break
+		}
+
+		var part string
+		if raw[0] == '"' {
+			end := strings.IndexByte(raw[1:], '"')
+			if end < 0 {
+				part, raw = raw[1:], ""
+			} else {
+				part, raw = raw[1:end+1], raw[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(raw, unicode.IsSpace)
+			if end < 0 {
+				end = len(raw)
+			}
+			part, raw = raw[:end], raw[end:]
+		}
+
+		prefix := strings.HasSuffix(part, "*")
+		var words []string
+		for _, token := range Tokenize(part) {
+			words = append(words, token.Text)
+		}
+		if len(words) > 0 {
+			q.Clauses = append(q.Clauses, Clause{Tokens: words, Prefix: prefix})
+		}
+	}
+	return q
+}
+
+// matches reports whether word satisfies the i-th token of the clause
+func (c Clause) matches(i int, word string) bool {
+	if c.Prefix && i == len(c.Tokens)-1 {
+		return strings.HasPrefix(word, c.Tokens[i])
+	}
+	return word == c.Tokens[i]
+}
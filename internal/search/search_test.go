@@ -0,0 +1,140 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want []Clause
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"*** !!", nil},
+		{"Go", []Clause{{Tokens: []string{"go"}}}},
+		{"web server", []Clause{{Tokens: []string{"web"}}, {Tokens: []string{"server"}}}},
+		{`"web server" mongo`, []Clause{{Tokens: []string{"web", "server"}}, {Tokens: []string{"mongo"}}}},
+		{"mon*", []Clause{{Tokens: []string{"mon"}, Prefix: true}}},
+		{`"rest api*"`, []Clause{{Tokens: []string{"rest", "api"}, Prefix: true}}},
+		{`"unterminated phrase`, []Clause{{Tokens: []string{"unterminated", "phrase"}}}},
+	}
+	for _, tt := range tests {
+		if got := ParseQuery(tt.raw).Clauses; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseQuery(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+// testFields are the fields of a content named name with a description and
+// stacks, weighted like the contents of the store
+func testFields(name, description string, stacks ...string) []Field {
+	return []Field{
+		{Name: "name", Weight: 10, Values: []string{name}},
+		{Name: "stack", Weight: 5, Values: stacks},
+		{Name: "description", Weight: 1, Values: []string{description}},
+	}
+}
+
+func TestScore(t *testing.T) {
+	fields := testFields("Go web server", "A small server written in Go, backed by Mongo", "Go", "MongoDB")
+	tests := []struct {
+		query string
+		want  float64
+	}{
+		// name 10 + stack 5 + description 1
+		{"go", 16},
+		// name 10 + description 1
+		{"server", 11},
+		{"mongo", 1},
+		// the prefix also matches the MongoDB stack
+		{"mongo*", 6},
+		{`"web server"`, 10},
+		// phrases do not match across words that are not consecutive
+		{`"go server"`, 0},
+		// every clause must match
+		{"go python", 0},
+		{"go server", 27},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := Score(fields, ParseQuery(tt.query)); got != tt.want {
+			t.Errorf("Score(%q) = %g, want %g", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	idx := NewIndex()
+	idx.Add("server", testFields("Go web server", "Serves HTTP", "Go"))
+	idx.Add("client", testFields("HTTP client", "Calls a Go web server", "Go"))
+	idx.Add("notes", testFields("Notes", "Nothing about it"))
+	idx.Add("gone", testFields("Go away", "Removed below"))
+	idx.Remove("gone")
+
+	ids := func(results []Result) []string {
+		var ids []string
+		for _, result := range results {
+			ids = append(ids, result.ID)
+		}
+		return ids
+	}
+	tests := []struct {
+		query string
+		limit int
+		want  []string
+	}{
+		// a match in the name outranks one in the description
+		{"server", 0, []string{"server", "client"}},
+		{"http", 0, []string{"client", "server"}},
+		{`"web server"`, 0, []string{"server", "client"}},
+		{"go", 1, []string{"server"}},
+		{"serv*", 0, []string{"server", "client"}},
+		{"go notes", 0, nil},
+		{"away", 0, nil},
+		{"", 0, nil},
+	}
+	for _, tt := range tests {
+		if got := ids(idx.Search(ParseQuery(tt.query), tt.limit)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q, %d) = %v, want %v", tt.query, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestPhrasesDoNotSpanValues(t *testing.T) {
+	idx := NewIndex()
+	idx.Add("content", []Field{{Name: "stack", Weight: 5, Values: []string{"React", "Native"}}})
+	if results := idx.Search(ParseQuery(`"react native"`), 0); len(results) != 0 {
+		t.Fatalf("the phrase matched across two stacks: %v", results)
+	}
+	if score := Score([]Field{{Name: "stack", Weight: 5, Values: []string{"React", "Native"}}}, ParseQuery(`"react native"`)); score != 0 {
+		t.Fatalf("Score matched the phrase across two stacks: %g", score)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		text  string
+		query string
+		want  string
+		ok    bool
+	}{
+		{"A Go web server", "go", "A <mark>Go</mark> web server", true},
+		{"A Go web server", `"web server"`, "A Go <mark>web</mark> <mark>server</mark>", true},
+		{"Mongo & <Go>", "mongo*", "<mark>Mongo</mark> &amp; &lt;Go&gt;", true},
+		{"Nothing here", "go", "", false},
+		{
+			"one two three four five six seven eight nine ten eleven match",
+			"match",
+			"…four five six seven eight nine ten eleven <mark>match</mark>",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		got, ok := Highlight(tt.text, ParseQuery(tt.query))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Highlight(%q, %q) = %q, %v, want %q, %v", tt.text, tt.query, got, ok, tt.want, tt.ok)
+		}
+	}
+}
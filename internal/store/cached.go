@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cms-server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxCachedSessions bounds the sessions a CachedSessions store remembers
+const maxCachedSessions = 10000
+
+// CachedSessions returns a SessionStore remembering the sessions GetSession
+// finds for ttl, so that checking the session of every request does not cost
+// a query each. Changes made through the returned store drop the sessions
+// they touch at once, and a lookup racing them is not cached; changes made
+// elsewhere, such as by another replica, show once the cached copy expires.
+func CachedSessions(next SessionStore, ttl time.Duration) SessionStore {
+	return &cachedSessionStore{
+		SessionStore: next,
+		ttl:          ttl,
+		entries:      make(map[primitive.ObjectID]cachedSession),
+	}
+}
+
+type cachedSession struct {
+	session models.Session
+	expires time.Time
+}
+
+type cachedSessionStore struct {
+	SessionStore
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[primitive.ObjectID]cachedSession
+	// generation counts the changes dropping sessions. A lookup only caches
+	// what it read when no change happened meanwhile, since it may have read
+	// the session before the change.
+	generation uint64
+}
+
+func (s *cachedSessionStore) GetSession(ctx context.Context, id primitive.ObjectID) (models.Session, error) {
+	now := time.Now()
+	s.mu.Lock()
+	entry, ok := s.entries[id]
+	generation := s.generation
+	s.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.session, nil
+	}
+
+	session, err := s.SessionStore.GetSession(ctx, id)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generation != generation {
+		return session, nil
+	}
+	if len(s.entries) >= maxCachedSessions {
+		s.evictExpired(now)
+	}
+	if len(s.entries) < maxCachedSessions {
+		s.entries[id] = cachedSession{session: session, expires: now.Add(s.ttl)}
+	}
+	return session, nil
+}
+
+// evictExpired drops the expired entries; the caller holds s.mu
+func (s *cachedSessionStore) evictExpired(now time.Time) {
+	for id, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, id)
+		}
+	}
+}
+
+func (s *cachedSessionStore) RotateRefreshToken(ctx context.Context, oldHash, newHash string, now time.Time, expiresAt time.Time) (models.Session, error) {
+	session, err := s.SessionStore.RotateRefreshToken(ctx, oldHash, newHash, now, expiresAt)
+	if err == nil {
+		s.forget(session.ID)
+	}
+	return session, err
+}
+
+func (s *cachedSessionStore) RevokeSession(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	err := s.SessionStore.RevokeSession(ctx, id, now)
+	s.forget(id)
+	return err
+}
+
+func (s *cachedSessionStore) RevokeUserSessions(ctx context.Context, userID string, except primitive.ObjectID, now time.Time) error {
+	err := s.SessionStore.RevokeUserSessions(ctx, userID, except, now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	for id, entry := range s.entries {
+		if entry.session.UserID == userID && id != except {
+			delete(s.entries, id)
+		}
+	}
+	return err
+}
+
+// forget drops the cached copy of the session id, once its change is
+// written
+func (s *cachedSessionStore) forget(id primitive.ObjectID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	delete(s.entries, id)
+}
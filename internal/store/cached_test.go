@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cms-server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// countingSessions counts the lookups reaching the wrapped store
+type countingSessions struct {
+	SessionStore
+	lookups int
+}
+
+func (s *countingSessions) GetSession(ctx context.Context, id primitive.ObjectID) (models.Session, error) {
+	s.lookups++
+	return s.SessionStore.GetSession(ctx, id)
+}
+
+func TestCachedSessions(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	newSession := func(sessions SessionStore, userID string) models.Session {
+		t.Helper()
+		session := models.Session{UserID: userID, TokenHash: primitive.NewObjectID().Hex(), CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+		if err := sessions.CreateSession(ctx, &session); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		return session
+	}
+
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		// change runs between two lookups of session, through the cache or
+		// straight on the store behind it
+		change      func(cached, next SessionStore, session, other models.Session)
+		wantLookups int
+		wantRevoked bool
+	}{
+		{"a second lookup is cached", time.Minute, func(cached, next SessionStore, session, other models.Session) {}, 1, false},
+		{"an expired entry is looked up again", 0, func(cached, next SessionStore, session, other models.Session) {}, 2, false},
+		{"a revocation elsewhere waits for the entry to expire", time.Minute, func(cached, next SessionStore, session, other models.Session) {
+			next.RevokeSession(ctx, session.ID, now)
+		}, 1, false},
+		{"revoking the session drops it", time.Minute, func(cached, next SessionStore, session, other models.Session) {
+			cached.RevokeSession(ctx, session.ID, now)
+		}, 2, true},
+		{"revoking the sessions of the user drops it", time.Minute, func(cached, next SessionStore, session, other models.Session) {
+			cached.RevokeUserSessions(ctx, session.UserID, other.ID, now)
+		}, 2, true},
+		{"revoking the other sessions keeps it", time.Minute, func(cached, next SessionStore, session, other models.Session) {
+			cached.RevokeUserSessions(ctx, session.UserID, session.ID, now)
+		}, 1, false},
+		{"rotating its refresh token drops it", time.Minute, func(cached, next SessionStore, session, other models.Session) {
+			cached.RotateRefreshToken(ctx, session.TokenHash, "rotated", now, now.Add(time.Hour))
+		}, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &countingSessions{SessionStore: NewMemoryStore().Sessions}
+			cached := CachedSessions(next, tt.ttl)
+			session := newSession(next, "alice")
+			other := newSession(next, "alice")
+
+			if _, err := cached.GetSession(ctx, session.ID); err != nil {
+				t.Fatalf("GetSession: %v", err)
+			}
+			tt.change(cached, next, session, other)
+			got, err := cached.GetSession(ctx, session.ID)
+			if err != nil {
+				t.Fatalf("GetSession: %v", err)
+			}
+
+			if next.lookups != tt.wantLookups {
+				t.Errorf("%d lookups reached the store, want %d", next.lookups, tt.wantLookups)
+			}
+			if revoked := got.RevokedAt != nil; revoked != tt.wantRevoked {
+				t.Errorf("revoked %v, want %v", revoked, tt.wantRevoked)
+			}
+		})
+	}
+}
+
+func TestCachedSessionsDoNotCacheMisses(t *testing.T) {
+	next := &countingSessions{SessionStore: NewMemoryStore().Sessions}
+	cached := CachedSessions(next, time.Minute)
+	id := primitive.NewObjectID()
+	for i := 0; i < 2; i++ {
+		if _, err := cached.GetSession(context.Background(), id); err != ErrNotFound {
+			t.Fatalf("GetSession of a missing session: %v, want ErrNotFound", err)
+		}
+	}
+	if next.lookups != 2 {
+		t.Errorf("%d lookups reached the store, want 2", next.lookups)
+	}
+}
+
+// pausedSessions holds GetSession after it read the session, until resumed
+type pausedSessions struct {
+	SessionStore
+	read, resume chan struct{}
+}
+
+func (s *pausedSessions) GetSession(ctx context.Context, id primitive.ObjectID) (models.Session, error) {
+	session, err := s.SessionStore.GetSession(ctx, id)
+	s.read <- struct{}{}
+	<-s.resume
+	return session, err
+}
+
+func TestCachedSessionsRevokedDuringALookup(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name   string
+		revoke func(cached SessionStore, session models.Session)
+	}{
+		{"the session", func(cached SessionStore, session models.Session) {
+			cached.RevokeSession(ctx, session.ID, now)
+		}},
+		{"the sessions of the user", func(cached SessionStore, session models.Session) {
+			cached.RevokeUserSessions(ctx, session.UserID, primitive.NilObjectID, now)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &pausedSessions{SessionStore: NewMemoryStore().Sessions, read: make(chan struct{}), resume: make(chan struct{})}
+			cached := CachedSessions(next, time.Minute)
+			session := models.Session{UserID: "alice", TokenHash: "hash", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+			if err := next.CreateSession(ctx, &session); err != nil {
+				t.Fatalf("CreateSession: %v", err)
+			}
+
+			// A lookup reads the session, which is revoked before the lookup
+			// caches what it read
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				cached.GetSession(ctx, session.ID)
+			}()
+			<-next.read
+			tt.revoke(cached, session)
+			next.resume <- struct{}{}
+			<-done
+
+			go func() {
+				<-next.read
+				next.resume <- struct{}{}
+			}()
+			got, err := cached.GetSession(ctx, session.ID)
+			if err != nil || got.RevokedAt == nil {
+				t.Errorf("the cache kept the session read before its revocation (%v)", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cms-server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoCommentStore struct {
+	collection *mongo.Collection
+	contents   *mongo.Collection
+}
+
+func (s *mongoCommentStore) CreateComment(ctx context.Context, comment *models.Comment) error {
+	if comment.ID.IsZero() {
+		comment.ID = primitive.NewObjectID()
+	}
+	if _, err := s.collection.InsertOne(ctx, comment); err != nil {
+		return mapMongoError(err)
+	}
+
+	if comment.ParentID != nil {
+		_, err := s.collection.UpdateOne(ctx, bson.M{"_id": *comment.ParentID}, bson.M{"$inc": bson.M{"reply_count": 1}})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := s.contents.UpdateOne(ctx, bson.M{"_id": comment.ContentID}, bson.M{"$inc": bson.M{"comment_count": 1}})
+	return err
+}
+
+func (s *mongoCommentStore) GetComment(ctx context.Context, id primitive.ObjectID) (models.Comment, error) {
+	var comment models.Comment
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&comment)
+	return comment, mapMongoError(err)
+}
+
+func (s *mongoCommentStore) ListComments(ctx context.Context, contentID, parentID primitive.ObjectID, opts ListOptions) (Page[models.Comment], error) {
+	query := bson.M{"content_id": contentID, "parent_id": nil}
+	if !parentID.IsZero() {
+		query["parent_id"] = parentID
+	}
+	return findPage(ctx, s.collection, query, opts, commentKey)
+}
+
+func (s *mongoCommentStore) UpdateCommentBody(ctx context.Context, id primitive.ObjectID, body string) (models.Comment, error) {
+	update := bson.M{"$set": bson.M{"body": body, "updated_at": time.Now().UTC()}}
+	findOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var comment models.Comment
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": id, "deleted": false}, update, findOptions).Decode(&comment)
+	return comment, mapMongoError(err)
+}
+
+func (s *mongoCommentStore) DeleteComment(ctx context.Context, id primitive.ObjectID) error {
+	// Only the call that flips the flag decrements the counter
+	update := bson.M{"$set": bson.M{"deleted": true, "body": "", "updated_at": time.Now().UTC()}}
+	var comment models.Comment
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": id, "deleted": false}, update).Decode(&comment)
+	if err != nil {
+		return mapMongoError(err)
+	}
+
+	if comment.ParentID != nil {
+		_, err := s.collection.UpdateOne(ctx, bson.M{"_id": *comment.ParentID}, bson.M{"$inc": bson.M{"reply_count": -1}})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = s.contents.UpdateOne(ctx, bson.M{"_id": comment.ContentID}, bson.M{"$inc": bson.M{"comment_count": -1}})
+	return err
+}
+
+func (s *mongoCommentStore) DeleteContentComments(ctx context.Context, contentID primitive.ObjectID) error {
+	_, err := s.collection.DeleteMany(ctx, bson.M{"content_id": contentID})
+	return err
+}
+
+// memoryCommentStore updates the counters of the content store it belongs to
+type memoryCommentStore struct {
+	mu       sync.RWMutex
+	comments map[primitive.ObjectID]models.Comment
+	contents *memoryContentStore
+}
+
+// addToCommentCount updates the comment counter of a content
+func (s *memoryCommentStore) addToCommentCount(contentID primitive.ObjectID, delta int64) {
+	s.contents.mu.Lock()
+	defer s.contents.mu.Unlock()
+
+	if content, ok := s.contents.contents[contentID]; ok {
+		content.CommentCount += delta
+		s.contents.contents[contentID] = content
+	}
+}
+
+func (s *memoryCommentStore) CreateComment(ctx context.Context, comment *models.Comment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if comment.ID.IsZero() {
+		comment.ID = primitive.NewObjectID()
+	}
+	if _, exists := s.comments[comment.ID]; exists {
+		return ErrDuplicate
+	}
+	s.comments[comment.ID] = *comment
+
+	if comment.ParentID != nil {
+		if parent, ok := s.comments[*comment.ParentID]; ok {
+			parent.ReplyCount++
+			s.comments[parent.ID] = parent
+		}
+	}
+	s.addToCommentCount(comment.ContentID, 1)
+	return nil
+}
+
+func (s *memoryCommentStore) GetComment(ctx context.Context, id primitive.ObjectID) (models.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	comment, ok := s.comments[id]
+	if !ok {
+		return models.Comment{}, ErrNotFound
+	}
+	return comment, nil
+}
+
+func (s *memoryCommentStore) ListComments(ctx context.Context, contentID, parentID primitive.ObjectID, opts ListOptions) (Page[models.Comment], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var comments []models.Comment
+	for _, comment := range s.comments {
+		if comment.ContentID != contentID {
+			continue
+		}
+		if (parentID.IsZero() && comment.ParentID == nil) || (comment.ParentID != nil && *comment.ParentID == parentID) {
+			comments = append(comments, comment)
+		}
+	}
+	return paginate(comments, opts, commentKey), nil
+}
+
+func (s *memoryCommentStore) UpdateCommentBody(ctx context.Context, id primitive.ObjectID, body string) (models.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, ok := s.comments[id]
+	if !ok || comment.Deleted {
+		return models.Comment{}, ErrNotFound
+	}
+	now := time.Now().UTC()
+	comment.Body = body
+	comment.UpdatedAt = &now
+	s.comments[id] = comment
+	return comment, nil
+}
+
+func (s *memoryCommentStore) DeleteComment(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, ok := s.comments[id]
+	if !ok || comment.Deleted {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	comment.Deleted = true
+	comment.Body = ""
+	comment.UpdatedAt = &now
+	s.comments[id] = comment
+
+	if comment.ParentID != nil {
+		if parent, ok := s.comments[*comment.ParentID]; ok {
+			parent.ReplyCount--
+			s.comments[parent.ID] = parent
+		}
+	}
+	s.addToCommentCount(comment.ContentID, -1)
+	return nil
+}
+
+func (s *memoryCommentStore) DeleteContentComments(ctx context.Context, contentID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, comment := range s.comments {
+		if comment.ContentID == contentID {
+			delete(s.comments, id)
+		}
+	}
+	return nil
+}
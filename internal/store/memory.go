@@ -0,0 +1,678 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"cms-server/internal/models"
+	"cms-server/internal/search"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NewMemoryStore returns a Store that keeps everything in process memory.
+// It is meant for tests and local demos that run without MongoDB.
+func NewMemoryStore() *Store {
+	contents := &memoryContentStore{contents: map[primitive.ObjectID]models.Content{}, index: search.NewIndex()}
+	return &Store{
+		Users:         &memoryUserStore{users: map[primitive.ObjectID]models.User{}},
+		Contents:      contents,
+		Stacks:        &memoryStackStore{stacks: map[primitive.ObjectID]models.Stack{}},
+		Follows:       &memoryFollowStore{},
+		Timelines:     &memoryTimelineStore{owners: map[string]bool{}},
+		Reactions:     &memoryReactionStore{reactions: map[reactionKey]models.Reaction{}, contents: contents},
+		Comments:      &memoryCommentStore{comments: map[primitive.ObjectID]models.Comment{}, contents: contents},
+		Notifications: &memoryNotificationStore{notifications: map[primitive.ObjectID]models.Notification{}},
+		Sessions:      &memorySessionStore{sessions: map[primitive.ObjectID]models.Session{}},
+	}
+}
+
+// sortByID orders items by their ObjectID, which follows insertion time
+func sortByID[T any](items []T, id func(T) primitive.ObjectID) {
+	sort.Slice(items, func(i, j int) bool {
+		a, b := id(items[i]), id(items[j])
+		return a.Hex() < b.Hex()
+	})
+}
+
+// copyContent detaches the embedded stacks and counters from the stored document
+func copyContent(content models.Content) models.Content {
+	content.Stack = slices.Clone(content.Stack)
+	content.Reactions = maps.Clone(content.Reactions)
+	return content
+}
+
+type memoryUserStore struct {
+	mu    sync.RWMutex
+	users map[primitive.ObjectID]models.User
+}
+
+func (s *memoryUserStore) CreateUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	// Usernames and emails are unique, like the indexes of the users
+	// collection
+	for id, existing := range s.users {
+		if id == user.ID || existing.Username == user.Username || existing.Email == user.Email {
+			return ErrDuplicate
+		}
+	}
+	s.users[user.ID] = *user
+	return nil
+}
+
+func (s *memoryUserStore) GetUserByID(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (s *memoryUserStore) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (s *memoryUserStore) SetUserRole(ctx context.Context, id primitive.ObjectID, role string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	user.Role = role
+	s.users[id] = user
+	return user, nil
+}
+
+func (s *memoryUserStore) CountUsersByRole(ctx context.Context, role string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for _, user := range s.users {
+		if user.Role == role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memoryUserStore) ListUsers(ctx context.Context, opts ListOptions) (Page[models.User], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]models.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	return paginate(users, opts, userKey), nil
+}
+
+func (s *memoryUserStore) GetUsersByID(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []models.User
+	for _, id := range ids {
+		if user, ok := s.users[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+type memoryContentStore struct {
+	mu       sync.RWMutex
+	contents map[primitive.ObjectID]models.Content
+	index    *search.Index
+}
+
+func (s *memoryContentStore) CreateContent(ctx context.Context, content *models.Content) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if content.ID.IsZero() {
+		content.ID = primitive.NewObjectID()
+	}
+	if _, exists := s.contents[content.ID]; exists {
+		return ErrDuplicate
+	}
+	s.contents[content.ID] = copyContent(*content)
+	s.index.Add(content.ID.Hex(), ContentFields(*content))
+	return nil
+}
+
+func (s *memoryContentStore) GetContent(ctx context.Context, id primitive.ObjectID) (models.Content, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	content, ok := s.contents[id]
+	if !ok {
+		return models.Content{}, ErrNotFound
+	}
+	return copyContent(content), nil
+}
+
+// matchContent reports whether content satisfies filter
+func matchContent(content models.Content, filter ContentFilter) bool {
+	if filter.UserID != "" && content.UserID != filter.UserID {
+		return false
+	}
+	if filter.UserIDs != nil && !slices.Contains(filter.UserIDs, content.UserID) {
+		return false
+	}
+	if !filter.StackID.IsZero() || filter.StackName != "" {
+		found := false
+		for _, stack := range content.Stack {
+			if (filter.StackID.IsZero() || stack.ID == filter.StackID) &&
+				(filter.StackName == "" || stack.Name == filter.StackName) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	created := content.ID.Timestamp()
+	if !filter.From.IsZero() && created.Before(filter.From.Truncate(time.Second)) {
+		return false
+	}
+	if !filter.To.IsZero() && !created.Before(filter.To.Truncate(time.Second)) {
+		return false
+	}
+	return filter.IncludeHidden || !content.Hidden
+}
+
+func (s *memoryContentStore) GetContentsByID(ctx context.Context, ids []primitive.ObjectID) ([]models.Content, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var contents []models.Content
+	for _, id := range ids {
+		if content, ok := s.contents[id]; ok {
+			contents = append(contents, copyContent(content))
+		}
+	}
+	return contents, nil
+}
+
+func (s *memoryContentStore) FindContents(ctx context.Context, filter ContentFilter, opts ListOptions) (Page[models.Content], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var contents []models.Content
+	for _, content := range s.contents {
+		if matchContent(content, filter) {
+			contents = append(contents, copyContent(content))
+		}
+	}
+	return paginate(contents, opts, contentKey), nil
+}
+
+func (s *memoryContentStore) UpdateContent(ctx context.Context, content models.Content) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.contents[content.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.Name = content.Name
+	existing.Description = content.Description
+	existing.Url = content.Url
+	existing.ImgUrl = content.ImgUrl
+	existing.Stack = slices.Clone(content.Stack)
+	s.contents[content.ID] = existing
+	s.index.Add(content.ID.Hex(), ContentFields(existing))
+	return nil
+}
+
+func (s *memoryContentStore) DeleteContent(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.contents[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.contents, id)
+	s.index.Remove(id.Hex())
+	return nil
+}
+
+func (s *memoryContentStore) SetContentHidden(ctx context.Context, id primitive.ObjectID, hidden bool, by string, at time.Time) (models.Content, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, ok := s.contents[id]
+	if !ok {
+		return models.Content{}, ErrNotFound
+	}
+	content.Hidden, content.HiddenBy, content.HiddenAt = false, "", nil
+	if hidden {
+		content.Hidden, content.HiddenBy, content.HiddenAt = true, by, &at
+	}
+	s.contents[id] = content
+	return copyContent(content), nil
+}
+
+func (s *memoryContentStore) SearchContents(ctx context.Context, query search.Query, limit int) ([]SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var results []SearchResult
+	for _, hit := range s.index.Search(query, limit) {
+		id, _ := primitive.ObjectIDFromHex(hit.ID)
+		if content, ok := s.contents[id]; ok && !content.Hidden {
+			results = append(results, SearchResult{Content: copyContent(content), Score: hit.Score})
+		}
+	}
+	return results, nil
+}
+
+func (s *memoryContentStore) CountContents(ctx context.Context, filter ContentFilter) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for _, content := range s.contents {
+		if matchContent(content, filter) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// rewriteStacks applies rewrite to the embedded stacks of every content using
+// stackID and reindexes the contents that changed
+func (s *memoryContentStore) rewriteStacks(stackID primitive.ObjectID, rewrite func([]models.Stack) []models.Stack) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changed int64
+	for id, content := range s.contents {
+		uses := slices.ContainsFunc(content.Stack, func(stack models.Stack) bool { return stack.ID == stackID })
+		if !uses {
+			continue
+		}
+		content.Stack = rewrite(slices.Clone(content.Stack))
+		s.contents[id] = content
+		s.index.Add(id.Hex(), ContentFields(content))
+		changed++
+	}
+	return changed
+}
+
+func (s *memoryContentStore) UpdateEmbeddedStack(ctx context.Context, stack models.Stack) (int64, error) {
+	return s.rewriteStacks(stack.ID, func(stacks []models.Stack) []models.Stack {
+		for i := range stacks {
+			if stacks[i].ID == stack.ID {
+				stacks[i].Name = stack.Name
+				stacks[i].Color = stack.Color
+			}
+		}
+		return stacks
+	}), nil
+}
+
+func (s *memoryContentStore) ReplaceEmbeddedStack(ctx context.Context, stackID primitive.ObjectID, replacement *models.Stack) (int64, error) {
+	return s.rewriteStacks(stackID, func(stacks []models.Stack) []models.Stack {
+		hasReplacement := replacement != nil && slices.ContainsFunc(stacks, func(stack models.Stack) bool { return stack.ID == replacement.ID })
+		result := stacks[:0]
+		for _, stack := range stacks {
+			if stack.ID != stackID {
+				result = append(result, stack)
+			} else if replacement != nil && !hasReplacement {
+				result = append(result, *replacement)
+			}
+		}
+		return result
+	}), nil
+}
+
+type memoryStackStore struct {
+	mu     sync.RWMutex
+	stacks map[primitive.ObjectID]models.Stack
+}
+
+func (s *memoryStackStore) CreateStack(ctx context.Context, stack *models.Stack) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stack.ID.IsZero() {
+		stack.ID = primitive.NewObjectID()
+	}
+	for id, existing := range s.stacks {
+		if id == stack.ID || existing.Name == stack.Name {
+			return ErrDuplicate
+		}
+	}
+	s.stacks[stack.ID] = *stack
+	return nil
+}
+
+func (s *memoryStackStore) GetStackByName(ctx context.Context, name string) (models.Stack, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, stack := range s.stacks {
+		if stack.Name == name {
+			return stack, nil
+		}
+	}
+	return models.Stack{}, ErrNotFound
+}
+
+func (s *memoryStackStore) FindStacksByName(ctx context.Context, names []string) ([]models.Stack, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	var stacks []models.Stack
+	for _, stack := range s.stacks {
+		if wanted[stack.Name] {
+			stacks = append(stacks, stack)
+		}
+	}
+	sortByID(stacks, func(s models.Stack) primitive.ObjectID { return s.ID })
+	return stacks, nil
+}
+
+func (s *memoryStackStore) ListStacks(ctx context.Context, opts ListOptions) (Page[models.Stack], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var stacks []models.Stack
+	for _, stack := range s.stacks {
+		stacks = append(stacks, stack)
+	}
+	return paginate(stacks, opts, stackKey), nil
+}
+
+func (s *memoryStackStore) GetStack(ctx context.Context, id primitive.ObjectID) (models.Stack, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stack, ok := s.stacks[id]
+	if !ok {
+		return models.Stack{}, ErrNotFound
+	}
+	return stack, nil
+}
+
+func (s *memoryStackStore) UpdateStack(ctx context.Context, stack models.Stack) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.stacks[stack.ID]; !ok {
+		return ErrNotFound
+	}
+	for id, existing := range s.stacks {
+		if id != stack.ID && existing.Name == stack.Name {
+			return ErrDuplicate
+		}
+	}
+	s.stacks[stack.ID] = stack
+	return nil
+}
+
+func (s *memoryStackStore) DeleteStack(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.stacks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.stacks, id)
+	return nil
+}
+
+type memoryFollowStore struct {
+	mu      sync.RWMutex
+	follows []models.Follow
+}
+
+func (s *memoryFollowStore) find(followerID, followeeID string) int {
+	for i, follow := range s.follows {
+		if follow.FollowerID == followerID && follow.FolloweeID == followeeID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *memoryFollowStore) Follow(ctx context.Context, followerID, followeeID string) (models.Follow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.find(followerID, followeeID) >= 0 {
+		return models.Follow{}, ErrDuplicate
+	}
+	follow := models.Follow{
+		ID:         primitive.NewObjectID(),
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+		CreatedAt:  time.Now().UTC(),
+	}
+	s.follows = append(s.follows, follow)
+	return follow, nil
+}
+
+func (s *memoryFollowStore) Unfollow(ctx context.Context, followerID, followeeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.find(followerID, followeeID)
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.follows = append(s.follows[:i], s.follows[i+1:]...)
+	return nil
+}
+
+// filter returns the follows accepted by keep
+func (s *memoryFollowStore) filter(keep func(models.Follow) bool) []models.Follow {
+	var follows []models.Follow
+	for _, follow := range s.follows {
+		if keep(follow) {
+			follows = append(follows, follow)
+		}
+	}
+	return follows
+}
+
+func (s *memoryFollowStore) ListFollowers(ctx context.Context, userID string, opts ListOptions) (Page[models.Follow], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	follows := s.filter(func(f models.Follow) bool { return f.FolloweeID == userID })
+	return paginate(follows, opts, followKey), nil
+}
+
+func (s *memoryFollowStore) ListFollowing(ctx context.Context, userID string, opts ListOptions) (Page[models.Follow], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	follows := s.filter(func(f models.Follow) bool { return f.FollowerID == userID })
+	return paginate(follows, opts, followKey), nil
+}
+
+func (s *memoryFollowStore) CountFollowers(ctx context.Context, userID string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return int64(len(s.filter(func(f models.Follow) bool { return f.FolloweeID == userID }))), nil
+}
+
+func (s *memoryFollowStore) CountFollowing(ctx context.Context, userID string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return int64(len(s.filter(func(f models.Follow) bool { return f.FollowerID == userID }))), nil
+}
+
+// followIDs maps follows to one side of the edge
+func followIDs(follows []models.Follow, side func(models.Follow) string) []string {
+	ids := make([]string, 0, len(follows))
+	for _, follow := range follows {
+		ids = append(ids, side(follow))
+	}
+	return ids
+}
+
+func (s *memoryFollowStore) FollowerIDs(ctx context.Context, userID string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	follows := s.filter(func(f models.Follow) bool { return f.FolloweeID == userID })
+	return followIDs(follows, func(f models.Follow) string { return f.FollowerID }), nil
+}
+
+func (s *memoryFollowStore) FollowingIDs(ctx context.Context, userID string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	follows := s.filter(func(f models.Follow) bool { return f.FollowerID == userID })
+	return followIDs(follows, func(f models.Follow) string { return f.FolloweeID }), nil
+}
+
+type memoryTimelineStore struct {
+	mu      sync.RWMutex
+	entries []models.TimelineEntry
+	owners  map[string]bool
+}
+
+func (s *memoryTimelineStore) AddToTimelines(ctx context.Context, userIDs []string, contentID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A timeline holds a content once, like the timelines_entry index
+	present := make(map[string]bool)
+	for _, entry := range s.entries {
+		if entry.ContentID == contentID {
+			present[entry.UserID] = true
+		}
+	}
+	for _, userID := range userIDs {
+		if present[userID] {
+			continue
+		}
+		present[userID] = true
+		s.entries = append(s.entries, models.TimelineEntry{
+			ID:        primitive.NewObjectID(),
+			UserID:    userID,
+			ContentID: contentID,
+		})
+	}
+	return nil
+}
+
+func (s *memoryTimelineStore) ListTimeline(ctx context.Context, userID string, opts ListOptions) (Page[models.TimelineEntry], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []models.TimelineEntry
+	for _, entry := range s.entries {
+		if entry.UserID == userID {
+			entries = append(entries, entry)
+		}
+	}
+	return paginate(entries, opts, timelineKey), nil
+}
+
+func (s *memoryTimelineStore) RemoveFromTimelines(ctx context.Context, contentID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = slices.DeleteFunc(s.entries, func(e models.TimelineEntry) bool { return e.ContentID == contentID })
+	return nil
+}
+
+func (s *memoryTimelineStore) BackfillTimeline(ctx context.Context, userID string, contentIDs []primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	present := make(map[primitive.ObjectID]bool)
+	for _, entry := range s.entries {
+		if entry.UserID == userID {
+			present[entry.ContentID] = true
+		}
+	}
+	for _, contentID := range contentIDs {
+		if present[contentID] {
+			continue
+		}
+		present[contentID] = true
+		s.entries = append(s.entries, models.TimelineEntry{
+			ID:        primitive.NewObjectID(),
+			UserID:    userID,
+			ContentID: contentID,
+		})
+	}
+	return nil
+}
+
+func (s *memoryTimelineStore) RemoveFromTimeline(ctx context.Context, userID string, contentIDs []primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = slices.DeleteFunc(s.entries, func(e models.TimelineEntry) bool {
+		return e.UserID == userID && slices.Contains(contentIDs, e.ContentID)
+	})
+	return nil
+}
+
+func (s *memoryTimelineStore) ClearTimeline(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = slices.DeleteFunc(s.entries, func(e models.TimelineEntry) bool { return e.UserID == userID })
+	return nil
+}
+
+func (s *memoryTimelineStore) EnableTimeline(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.owners[userID] = true
+	return nil
+}
+
+func (s *memoryTimelineStore) TimelineOwners(ctx context.Context, userIDs []string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var owners []string
+	for _, userID := range userIDs {
+		if s.owners[userID] && !slices.Contains(owners, userID) {
+			owners = append(owners, userID)
+		}
+	}
+	return owners, nil
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTimelineHoldsAContentOnce(t *testing.T) {
+	ctx := context.Background()
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+
+	tests := []struct {
+		name   string
+		add    func(s TimelineStore)
+		alice  int
+		others int
+	}{
+		{"a fan-out repeated", func(s TimelineStore) {
+			s.AddToTimelines(ctx, []string{"alice", "bob"}, first)
+			s.AddToTimelines(ctx, []string{"alice", "bob"}, first)
+		}, 1, 1},
+		{"a user listed twice", func(s TimelineStore) {
+			s.AddToTimelines(ctx, []string{"alice", "alice"}, first)
+		}, 1, 0},
+		{"a backfill racing a fan-out", func(s TimelineStore) {
+			s.BackfillTimeline(ctx, "alice", []primitive.ObjectID{first, second})
+			s.AddToTimelines(ctx, []string{"alice", "bob"}, second)
+		}, 2, 1},
+		{"a fan-out racing a backfill", func(s TimelineStore) {
+			s.AddToTimelines(ctx, []string{"alice"}, second)
+			s.BackfillTimeline(ctx, "alice", []primitive.ObjectID{first, second})
+		}, 2, 0},
+	}
+	for _, tt := range tests {
+		s := NewMemoryStore().Timelines
+		tt.add(s)
+		alice, _ := s.ListTimeline(ctx, "alice", ListOptions{Sort: SortNewest})
+		bob, _ := s.ListTimeline(ctx, "bob", ListOptions{Sort: SortNewest})
+		if len(alice.Items) != tt.alice || len(bob.Items) != tt.others {
+			t.Errorf("%s: alice has %d entries and bob %d, want %d and %d", tt.name, len(alice.Items), len(bob.Items), tt.alice, tt.others)
+		}
+	}
+}
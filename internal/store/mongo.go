@@ -0,0 +1,516 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"cms-server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewMongoStore returns a Store backed by the collections of db
+func NewMongoStore(db *mongo.Database) *Store {
+	return &Store{
+		Users:         &mongoUserStore{collection: db.Collection("users")},
+		Contents:      &mongoContentStore{collection: db.Collection("contents")},
+		Stacks:        &mongoStackStore{collection: db.Collection("stacks")},
+		Follows:       &mongoFollowStore{collection: db.Collection("follows")},
+		Timelines:     &mongoTimelineStore{collection: db.Collection("timelines"), owners: db.Collection("timeline_owners")},
+		Reactions:     &mongoReactionStore{collection: db.Collection("reactions"), contents: db.Collection("contents")},
+		Comments:      &mongoCommentStore{collection: db.Collection("comments"), contents: db.Collection("contents")},
+		Notifications: &mongoNotificationStore{collection: db.Collection("notifications")},
+		Sessions:      &mongoSessionStore{collection: db.Collection("sessions")},
+	}
+}
+
+// mapMongoError translates driver errors into store errors
+func mapMongoError(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// decodeAll drains a cursor into a slice of T
+func decodeAll[T any](ctx context.Context, cursor *mongo.Cursor) ([]T, error) {
+	defer cursor.Close(ctx)
+
+	var items []T
+	for cursor.Next(ctx) {
+		var item T
+		if err := cursor.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	// Check if there was an error during the cursor iteration
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+type mongoUserStore struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoUserStore) CreateUser(ctx context.Context, user *models.User) error {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	_, err := s.collection.InsertOne(ctx, user)
+	return mapMongoError(err)
+}
+
+func (s *mongoUserStore) GetUserByID(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	var user models.User
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+	return user, mapMongoError(err)
+}
+
+func (s *mongoUserStore) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+	var user models.User
+	err := s.collection.FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	return user, mapMongoError(err)
+}
+
+// GetUsersByID returns the users of ids in no particular order. An empty ids
+// matches nothing without a query: $in refuses the null a nil slice encodes to.
+func (s *mongoUserStore) GetUsersByID(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	cursor, err := s.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll[models.User](ctx, cursor)
+}
+
+func (s *mongoUserStore) SetUserRole(ctx context.Context, id primitive.ObjectID, role string) (models.User, error) {
+	findOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var user models.User
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"role": role}}, findOptions).Decode(&user)
+	return user, mapMongoError(err)
+}
+
+func (s *mongoUserStore) CountUsersByRole(ctx context.Context, role string) (int64, error) {
+	return s.collection.CountDocuments(ctx, bson.M{"role": role})
+}
+
+func (s *mongoUserStore) ListUsers(ctx context.Context, opts ListOptions) (Page[models.User], error) {
+	return findPage(ctx, s.collection, bson.M{}, opts, userKey)
+}
+
+type mongoContentStore struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoContentStore) CreateContent(ctx context.Context, content *models.Content) error {
+	if content.ID.IsZero() {
+		content.ID = primitive.NewObjectID()
+	}
+	_, err := s.collection.InsertOne(ctx, content)
+	return mapMongoError(err)
+}
+
+func (s *mongoContentStore) GetContent(ctx context.Context, id primitive.ObjectID) (models.Content, error) {
+	var content models.Content
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&content)
+	return content, mapMongoError(err)
+}
+
+// contentQuery translates a ContentFilter into a MongoDB query
+func contentQuery(filter ContentFilter) bson.M {
+	query := bson.M{}
+	switch {
+	case filter.UserIDs != nil && filter.UserID != "":
+		// Both narrow the authors down, like matchContent does
+		authors := []string{}
+		if slices.Contains(filter.UserIDs, filter.UserID) {
+			authors = append(authors, filter.UserID)
+		}
+		query["user_id"] = bson.M{"$in": authors}
+	case filter.UserIDs != nil:
+		query["user_id"] = bson.M{"$in": filter.UserIDs}
+	case filter.UserID != "":
+		query["user_id"] = filter.UserID
+	}
+	if !filter.StackID.IsZero() {
+		query["stack._id"] = filter.StackID
+	}
+	if filter.StackName != "" {
+		query["stack.name"] = filter.StackName
+	}
+
+	// ObjectIDs start with their creation time, so a date range is an _id range
+	created := bson.M{}
+	if !filter.From.IsZero() {
+		created["$gte"] = primitive.NewObjectIDFromTimestamp(filter.From)
+	}
+	if !filter.To.IsZero() {
+		created["$lt"] = primitive.NewObjectIDFromTimestamp(filter.To)
+	}
+	if len(created) > 0 {
+		query["_id"] = created
+	}
+	if !filter.IncludeHidden {
+		query["hidden"] = bson.M{"$ne": true}
+	}
+	return query
+}
+
+// findPage runs a paginated query against collection
+func findPage[T any](ctx context.Context, collection *mongo.Collection, query bson.M, opts ListOptions, key func(T) Cursor) (Page[T], error) {
+	return findPageOn(ctx, collection, "_id", query, opts, key)
+}
+
+// findPageOn runs a paginated query ordered by the ObjectID field idField
+// rather than _id
+func findPageOn[T any](ctx context.Context, collection *mongo.Collection, idField string, query bson.M, opts ListOptions, key func(T) Cursor) (Page[T], error) {
+	findOptions := options.Find().SetSort(mongoSort(idField, opts.Sort))
+	if opts.Limit > 0 {
+		findOptions.SetLimit(int64(opts.Limit + 1))
+	}
+
+	cursor, err := collection.Find(ctx, mongoAnd(query, mongoAfter(idField, opts)), findOptions)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	items, err := decodeAll[T](ctx, cursor)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	return newPage(items, opts, key), nil
+}
+
+// GetContentsByID returns the contents of ids in no particular order, like
+// GetUsersByID
+func (s *mongoContentStore) GetContentsByID(ctx context.Context, ids []primitive.ObjectID) ([]models.Content, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	cursor, err := s.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll[models.Content](ctx, cursor)
+}
+
+func (s *mongoContentStore) FindContents(ctx context.Context, filter ContentFilter, opts ListOptions) (Page[models.Content], error) {
+	return findPage(ctx, s.collection, contentQuery(filter), opts, contentKey)
+}
+
+func (s *mongoContentStore) UpdateContent(ctx context.Context, content models.Content) error {
+	update := bson.M{
+		"$set": bson.M{
+			"name":        content.Name,
+			"description": content.Description,
+			"url":         content.Url,
+			"imgUrl":      content.ImgUrl,
+			"stack":       content.Stack,
+		},
+	}
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": content.ID}, update)
+	if err != nil {
+		return mapMongoError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoContentStore) DeleteContent(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoContentStore) SetContentHidden(ctx context.Context, id primitive.ObjectID, hidden bool, by string, at time.Time) (models.Content, error) {
+	update := bson.M{"$unset": bson.M{"hidden": "", "hidden_by": "", "hidden_at": ""}}
+	if hidden {
+		update = bson.M{"$set": bson.M{"hidden": true, "hidden_by": by, "hidden_at": at}}
+	}
+	findOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var content models.Content
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, findOptions).Decode(&content)
+	return content, mapMongoError(err)
+}
+
+func (s *mongoContentStore) CountContents(ctx context.Context, filter ContentFilter) (int64, error) {
+	return s.collection.CountDocuments(ctx, contentQuery(filter))
+}
+
+func (s *mongoContentStore) UpdateEmbeddedStack(ctx context.Context, stack models.Stack) (int64, error) {
+	update := bson.M{"$set": bson.M{
+		"stack.$[s].name":  stack.Name,
+		"stack.$[s].color": stack.Color,
+	}}
+	updateOptions := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: bson.A{bson.M{"s._id": stack.ID}},
+	})
+
+	result, err := s.collection.UpdateMany(ctx, bson.M{"stack._id": stack.ID}, update, updateOptions)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (s *mongoContentStore) ReplaceEmbeddedStack(ctx context.Context, stackID primitive.ObjectID, replacement *models.Stack) (int64, error) {
+	pull := bson.M{"$pull": bson.M{"stack": bson.M{"_id": stackID}}}
+	if replacement == nil {
+		result, err := s.collection.UpdateMany(ctx, bson.M{"stack._id": stackID}, pull)
+		if err != nil {
+			return 0, err
+		}
+		return result.ModifiedCount, nil
+	}
+
+	// Contents already carrying the replacement only lose the old stack
+	both := bson.M{"stack._id": bson.M{"$all": bson.A{stackID, replacement.ID}}}
+	pulled, err := s.collection.UpdateMany(ctx, both, pull)
+	if err != nil {
+		return 0, err
+	}
+
+	updateOptions := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: bson.A{bson.M{"s._id": stackID}},
+	})
+	replaced, err := s.collection.UpdateMany(ctx, bson.M{"stack._id": stackID}, bson.M{"$set": bson.M{"stack.$[s]": replacement}}, updateOptions)
+	if err != nil {
+		return pulled.ModifiedCount, err
+	}
+	return pulled.ModifiedCount + replaced.ModifiedCount, nil
+}
+
+type mongoStackStore struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoStackStore) CreateStack(ctx context.Context, stack *models.Stack) error {
+	if stack.ID.IsZero() {
+		stack.ID = primitive.NewObjectID()
+	}
+	_, err := s.collection.InsertOne(ctx, stack)
+	return mapMongoError(err)
+}
+
+func (s *mongoStackStore) GetStackByName(ctx context.Context, name string) (models.Stack, error) {
+	var stack models.Stack
+	err := s.collection.FindOne(ctx, bson.M{"name": name}).Decode(&stack)
+	return stack, mapMongoError(err)
+}
+
+func (s *mongoStackStore) FindStacksByName(ctx context.Context, names []string) ([]models.Stack, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"name": bson.M{"$in": names}})
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll[models.Stack](ctx, cursor)
+}
+
+func (s *mongoStackStore) ListStacks(ctx context.Context, opts ListOptions) (Page[models.Stack], error) {
+	return findPage(ctx, s.collection, bson.M{}, opts, stackKey)
+}
+
+func (s *mongoStackStore) GetStack(ctx context.Context, id primitive.ObjectID) (models.Stack, error) {
+	var stack models.Stack
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&stack)
+	return stack, mapMongoError(err)
+}
+
+func (s *mongoStackStore) UpdateStack(ctx context.Context, stack models.Stack) error {
+	update := bson.M{
+		"$set": bson.M{
+			"name":  stack.Name,
+			"color": stack.Color,
+		},
+	}
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": stack.ID}, update)
+	if err != nil {
+		return mapMongoError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoStackStore) DeleteStack(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoFollowStore struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoFollowStore) Follow(ctx context.Context, followerID, followeeID string) (models.Follow, error) {
+	follow := models.Follow{
+		ID:         primitive.NewObjectID(),
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	// Upsert so that following twice never creates a second edge
+	filter := bson.M{"follower_id": followerID, "followee_id": followeeID}
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$setOnInsert": follow}, options.Update().SetUpsert(true))
+	if err != nil {
+		return models.Follow{}, mapMongoError(err)
+	}
+	if result.UpsertedCount == 0 {
+		return models.Follow{}, ErrDuplicate
+	}
+	return follow, nil
+}
+
+func (s *mongoFollowStore) Unfollow(ctx context.Context, followerID, followeeID string) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"follower_id": followerID, "followee_id": followeeID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoFollowStore) ListFollowers(ctx context.Context, userID string, opts ListOptions) (Page[models.Follow], error) {
+	return findPage(ctx, s.collection, bson.M{"followee_id": userID}, opts, followKey)
+}
+
+func (s *mongoFollowStore) ListFollowing(ctx context.Context, userID string, opts ListOptions) (Page[models.Follow], error) {
+	return findPage(ctx, s.collection, bson.M{"follower_id": userID}, opts, followKey)
+}
+
+func (s *mongoFollowStore) CountFollowers(ctx context.Context, userID string) (int64, error) {
+	return s.collection.CountDocuments(ctx, bson.M{"followee_id": userID})
+}
+
+func (s *mongoFollowStore) CountFollowing(ctx context.Context, userID string) (int64, error) {
+	return s.collection.CountDocuments(ctx, bson.M{"follower_id": userID})
+}
+
+// distinctIDs returns the distinct string values of field among documents matching filter
+func distinctIDs(ctx context.Context, collection *mongo.Collection, field string, filter bson.M) ([]string, error) {
+	values, err := collection.Distinct(ctx, field, filter)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (s *mongoFollowStore) FollowerIDs(ctx context.Context, userID string) ([]string, error) {
+	return distinctIDs(ctx, s.collection, "follower_id", bson.M{"followee_id": userID})
+}
+
+func (s *mongoFollowStore) FollowingIDs(ctx context.Context, userID string) ([]string, error) {
+	return distinctIDs(ctx, s.collection, "followee_id", bson.M{"follower_id": userID})
+}
+
+type mongoTimelineStore struct {
+	collection *mongo.Collection
+	// owners holds one document per user served from its timeline, keyed by
+	// user ID
+	owners *mongo.Collection
+}
+
+func (s *mongoTimelineStore) AddToTimelines(ctx context.Context, userIDs []string, contentID primitive.ObjectID) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	// Upserts skip the timelines a racing backfill already gave the content
+	writes := make([]mongo.WriteModel, 0, len(userIDs))
+	for _, userID := range userIDs {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"user_id": userID, "content_id": contentID}).
+			SetUpdate(bson.M{"$setOnInsert": bson.M{"_id": primitive.NewObjectID()}}).
+			SetUpsert(true))
+	}
+	_, err := s.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (s *mongoTimelineStore) ListTimeline(ctx context.Context, userID string, opts ListOptions) (Page[models.TimelineEntry], error) {
+	return findPageOn(ctx, s.collection, "content_id", bson.M{"user_id": userID}, opts, timelineKey)
+}
+
+func (s *mongoTimelineStore) RemoveFromTimelines(ctx context.Context, contentID primitive.ObjectID) error {
+	_, err := s.collection.DeleteMany(ctx, bson.M{"content_id": contentID})
+	return err
+}
+
+func (s *mongoTimelineStore) BackfillTimeline(ctx context.Context, userID string, contentIDs []primitive.ObjectID) error {
+	if len(contentIDs) == 0 {
+		return nil
+	}
+	// Upserts skip the contents the timeline already has
+	writes := make([]mongo.WriteModel, 0, len(contentIDs))
+	for _, contentID := range contentIDs {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"user_id": userID, "content_id": contentID}).
+			SetUpdate(bson.M{"$setOnInsert": bson.M{"_id": primitive.NewObjectID()}}).
+			SetUpsert(true))
+	}
+	_, err := s.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (s *mongoTimelineStore) RemoveFromTimeline(ctx context.Context, userID string, contentIDs []primitive.ObjectID) error {
+	if len(contentIDs) == 0 {
+		return nil
+	}
+	_, err := s.collection.DeleteMany(ctx, bson.M{"user_id": userID, "content_id": bson.M{"$in": contentIDs}})
+	return err
+}
+
+func (s *mongoTimelineStore) ClearTimeline(ctx context.Context, userID string) error {
+	_, err := s.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+func (s *mongoTimelineStore) EnableTimeline(ctx context.Context, userID string) error {
+	update := bson.M{"$setOnInsert": bson.M{"enabled_at": time.Now().UTC()}}
+	_, err := s.owners.UpdateOne(ctx, bson.M{"_id": userID}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *mongoTimelineStore) TimelineOwners(ctx context.Context, userIDs []string) ([]string, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	return distinctIDs(ctx, s.owners, "_id", bson.M{"_id": bson.M{"$in": userIDs}})
+}
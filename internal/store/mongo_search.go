@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cms-server/internal/models"
+	"cms-server/internal/search"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// prefixCandidates is how many of the newest matches of a query without
+// whole words are scored, beyond its limit, before the best ones are kept
+const prefixCandidates = 500
+
+// prefixCondition matches a prefix clause with a case-insensitive regex,
+// since text indexes only match whole words
+func prefixCondition(clause search.Clause) bson.M {
+	words := make([]string, len(clause.Tokens))
+	for i, token := range clause.Tokens {
+		words[i] = regexp.QuoteMeta(token)
+	}
+	pattern := primitive.Regex{Pattern: `\b` + strings.Join(words, `\W+`), Options: "i"}
+	return bson.M{"$or": bson.A{
+		bson.M{"name": pattern},
+		bson.M{"description": pattern},
+		bson.M{"stack.name": pattern},
+	}}
+}
+
+func (s *mongoContentStore) SearchContents(ctx context.Context, query search.Query, limit int) ([]SearchResult, error) {
+	// Whole words and phrases go through the text index; quoting every
+	// clause makes MongoDB require all of them, like the in-memory index
+	var phrases []string
+	var conditions []bson.M
+	for _, clause := range query.Clauses {
+		if clause.Prefix {
+			conditions = append(conditions, prefixCondition(clause))
+		} else {
+			phrases = append(phrases, `"`+strings.Join(clause.Tokens, " ")+`"`)
+		}
+	}
+
+	conditions = append(conditions, bson.M{"hidden": bson.M{"$ne": true}})
+
+	findOptions := options.Find()
+	if len(phrases) > 0 {
+		text := bson.M{"$text": bson.M{"$search": strings.Join(phrases, " ")}}
+		conditions = append([]bson.M{text}, conditions...)
+		score := bson.M{"$meta": "textScore"}
+		findOptions.SetProjection(bson.M{"score": score}).SetSort(bson.M{"score": score})
+		if limit > 0 {
+			findOptions.SetLimit(int64(limit))
+		}
+	} else {
+		// The text index cannot score prefixes: they are scored below, on a
+		// bounded set of candidates, so the limit applies once ranked
+		findOptions.SetSort(mongoSort("_id", SortNewest))
+		if limit > 0 {
+			findOptions.SetLimit(int64(max(limit, prefixCandidates)))
+		}
+	}
+
+	cursor, err := s.collection.Find(ctx, mongoAnd(conditions...), findOptions)
+	if err != nil {
+		return nil, err
+	}
+	type scoredContent struct {
+		models.Content `bson:",inline"`
+		Score          float64 `bson:"score"`
+	}
+	docs, err := decodeAll[scoredContent](ctx, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(docs))
+	for _, doc := range docs {
+		score := doc.Score
+		if len(phrases) == 0 {
+			score = search.Score(ContentFields(doc.Content), query)
+		}
+		results = append(results, SearchResult{Content: doc.Content, Score: score})
+	}
+	return bestResults(results, limit), nil
+}
+
+// bestResults ranks results by score, the newest first among equals when
+// they come newest first, and keeps the limit best ones
+func bestResults(results []SearchResult, limit int) []SearchResult {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
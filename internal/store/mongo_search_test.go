@@ -0,0 +1,44 @@
+package store
+
+import (
+	"slices"
+	"testing"
+
+	"cms-server/internal/models"
+	"cms-server/internal/search"
+)
+
+func TestBestResults(t *testing.T) {
+	query := search.ParseQuery("deploy*")
+	// Candidates come newest first: the best match is the oldest
+	var results []SearchResult
+	for _, content := range []models.Content{
+		{Name: "Blog", Description: "deployed daily"},
+		{Name: "Shop", Description: "deployed weekly"},
+		{Name: "Wiki", Description: "deployed yearly"},
+		{Name: "Deploy"},
+	} {
+		results = append(results, SearchResult{Content: content, Score: search.Score(ContentFields(content), query)})
+	}
+
+	tests := []struct {
+		limit int
+		want  []string
+	}{
+		{1, []string{"Deploy"}},
+		{3, []string{"Deploy", "Blog", "Shop"}},
+		{0, []string{"Deploy", "Blog", "Shop", "Wiki"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, result := range bestResults(append([]SearchResult(nil), results...), tt.limit) {
+			got = append(got, result.Content.Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("limit %d: kept %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+	if prefixCandidates <= 100 {
+		t.Errorf("prefix queries score %d candidates, fewer than a page of 100", prefixCandidates)
+	}
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"cms-server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMapMongoError(t *testing.T) {
+	other := errors.New("connection reset")
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"no documents", mongo.ErrNoDocuments, ErrNotFound},
+		{"wrapped no documents", fmt.Errorf("finding: %w", mongo.ErrNoDocuments), ErrNotFound},
+		{"a duplicate insert", mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}}, ErrDuplicate},
+		{"a duplicate upsert", mongo.CommandError{Code: 11000}, ErrDuplicate},
+		{"another write error", mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 121}}}, nil},
+		{"any other error", other, other},
+	}
+	for _, tt := range tests {
+		got := mapMongoError(tt.err)
+		if tt.want == nil {
+			if errors.Is(got, ErrNotFound) || errors.Is(got, ErrDuplicate) {
+				t.Errorf("%s mapped to %v", tt.name, got)
+			}
+			continue
+		}
+		if !errors.Is(got, tt.want) {
+			t.Errorf("%s mapped to %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// unreachableDatabase returns a database no query can reach, to check which
+// calls never send one
+func unreachableDatabase(t *testing.T) *mongo.Database {
+	t.Helper()
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1").SetServerSelectionTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+	return client.Database("test")
+}
+
+func TestMongoEmptyLookups(t *testing.T) {
+	ctx := context.Background()
+	db := unreachableDatabase(t)
+
+	if users, err := (&mongoUserStore{collection: db.Collection("users")}).GetUsersByID(ctx, nil); err != nil || len(users) != 0 {
+		t.Errorf("GetUsersByID(nil) = %v, %v", users, err)
+	}
+	if contents, err := (&mongoContentStore{collection: db.Collection("contents")}).GetContentsByID(ctx, []primitive.ObjectID{}); err != nil || len(contents) != 0 {
+		t.Errorf("GetContentsByID([]) = %v, %v", contents, err)
+	}
+}
+
+func TestContentQueryAuthors(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter ContentFilter
+		want   interface{}
+	}{
+		{"one author", ContentFilter{UserID: "a"}, "a"},
+		{"several authors", ContentFilter{UserIDs: []string{"a", "b"}}, bson.M{"$in": []string{"a", "b"}}},
+		{"no author", ContentFilter{UserIDs: []string{}}, bson.M{"$in": []string{}}},
+		{"an author among several", ContentFilter{UserID: "a", UserIDs: []string{"a", "b"}}, bson.M{"$in": []string{"a"}}},
+		{"an author among others", ContentFilter{UserID: "c", UserIDs: []string{"a", "b"}}, bson.M{"$in": []string{}}},
+	}
+	for _, tt := range tests {
+		if got := contentQuery(tt.filter)["user_id"]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: user_id matches %v, want %v", tt.name, got, tt.want)
+		}
+
+		// The memory store agrees on which authors match
+		for _, author := range []string{"a", "b", "c"} {
+			want := tt.want == author
+			if in, ok := tt.want.(bson.M); ok {
+				want = slices.Contains(in["$in"].([]string), author)
+			}
+			if got := matchContent(models.Content{UserID: author}, tt.filter); got != want {
+				t.Errorf("%s: matchContent of %s = %v, want %v", tt.name, author, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"cms-server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxGroupedActors is how many actor IDs a grouped notification remembers
+const maxGroupedActors = 10
+
+// mergeNotification folds the actor of n into the existing group
+func mergeNotification(existing, n models.Notification) models.Notification {
+	actorID := n.ActorIDs[0]
+	if !slices.Contains(existing.ActorIDs, actorID) {
+		existing.ActorCount++
+	}
+	actors := slices.DeleteFunc(existing.ActorIDs, func(id string) bool { return id == actorID })
+	existing.ActorIDs = append([]string{actorID}, actors...)
+	if len(existing.ActorIDs) > maxGroupedActors {
+		existing.ActorIDs = existing.ActorIDs[:maxGroupedActors]
+	}
+	existing.Reaction = n.Reaction
+	existing.UpdatedAt = n.UpdatedAt
+	return existing
+}
+
+// newNotification prepares a notification carrying a single actor
+func newNotification(n models.Notification) models.Notification {
+	n.ActorIDs = n.ActorIDs[:1]
+	n.ActorCount = 1
+	n.Read = false
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = n.UpdatedAt
+	}
+	return n
+}
+
+type mongoNotificationStore struct {
+	collection *mongo.Collection
+}
+
+// AddNotification folds n into the unread group of its key in a single
+// upsert, so that concurrent events of a group, from any replica, neither
+// lose an actor nor open a second group. The unique notifications_unread_group
+// index makes the loser of a race to open a group retry as an update.
+func (s *mongoNotificationStore) AddNotification(ctx context.Context, n models.Notification) (models.Notification, error) {
+	actorID := bson.M{"$literal": n.ActorIDs[0]}
+	actors := bson.M{"$ifNull": bson.A{"$actor_ids", bson.A{}}}
+	others := bson.M{"$filter": bson.M{"input": actors, "cond": bson.M{"$ne": bson.A{"$$this", actorID}}}}
+	createdAt := n.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = n.UpdatedAt
+	}
+
+	set := bson.M{
+		"type":        bson.M{"$literal": n.Type},
+		"activity_id": primitive.NewObjectID(),
+		"actor_count": bson.M{"$add": bson.A{
+			bson.M{"$ifNull": bson.A{"$actor_count", 0}},
+			bson.M{"$cond": bson.A{bson.M{"$in": bson.A{actorID, actors}}, 0, 1}},
+		}},
+		"actor_ids":  bson.M{"$slice": bson.A{bson.M{"$concatArrays": bson.A{bson.A{actorID}, others}}, maxGroupedActors}},
+		"created_at": bson.M{"$ifNull": bson.A{"$created_at", createdAt}},
+		"updated_at": n.UpdatedAt,
+	}
+	if n.ContentID != nil {
+		set["content_id"] = *n.ContentID
+	}
+	if n.CommentID != nil {
+		set["comment_id"] = *n.CommentID
+	}
+	if n.Reaction != "" {
+		set["reaction"] = bson.M{"$literal": n.Reaction}
+	}
+
+	filter := bson.M{"user_id": n.UserID, "group_key": n.GroupKey, "read": false}
+	update := bson.A{bson.M{"$set": set}}
+	findOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var grouped models.Notification
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&grouped)
+	if mongo.IsDuplicateKeyError(err) {
+		err = s.collection.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&grouped)
+	}
+	if err != nil {
+		return models.Notification{}, mapMongoError(err)
+	}
+	return grouped, nil
+}
+
+// ListNotifications lists the groups of userID by their latest activity, on
+// the notifications_activity index, so that a group with new activity comes
+// back first
+func (s *mongoNotificationStore) ListNotifications(ctx context.Context, userID string, unreadOnly bool, opts ListOptions) (Page[models.Notification], error) {
+	query := bson.M{"user_id": userID}
+	if unreadOnly {
+		query["read"] = false
+	}
+	return findPageOn(ctx, s.collection, "activity_id", query, opts, notificationKey)
+}
+
+func (s *mongoNotificationStore) CountUnread(ctx context.Context, userID string) (int64, error) {
+	return s.collection.CountDocuments(ctx, bson.M{"user_id": userID, "read": false})
+}
+
+func (s *mongoNotificationStore) MarkRead(ctx context.Context, userID string, id primitive.ObjectID) error {
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id, "user_id": userID}, bson.M{"$set": bson.M{"read": true}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoNotificationStore) MarkAllRead(ctx context.Context, userID string) error {
+	_, err := s.collection.UpdateMany(ctx, bson.M{"user_id": userID, "read": false}, bson.M{"$set": bson.M{"read": true}})
+	return err
+}
+
+type memoryNotificationStore struct {
+	mu            sync.RWMutex
+	notifications map[primitive.ObjectID]models.Notification
+}
+
+func (s *memoryNotificationStore) AddNotification(ctx context.Context, n models.Notification) (models.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	merged := newNotification(n)
+	merged.ID = primitive.NewObjectID()
+	for _, existing := range s.notifications {
+		if existing.UserID == n.UserID && existing.GroupKey == n.GroupKey && !existing.Read {
+			merged = mergeNotification(existing, n)
+			break
+		}
+	}
+
+	merged.ActivityID = primitive.NewObjectID()
+	merged.ActorIDs = slices.Clone(merged.ActorIDs)
+	s.notifications[merged.ID] = merged
+	return merged, nil
+}
+
+func (s *memoryNotificationStore) ListNotifications(ctx context.Context, userID string, unreadOnly bool, opts ListOptions) (Page[models.Notification], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var notifications []models.Notification
+	for _, n := range s.notifications {
+		if n.UserID == userID && !(unreadOnly && n.Read) {
+			n.ActorIDs = slices.Clone(n.ActorIDs)
+			notifications = append(notifications, n)
+		}
+	}
+	return paginate(notifications, opts, notificationKey), nil
+}
+
+func (s *memoryNotificationStore) CountUnread(ctx context.Context, userID string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for _, n := range s.notifications {
+		if n.UserID == userID && !n.Read {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memoryNotificationStore) MarkRead(ctx context.Context, userID string, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.notifications[id]
+	if !ok || n.UserID != userID {
+		return ErrNotFound
+	}
+	n.Read = true
+	s.notifications[id] = n
+	return nil
+}
+
+func (s *memoryNotificationStore) MarkAllRead(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, n := range s.notifications {
+		if n.UserID == userID {
+			n.Read = true
+			s.notifications[id] = n
+		}
+	}
+	return nil
+}
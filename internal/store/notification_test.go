@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"cms-server/internal/models"
+)
+
+func TestListNotificationsByActivity(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore().Notifications
+	notify := func(group, actor string) {
+		t.Helper()
+		n := models.Notification{UserID: "alice", Type: "follow", GroupKey: group, ActorIDs: []string{actor}, UpdatedAt: time.Now()}
+		if _, err := s.AddNotification(ctx, n); err != nil {
+			t.Fatalf("AddNotification: %v", err)
+		}
+	}
+	list := func(opts ListOptions) []string {
+		t.Helper()
+		var groups []string
+		for {
+			page, err := s.ListNotifications(ctx, "alice", false, opts)
+			if err != nil {
+				t.Fatalf("ListNotifications: %v", err)
+			}
+			for _, n := range page.Items {
+				groups = append(groups, n.GroupKey)
+			}
+			if !page.HasMore {
+				return groups
+			}
+			if opts.After, err = DecodeCursor(opts.Sort, page.NextCursor); err != nil {
+				t.Fatalf("DecodeCursor: %v", err)
+			}
+		}
+	}
+
+	notify("a", "bob")
+	notify("b", "bob")
+	notify("c", "bob")
+	// The oldest group receives new activity
+	notify("a", "carol")
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		{"newest first", ListOptions{Sort: SortNewest}, []string{"a", "c", "b"}},
+		{"newest first, a page at a time", ListOptions{Limit: 1, Sort: SortNewest}, []string{"a", "c", "b"}},
+		{"oldest first, a page at a time", ListOptions{Limit: 2, Sort: SortOldest}, []string{"b", "c", "a"}},
+	}
+	for _, tt := range tests {
+		if got := list(tt.opts); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: listed %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
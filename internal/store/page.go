@@ -0,0 +1,179 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidCursor is returned when a cursor cannot be decoded or was
+// issued for a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SortOrder controls the order of listed documents
+type SortOrder string
+
+const (
+	SortNewest SortOrder = "newest"
+	SortOldest SortOrder = "oldest"
+	SortName   SortOrder = "name"
+)
+
+// ParseSortOrder validates a sort order coming from a query string;
+// an empty value defaults to SortNewest
+func ParseSortOrder(s string) (SortOrder, error) {
+	switch SortOrder(s) {
+	case "":
+		return SortNewest, nil
+	case SortNewest, SortOldest, SortName:
+		return SortOrder(s), nil
+	}
+	return "", fmt.Errorf("unknown sort order %q", s)
+}
+
+// Cursor is the position of the last document of a page
+type Cursor struct {
+	ID   primitive.ObjectID `json:"id"`
+	Name string             `json:"n,omitempty"`
+}
+
+type encodedCursor struct {
+	Sort SortOrder `json:"s"`
+	Cursor
+}
+
+// EncodeCursor turns c into an opaque token bound to the given sort order
+func EncodeCursor(order SortOrder, c Cursor) string {
+	raw, _ := json.Marshal(encodedCursor{Sort: order, Cursor: c})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCursor parses a token produced by EncodeCursor
+func DecodeCursor(order SortOrder, token string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var decoded encodedCursor
+	if err := json.Unmarshal(raw, &decoded); err != nil || decoded.Sort != order || decoded.ID.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &decoded.Cursor, nil
+}
+
+// ListOptions describes which page of a listing to return
+type ListOptions struct {
+	Limit int
+	Sort  SortOrder
+	After *Cursor
+}
+
+// Page is one slice of a listing plus what is needed to fetch the next one
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// less reports whether a sorts before b under order
+func (order SortOrder) less(a, b Cursor) bool {
+	switch order {
+	case SortOldest:
+		return a.ID.Hex() < b.ID.Hex()
+	case SortName:
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID.Hex() < b.ID.Hex()
+	default:
+		return a.ID.Hex() > b.ID.Hex()
+	}
+}
+
+// newPage trims items fetched with Limit+1 down to a page
+func newPage[T any](items []T, opts ListOptions, key func(T) Cursor) Page[T] {
+	page := Page[T]{Items: items}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if opts.Limit > 0 && len(items) > opts.Limit {
+		page.Items = items[:opts.Limit]
+		page.HasMore = true
+		page.NextCursor = EncodeCursor(opts.Sort, key(page.Items[opts.Limit-1]))
+	}
+	return page
+}
+
+// paginate sorts items in memory and cuts the page described by opts
+func paginate[T any](items []T, opts ListOptions, key func(T) Cursor) Page[T] {
+	sort.SliceStable(items, func(i, j int) bool {
+		return opts.Sort.less(key(items[i]), key(items[j]))
+	})
+
+	start := 0
+	if opts.After != nil {
+		for start < len(items) && !opts.Sort.less(*opts.After, key(items[start])) {
+			start++
+		}
+	}
+	items = items[start:]
+
+	if opts.Limit > 0 && len(items) > opts.Limit+1 {
+		items = items[:opts.Limit+1]
+	}
+	return newPage(items, opts, key)
+}
+
+// mongoSort returns the sort document matching order. idField is the
+// ObjectID field standing for the ID of the cursor, _id for most listings.
+func mongoSort(idField string, order SortOrder) bson.D {
+	switch order {
+	case SortOldest:
+		return bson.D{{Key: idField, Value: 1}}
+	case SortName:
+		return bson.D{{Key: "name", Value: 1}, {Key: idField, Value: 1}}
+	default:
+		return bson.D{{Key: idField, Value: -1}}
+	}
+}
+
+// mongoAfter returns the condition selecting documents after the cursor
+func mongoAfter(idField string, opts ListOptions) bson.M {
+	if opts.After == nil {
+		return nil
+	}
+	c := opts.After
+	switch opts.Sort {
+	case SortOldest:
+		return bson.M{idField: bson.M{"$gt": c.ID}}
+	case SortName:
+		return bson.M{"$or": bson.A{
+			bson.M{"name": bson.M{"$gt": c.Name}},
+			bson.M{"name": c.Name, idField: bson.M{"$gt": c.ID}},
+		}}
+	default:
+		return bson.M{idField: bson.M{"$lt": c.ID}}
+	}
+}
+
+// mongoAnd combines query conditions, skipping empty ones
+func mongoAnd(conditions ...bson.M) bson.M {
+	var parts bson.A
+	for _, cond := range conditions {
+		if len(cond) > 0 {
+			parts = append(parts, cond)
+		}
+	}
+	switch len(parts) {
+	case 0:
+		return bson.M{}
+	case 1:
+		return parts[0].(bson.M)
+	}
+	return bson.M{"$and": parts}
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	tests := []struct {
+		name   string
+		order  SortOrder
+		cursor Cursor
+	}{
+		{"newest", SortNewest, Cursor{ID: id}},
+		{"oldest", SortOldest, Cursor{ID: id}},
+		{"name", SortName, Cursor{ID: id, Name: "Go & Mongo"}},
+		{"name with unicode", SortName, Cursor{ID: id, Name: "café ☕"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := DecodeCursor(tt.order, EncodeCursor(tt.order, tt.cursor))
+			if err != nil {
+				t.Fatalf("DecodeCursor: %v", err)
+			}
+			if *decoded != tt.cursor {
+				t.Fatalf("decoded %+v, want %+v", *decoded, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	valid := EncodeCursor(SortNewest, Cursor{ID: primitive.NewObjectID()})
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name  string
+		order SortOrder
+		token string
+	}{
+		{"another sort order", SortOldest, valid},
+		{"not base64", SortNewest, "not a cursor!"},
+		{"padded base64", SortNewest, valid + "=="},
+		{"not JSON", SortNewest, raw("newest")},
+		{"no ID", SortNewest, raw(`{"s":"newest"}`)},
+		{"zero ID", SortNewest, raw(`{"s":"newest","id":"000000000000000000000000"}`)},
+		{"malformed ID", SortNewest, raw(`{"s":"newest","id":"xyz"}`)},
+		{"empty", SortNewest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeCursor(tt.order, tt.token); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("DecodeCursor(%q) = %v, want ErrInvalidCursor", tt.token, err)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	ids := make([]primitive.ObjectID, 5)
+	for i := range ids {
+		ids[i] = primitive.NewObjectID()
+	}
+	key := func(id primitive.ObjectID) Cursor { return Cursor{ID: id} }
+
+	// Walk every page and check the listing comes out whole and in order
+	for _, order := range []SortOrder{SortNewest, SortOldest} {
+		t.Run(string(order), func(t *testing.T) {
+			var seen []primitive.ObjectID
+			opts := ListOptions{Limit: 2, Sort: order}
+			for pages := 0; ; pages++ {
+				if pages > len(ids) {
+					t.Fatal("pagination does not end")
+				}
+				page := paginate(append([]primitive.ObjectID(nil), ids...), opts, key)
+				seen = append(seen, page.Items...)
+				if !page.HasMore {
+					break
+				}
+				opts.After, _ = DecodeCursor(order, page.NextCursor)
+			}
+			if len(seen) != len(ids) {
+				t.Fatalf("listed %d items, want %d", len(seen), len(ids))
+			}
+			for i := 1; i < len(seen); i++ {
+				if !order.less(key(seen[i-1]), key(seen[i])) {
+					t.Fatalf("items %d and %d are out of %s order", i-1, i, order)
+				}
+			}
+		})
+	}
+}
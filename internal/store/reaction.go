@@ -0,0 +1,266 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"cms-server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// reactionDelta is the counter update turning previous into current
+func reactionDelta(previous, current string) bson.M {
+	inc := bson.M{}
+	if previous != "" {
+		inc["reactions."+previous] = -1
+	}
+	if current != "" {
+		inc["reactions."+current] = 1
+	}
+	return inc
+}
+
+type mongoReactionStore struct {
+	collection *mongo.Collection
+	contents   *mongo.Collection
+}
+
+// recountTimeout bounds the repair of the counters after a failed $inc
+const recountTimeout = 10 * time.Second
+
+// React swaps the reaction document atomically and applies the difference
+// to the counters with $inc, so concurrent reactions never lose an update.
+// The two writes are not a transaction, which needs a replica set: when the
+// $inc fails the counters are recounted instead.
+func (s *mongoReactionStore) React(ctx context.Context, contentID primitive.ObjectID, userID, reactionType string) (string, error) {
+	filter := bson.M{"content_id": contentID, "user_id": userID}
+	update := bson.M{
+		"$set":         bson.M{"type": reactionType, "created_at": time.Now().UTC()},
+		"$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+	}
+	findOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+
+	var previous models.Reaction
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&previous)
+	if mongo.IsDuplicateKeyError(err) {
+		// Another first reaction of the user won the insert; this one is
+		// now an update of it
+		previous = models.Reaction{}
+		err = s.collection.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&previous)
+	}
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return "", mapMongoError(err)
+	}
+	if previous.Type == reactionType {
+		return previous.Type, nil
+	}
+
+	return previous.Type, s.applyDelta(ctx, contentID, previous.Type, reactionType)
+}
+
+// applyDelta updates the counters of a content, or recounts them when that
+// fails, so that a reaction is never left uncounted
+func (s *mongoReactionStore) applyDelta(ctx context.Context, contentID primitive.ObjectID, previous, current string) error {
+	_, err := s.contents.UpdateOne(ctx, bson.M{"_id": contentID}, bson.M{"$inc": reactionDelta(previous, current)})
+	if err == nil {
+		return nil
+	}
+
+	// The request may be gone, the repair must still happen
+	recountCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recountTimeout)
+	defer cancel()
+	if recountErr := s.RecountReactions(recountCtx, contentID); recountErr != nil {
+		return errors.Join(err, recountErr)
+	}
+	return nil
+}
+
+func (s *mongoReactionStore) Unreact(ctx context.Context, contentID primitive.ObjectID, userID string) (string, error) {
+	var previous models.Reaction
+	err := s.collection.FindOneAndDelete(ctx, bson.M{"content_id": contentID, "user_id": userID}).Decode(&previous)
+	if err != nil {
+		return "", mapMongoError(err)
+	}
+
+	return previous.Type, s.applyDelta(ctx, contentID, previous.Type, "")
+}
+
+func (s *mongoReactionStore) UserReactions(ctx context.Context, userID string, contentIDs []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"user_id": userID, "content_id": bson.M{"$in": contentIDs}})
+	if err != nil {
+		return nil, err
+	}
+	reactions, err := decodeAll[models.Reaction](ctx, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	byContent := make(map[primitive.ObjectID]string, len(reactions))
+	for _, reaction := range reactions {
+		byContent[reaction.ContentID] = reaction.Type
+	}
+	return byContent, nil
+}
+
+func (s *mongoReactionStore) DeleteContentReactions(ctx context.Context, contentID primitive.ObjectID) error {
+	_, err := s.collection.DeleteMany(ctx, bson.M{"content_id": contentID})
+	return err
+}
+
+// RecountReactions counts the reactions of the content by type and replaces
+// its counters. A reaction racing with the recount may be counted off by
+// one until the next recount.
+func (s *mongoReactionStore) RecountReactions(ctx context.Context, contentID primitive.ObjectID) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"content_id": contentID}}},
+		{{Key: "$group", Value: bson.M{"_id": "$type", "count": bson.M{"$sum": 1}}}},
+	}
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	var groups []struct {
+		Type  string `bson:"_id"`
+		Count int64  `bson:"count"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return err
+	}
+
+	counts := models.ReactionCounts{}
+	for _, group := range groups {
+		counts[group.Type] = group.Count
+	}
+	result, err := s.contents.UpdateOne(ctx, bson.M{"_id": contentID}, bson.M{"$set": bson.M{"reactions": counts}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type reactionKey struct {
+	contentID primitive.ObjectID
+	userID    string
+}
+
+// memoryReactionStore updates the counters of the content store it belongs
+// to while holding both locks, which keeps them exact
+type memoryReactionStore struct {
+	mu        sync.RWMutex
+	reactions map[reactionKey]models.Reaction
+	contents  *memoryContentStore
+}
+
+// applyDelta updates the counters of a content, ignoring deleted contents
+func (s *memoryReactionStore) applyDelta(contentID primitive.ObjectID, previous, current string) {
+	s.contents.mu.Lock()
+	defer s.contents.mu.Unlock()
+
+	content, ok := s.contents.contents[contentID]
+	if !ok {
+		return
+	}
+	if content.Reactions == nil {
+		content.Reactions = models.ReactionCounts{}
+	}
+	if previous != "" {
+		content.Reactions[previous]--
+	}
+	if current != "" {
+		content.Reactions[current]++
+	}
+	s.contents.contents[contentID] = content
+}
+
+func (s *memoryReactionStore) React(ctx context.Context, contentID primitive.ObjectID, userID, reactionType string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := reactionKey{contentID: contentID, userID: userID}
+	previous := s.reactions[key]
+	if previous.Type == reactionType {
+		return previous.Type, nil
+	}
+
+	s.reactions[key] = models.Reaction{
+		ID:        primitive.NewObjectID(),
+		ContentID: contentID,
+		UserID:    userID,
+		Type:      reactionType,
+		CreatedAt: time.Now().UTC(),
+	}
+	s.applyDelta(contentID, previous.Type, reactionType)
+	return previous.Type, nil
+}
+
+func (s *memoryReactionStore) Unreact(ctx context.Context, contentID primitive.ObjectID, userID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := reactionKey{contentID: contentID, userID: userID}
+	previous, ok := s.reactions[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	delete(s.reactions, key)
+	s.applyDelta(contentID, previous.Type, "")
+	return previous.Type, nil
+}
+
+func (s *memoryReactionStore) UserReactions(ctx context.Context, userID string, contentIDs []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	byContent := map[primitive.ObjectID]string{}
+	for _, contentID := range contentIDs {
+		if reaction, ok := s.reactions[reactionKey{contentID: contentID, userID: userID}]; ok {
+			byContent[contentID] = reaction.Type
+		}
+	}
+	return byContent, nil
+}
+
+func (s *memoryReactionStore) DeleteContentReactions(ctx context.Context, contentID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.reactions {
+		if key.contentID == contentID {
+			delete(s.reactions, key)
+		}
+	}
+	return nil
+}
+
+func (s *memoryReactionStore) RecountReactions(ctx context.Context, contentID primitive.ObjectID) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := models.ReactionCounts{}
+	for key, reaction := range s.reactions {
+		if key.contentID == contentID {
+			counts[reaction.Type]++
+		}
+	}
+
+	s.contents.mu.Lock()
+	defer s.contents.mu.Unlock()
+
+	content, ok := s.contents.contents[contentID]
+	if !ok {
+		return ErrNotFound
+	}
+	content.Reactions = counts
+	s.contents.contents[contentID] = content
+	return nil
+}
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"cms-server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoSessionStore struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoSessionStore) CreateSession(ctx context.Context, session *models.Session) error {
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+	if session.UsedHashes == nil {
+		session.UsedHashes = []string{}
+	}
+	_, err := s.collection.InsertOne(ctx, session)
+	return mapMongoError(err)
+}
+
+func (s *mongoSessionStore) GetSession(ctx context.Context, id primitive.ObjectID) (models.Session, error) {
+	var session models.Session
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+	return session, mapMongoError(err)
+}
+
+func (s *mongoSessionStore) RotateRefreshToken(ctx context.Context, oldHash, newHash string, now time.Time, expiresAt time.Time) (models.Session, error) {
+	filter := bson.M{"token_hash": oldHash, "revoked_at": nil, "expires_at": bson.M{"$gt": now}}
+	update := bson.M{
+		"$set":  bson.M{"token_hash": newHash, "last_used_at": now, "expires_at": expiresAt},
+		"$push": bson.M{"used_hashes": oldHash},
+	}
+	findOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var session models.Session
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&session)
+	return session, mapMongoError(err)
+}
+
+func (s *mongoSessionStore) FindSessionByUsedHash(ctx context.Context, hash string) (models.Session, error) {
+	var session models.Session
+	err := s.collection.FindOne(ctx, bson.M{"used_hashes": hash}).Decode(&session)
+	return session, mapMongoError(err)
+}
+
+func (s *mongoSessionStore) FindSessionByTokenHash(ctx context.Context, hash string) (models.Session, error) {
+	var session models.Session
+	err := s.collection.FindOne(ctx, bson.M{"token_hash": hash}).Decode(&session)
+	return session, mapMongoError(err)
+}
+
+func (s *mongoSessionStore) ListActiveSessions(ctx context.Context, userID string, now time.Time) ([]models.Session, error) {
+	filter := bson.M{"user_id": userID, "revoked_at": nil, "expires_at": bson.M{"$gt": now}}
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "last_used_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll[models.Session](ctx, cursor)
+}
+
+func (s *mongoSessionStore) RevokeSession(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id, "revoked_at": nil}, bson.M{"$set": bson.M{"revoked_at": now}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoSessionStore) RevokeUserSessions(ctx context.Context, userID string, except primitive.ObjectID, now time.Time) error {
+	filter := bson.M{"user_id": userID, "revoked_at": nil, "_id": bson.M{"$ne": except}}
+	_, err := s.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": now}})
+	return err
+}
+
+type memorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[primitive.ObjectID]models.Session
+}
+
+// copySession detaches the used hashes from the stored session
+func copySession(session models.Session) models.Session {
+	session.UsedHashes = slices.Clone(session.UsedHashes)
+	return session
+}
+
+// sessionActive reports whether a session can still be refreshed at now
+func sessionActive(session models.Session, now time.Time) bool {
+	return session.RevokedAt == nil && session.ExpiresAt.After(now)
+}
+
+func (s *memorySessionStore) CreateSession(ctx context.Context, session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+	if _, exists := s.sessions[session.ID]; exists {
+		return ErrDuplicate
+	}
+	s.sessions[session.ID] = copySession(*session)
+	return nil
+}
+
+func (s *memorySessionStore) GetSession(ctx context.Context, id primitive.ObjectID) (models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return models.Session{}, ErrNotFound
+	}
+	return copySession(session), nil
+}
+
+func (s *memorySessionStore) RotateRefreshToken(ctx context.Context, oldHash, newHash string, now time.Time, expiresAt time.Time) (models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.TokenHash != oldHash || !sessionActive(session, now) {
+			continue
+		}
+		session.UsedHashes = append(session.UsedHashes, oldHash)
+		session.TokenHash = newHash
+		session.LastUsedAt = now
+		session.ExpiresAt = expiresAt
+		s.sessions[id] = session
+		return copySession(session), nil
+	}
+	return models.Session{}, ErrNotFound
+}
+
+// findBy returns the first session accepted by match
+func (s *memorySessionStore) findBy(match func(models.Session) bool) (models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, session := range s.sessions {
+		if match(session) {
+			return copySession(session), nil
+		}
+	}
+	return models.Session{}, ErrNotFound
+}
+
+func (s *memorySessionStore) FindSessionByUsedHash(ctx context.Context, hash string) (models.Session, error) {
+	return s.findBy(func(session models.Session) bool { return slices.Contains(session.UsedHashes, hash) })
+}
+
+func (s *memorySessionStore) FindSessionByTokenHash(ctx context.Context, hash string) (models.Session, error) {
+	return s.findBy(func(session models.Session) bool { return session.TokenHash == hash })
+}
+
+func (s *memorySessionStore) ListActiveSessions(ctx context.Context, userID string, now time.Time) ([]models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sessions []models.Session
+	for _, session := range s.sessions {
+		if session.UserID == userID && sessionActive(session, now) {
+			sessions = append(sessions, copySession(session))
+		}
+	}
+	slices.SortFunc(sessions, func(a, b models.Session) int { return b.LastUsedAt.Compare(a.LastUsedAt) })
+	return sessions, nil
+}
+
+func (s *memorySessionStore) RevokeSession(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.RevokedAt != nil {
+		return ErrNotFound
+	}
+	session.RevokedAt = &now
+	s.sessions[id] = session
+	return nil
+}
+
+func (s *memorySessionStore) RevokeUserSessions(ctx context.Context, userID string, except primitive.ObjectID, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.UserID == userID && session.RevokedAt == nil && id != except {
+			session.RevokedAt = &now
+			s.sessions[id] = session
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cms-server/internal/models"
+	"cms-server/internal/search"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNotFound is returned when a requested document does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrDuplicate is returned when a document conflicts with an existing one
+var ErrDuplicate = errors.New("duplicate")
+
+// UserStore persists registered users
+type UserStore interface {
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUserByID(ctx context.Context, id primitive.ObjectID) (models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (models.User, error)
+	GetUsersByID(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error)
+	SetUserRole(ctx context.Context, id primitive.ObjectID, role string) (models.User, error)
+	CountUsersByRole(ctx context.Context, role string) (int64, error)
+	// ListUsers lists every user, for maintenance commands
+	ListUsers(ctx context.Context, opts ListOptions) (Page[models.User], error)
+}
+
+// userKey is the pagination key of a user
+func userKey(u models.User) Cursor {
+	return Cursor{ID: u.ID}
+}
+
+// ContentFilter narrows down the contents returned by FindContents.
+// Zero fields are ignored; From is inclusive and To is exclusive. A non-nil
+// UserIDs matches its authors only, and only UserID when both are set.
+type ContentFilter struct {
+	UserID    string
+	UserIDs   []string
+	StackID   primitive.ObjectID
+	StackName string
+	From      time.Time
+	To        time.Time
+	// IncludeHidden also matches contents hidden by moderators
+	IncludeHidden bool
+}
+
+// contentKey is the pagination key of a content
+func contentKey(c models.Content) Cursor {
+	return Cursor{ID: c.ID, Name: c.Name}
+}
+
+// stackKey is the pagination key of a stack
+func stackKey(s models.Stack) Cursor {
+	return Cursor{ID: s.ID, Name: s.Name}
+}
+
+// SearchResult is a content matching a search query
+type SearchResult struct {
+	Content models.Content
+	Score   float64
+}
+
+// ContentFields lists the searchable fields of a content and their weights
+func ContentFields(content models.Content) []search.Field {
+	stackNames := make([]string, 0, len(content.Stack))
+	for _, stack := range content.Stack {
+		stackNames = append(stackNames, stack.Name)
+	}
+	return []search.Field{
+		{Name: "name", Weight: 10, Values: []string{content.Name}},
+		{Name: "stack", Weight: 5, Values: stackNames},
+		{Name: "description", Weight: 1, Values: []string{content.Description}},
+	}
+}
+
+// ContentStore persists contents. Contents embed full copies of their
+// stacks, so a change to the stack catalog has to be written into every
+// content using the stack.
+type ContentStore interface {
+	CreateContent(ctx context.Context, content *models.Content) error
+	GetContent(ctx context.Context, id primitive.ObjectID) (models.Content, error)
+	GetContentsByID(ctx context.Context, ids []primitive.ObjectID) ([]models.Content, error)
+	FindContents(ctx context.Context, filter ContentFilter, opts ListOptions) (Page[models.Content], error)
+	UpdateContent(ctx context.Context, content models.Content) error
+	DeleteContent(ctx context.Context, id primitive.ObjectID) error
+	CountContents(ctx context.Context, filter ContentFilter) (int64, error)
+	// UpdateEmbeddedStack copies the name and color of stack into every
+	// content embedding it and returns how many contents changed
+	UpdateEmbeddedStack(ctx context.Context, stack models.Stack) (int64, error)
+	// ReplaceEmbeddedStack swaps the embedded stack stackID for replacement,
+	// or removes it when replacement is nil, and returns how many contents changed
+	ReplaceEmbeddedStack(ctx context.Context, stackID primitive.ObjectID, replacement *models.Stack) (int64, error)
+	// SetContentHidden hides or restores a content and returns it
+	SetContentHidden(ctx context.Context, id primitive.ObjectID, hidden bool, by string, at time.Time) (models.Content, error)
+	// SearchContents never returns hidden contents
+	SearchContents(ctx context.Context, query search.Query, limit int) ([]SearchResult, error)
+}
+
+// StackStore persists the shared stack catalog
+type StackStore interface {
+	CreateStack(ctx context.Context, stack *models.Stack) error
+	GetStack(ctx context.Context, id primitive.ObjectID) (models.Stack, error)
+	GetStackByName(ctx context.Context, name string) (models.Stack, error)
+	FindStacksByName(ctx context.Context, names []string) ([]models.Stack, error)
+	ListStacks(ctx context.Context, opts ListOptions) (Page[models.Stack], error)
+	UpdateStack(ctx context.Context, stack models.Stack) error
+	DeleteStack(ctx context.Context, id primitive.ObjectID) error
+}
+
+// FollowStore persists the follow graph between users
+type FollowStore interface {
+	Follow(ctx context.Context, followerID, followeeID string) (models.Follow, error)
+	Unfollow(ctx context.Context, followerID, followeeID string) error
+	ListFollowers(ctx context.Context, userID string, opts ListOptions) (Page[models.Follow], error)
+	ListFollowing(ctx context.Context, userID string, opts ListOptions) (Page[models.Follow], error)
+	CountFollowers(ctx context.Context, userID string) (int64, error)
+	CountFollowing(ctx context.Context, userID string) (int64, error)
+	FollowerIDs(ctx context.Context, userID string) ([]string, error)
+	FollowingIDs(ctx context.Context, userID string) ([]string, error)
+}
+
+// followKey is the pagination key of a follow
+func followKey(f models.Follow) Cursor {
+	return Cursor{ID: f.ID}
+}
+
+// TimelineStore persists precomputed home feeds
+type TimelineStore interface {
+	// AddToTimelines adds a content to the timelines of userIDs, skipping
+	// the ones that already have it
+	AddToTimelines(ctx context.Context, userIDs []string, contentID primitive.ObjectID) error
+	ListTimeline(ctx context.Context, userID string, opts ListOptions) (Page[models.TimelineEntry], error)
+	RemoveFromTimelines(ctx context.Context, contentID primitive.ObjectID) error
+	// BackfillTimeline adds existing contents to the timeline of userID.
+	// Contents already in the timeline are skipped.
+	BackfillTimeline(ctx context.Context, userID string, contentIDs []primitive.ObjectID) error
+	// RemoveFromTimeline removes contents from the timeline of userID only
+	RemoveFromTimeline(ctx context.Context, userID string, contentIDs []primitive.ObjectID) error
+	ClearTimeline(ctx context.Context, userID string) error
+	// EnableTimeline records that the feed of userID is read from its
+	// timeline
+	EnableTimeline(ctx context.Context, userID string) error
+	// TimelineOwners returns those of userIDs whose feed is read from their
+	// timeline
+	TimelineOwners(ctx context.Context, userIDs []string) ([]string, error)
+}
+
+// timelineKey is the pagination key of a timeline entry. Timelines list by
+// content rather than by entry, so that backfilled contents fall in place.
+func timelineKey(e models.TimelineEntry) Cursor {
+	return Cursor{ID: e.ContentID}
+}
+
+// ReactionStore persists reactions and keeps the reaction counters of
+// contents in sync. A user has at most one reaction per content.
+type ReactionStore interface {
+	// React sets the reaction of userID and returns the one it replaced, if any
+	React(ctx context.Context, contentID primitive.ObjectID, userID, reactionType string) (string, error)
+	// Unreact removes the reaction of userID and returns it
+	Unreact(ctx context.Context, contentID primitive.ObjectID, userID string) (string, error)
+	// UserReactions returns the reactions of userID on the given contents
+	UserReactions(ctx context.Context, userID string, contentIDs []primitive.ObjectID) (map[primitive.ObjectID]string, error)
+	DeleteContentReactions(ctx context.Context, contentID primitive.ObjectID) error
+	// RecountReactions sets the counters of a content from its reactions, to
+	// repair counters a failure left out of sync
+	RecountReactions(ctx context.Context, contentID primitive.ObjectID) error
+}
+
+// CommentStore persists comment threads and keeps the comment counters of
+// contents and the reply counters of comments in sync
+type CommentStore interface {
+	CreateComment(ctx context.Context, comment *models.Comment) error
+	GetComment(ctx context.Context, id primitive.ObjectID) (models.Comment, error)
+	// ListComments lists the replies of parentID, or the top level comments
+	// of the content when parentID is zero
+	ListComments(ctx context.Context, contentID, parentID primitive.ObjectID, opts ListOptions) (Page[models.Comment], error)
+	UpdateCommentBody(ctx context.Context, id primitive.ObjectID, body string) (models.Comment, error)
+	// DeleteComment tombstones a comment so that its replies stay reachable
+	DeleteComment(ctx context.Context, id primitive.ObjectID) error
+	DeleteContentComments(ctx context.Context, contentID primitive.ObjectID) error
+}
+
+// commentKey is the pagination key of a comment
+func commentKey(c models.Comment) Cursor {
+	return Cursor{ID: c.ID}
+}
+
+// NotificationStore persists the notification inbox of every user
+type NotificationStore interface {
+	// AddNotification merges n into the unread notification of the same user
+	// and group key, or inserts it. Either way the result becomes the newest.
+	AddNotification(ctx context.Context, n models.Notification) (models.Notification, error)
+	ListNotifications(ctx context.Context, userID string, unreadOnly bool, opts ListOptions) (Page[models.Notification], error)
+	CountUnread(ctx context.Context, userID string) (int64, error)
+	MarkRead(ctx context.Context, userID string, id primitive.ObjectID) error
+	MarkAllRead(ctx context.Context, userID string) error
+}
+
+// notificationKey is the pagination key of a notification, which lists by
+// latest activity
+func notificationKey(n models.Notification) Cursor {
+	return Cursor{ID: n.ActivityID}
+}
+
+// SessionStore persists login sessions and their refresh tokens
+type SessionStore interface {
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSession(ctx context.Context, id primitive.ObjectID) (models.Session, error)
+	// RotateRefreshToken atomically replaces the current refresh token of an
+	// active session. It returns ErrNotFound when oldHash is not current.
+	RotateRefreshToken(ctx context.Context, oldHash, newHash string, now time.Time, expiresAt time.Time) (models.Session, error)
+	// FindSessionByUsedHash finds the session a rotated refresh token belonged to
+	FindSessionByUsedHash(ctx context.Context, hash string) (models.Session, error)
+	FindSessionByTokenHash(ctx context.Context, hash string) (models.Session, error)
+	ListActiveSessions(ctx context.Context, userID string, now time.Time) ([]models.Session, error)
+	RevokeSession(ctx context.Context, id primitive.ObjectID, now time.Time) error
+	// RevokeUserSessions revokes every session of userID but except
+	RevokeUserSessions(ctx context.Context, userID string, except primitive.ObjectID, now time.Time) error
+}
+
+// Store groups every repository the handlers depend on
+type Store struct {
+	Users         UserStore
+	Contents      ContentStore
+	Stacks        StackStore
+	Follows       FollowStore
+	Timelines     TimelineStore
+	Reactions     ReactionStore
+	Comments      CommentStore
+	Notifications NotificationStore
+	Sessions      SessionStore
+}
@@ -0,0 +1,524 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cms-server/internal/models"
+	"cms-server/internal/search"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the spans of store operations. It follows the tracer
+// provider installed later by the tracing package.
+var tracer = otel.Tracer("cms-server/internal/store")
+
+// Traced returns a Store recording a span for every operation of s, as a
+// child of the span of the context it is given
+func Traced(s *Store) *Store {
+	return &Store{
+		Users:         tracedUserStore{s.Users},
+		Contents:      tracedContentStore{s.Contents},
+		Stacks:        tracedStackStore{s.Stacks},
+		Follows:       tracedFollowStore{s.Follows},
+		Timelines:     tracedTimelineStore{s.Timelines},
+		Reactions:     tracedReactionStore{s.Reactions},
+		Comments:      tracedCommentStore{s.Comments},
+		Notifications: tracedNotificationStore{s.Notifications},
+		Sessions:      tracedSessionStore{s.Sessions},
+	}
+}
+
+// startSpan starts the span of operation, such as Users.GetUserByID
+func startSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "store."+operation, trace.WithAttributes(attribute.String("store.operation", operation)))
+}
+
+// endSpan ends span, marking it failed unless err is nil or only reports a
+// missing document
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+type tracedUserStore struct{ next UserStore }
+
+func (s tracedUserStore) CreateUser(ctx context.Context, user *models.User) error {
+	ctx, span := startSpan(ctx, "Users.CreateUser")
+	err := s.next.CreateUser(ctx, user)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedUserStore) GetUserByID(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	ctx, span := startSpan(ctx, "Users.GetUserByID")
+	result, err := s.next.GetUserByID(ctx, id)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedUserStore) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+	ctx, span := startSpan(ctx, "Users.GetUserByUsername")
+	result, err := s.next.GetUserByUsername(ctx, username)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedUserStore) GetUsersByID(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error) {
+	ctx, span := startSpan(ctx, "Users.GetUsersByID")
+	result, err := s.next.GetUsersByID(ctx, ids)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedUserStore) SetUserRole(ctx context.Context, id primitive.ObjectID, role string) (models.User, error) {
+	ctx, span := startSpan(ctx, "Users.SetUserRole")
+	result, err := s.next.SetUserRole(ctx, id, role)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedUserStore) CountUsersByRole(ctx context.Context, role string) (int64, error) {
+	ctx, span := startSpan(ctx, "Users.CountUsersByRole")
+	result, err := s.next.CountUsersByRole(ctx, role)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedUserStore) ListUsers(ctx context.Context, opts ListOptions) (Page[models.User], error) {
+	ctx, span := startSpan(ctx, "Users.ListUsers")
+	result, err := s.next.ListUsers(ctx, opts)
+	endSpan(span, err)
+	return result, err
+}
+
+type tracedContentStore struct{ next ContentStore }
+
+func (s tracedContentStore) CreateContent(ctx context.Context, content *models.Content) error {
+	ctx, span := startSpan(ctx, "Contents.CreateContent")
+	err := s.next.CreateContent(ctx, content)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedContentStore) GetContent(ctx context.Context, id primitive.ObjectID) (models.Content, error) {
+	ctx, span := startSpan(ctx, "Contents.GetContent")
+	result, err := s.next.GetContent(ctx, id)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedContentStore) GetContentsByID(ctx context.Context, ids []primitive.ObjectID) ([]models.Content, error) {
+	ctx, span := startSpan(ctx, "Contents.GetContentsByID")
+	result, err := s.next.GetContentsByID(ctx, ids)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedContentStore) FindContents(ctx context.Context, filter ContentFilter, opts ListOptions) (Page[models.Content], error) {
+	ctx, span := startSpan(ctx, "Contents.FindContents")
+	result, err := s.next.FindContents(ctx, filter, opts)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedContentStore) UpdateContent(ctx context.Context, content models.Content) error {
+	ctx, span := startSpan(ctx, "Contents.UpdateContent")
+	err := s.next.UpdateContent(ctx, content)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedContentStore) DeleteContent(ctx context.Context, id primitive.ObjectID) error {
+	ctx, span := startSpan(ctx, "Contents.DeleteContent")
+	err := s.next.DeleteContent(ctx, id)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedContentStore) CountContents(ctx context.Context, filter ContentFilter) (int64, error) {
+	ctx, span := startSpan(ctx, "Contents.CountContents")
+	result, err := s.next.CountContents(ctx, filter)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedContentStore) UpdateEmbeddedStack(ctx context.Context, stack models.Stack) (int64, error) {
+	ctx, span := startSpan(ctx, "Contents.UpdateEmbeddedStack")
+	result, err := s.next.UpdateEmbeddedStack(ctx, stack)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedContentStore) ReplaceEmbeddedStack(ctx context.Context, stackID primitive.ObjectID, replacement *models.Stack) (int64, error) {
+	ctx, span := startSpan(ctx, "Contents.ReplaceEmbeddedStack")
+	result, err := s.next.ReplaceEmbeddedStack(ctx, stackID, replacement)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedContentStore) SetContentHidden(ctx context.Context, id primitive.ObjectID, hidden bool, by string, at time.Time) (models.Content, error) {
+	ctx, span := startSpan(ctx, "Contents.SetContentHidden")
+	result, err := s.next.SetContentHidden(ctx, id, hidden, by, at)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedContentStore) SearchContents(ctx context.Context, query search.Query, limit int) ([]SearchResult, error) {
+	ctx, span := startSpan(ctx, "Contents.SearchContents")
+	result, err := s.next.SearchContents(ctx, query, limit)
+	endSpan(span, err)
+	return result, err
+}
+
+type tracedStackStore struct{ next StackStore }
+
+func (s tracedStackStore) CreateStack(ctx context.Context, stack *models.Stack) error {
+	ctx, span := startSpan(ctx, "Stacks.CreateStack")
+	err := s.next.CreateStack(ctx, stack)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedStackStore) GetStack(ctx context.Context, id primitive.ObjectID) (models.Stack, error) {
+	ctx, span := startSpan(ctx, "Stacks.GetStack")
+	result, err := s.next.GetStack(ctx, id)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedStackStore) GetStackByName(ctx context.Context, name string) (models.Stack, error) {
+	ctx, span := startSpan(ctx, "Stacks.GetStackByName")
+	result, err := s.next.GetStackByName(ctx, name)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedStackStore) FindStacksByName(ctx context.Context, names []string) ([]models.Stack, error) {
+	ctx, span := startSpan(ctx, "Stacks.FindStacksByName")
+	result, err := s.next.FindStacksByName(ctx, names)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedStackStore) ListStacks(ctx context.Context, opts ListOptions) (Page[models.Stack], error) {
+	ctx, span := startSpan(ctx, "Stacks.ListStacks")
+	result, err := s.next.ListStacks(ctx, opts)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedStackStore) UpdateStack(ctx context.Context, stack models.Stack) error {
+	ctx, span := startSpan(ctx, "Stacks.UpdateStack")
+	err := s.next.UpdateStack(ctx, stack)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedStackStore) DeleteStack(ctx context.Context, id primitive.ObjectID) error {
+	ctx, span := startSpan(ctx, "Stacks.DeleteStack")
+	err := s.next.DeleteStack(ctx, id)
+	endSpan(span, err)
+	return err
+}
+
+type tracedFollowStore struct{ next FollowStore }
+
+func (s tracedFollowStore) Follow(ctx context.Context, followerID, followeeID string) (models.Follow, error) {
+	ctx, span := startSpan(ctx, "Follows.Follow")
+	result, err := s.next.Follow(ctx, followerID, followeeID)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedFollowStore) Unfollow(ctx context.Context, followerID, followeeID string) error {
+	ctx, span := startSpan(ctx, "Follows.Unfollow")
+	err := s.next.Unfollow(ctx, followerID, followeeID)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedFollowStore) ListFollowers(ctx context.Context, userID string, opts ListOptions) (Page[models.Follow], error) {
+	ctx, span := startSpan(ctx, "Follows.ListFollowers")
+	result, err := s.next.ListFollowers(ctx, userID, opts)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedFollowStore) ListFollowing(ctx context.Context, userID string, opts ListOptions) (Page[models.Follow], error) {
+	ctx, span := startSpan(ctx, "Follows.ListFollowing")
+	result, err := s.next.ListFollowing(ctx, userID, opts)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedFollowStore) CountFollowers(ctx context.Context, userID string) (int64, error) {
+	ctx, span := startSpan(ctx, "Follows.CountFollowers")
+	result, err := s.next.CountFollowers(ctx, userID)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedFollowStore) CountFollowing(ctx context.Context, userID string) (int64, error) {
+	ctx, span := startSpan(ctx, "Follows.CountFollowing")
+	result, err := s.next.CountFollowing(ctx, userID)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedFollowStore) FollowerIDs(ctx context.Context, userID string) ([]string, error) {
+	ctx, span := startSpan(ctx, "Follows.FollowerIDs")
+	result, err := s.next.FollowerIDs(ctx, userID)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedFollowStore) FollowingIDs(ctx context.Context, userID string) ([]string, error) {
+	ctx, span := startSpan(ctx, "Follows.FollowingIDs")
+	result, err := s.next.FollowingIDs(ctx, userID)
+	endSpan(span, err)
+	return result, err
+}
+
+type tracedTimelineStore struct{ next TimelineStore }
+
+func (s tracedTimelineStore) AddToTimelines(ctx context.Context, userIDs []string, contentID primitive.ObjectID) error {
+	ctx, span := startSpan(ctx, "Timelines.AddToTimelines")
+	err := s.next.AddToTimelines(ctx, userIDs, contentID)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedTimelineStore) ListTimeline(ctx context.Context, userID string, opts ListOptions) (Page[models.TimelineEntry], error) {
+	ctx, span := startSpan(ctx, "Timelines.ListTimeline")
+	result, err := s.next.ListTimeline(ctx, userID, opts)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedTimelineStore) RemoveFromTimelines(ctx context.Context, contentID primitive.ObjectID) error {
+	ctx, span := startSpan(ctx, "Timelines.RemoveFromTimelines")
+	err := s.next.RemoveFromTimelines(ctx, contentID)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedTimelineStore) BackfillTimeline(ctx context.Context, userID string, contentIDs []primitive.ObjectID) error {
+	ctx, span := startSpan(ctx, "Timelines.BackfillTimeline")
+	err := s.next.BackfillTimeline(ctx, userID, contentIDs)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedTimelineStore) RemoveFromTimeline(ctx context.Context, userID string, contentIDs []primitive.ObjectID) error {
+	ctx, span := startSpan(ctx, "Timelines.RemoveFromTimeline")
+	err := s.next.RemoveFromTimeline(ctx, userID, contentIDs)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedTimelineStore) ClearTimeline(ctx context.Context, userID string) error {
+	ctx, span := startSpan(ctx, "Timelines.ClearTimeline")
+	err := s.next.ClearTimeline(ctx, userID)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedTimelineStore) EnableTimeline(ctx context.Context, userID string) error {
+	ctx, span := startSpan(ctx, "Timelines.EnableTimeline")
+	err := s.next.EnableTimeline(ctx, userID)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedTimelineStore) TimelineOwners(ctx context.Context, userIDs []string) ([]string, error) {
+	ctx, span := startSpan(ctx, "Timelines.TimelineOwners")
+	result, err := s.next.TimelineOwners(ctx, userIDs)
+	endSpan(span, err)
+	return result, err
+}
+
+type tracedReactionStore struct{ next ReactionStore }
+
+func (s tracedReactionStore) React(ctx context.Context, contentID primitive.ObjectID, userID, reactionType string) (string, error) {
+	ctx, span := startSpan(ctx, "Reactions.React")
+	result, err := s.next.React(ctx, contentID, userID, reactionType)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedReactionStore) Unreact(ctx context.Context, contentID primitive.ObjectID, userID string) (string, error) {
+	ctx, span := startSpan(ctx, "Reactions.Unreact")
+	result, err := s.next.Unreact(ctx, contentID, userID)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedReactionStore) UserReactions(ctx context.Context, userID string, contentIDs []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	ctx, span := startSpan(ctx, "Reactions.UserReactions")
+	result, err := s.next.UserReactions(ctx, userID, contentIDs)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedReactionStore) DeleteContentReactions(ctx context.Context, contentID primitive.ObjectID) error {
+	ctx, span := startSpan(ctx, "Reactions.DeleteContentReactions")
+	err := s.next.DeleteContentReactions(ctx, contentID)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedReactionStore) RecountReactions(ctx context.Context, contentID primitive.ObjectID) error {
+	ctx, span := startSpan(ctx, "Reactions.RecountReactions")
+	err := s.next.RecountReactions(ctx, contentID)
+	endSpan(span, err)
+	return err
+}
+
+type tracedCommentStore struct{ next CommentStore }
+
+func (s tracedCommentStore) CreateComment(ctx context.Context, comment *models.Comment) error {
+	ctx, span := startSpan(ctx, "Comments.CreateComment")
+	err := s.next.CreateComment(ctx, comment)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedCommentStore) GetComment(ctx context.Context, id primitive.ObjectID) (models.Comment, error) {
+	ctx, span := startSpan(ctx, "Comments.GetComment")
+	result, err := s.next.GetComment(ctx, id)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedCommentStore) ListComments(ctx context.Context, contentID, parentID primitive.ObjectID, opts ListOptions) (Page[models.Comment], error) {
+	ctx, span := startSpan(ctx, "Comments.ListComments")
+	result, err := s.next.ListComments(ctx, contentID, parentID, opts)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedCommentStore) UpdateCommentBody(ctx context.Context, id primitive.ObjectID, body string) (models.Comment, error) {
+	ctx, span := startSpan(ctx, "Comments.UpdateCommentBody")
+	result, err := s.next.UpdateCommentBody(ctx, id, body)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedCommentStore) DeleteComment(ctx context.Context, id primitive.ObjectID) error {
+	ctx, span := startSpan(ctx, "Comments.DeleteComment")
+	err := s.next.DeleteComment(ctx, id)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedCommentStore) DeleteContentComments(ctx context.Context, contentID primitive.ObjectID) error {
+	ctx, span := startSpan(ctx, "Comments.DeleteContentComments")
+	err := s.next.DeleteContentComments(ctx, contentID)
+	endSpan(span, err)
+	return err
+}
+
+type tracedNotificationStore struct{ next NotificationStore }
+
+func (s tracedNotificationStore) AddNotification(ctx context.Context, n models.Notification) (models.Notification, error) {
+	ctx, span := startSpan(ctx, "Notifications.AddNotification")
+	result, err := s.next.AddNotification(ctx, n)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedNotificationStore) ListNotifications(ctx context.Context, userID string, unreadOnly bool, opts ListOptions) (Page[models.Notification], error) {
+	ctx, span := startSpan(ctx, "Notifications.ListNotifications")
+	result, err := s.next.ListNotifications(ctx, userID, unreadOnly, opts)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedNotificationStore) CountUnread(ctx context.Context, userID string) (int64, error) {
+	ctx, span := startSpan(ctx, "Notifications.CountUnread")
+	result, err := s.next.CountUnread(ctx, userID)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedNotificationStore) MarkRead(ctx context.Context, userID string, id primitive.ObjectID) error {
+	ctx, span := startSpan(ctx, "Notifications.MarkRead")
+	err := s.next.MarkRead(ctx, userID, id)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedNotificationStore) MarkAllRead(ctx context.Context, userID string) error {
+	ctx, span := startSpan(ctx, "Notifications.MarkAllRead")
+	err := s.next.MarkAllRead(ctx, userID)
+	endSpan(span, err)
+	return err
+}
+
+type tracedSessionStore struct{ next SessionStore }
+
+func (s tracedSessionStore) CreateSession(ctx context.Context, session *models.Session) error {
+	ctx, span := startSpan(ctx, "Sessions.CreateSession")
+	err := s.next.CreateSession(ctx, session)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedSessionStore) GetSession(ctx context.Context, id primitive.ObjectID) (models.Session, error) {
+	ctx, span := startSpan(ctx, "Sessions.GetSession")
+	result, err := s.next.GetSession(ctx, id)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedSessionStore) RotateRefreshToken(ctx context.Context, oldHash, newHash string, now time.Time, expiresAt time.Time) (models.Session, error) {
+	ctx, span := startSpan(ctx, "Sessions.RotateRefreshToken")
+	result, err := s.next.RotateRefreshToken(ctx, oldHash, newHash, now, expiresAt)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedSessionStore) FindSessionByUsedHash(ctx context.Context, hash string) (models.Session, error) {
+	ctx, span := startSpan(ctx, "Sessions.FindSessionByUsedHash")
+	result, err := s.next.FindSessionByUsedHash(ctx, hash)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedSessionStore) FindSessionByTokenHash(ctx context.Context, hash string) (models.Session, error) {
+	ctx, span := startSpan(ctx, "Sessions.FindSessionByTokenHash")
+	result, err := s.next.FindSessionByTokenHash(ctx, hash)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedSessionStore) ListActiveSessions(ctx context.Context, userID string, now time.Time) ([]models.Session, error) {
+	ctx, span := startSpan(ctx, "Sessions.ListActiveSessions")
+	result, err := s.next.ListActiveSessions(ctx, userID, now)
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedSessionStore) RevokeSession(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	ctx, span := startSpan(ctx, "Sessions.RevokeSession")
+	err := s.next.RevokeSession(ctx, id, now)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedSessionStore) RevokeUserSessions(ctx context.Context, userID string, except primitive.ObjectID, now time.Time) error {
+	ctx, span := startSpan(ctx, "Sessions.RevokeUserSessions")
+	err := s.next.RevokeUserSessions(ctx, userID, except, now)
+	endSpan(span, err)
+	return err
+}
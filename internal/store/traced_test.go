@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"cms-server/internal/models"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraced(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	otel.SetTracerProvider(provider)
+	s := Traced(NewMemoryStore())
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	tests := []struct {
+		name      string
+		operation func() error
+		span      string
+		status    codes.Code
+	}{
+		{"a success", func() error {
+			return s.Users.CreateUser(ctx, &models.User{Username: "alice", Email: "alice@example.com"})
+		}, "store.Users.CreateUser", codes.Unset},
+		{"a failure", func() error {
+			return s.Users.CreateUser(ctx, &models.User{Username: "alice", Email: "other@example.com"})
+		}, "store.Users.CreateUser", codes.Error},
+		{"a missing document", func() error {
+			_, err := s.Users.GetUserByUsername(ctx, "bob")
+			return err
+		}, "store.Users.GetUserByUsername", codes.Unset},
+	}
+	for _, tt := range tests {
+		before := len(spans.Ended())
+		err := tt.operation()
+		ended := spans.Ended()
+		if len(ended) != before+1 {
+			t.Errorf("%s ended %d spans, want 1", tt.name, len(ended)-before)
+			continue
+		}
+		span := ended[len(ended)-1]
+		if span.Name() != tt.span || span.Status().Code != tt.status || span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("%s (%v) ended the span %s with the status %v, child of %s", tt.name, err, span.Name(), span.Status().Code, span.Parent().SpanID())
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package tlscert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePair writes a self-signed certificate for commonName and its key
+// to the files of dir, dated modTime
+func writePair(t *testing.T, dir, commonName string, modTime time.Time) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	for name, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(name, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+	return certFile, keyFile
+}
+
+// commonName returns the common name of the certificate r serves
+func commonName(t *testing.T, r *Reloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	certFile, keyFile := writePair(t, dir, "first", start)
+
+	if _, err := NewReloader(certFile, filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("NewReloader accepted a missing key file")
+	}
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	if name := commonName(t, r); name != "first" {
+		t.Fatalf("serving %q, want first", name)
+	}
+
+	// A broken pair leaves the previous one in use
+	os.WriteFile(keyFile, []byte("garbage"), 0o600)
+	if err := r.Reload(); err == nil {
+		t.Error("Reload accepted a broken key")
+	}
+	if name := commonName(t, r); name != "first" {
+		t.Errorf("serving %q after a failed reload, want first", name)
+	}
+
+	// Watch picks up renewed files
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+	writePair(t, dir, "second", start.Add(time.Minute))
+	deadline := time.Now().Add(2 * time.Second)
+	for commonName(t, r) != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("Watch did not reload the renewed certificate")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
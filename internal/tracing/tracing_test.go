@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cms-server/internal/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSetup(t *testing.T) {
+	ctx := context.Background()
+	if _, err := Setup(ctx, config.Tracing{Exporter: "jaeger"}); err == nil {
+		t.Error("Setup accepted an unknown exporter")
+	}
+	flush, err := Setup(ctx, config.Tracing{Exporter: config.NoExporter})
+	if err != nil || flush(ctx) != nil {
+		t.Errorf("Setup without an exporter: %v", err)
+	}
+	if fields := otel.GetTextMapPropagator().Fields(); !strings.Contains(strings.Join(fields, ","), "traceparent") {
+		t.Errorf("the propagator reads %v, want traceparent", fields)
+	}
+
+	// The file exporter writes the spans when they are flushed
+	file := filepath.Join(t.TempDir(), "spans.jsonl")
+	flush, err = Setup(ctx, config.Tracing{Exporter: config.FileExporter, File: file, SampleRatio: 1, ServiceName: "cms-test"})
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	_, span := otel.Tracer("test").Start(ctx, "exported")
+	span.End()
+	if err := flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	written, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(written), `"Name":"exported"`) || !strings.Contains(string(written), "cms-test") {
+		t.Errorf("the file exporter wrote %s", written)
+	}
+
+	// No span is exported at a ratio of 0, unless the caller sampled it
+	file = filepath.Join(t.TempDir(), "spans.jsonl")
+	flush, err = Setup(ctx, config.Tracing{Exporter: config.FileExporter, File: file, SampleRatio: 0, ServiceName: "cms-test"})
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	_, span = otel.Tracer("test").Start(ctx, "dropped")
+	span.End()
+	caller := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	_, span = otel.Tracer("test").Start(trace.ContextWithRemoteSpanContext(ctx, caller), "sampled by the caller")
+	span.End()
+	flush(ctx)
+	written, _ = os.ReadFile(file)
+	if strings.Contains(string(written), "dropped") || !strings.Contains(string(written), "sampled by the caller") {
+		t.Errorf("at a sample ratio of 0, exported %s", written)
+	}
+}
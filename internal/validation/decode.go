@@ -0,0 +1,87 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxBodySize bounds request bodies read by Decode
+const DefaultMaxBodySize = 1 << 20
+
+// Decode reads the JSON body of r into dst, rejecting unknown members,
+// trailing data and bodies over DefaultMaxBodySize, then validates it.
+// Every failure is an *Error.
+func Decode(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	if err := DecodeJSON(w, r, dst); err != nil {
+		return err
+	}
+	return Struct(dst)
+}
+
+// DecodeJSON is Decode without the validation of the struct tags
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, DefaultMaxBodySize))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	// Anything but the end of the body after the value is trailing data,
+	// including a stray closing bracket that decoder.More would not report
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return decodeError(err)
+		}
+		return &Error{Status: http.StatusBadRequest, Code: "invalid_json", Message: "The request body must contain a single JSON value"}
+	}
+	return nil
+}
+
+// Unmarshal decodes a JSON document into dst like DecodeJSON, for documents
+// built on the server; a mismatch is reported as unprocessable
+func Unmarshal(data []byte, dst interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		validationError := decodeError(err)
+		validationError.Status = http.StatusUnprocessableEntity
+		return validationError
+	}
+	return nil
+}
+
+// decodeError turns a decoding failure into an *Error
+func decodeError(err error) *Error {
+	var maxBytesError *http.MaxBytesError
+	var typeError *json.UnmarshalTypeError
+	var syntaxError *json.SyntaxError
+
+	switch {
+	case errors.As(err, &maxBytesError):
+		return &Error{Status: http.StatusRequestEntityTooLarge, Code: "body_too_large", Message: "The request body is too large"}
+	case errors.Is(err, io.EOF):
+		return &Error{Status: http.StatusBadRequest, Code: "invalid_json", Message: "The request body is empty"}
+	case errors.As(err, &typeError):
+		return &Error{Status: http.StatusBadRequest, Code: "invalid_json", Message: "The request body is invalid", Fields: []FieldError{{
+			Field:   typeError.Field,
+			Code:    "type",
+			Message: "must be a " + typeError.Type.String(),
+		}}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		name := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &Error{Status: http.StatusBadRequest, Code: "unknown_field", Message: "The request body is invalid", Fields: []FieldError{{
+			Field:   name,
+			Code:    "unknown",
+			Message: "is not a known field",
+		}}}
+	case errors.As(err, &syntaxError), errors.Is(err, io.ErrUnexpectedEOF):
+		return &Error{Status: http.StatusBadRequest, Code: "invalid_json", Message: "The request body is not valid JSON"}
+	default:
+		return &Error{Status: http.StatusBadRequest, Code: "invalid_json", Message: "The request body is invalid"}
+	}
+}
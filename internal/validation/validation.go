@@ -0,0 +1,285 @@
+// Package validation decodes request bodies and checks them against the
+// rules declared in their `validate` struct tags.
+//
+// Rules are separated by commas and apply in order:
+//
+//	required        the value is not empty
+//	min=N, max=N    length of a string (in characters) or slice, or value of a number
+//	oneof=a|b       the value is one of the listed ones
+//	email           an email address
+//	url=http|https  an absolute URL using one of the listed schemes
+//	hexcolor        a #rgb or #rrggbb color
+//	username        3 to 30 letters, digits or underscores
+//	password        8 to 72 bytes mixing at least three of lower case,
+//	                upper case, digits and symbols
+//	unique          a slice without duplicates
+//	dive            the following rules apply to every element of a slice
+//
+// Empty values only fail the required rule.
+package validation
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FieldError describes why one field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is a rejected request body. The problem package renders it with its
+// status, code and fields.
+type Error struct {
+	Status  int          `json:"-"`
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+	parts := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		parts = append(parts, field.Field+": "+field.Message)
+	}
+	return e.Message + ": " + strings.Join(parts, "; ")
+}
+
+// Fields returns the error rejecting a body because of fields
+func Fields(fields ...FieldError) *Error {
+	return &Error{Status: http.StatusUnprocessableEntity, Code: "validation_failed", Message: "The request body is invalid", Fields: fields}
+}
+
+// rule is one parsed check of a field
+type rule struct {
+	name  string
+	param string
+}
+
+type field struct {
+	index int
+	name  string
+	rules []rule
+}
+
+var (
+	cacheMu sync.RWMutex
+	cache   = map[reflect.Type][]field{}
+
+	hexColorPattern = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+	usernamePattern = regexp.MustCompile(`^\w{3,30}$`)
+)
+
+// fieldsOf returns the validated fields of a struct type, parsing tags once
+func fieldsOf(t reflect.Type) []field {
+	cacheMu.RLock()
+	fields, ok := cache[t]
+	cacheMu.RUnlock()
+	if ok {
+		return fields
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		tag := structField.Tag.Get("validate")
+		if tag == "" || !structField.IsExported() {
+			continue
+		}
+		name := strings.Split(structField.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = structField.Name
+		}
+		var rules []rule
+		for _, part := range strings.Split(tag, ",") {
+			ruleName, param, _ := strings.Cut(part, "=")
+			rules = append(rules, rule{name: ruleName, param: param})
+		}
+		fields = append(fields, field{index: i, name: name, rules: rules})
+	}
+
+	cacheMu.Lock()
+	cache[t] = fields
+	cacheMu.Unlock()
+	return fields
+}
+
+// Struct checks the fields of the struct v points to and returns an *Error
+// listing every rejected field, or nil
+func Struct(v interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("validation: %T is not a struct", v)
+	}
+
+	var errs []FieldError
+	for _, f := range fieldsOf(value.Type()) {
+		errs = append(errs, check(f.name, value.Field(f.index), f.rules)...)
+	}
+	if len(errs) > 0 {
+		return Fields(errs...)
+	}
+	return nil
+}
+
+// check applies rules to value and stops at the first failure
+func check(name string, value reflect.Value, rules []rule) []FieldError {
+	if value.IsZero() && !slices.ContainsFunc(rules, func(r rule) bool { return r.name == "required" }) {
+		return nil
+	}
+
+	for i, r := range rules {
+		if r.name == "dive" {
+			var errs []FieldError
+			for j := 0; j < value.Len(); j++ {
+				errs = append(errs, check(fmt.Sprintf("%s[%d]", name, j), value.Index(j), rules[i+1:])...)
+			}
+			return errs
+		}
+		if message := apply(r, value); message != "" {
+			return []FieldError{{Field: name, Code: r.name, Message: message}}
+		}
+	}
+	return nil
+}
+
+// size is the length of strings and slices and the value of numbers
+func size(value reflect.Value) float64 {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String()))
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(value.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	}
+	return 0
+}
+
+// sizeMessage words a min or max failure for the kind of value
+func sizeMessage(value reflect.Value, bound string, limit string) string {
+	switch value.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("must be at %s %s characters long", bound, limit)
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return fmt.Sprintf("must have at %s %s items", bound, limit)
+	}
+	return fmt.Sprintf("must be at %s %s", bound, limit)
+}
+
+// apply runs one rule and returns a message when it fails
+func apply(r rule, value reflect.Value) string {
+	text := ""
+	if value.Kind() == reflect.String {
+		text = value.String()
+	}
+
+	switch r.name {
+	case "required":
+		if value.IsZero() || (value.Kind() == reflect.String && strings.TrimSpace(text) == "") {
+			return "is required"
+		}
+	case "min", "max":
+		limit, err := strconv.ParseFloat(r.param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validation: invalid %s=%q", r.name, r.param))
+		}
+		if r.name == "min" && size(value) < limit {
+			return sizeMessage(value, "least", r.param)
+		}
+		if r.name == "max" && size(value) > limit {
+			return sizeMessage(value, "most", r.param)
+		}
+	case "oneof":
+		allowed := strings.Split(r.param, "|")
+		if !slices.Contains(allowed, fmt.Sprint(value.Interface())) {
+			return "must be one of " + strings.Join(allowed, ", ")
+		}
+	case "email":
+		address, err := mail.ParseAddress(text)
+		if err != nil || address.Address != text || !strings.Contains(text[strings.LastIndex(text, "@"):], ".") {
+			return "must be a valid email address"
+		}
+	case "url":
+		schemes := strings.Split(r.param, "|")
+		u, err := url.Parse(text)
+		if err != nil || u.Host == "" || !slices.Contains(schemes, strings.ToLower(u.Scheme)) {
+			return "must be an absolute URL using " + strings.Join(schemes, " or ")
+		}
+	case "hexcolor":
+		if !hexColorPattern.MatchString(text) {
+			return "must be a hex color such as #1e90ff"
+		}
+	case "username":
+		if !usernamePattern.MatchString(text) {
+			return "must be 3 to 30 letters, digits or underscores"
+		}
+	case "password":
+		return passwordMessage(text)
+	case "unique":
+		seen := map[interface{}]bool{}
+		for i := 0; i < value.Len(); i++ {
+			item := value.Index(i).Interface()
+			if seen[item] {
+				return fmt.Sprintf("contains %v more than once", item)
+			}
+			seen[item] = true
+		}
+	default:
+		panic(fmt.Sprintf("validation: unknown rule %q", r.name))
+	}
+	return ""
+}
+
+// passwordMessage checks the strength of a password; bcrypt ignores
+// everything past 72 bytes, so longer passwords are refused
+func passwordMessage(password string) string {
+	if utf8.RuneCountInString(password) < 8 {
+		return "must be at least 8 characters long"
+	}
+	if len(password) > 72 {
+		return "must be at most 72 bytes long"
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	if classes < 3 {
+		return "must mix at least three of lower case letters, upper case letters, digits and symbols"
+	}
+	return ""
+}
@@ -0,0 +1,147 @@
+package validation
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		rules string
+		value interface{}
+		ok    bool
+	}{
+		{"required", "x", true},
+		{"required", "", false},
+		{"required", "   ", false},
+		{"required", 0, false},
+		{"min=3", "abc", true},
+		{"min=3", "ab", false},
+		{"max=3", "ééé", true},
+		{"max=3", "abcd", false},
+		{"max=2", []string{"a", "b", "c"}, false},
+		{"min=1", 0, true}, // empty values only fail required
+		{"min=1", -1, false},
+		{"oneof=a|b", "b", true},
+		{"oneof=a|b", "c", false},
+		{"email", "alice@example.com", true},
+		{"email", "Alice <alice@example.com>", false},
+		{"email", "alice@localhost", false},
+		{"email", "alice", false},
+		{"url=http|https", "https://example.com/a?b=c", true},
+		{"url=http|https", "HTTP://example.com", true},
+		{"url=http|https", "ftp://example.com", false},
+		{"url=http|https", "javascript:alert(1)", false},
+		{"url=http|https", "/relative", false},
+		{"hexcolor", "#1e90ff", true},
+		{"hexcolor", "#FFF", true},
+		{"hexcolor", "1e90ff", false},
+		{"hexcolor", "#1e90fg", false},
+		{"username", "alice_01", true},
+		{"username", "al", false},
+		{"username", "alice smith", false},
+		{"password", "Passw0rd", true},
+		{"password", "pass word1", true},
+		{"password", "password", false},
+		{"password", "Password", false},
+		{"password", "Pa1!", false},
+		{"password", "Pa1!" + strings.Repeat("x", 69), false},
+		{"unique", []string{"a", "b"}, true},
+		{"unique", []string{"a", "a"}, false},
+		{"dive,required,max=2", []string{"ab", "c"}, true},
+		{"dive,required,max=2", []string{"ab", ""}, false},
+		{"dive,required,max=2", []string{"abc"}, false},
+	}
+	for _, tt := range tests {
+		var rules []rule
+		for _, part := range strings.Split(tt.rules, ",") {
+			name, param, _ := strings.Cut(part, "=")
+			rules = append(rules, rule{name: name, param: param})
+		}
+		errs := check("field", reflect.ValueOf(tt.value), rules)
+		if (len(errs) == 0) != tt.ok {
+			t.Errorf("%s on %#v: %v, want ok %v", tt.rules, tt.value, errs, tt.ok)
+		}
+	}
+}
+
+func TestStruct(t *testing.T) {
+	type body struct {
+		Name    string   `json:"name" validate:"required,max=5"`
+		Email   string   `json:"email" validate:"email"`
+		Tags    []string `json:"tags" validate:"unique,dive,min=2"`
+		Ignored string   `json:"ignored"`
+	}
+
+	err := Struct(&body{Name: "toolong", Email: "nope", Tags: []string{"go", "x", "go"}})
+	var validationError *Error
+	if !errors.As(err, &validationError) {
+		t.Fatalf("Struct: %v, want an *Error", err)
+	}
+	want := []FieldError{
+		{Field: "name", Code: "max", Message: "must be at most 5 characters long"},
+		{Field: "email", Code: "email", Message: "must be a valid email address"},
+		{Field: "tags", Code: "unique", Message: "contains go more than once"},
+	}
+	if validationError.Status != http.StatusUnprocessableEntity || !reflect.DeepEqual(validationError.Fields, want) {
+		t.Errorf("Struct rejected %+v, want %+v", validationError, want)
+	}
+
+	err = Struct(&body{Tags: []string{"go", "x"}})
+	if !errors.As(err, &validationError) || len(validationError.Fields) != 2 || validationError.Fields[1].Field != "tags[1]" {
+		t.Errorf("Struct: %v, want name and tags[1] rejected", err)
+	}
+	if err := Struct(&body{Name: "ok"}); err != nil {
+		t.Errorf("Struct of a valid body: %v", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	type body struct {
+		Name string `json:"name" validate:"required"`
+		Age  int    `json:"age"`
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"a valid body", `{"name":"alice","age":3}`, 0, ""},
+		{"an empty body", ``, http.StatusBadRequest, "invalid_json"},
+		{"invalid JSON", `{"name":`, http.StatusBadRequest, "invalid_json"},
+		{"a wrong type", `{"name":"alice","age":"three"}`, http.StatusBadRequest, "invalid_json"},
+		{"an unknown member", `{"name":"alice","admin":true}`, http.StatusBadRequest, "unknown_field"},
+		{"trailing data", `{"name":"alice"} {}`, http.StatusBadRequest, "invalid_json"},
+		{"a stray closing brace", `{"name":"alice"} }`, http.StatusBadRequest, "invalid_json"},
+		{"a stray closing bracket", `{"name":"alice"}]`, http.StatusBadRequest, "invalid_json"},
+		{"trailing whitespace", "{\"name\":\"alice\"}\n\t ", 0, ""},
+		{"a failed rule", `{"age":3}`, http.StatusUnprocessableEntity, "validation_failed"},
+		{"a body too large", `{"name":"` + strings.Repeat("a", DefaultMaxBodySize) + `"}`, http.StatusRequestEntityTooLarge, "body_too_large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			var dst body
+			err := Decode(httptest.NewRecorder(), r, &dst)
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("Decode: %v", err)
+				}
+				return
+			}
+			var validationError *Error
+			if !errors.As(err, &validationError) {
+				t.Fatalf("Decode: %v, want an *Error", err)
+			}
+			if validationError.Status != tt.status || validationError.Code != tt.code {
+				t.Fatalf("Decode: %d %s, want %d %s", validationError.Status, validationError.Code, tt.status, tt.code)
+			}
+		})
+	}
+}